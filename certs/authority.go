@@ -0,0 +1,192 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// Authority is a certificate authority issuing development certificates
+type Authority struct {
+	Certificate *x509.Certificate
+	Key         *ecdsa.PrivateKey
+}
+
+// NewAuthority generates a self-signed CA
+func NewAuthority(commonName string, validFor time.Duration) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate CA key: %w", err)
+	}
+
+	template, err := newTemplate(commonName, validFor)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	certificate, err := createCertificate(template, template, key, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Authority{certificate, key}, nil
+}
+
+// LoadAuthority loads the CA certificate and key of the PEM files
+func LoadAuthority(certFile string, keyFile string) (*Authority, error) {
+	certBlock, err := readPEM(certFile, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA certificate: %w", err)
+	}
+	if !certificate.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+
+	keyBlock, err := readPEM(keyFile, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse CA key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CA key of %s is not an ECDSA key", keyFile)
+	}
+
+	return &Authority{certificate, key}, nil
+}
+
+// IssueServer issues a certificate for the DNS names and IP addresses of
+// hosts, it is valid for server and client authentication
+func (authority *Authority) IssueServer(commonName string, hosts []string, validFor time.Duration) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	template, err := newTemplate(commonName, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	return authority.issue(template)
+}
+
+// IssueClient issues a client certificate, the common name is the identity of
+// the client
+func (authority *Authority) IssueClient(commonName string, validFor time.Duration) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	template, err := newTemplate(commonName, validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	return authority.issue(template)
+}
+
+func (authority *Authority) issue(template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate key: %w", err)
+	}
+
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	certificate, err := createCertificate(template, authority.Certificate, key, authority.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certificate, key, nil
+}
+
+func newTemplate(commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		// the start is backdated a little for clocks that are behind
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(validFor),
+	}, nil
+}
+
+func createCertificate(template *x509.Certificate, parent *x509.Certificate, key *ecdsa.PrivateKey, signer *ecdsa.PrivateKey) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// WriteCertificate writes the certificate to a PEM file
+func WriteCertificate(path string, certificate *x509.Certificate) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	return writeFile(path, data, 0o644)
+}
+
+// WriteKey writes the key to a PKCS #8 PEM file only readable by its owner
+func WriteKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("cannot encode key: %w", err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return writeFile(path, data, 0o600)
+}
+
+// writeFile replaces the file with a rename, so a server reloading it never
+// reads it half written
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, data, perm)
+	if err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	return nil
+}
+
+func readPEM(path string, blockType string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("no %s in %s", blockType, path)
+	}
+	return block, nil
+}
@@ -0,0 +1,59 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// clientCredentials are the TLS credentials of a gRPC client, every handshake
+// verifies the server with the current CAs of the CA file
+type clientCredentials struct {
+	config  *tls.Config
+	rootCAs *CertPool
+}
+
+// NewClientCredentials returns the gRPC transport credentials of the config of
+// NewClientConfig, except that the CAs of caFile are loaded again when the
+// file changes
+func NewClientCredentials(caFile string, certFile string, keyFile string, serverName string) (credentials.TransportCredentials, error) {
+	config, rootCAs, err := newClientConfig(caFile, certFile, keyFile, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientCredentials{config, rootCAs}, nil
+}
+
+// current returns the credentials of the current CAs, gRPC sets the server
+// name from the address when it is not set
+func (creds *clientCredentials) current() credentials.TransportCredentials {
+	config := creds.config.Clone()
+	if creds.rootCAs != nil {
+		config.RootCAs = creds.rootCAs.Pool()
+	}
+	return credentials.NewTLS(config)
+}
+
+func (creds *clientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return creds.current().ClientHandshake(ctx, authority, rawConn)
+}
+
+func (creds *clientCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return creds.current().ServerHandshake(rawConn)
+}
+
+func (creds *clientCredentials) Info() credentials.ProtocolInfo {
+	return creds.current().Info()
+}
+
+func (creds *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{creds.config.Clone(), creds.rootCAs}
+}
+
+func (creds *clientCredentials) OverrideServerName(serverName string) error {
+	creds.config.ServerName = serverName
+	return nil
+}
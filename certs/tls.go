@@ -0,0 +1,253 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// reloader loads a value from files and loads it again when one of the files
+// changes
+type reloader[T any] struct {
+	paths []string
+	load  func() (T, error)
+
+	mutex    sync.Mutex
+	modTimes []time.Time
+	value    T
+}
+
+func newReloader[T any](load func() (T, error), paths ...string) (*reloader[T], error) {
+	reloader := &reloader[T]{
+		paths: paths,
+		load:  load,
+	}
+
+	modTimes, err := reloader.stat()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	reloader.modTimes = modTimes
+	reloader.value = value
+	return reloader, nil
+}
+
+func (reloader *reloader[T]) stat() ([]time.Time, error) {
+	modTimes := make([]time.Time, 0, len(reloader.paths))
+	for _, path := range reloader.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// get returns the value, it is loaded again first when one of the files
+// changed. The last value is kept when the files cannot be loaded, like while
+// a certificate is replaced but not yet its key, and they are loaded again on
+// their next change.
+func (reloader *reloader[T]) get() T {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	modTimes, err := reloader.stat()
+	if err != nil || !changed(reloader.modTimes, modTimes) {
+		return reloader.value
+	}
+	reloader.modTimes = modTimes
+
+	value, err := reloader.load()
+	if err != nil {
+		log.Printf("cannot reload %v, keeping the loaded one: %v", reloader.paths, err)
+		return reloader.value
+	}
+
+	log.Printf("reloaded %v", reloader.paths)
+	reloader.value = value
+	return value
+}
+
+func changed(modTimes []time.Time, newModTimes []time.Time) bool {
+	for i := range modTimes {
+		if !modTimes[i].Equal(newModTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyPair is a certificate and its key loaded from PEM files, they are loaded
+// again when the files change
+type KeyPair struct {
+	reloader *reloader[*tls.Certificate]
+}
+
+func LoadKeyPair(certFile string, keyFile string) (*KeyPair, error) {
+	reloader, err := newReloader(func() (*tls.Certificate, error) {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &certificate, nil
+	}, certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load key pair: %w", err)
+	}
+
+	return &KeyPair{reloader}, nil
+}
+
+// Certificate returns the current certificate
+func (keyPair *KeyPair) Certificate() *tls.Certificate {
+	return keyPair.reloader.get()
+}
+
+// CertPool is a pool of the CA certificates of a PEM file, it is loaded again
+// when the file changes
+type CertPool struct {
+	reloader *reloader[*x509.CertPool]
+}
+
+func LoadCertPool(caFile string) (*CertPool, error) {
+	reloader, err := newReloader(func() (*x509.CertPool, error) {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate in %s", caFile)
+		}
+		return pool, nil
+	}, caFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load CA certificates: %w", err)
+	}
+
+	return &CertPool{reloader}, nil
+}
+
+// Pool returns the current pool
+func (certPool *CertPool) Pool() *x509.CertPool {
+	return certPool.reloader.get()
+}
+
+// NewServerConfig returns the TLS config of a server with the certificate of
+// the files. When clientCAFile is set, clients must present a certificate
+// signed by one of its CAs, or may present none when clientCertOptional is
+// set. The files are loaded again when they change.
+func NewServerConfig(certFile string, keyFile string, clientCAFile string, clientCertOptional bool) (*tls.Config, error) {
+	keyPair, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return keyPair.Certificate(), nil
+		},
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	clientCAs, err := LoadCertPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// the client certificates are verified here rather than with ClientCAs, so
+	// the pool is the current one of the CA file. VerifyConnection also runs
+	// for resumed sessions, so a session of a certificate of a removed CA cannot
+	// be resumed.
+	config.ClientAuth = tls.RequireAnyClientCert
+	if clientCertOptional {
+		config.ClientAuth = tls.RequestClientCert
+	}
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return nil
+		}
+		return verifyClientCertificate(state.PeerCertificates, clientCAs.Pool())
+	}
+	return config, nil
+}
+
+func verifyClientCertificate(certificates []*x509.Certificate, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err := certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot verify client certificate: %w", err)
+	}
+	return nil
+}
+
+// NewClientConfig returns the TLS config of a client verifying the server
+// with the CAs of caFile, or the system CAs when it is empty. The client
+// presents the certificate of certFile and keyFile when they are set, it is
+// loaded again when the files change. serverName overrides the name the
+// server certificate is verified for. The CAs are loaded once, gRPC clients
+// reload them with NewClientCredentials.
+func NewClientConfig(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, error) {
+	config, rootCAs, err := newClientConfig(caFile, certFile, keyFile, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	if rootCAs != nil {
+		config.RootCAs = rootCAs.Pool()
+	}
+	return config, nil
+}
+
+// newClientConfig returns the config of NewClientConfig without its root CAs,
+// and the pool of caFile or nil when it is empty
+func newClientConfig(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, *CertPool, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	var rootCAs *CertPool
+	if caFile != "" {
+		var err error
+		rootCAs, err = LoadCertPool(caFile)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		keyPair, err := LoadKeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return keyPair.Certificate(), nil
+		}
+	}
+	return config, rootCAs, nil
+}
@@ -0,0 +1,402 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/certs"
+)
+
+// testFiles are the files of a CA, a server certificate for localhost and a
+// client certificate of philly
+type testFiles struct {
+	authority  *certs.Authority
+	caFile     string
+	serverCert string
+	serverKey  string
+	clientCert string
+	clientKey  string
+}
+
+func newTestFiles(t *testing.T) *testFiles {
+	t.Helper()
+
+	authority, err := certs.NewAuthority("test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+
+	dir := t.TempDir()
+	files := &testFiles{
+		authority:  authority,
+		caFile:     filepath.Join(dir, "ca.pem"),
+		serverCert: filepath.Join(dir, "server.pem"),
+		serverKey:  filepath.Join(dir, "server-key.pem"),
+		clientCert: filepath.Join(dir, "client.pem"),
+		clientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+	if err := certs.WriteCertificate(files.caFile, authority.Certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+
+	certificate, key, err := authority.IssueServer("localhost", []string{"localhost", "127.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueServer: %v", err)
+	}
+	writePair(t, files.serverCert, files.serverKey, certificate, key)
+
+	certificate, key, err = authority.IssueClient("philly", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueClient: %v", err)
+	}
+	writePair(t, files.clientCert, files.clientKey, certificate, key)
+	return files
+}
+
+func writePair(t *testing.T, certFile string, keyFile string, certificate *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	if err := certs.WriteKey(keyFile, key); err != nil {
+		t.Fatalf("WriteKey: %v", err)
+	}
+	if err := certs.WriteCertificate(certFile, certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+}
+
+// touch moves the modification time of the files forward, so a rewrite is
+// seen as a change even on file systems with a coarse time resolution
+func touch(t *testing.T, paths ...string) {
+	t.Helper()
+
+	modTime := time.Now().Add(time.Minute)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime().Add(time.Minute)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+}
+
+// connPair returns the ends of a loopback TCP connection, unlike the ends of
+// net.Pipe they do not block when both write at once
+func connPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	serverConn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	return serverConn, clientConn
+}
+
+// handshake runs a TLS handshake between the configs and returns the error of
+// the server, and the connection state of the client
+func handshake(t *testing.T, serverConfig *tls.Config, clientConfig *tls.Config) (tls.ConnectionState, error) {
+	t.Helper()
+
+	serverConn, clientConn := connPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := tls.Client(clientConn, clientConfig)
+	var clientErr error
+	clientDone := make(chan struct{})
+	go func() {
+		defer close(clientDone)
+		clientErr = client.HandshakeContext(ctx)
+		// the session tickets are read, then the connection is drained so the
+		// alert of a server rejecting the client certificate is not blocked
+		io.Copy(io.Discard, client)
+		io.Copy(io.Discard, clientConn)
+	}()
+
+	server := tls.Server(serverConn, serverConfig)
+	err := server.HandshakeContext(ctx)
+	// closing flushes the session tickets, and the client does not wait for the
+	// server to verify its certificate
+	server.Close()
+	<-clientDone
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	if clientErr != nil {
+		t.Fatalf("client handshake: %v", clientErr)
+	}
+	return client.ConnectionState(), nil
+}
+
+func TestServerConfigRequiresClientCertificate(t *testing.T) {
+	files := newTestFiles(t)
+
+	serverConfig, err := certs.NewServerConfig(files.serverCert, files.serverKey, files.caFile, false)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+
+	withCert, err := certs.NewClientConfig(files.caFile, files.clientCert, files.clientKey, "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	if _, err := handshake(t, serverConfig, withCert); err != nil {
+		t.Fatalf("handshake with client certificate: %v", err)
+	}
+
+	withoutCert, err := certs.NewClientConfig(files.caFile, "", "", "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	if _, err := handshake(t, serverConfig, withoutCert); err == nil {
+		t.Fatal("handshake without client certificate succeeded")
+	}
+
+	// a client certificate of another CA is rejected
+	other, err := certs.NewAuthority("other CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+	certificate, key, err := other.IssueClient("philly", time.Hour)
+	if err != nil {
+		t.Fatalf("IssueClient: %v", err)
+	}
+	writePair(t, files.clientCert, files.clientKey, certificate, key)
+	touch(t, files.clientCert, files.clientKey)
+
+	if _, err := handshake(t, serverConfig, withCert); err == nil {
+		t.Fatal("handshake with a client certificate of another CA succeeded")
+	}
+}
+
+func TestServerConfigOptionalClientCertificate(t *testing.T) {
+	files := newTestFiles(t)
+
+	serverConfig, err := certs.NewServerConfig(files.serverCert, files.serverKey, files.caFile, true)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+
+	withoutCert, err := certs.NewClientConfig(files.caFile, "", "", "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	if _, err := handshake(t, serverConfig, withoutCert); err != nil {
+		t.Fatalf("handshake without client certificate: %v", err)
+	}
+
+	withCert, err := certs.NewClientConfig(files.caFile, files.clientCert, files.clientKey, "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	if _, err := handshake(t, serverConfig, withCert); err != nil {
+		t.Fatalf("handshake with client certificate: %v", err)
+	}
+}
+
+func TestServerConfigReloadsCertificate(t *testing.T) {
+	files := newTestFiles(t)
+
+	serverConfig, err := certs.NewServerConfig(files.serverCert, files.serverKey, "", false)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+	clientConfig, err := certs.NewClientConfig(files.caFile, "", "", "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+
+	state, err := handshake(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	first := state.PeerCertificates[0]
+
+	certificate, key, err := files.authority.IssueServer("localhost", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueServer: %v", err)
+	}
+
+	// a new key without its certificate keeps the loaded pair
+	if err := certs.WriteKey(files.serverKey, key); err != nil {
+		t.Fatalf("WriteKey: %v", err)
+	}
+	touch(t, files.serverKey)
+
+	state, err = handshake(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake with a half written pair: %v", err)
+	}
+	if !state.PeerCertificates[0].Equal(first) {
+		t.Fatal("half written pair replaced the served certificate")
+	}
+
+	if err := certs.WriteCertificate(files.serverCert, certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+	touch(t, files.serverCert)
+
+	state, err = handshake(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+	if served := state.PeerCertificates[0]; !served.Equal(certificate) {
+		t.Fatalf("served certificate %v, want the reloaded %v", served.SerialNumber, certificate.SerialNumber)
+	}
+}
+
+func TestServerConfigVerifiesResumedSessions(t *testing.T) {
+	files := newTestFiles(t)
+
+	// the client CAs are a copy of the CA file, so replacing them does not change
+	// the CAs the client verifies the server with
+	clientCAFile := filepath.Join(t.TempDir(), "client-ca.pem")
+	if err := certs.WriteCertificate(clientCAFile, files.authority.Certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+
+	serverConfig, err := certs.NewServerConfig(files.serverCert, files.serverKey, clientCAFile, false)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+	clientConfig, err := certs.NewClientConfig(files.caFile, files.clientCert, files.clientKey, "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	if _, err := handshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	state, err := handshake(t, serverConfig, clientConfig)
+	if err != nil {
+		t.Fatalf("resumed handshake: %v", err)
+	}
+	if !state.DidResume {
+		t.Fatal("second handshake did not resume the session")
+	}
+
+	// the CA of the client certificate is removed
+	other, err := certs.NewAuthority("other CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+	if err := certs.WriteCertificate(clientCAFile, other.Certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+	touch(t, clientCAFile)
+
+	if _, err := handshake(t, serverConfig, clientConfig); err == nil {
+		t.Fatal("session of a client certificate of a removed CA was resumed")
+	}
+}
+
+func TestClientCredentialsReloadCAs(t *testing.T) {
+	files := newTestFiles(t)
+
+	serverConfig, err := certs.NewServerConfig(files.serverCert, files.serverKey, "", false)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+	creds, err := certs.NewClientCredentials(files.caFile, "", "", "")
+	if err != nil {
+		t.Fatalf("NewClientCredentials: %v", err)
+	}
+
+	clientHandshake := func() error {
+		serverConn, clientConn := connPair(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		go func() {
+			tls.Server(serverConn, serverConfig).HandshakeContext(ctx)
+			io.Copy(io.Discard, serverConn)
+		}()
+
+		_, _, err := creds.ClientHandshake(ctx, "localhost:443", clientConn)
+		return err
+	}
+
+	if err := clientHandshake(); err != nil {
+		t.Fatalf("ClientHandshake: %v", err)
+	}
+
+	// the server certificate is not signed by the new CA
+	other, err := certs.NewAuthority("other CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+	if err := certs.WriteCertificate(files.caFile, other.Certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+	touch(t, files.caFile)
+
+	if err := clientHandshake(); err == nil {
+		t.Fatal("ClientHandshake with a server certificate of a removed CA succeeded")
+	}
+}
+
+func TestLoadAuthority(t *testing.T) {
+	authority, err := certs.NewAuthority("test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	writePair(t, certFile, keyFile, authority.Certificate, authority.Key)
+
+	loaded, err := certs.LoadAuthority(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadAuthority: %v", err)
+	}
+	if !loaded.Certificate.Equal(authority.Certificate) || !loaded.Key.Equal(authority.Key) {
+		t.Fatal("loaded authority differs")
+	}
+
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("key file permissions = %o, want 600", perm)
+	}
+
+	// a server certificate is not a CA
+	certificate, key, err := loaded.IssueServer("localhost", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueServer: %v", err)
+	}
+	writePair(t, certFile, keyFile, certificate, key)
+	if _, err := certs.LoadAuthority(certFile, keyFile); err == nil {
+		t.Fatal("LoadAuthority of a server certificate succeeded")
+	}
+}
@@ -2,10 +2,10 @@ package client
 
 import (
 	"context"
-	"time"
 
 	"github.com/chienaeae/todo-go-grpc/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type AuthClient struct {
@@ -14,18 +14,15 @@ type AuthClient struct {
 	password string
 }
 
-func NewAuthClient(cc *grpc.ClientConn, username, password string) *AuthClient {
+func NewAuthClient(cc *grpc.ClientConn, username, password string, opts ...Option) *AuthClient {
 	return &AuthClient{
-		service:  pb.NewAuthServiceClient(cc),
+		service:  pb.NewAuthServiceClient(newOptions(opts).conn(cc)),
 		username: username,
 		password: password,
 	}
 }
 
-func (client *AuthClient) Login() (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
+func (client *AuthClient) Login(ctx context.Context) (*pb.LoginResponse, error) {
 	req := &pb.LoginRequest{
 		Username: client.username,
 		Password: client.password,
@@ -33,7 +30,32 @@ func (client *AuthClient) Login() (string, error) {
 
 	res, err := client.service.Login(ctx, req)
 	if err != nil {
-		return "", err
+		return nil, wrapError(err)
+	}
+	return res, nil
+}
+
+// RefreshToken exchanges the refresh token for a new token pair, the given
+// refresh token cannot be used again
+func (client *AuthClient) RefreshToken(ctx context.Context, refreshToken string) (*pb.RefreshTokenResponse, error) {
+	req := &pb.RefreshTokenRequest{
+		RefreshToken: refreshToken,
 	}
-	return res.GetAccessToken(), err
+
+	res, err := client.service.RefreshToken(ctx, req)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	return res, nil
+}
+
+// Logout revokes the access token and the refresh token on the server
+func (client *AuthClient) Logout(ctx context.Context, accessToken string, refreshToken string) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+	req := &pb.LogoutRequest{
+		RefreshToken: refreshToken,
+	}
+
+	_, err := client.service.Logout(ctx, req)
+	return wrapError(err)
 }
@@ -2,36 +2,219 @@ package client
 
 import (
 	"context"
-	"log"
+	"errors"
+	"io"
+	"sync"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
+// ErrClosed is returned for the calls made after the AuthInterceptor is closed
+var ErrClosed = errors.New("auth interceptor is closed")
+
+// publicAuthMethods never get a token when the interceptor authenticates every
+// method, they are how the token is obtained
+var publicAuthMethods = map[string]bool{
+	"/todoGoGrpc.AuthService/Login":        true,
+	"/todoGoGrpc.AuthService/RefreshToken": true,
+	"/todoGoGrpc.AuthService/Register":     true,
+	"/todoGoGrpc.AuthService/GetJwks":      true,
+}
+
+// AuthInterceptor is a token source for the calls of a connection: it logs in
+// once, refreshes the access token when it is about to expire and retries a
+// call once with a new token when the server rejects the token. It is
+// safe for concurrent use, and it is used either as the interceptors of a
+// connection or as its grpc.PerRPCCredentials.
 type AuthInterceptor struct {
-	authClient  *AuthClient
-	authMethods map[string]bool
+	authClient    *AuthClient
+	authMethods   map[string]bool
+	refreshBefore time.Duration
+
+	// closed is done once the interceptor is closed, it cancels a refresh in
+	// progress
+	closed    context.Context
+	closeFunc context.CancelFunc
+
+	// mutex guards the tokens and the refresh in progress, it is not held
+	// during the refresh so a call waiting for it stops when its context is done
+	mutex        sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiresAt    time.Time
+	refresh      *tokenRefresh
+}
+
+// tokenRefresh is a renewal of the tokens shared by the calls waiting for it,
+// done is closed once it has ended with the access token or err
+type tokenRefresh struct {
+	done        chan struct{}
 	accessToken string
+	err         error
 }
 
+// tokenRefreshTimeout bounds a refresh, it runs on after the call that started
+// it is done so the other calls can still use it
+const tokenRefreshTimeout = 30 * time.Second
+
+// NewAuthInterceptor logs in with the auth client and returns the interceptor,
+// the access token is refreshed refreshBefore its expiry. Only the methods of
+// authMethods get a token, every method but the ones logging in does when it is
+// nil.
 func NewAuthInterceptor(
+	ctx context.Context,
 	authClient *AuthClient,
 	authMethods map[string]bool,
-	refreshDuration time.Duration,
+	refreshBefore time.Duration,
 ) (*AuthInterceptor, error) {
+	closed, closeFunc := context.WithCancel(context.Background())
 	interceptor := &AuthInterceptor{
-		authClient:  authClient,
-		authMethods: authMethods,
+		authClient:    authClient,
+		authMethods:   authMethods,
+		refreshBefore: refreshBefore,
+		closed:        closed,
+		closeFunc:     closeFunc,
 	}
 
-	err := interceptor.scheduleRefreshToken(refreshDuration)
+	_, err := interceptor.Token(ctx)
 	if err != nil {
+		closeFunc()
 		return nil, err
 	}
 	return interceptor, nil
 }
 
+// Close stops a refresh in progress, the calls made after it fail with
+// ErrClosed
+func (interceptor *AuthInterceptor) Close() {
+	interceptor.closeFunc()
+}
+
+// Token returns a valid access token, it is renewed first when it expires
+// within the refresh duration. Concurrent calls share a single renewal and each
+// stops waiting for it when its context is done.
+func (interceptor *AuthInterceptor) Token(ctx context.Context) (string, error) {
+	interceptor.mutex.Lock()
+	if interceptor.closed.Err() != nil {
+		interceptor.mutex.Unlock()
+		return "", ErrClosed
+	}
+
+	if interceptor.accessToken != "" && time.Until(interceptor.expiresAt) > interceptor.refreshBefore {
+		accessToken := interceptor.accessToken
+		interceptor.mutex.Unlock()
+		return accessToken, nil
+	}
+
+	refresh := interceptor.refresh
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		interceptor.refresh = refresh
+		go interceptor.renewTokens(refresh, interceptor.refreshToken)
+	}
+	interceptor.mutex.Unlock()
+
+	select {
+	case <-refresh.done:
+		return refresh.accessToken, refresh.err
+	case <-ctx.Done():
+		return "", interceptor.doneError(ctx)
+	}
+}
+
+// invalidate forgets the access token when it is still the rejected one, so
+// the next Token call renews it
+func (interceptor *AuthInterceptor) invalidate(rejected string) {
+	interceptor.mutex.Lock()
+	defer interceptor.mutex.Unlock()
+
+	if interceptor.accessToken == rejected {
+		interceptor.accessToken = ""
+	}
+}
+
+// renewTokens uses the refresh token to get new tokens and only logs in again
+// when there is no refresh token or it is rejected, it ends the refresh
+func (interceptor *AuthInterceptor) renewTokens(refresh *tokenRefresh, refreshToken string) {
+	ctx, cancel := context.WithTimeout(interceptor.closed, tokenRefreshTimeout)
+	defer cancel()
+
+	accessToken, newRefreshToken, expiresAt, err := interceptor.fetchTokens(ctx, refreshToken)
+	if err != nil && ctx.Err() != nil {
+		err = interceptor.doneError(ctx)
+	}
+
+	interceptor.mutex.Lock()
+	switch {
+	case err == nil:
+		interceptor.setTokens(accessToken, newRefreshToken, expiresAt)
+		refresh.accessToken = interceptor.accessToken
+	case ctx.Err() == nil:
+		// the server rejected the refresh token and the login
+		interceptor.refreshToken = ""
+	}
+	refresh.err = err
+	interceptor.refresh = nil
+	interceptor.mutex.Unlock()
+
+	close(refresh.done)
+}
+
+// fetchTokens calls the auth server, the mutex is not held
+func (interceptor *AuthInterceptor) fetchTokens(ctx context.Context, refreshToken string) (string, string, time.Time, error) {
+	if refreshToken != "" {
+		res, err := interceptor.authClient.RefreshToken(ctx, refreshToken)
+		if err == nil {
+			return res.GetAccessToken(), res.GetRefreshToken(), res.GetAccessTokenExpiresAt().AsTime(), nil
+		}
+		if ctx.Err() != nil {
+			return "", "", time.Time{}, err
+		}
+	}
+
+	res, err := interceptor.authClient.Login(ctx)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return res.GetAccessToken(), res.GetRefreshToken(), res.GetAccessTokenExpiresAt().AsTime(), nil
+}
+
+// setTokens keeps the tokens, the access token expires at its exp claim and
+// falls back to the expiry in the response
+func (interceptor *AuthInterceptor) setTokens(accessToken string, refreshToken string, expiresAt time.Time) {
+	claims := &jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(accessToken, claims)
+	if err == nil && claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	interceptor.accessToken = accessToken
+	interceptor.refreshToken = refreshToken
+	interceptor.expiresAt = expiresAt
+}
+
+func (interceptor *AuthInterceptor) doneError(ctx context.Context) error {
+	if interceptor.closed.Err() != nil {
+		return ErrClosed
+	}
+	return ctx.Err()
+}
+
+func (interceptor *AuthInterceptor) authenticates(method string) bool {
+	if interceptor.authMethods == nil {
+		return !publicAuthMethods[method]
+	}
+	return interceptor.authMethods[method]
+}
+
 func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
 	return func(
 		ctx context.Context,
@@ -41,15 +224,36 @@ func (interceptor *AuthInterceptor) Unary() grpc.UnaryClientInterceptor {
 		invoker grpc.UnaryInvoker,
 		opts ...grpc.CallOption,
 	) error {
-		log.Printf("--> unary interceptor: %s", method)
+		if !interceptor.authenticates(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		for attempt := 1; ; attempt++ {
+			token, err := interceptor.Token(ctx)
+			if err != nil {
+				return err
+			}
 
-		if interceptor.authMethods[method] {
-			return invoker(interceptor.attackToken(ctx), method, req, reply, cc, opts...)
+			// a call denied for the role of the user fails with PermissionDenied,
+			// only a rejected token is renewed
+			err = invoker(attachToken(ctx, token), method, req, reply, cc, opts...)
+			if attempt == 2 || status.Code(err) != codes.Unauthenticated {
+				return err
+			}
+			interceptor.invalidate(token)
 		}
-		return invoker(ctx, method, req, reply, cc, opts...)
 	}
 }
 
+// streamReplayLimit bounds the size of the messages a stream keeps to send
+// them again, a stream sending more before its first response is not retried
+const streamReplayLimit = 4 << 20
+
+// Stream attaches the token to the streams. The server rejects a token when
+// the stream starts, before any response, so a client- or server-streaming
+// call rejected before its first response is opened again once with a new token
+// and gets the messages sent so far. A bidirectional stream receives while it
+// sends, it is not retried and only has the token renewed for the next calls.
 func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
 	return func(
 		ctx context.Context,
@@ -59,48 +263,180 @@ func (interceptor *AuthInterceptor) Stream() grpc.StreamClientInterceptor {
 		streamer grpc.Streamer,
 		opts ...grpc.CallOption,
 	) (grpc.ClientStream, error) {
-		log.Printf("--> stream interceptor: %s", method)
+		if !interceptor.authenticates(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
 
-		if interceptor.authMethods[method] {
-			return streamer(interceptor.attackToken(ctx), desc, cc, method, opts...)
+		token, err := interceptor.Token(ctx)
+		if err != nil {
+			return nil, err
 		}
-		return streamer(ctx, desc, cc, method, opts...)
-	}
 
+		open := func(token string) (grpc.ClientStream, error) {
+			return streamer(attachToken(ctx, token), desc, cc, method, opts...)
+		}
+		stream, err := open(token)
+		if err != nil {
+			return nil, err
+		}
+		return &authStream{
+			ClientStream: stream,
+			interceptor:  interceptor,
+			ctx:          ctx,
+			open:         open,
+			token:        token,
+			replay:       !desc.ClientStreams || !desc.ServerStreams,
+		}, nil
+	}
 }
 
-func (interceptor *AuthInterceptor) scheduleRefreshToken(refreshDuration time.Duration) error {
-	err := interceptor.refreshToken()
+// GetRequestMetadata makes the interceptor a grpc.PerRPCCredentials, a call
+// rejected with it is not retried
+func (interceptor *AuthInterceptor) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	info, ok := credentials.RequestInfoFromContext(ctx)
+	if ok && !interceptor.authenticates(info.Method) {
+		return nil, nil
+	}
+
+	token, err := interceptor.Token(ctx)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	return map[string]string{"authorization": token}, nil
+}
 
-	go func() {
-		wait := refreshDuration
-		for {
-			time.Sleep(wait)
-			err := interceptor.refreshToken()
-			if err != nil {
-				wait = time.Second
-			} else {
-				wait = refreshDuration
-			}
-		}
-	}()
+// RequireTransportSecurity allows the token on connections without TLS
+func (interceptor *AuthInterceptor) RequireTransportSecurity() bool {
+	return false
+}
+
+// authStream renews the token when the server rejects it on the stream, and
+// opens the stream again when it can be replayed. It is used by one goroutine,
+// as client- and server-streaming calls are.
+type authStream struct {
+	grpc.ClientStream
+	interceptor *AuthInterceptor
+	ctx         context.Context
+	open        func(token string) (grpc.ClientStream, error)
+	token       string
+
+	// replay is set until the first response or the retry, the messages sent
+	// meanwhile are kept to send them on the new stream
+	replay     bool
+	sent       []proto.Message
+	sentSize   int
+	closedSend bool
+
+	// err is the status of a stream that ended while sending and was not
+	// retried, RecvMsg returns it
+	err error
+}
+
+func (stream *authStream) SendMsg(m any) error {
+	stream.keep(m)
+
+	err := stream.ClientStream.SendMsg(m)
+	if err != io.EOF || !stream.replay {
+		return err
+	}
+
+	// a stream rejected before its handler ends without a header, its status
+	// is read without a response
+	header, _ := stream.ClientStream.Header()
+	if header != nil {
+		return err
+	}
+	statusErr := stream.ClientStream.RecvMsg(&emptypb.Empty{})
+	stream.err = stream.retry(statusErr)
+	if stream.err != nil {
+		return io.EOF
+	}
 	return nil
 }
 
-func (interceptor *AuthInterceptor) refreshToken() error {
-	accessToken, err := interceptor.authClient.Login()
+func (stream *authStream) CloseSend() error {
+	stream.closedSend = true
+	return stream.ClientStream.CloseSend()
+}
+
+func (stream *authStream) RecvMsg(m any) error {
+	if stream.err != nil {
+		return stream.err
+	}
+
+	err := stream.ClientStream.RecvMsg(m)
+	if err == nil {
+		stream.stopReplay()
+		return nil
+	}
+
+	retryErr := stream.retry(err)
+	if retryErr != nil {
+		return retryErr
+	}
+	return stream.RecvMsg(m)
+}
+
+// keep copies a message sent before the first response, the replay stops when
+// the messages get too large
+func (stream *authStream) keep(m any) {
+	if !stream.replay {
+		return
+	}
+
+	message, ok := m.(proto.Message)
+	if ok {
+		stream.sentSize += proto.Size(message)
+	}
+	if !ok || stream.sentSize > streamReplayLimit {
+		stream.stopReplay()
+		return
+	}
+	stream.sent = append(stream.sent, proto.Clone(message))
+}
+
+func (stream *authStream) stopReplay() {
+	stream.replay = false
+	stream.sent = nil
+}
+
+// retry opens the stream again with a new token when the server rejected the
+// token and the stream can be replayed, it returns nil once the kept messages
+// are sent on the new stream and the error of the call otherwise
+func (stream *authStream) retry(err error) error {
+	if status.Code(err) != codes.Unauthenticated {
+		return err
+	}
+	stream.interceptor.invalidate(stream.token)
+	if !stream.replay {
+		return err
+	}
+	sent := stream.sent
+	stream.stopReplay()
+
+	token, err := stream.interceptor.Token(stream.ctx)
 	if err != nil {
 		return err
 	}
+	newStream, err := stream.open(token)
+	if err != nil {
+		return err
+	}
+	stream.ClientStream = newStream
+	stream.token = token
 
-	interceptor.accessToken = accessToken
-	log.Printf("token refreshed: %v", accessToken)
+	for _, m := range sent {
+		// a stream that ends again returns its status from RecvMsg
+		if newStream.SendMsg(m) != nil {
+			return nil
+		}
+	}
+	if stream.closedSend {
+		return newStream.CloseSend()
+	}
 	return nil
 }
 
-func (interceptor *AuthInterceptor) attackToken(ctx context.Context) context.Context {
-	return metadata.AppendToOutgoingContext(ctx, "authorization", interceptor.accessToken)
+func attachToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", token)
 }
@@ -0,0 +1,353 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/client"
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func newTestAuthInterceptor(t *testing.T, server *testServer, refreshBefore time.Duration) *client.AuthInterceptor {
+	t.Helper()
+
+	authClient := client.NewAuthClient(server.cc, "philly", "secret123")
+	interceptor, err := client.NewAuthInterceptor(context.Background(), authClient, nil, refreshBefore)
+	if err != nil {
+		t.Fatalf("NewAuthInterceptor: %v", err)
+	}
+	t.Cleanup(interceptor.Close)
+	return interceptor
+}
+
+func TestAuthInterceptorLoginError(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+
+	authClient := client.NewAuthClient(server.cc, "philly", "wrong password")
+	_, err := client.NewAuthInterceptor(context.Background(), authClient, nil, time.Second)
+	var clientErr *client.Error
+	if !errors.As(err, &clientErr) {
+		t.Fatalf("NewAuthInterceptor error = %v, want the login error", err)
+	}
+}
+
+func TestAuthInterceptorRefreshesBeforeExpiry(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+	ctx := context.Background()
+
+	interceptor := newTestAuthInterceptor(t, server, 10*time.Second)
+	first, err := interceptor.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	second, err := interceptor.Token(ctx)
+	if err != nil || second != first {
+		t.Fatalf("Token = %v, want the same token", err)
+	}
+	if logins, refreshes := server.logins.Load(), server.refreshes.Load(); logins != 1 || refreshes != 0 {
+		t.Fatalf("logins = %d, refreshes = %d, want 1 and 0", logins, refreshes)
+	}
+
+	// the token always expires within the refresh duration, so every Token call
+	// after the login refreshes it
+	interceptor = newTestAuthInterceptor(t, server, 2*time.Minute)
+	first, err = interceptor.Token(ctx)
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	second, err = interceptor.Token(ctx)
+	if err != nil || second == first {
+		t.Fatalf("Token = %v, want a refreshed token", err)
+	}
+	if logins, refreshes := server.logins.Load(), server.refreshes.Load(); logins != 2 || refreshes != 2 {
+		t.Fatalf("logins = %d, refreshes = %d, want 2 and 2", logins, refreshes)
+	}
+}
+
+func TestAuthInterceptorRetriesUnauthenticated(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+	ctx := context.Background()
+
+	interceptor := newTestAuthInterceptor(t, server, time.Second)
+	todoClient := client.NewTodoClient(
+		server.cc,
+		client.WithUnaryInterceptors(interceptor.Unary()),
+		client.WithStreamInterceptors(interceptor.Stream()),
+	)
+
+	id, err := todoClient.CreateTodo(ctx, &pb.Todo{Title: "first"})
+	if err != nil {
+		t.Fatalf("CreateTodo: %v", err)
+	}
+
+	revokeToken(t, server, interceptor)
+
+	// every call is rejected once, the token is only refreshed once
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := todoClient.GetTodo(ctx, id)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("GetTodo: %v", err)
+		}
+	}
+	if canceled := server.canceledRefreshes.Load(); canceled != 0 {
+		t.Fatalf("canceled refreshes = %d, want 0", canceled)
+	}
+}
+
+// revokeToken revokes the access token of the interceptor on the server
+func revokeToken(t *testing.T, server *testServer, interceptor *client.AuthInterceptor) {
+	t.Helper()
+
+	token, err := interceptor.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	claims, err := server.jwtManager.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if err := server.revocationStore.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+}
+
+func TestAuthInterceptorRetriesStreams(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+	ctx := context.Background()
+
+	interceptor := newTestAuthInterceptor(t, server, time.Second)
+	cc, err := grpc.NewClient(
+		server.cc.Target(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(interceptor.Unary()),
+		grpc.WithStreamInterceptor(interceptor.Stream()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer cc.Close()
+	todoClient := client.NewTodoClient(cc)
+
+	todoID, err := todoClient.CreateTodo(ctx, &pb.Todo{Title: "with image"})
+	if err != nil {
+		t.Fatalf("CreateTodo: %v", err)
+	}
+
+	// a server-streaming call is rejected once it has sent its request
+	revokeToken(t, server, interceptor)
+	iterator, err := todoClient.GetTodos(ctx, &pb.GetTodosRequest{})
+	if err != nil {
+		t.Fatalf("GetTodos: %v", err)
+	}
+	todos, err := iterator.All()
+	if err != nil || len(todos) != 1 {
+		t.Fatalf("GetTodos = %v, %v", todos, err)
+	}
+	if refreshes := server.refreshes.Load(); refreshes != 1 {
+		t.Fatalf("refreshes = %d, want 1", refreshes)
+	}
+
+	// noise does not compress, the image is larger than the flow control
+	// window so a client-streaming call is rejected while it sends
+	img := image.NewGray(image.Rect(0, 0, 600, 600))
+	rand.New(rand.NewSource(1)).Read(img.Pix)
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	digest := sha256.Sum256(data.Bytes())
+
+	todoService := pb.NewTodoServiceClient(cc)
+	createRes, err := todoService.CreateUploadSession(ctx, &pb.CreateUploadSessionRequest{
+		ImageInfo: &pb.ImageInfo{TodoId: todoID, ImageType: ".png"},
+		Size:      uint64(data.Len()),
+		Sha256:    hex.EncodeToString(digest[:]),
+	})
+	if err != nil {
+		t.Fatalf("CreateUploadSession: %v", err)
+	}
+
+	revokeToken(t, server, interceptor)
+	stream, err := todoService.UploadImage(ctx)
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	err = stream.Send(&pb.UploadImageRequest{
+		Data: &pb.UploadImageRequest_SessionId{SessionId: createRes.GetSession().GetId()},
+	})
+	if err != nil {
+		t.Fatalf("Send session: %v", err)
+	}
+	// the chunk buffer is reused, the kept messages are copies
+	buffer := make([]byte, 64<<10)
+	for offset := 0; offset < data.Len(); offset += len(buffer) {
+		n := copy(buffer, data.Bytes()[offset:])
+		chunkDigest := sha256.Sum256(buffer[:n])
+		err := stream.Send(&pb.UploadImageRequest{
+			Data: &pb.UploadImageRequest_Chunk{
+				Chunk: &pb.ImageChunk{Offset: uint64(offset), Data: buffer[:n], Sha256: hex.EncodeToString(chunkDigest[:])},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Send chunk at %d: %v", offset, err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("CloseAndRecv: %v", err)
+	}
+	if res.GetId() == "" || res.GetSize() != uint32(data.Len()) {
+		t.Fatalf("UploadImage = %v, want the image of %d bytes", res, data.Len())
+	}
+	if refreshes := server.refreshes.Load(); refreshes != 2 {
+		t.Fatalf("refreshes = %d, want 2", refreshes)
+	}
+}
+
+func TestAuthInterceptorWaiterStopsWithItsContext(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+
+	// every Token call refreshes the token, the refresh waits for the gate
+	interceptor := newTestAuthInterceptor(t, server, 2*time.Minute)
+	gate := make(chan struct{})
+	server.refreshGate.Store(&gate)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := interceptor.Token(ctx)
+		canceled <- err
+	}()
+	for server.refreshes.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the call that started the refresh stops waiting, the refresh goes on for
+	// the other calls
+	cancel()
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Token error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Token did not return once its context was canceled")
+	}
+
+	tokens := make(chan error, 1)
+	go func() {
+		_, err := interceptor.Token(context.Background())
+		tokens <- err
+	}()
+	close(gate)
+	if err := <-tokens; err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if canceled := server.canceledRefreshes.Load(); canceled != 0 {
+		t.Fatalf("canceled refreshes = %d, want 0", canceled)
+	}
+}
+
+func TestAuthInterceptorDoesNotRetryPermissionDenied(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+	ctx := context.Background()
+
+	authClient := client.NewAuthClient(server.cc, "reporter", "secret123")
+	interceptor, err := client.NewAuthInterceptor(ctx, authClient, nil, time.Second)
+	if err != nil {
+		t.Fatalf("NewAuthInterceptor: %v", err)
+	}
+	t.Cleanup(interceptor.Close)
+	todoClient := client.NewTodoClient(
+		server.cc,
+		client.WithUnaryInterceptors(interceptor.Unary()),
+		client.WithStreamInterceptors(interceptor.Stream()),
+	)
+
+	// a new token of the user would have the same role
+	_, err = todoClient.CreateTodo(ctx, &pb.Todo{Title: "first"})
+	if !errors.Is(err, client.ErrPermissionDenied) {
+		t.Fatalf("CreateTodo error = %v, want %v", err, client.ErrPermissionDenied)
+	}
+	if logins, refreshes := server.logins.Load(), server.refreshes.Load(); logins != 1 || refreshes != 0 {
+		t.Fatalf("logins = %d, refreshes = %d, want 1 and 0", logins, refreshes)
+	}
+}
+
+func TestAuthInterceptorPerRPCCredentials(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+	ctx := context.Background()
+
+	interceptor := newTestAuthInterceptor(t, server, time.Second)
+	cc, err := grpc.NewClient(
+		server.cc.Target(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(interceptor),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer cc.Close()
+
+	// the login methods go without a token
+	_, err = client.NewAuthClient(cc, "philly", "secret123").Login(ctx)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	todoClient := client.NewTodoClient(cc)
+	_, err = todoClient.CreateTodo(ctx, &pb.Todo{Title: "first"})
+	if err != nil {
+		t.Fatalf("CreateTodo: %v", err)
+	}
+
+	iterator, err := todoClient.GetTodos(ctx, &pb.GetTodosRequest{})
+	if err != nil {
+		t.Fatalf("GetTodos: %v", err)
+	}
+	todos, err := iterator.All()
+	if err != nil || len(todos) != 1 {
+		t.Fatalf("GetTodos = %v, %v", todos, err)
+	}
+}
+
+func TestAuthInterceptorClose(t *testing.T) {
+	server := newTestServer(t, time.Minute)
+
+	interceptor := newTestAuthInterceptor(t, server, time.Second)
+	interceptor.Close()
+
+	_, err := interceptor.Token(context.Background())
+	if !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("Token error = %v, want ErrClosed", err)
+	}
+
+	todoClient := client.NewTodoClient(server.cc, client.WithUnaryInterceptors(interceptor.Unary()))
+	_, err = todoClient.CreateTodo(context.Background(), &pb.Todo{Title: "first"})
+	if !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("CreateTodo error = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors the status codes of the server map to, a returned *Error matches
+// the one of its code with errors.Is
+var (
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrUnauthenticated    = errors.New("unauthenticated")
+	ErrFailedPrecondition = errors.New("failed precondition")
+	ErrResourceExhausted  = errors.New("resource exhausted")
+	ErrUnavailable        = errors.New("unavailable")
+	ErrInternal           = errors.New("internal error")
+)
+
+var codeErrors = map[codes.Code]error{
+	codes.InvalidArgument:    ErrInvalidArgument,
+	codes.NotFound:           ErrNotFound,
+	codes.AlreadyExists:      ErrAlreadyExists,
+	codes.PermissionDenied:   ErrPermissionDenied,
+	codes.Unauthenticated:    ErrUnauthenticated,
+	codes.FailedPrecondition: ErrFailedPrecondition,
+	codes.ResourceExhausted:  ErrResourceExhausted,
+	codes.Unavailable:        ErrUnavailable,
+	codes.Internal:           ErrInternal,
+	codes.Canceled:           context.Canceled,
+	codes.DeadlineExceeded:   context.DeadlineExceeded,
+}
+
+// Error is the error status of a call
+type Error struct {
+	Code    codes.Code
+	Message string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", strings.ToLower(err.Code.String()), err.Message)
+}
+
+// Unwrap returns the error of the code, context.Canceled and
+// context.DeadlineExceeded for the codes of a done context
+func (err *Error) Unwrap() error {
+	return codeErrors[err.Code]
+}
+
+// GRPCStatus keeps the status of the error, so status.Code still works on it
+func (err *Error) GRPCStatus() *status.Status {
+	return status.New(err.Code, err.Message)
+}
+
+// wrapError converts the status error of a call to an *Error, other errors are
+// returned as they are
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var clientErr *Error
+	if errors.As(err, &clientErr) {
+		return err
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return &Error{Code: st.Code(), Message: st.Message()}
+}
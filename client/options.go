@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultTimeout is the timeout of a unary call when no option sets it
+const defaultTimeout = 5 * time.Second
+
+// RetryPolicy retries the unary calls failing with one of its codes, the delay
+// between the attempts starts at Backoff and doubles up to MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Codes       []codes.Code
+	// Methods are the full names of the methods that are retried, like
+	// /todoGoGrpc.TodoService/GetTodo, every method is retried when it is nil
+	Methods []string
+}
+
+// idempotentMethods can be called again with the same result, their calls are
+// retried by DefaultRetryPolicy
+var idempotentMethods = []string{
+	"/todoGoGrpc.TodoService/GetTodo",
+	"/todoGoGrpc.TodoService/UpdateTodo",
+	"/todoGoGrpc.TodoService/GetUploadSession",
+	"/todoGoGrpc.TodoService/GetImageURL",
+	"/todoGoGrpc.TodoService/ListImages",
+	"/todoGoGrpc.TodoService/ShareTodo",
+	"/todoGoGrpc.TodoService/ListCollaborators",
+	"/todoGoGrpc.AuthService/GetJwks",
+	"/todoGoGrpc.AuthService/GetMe",
+	"/todoGoGrpc.AuthService/ListUsers",
+}
+
+// DefaultRetryPolicy retries the idempotent methods failing with Unavailable.
+// Unavailable does not mean the call did not reach the server, so the calls
+// creating, deleting or consuming something, like CreateTodo or RefreshToken,
+// are not retried.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     100 * time.Millisecond,
+		MaxBackoff:  2 * time.Second,
+		Codes:       []codes.Code{codes.Unavailable},
+		Methods:     slices.Clone(idempotentMethods),
+	}
+}
+
+// Delay returns how long to wait after the failed attempt, counted from 1
+func (policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.Backoff
+	for i := 1; i < attempt && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		return policy.MaxBackoff
+	}
+	return delay
+}
+
+func (policy RetryPolicy) retries(method string, err error) bool {
+	if policy.Methods != nil && !slices.Contains(policy.Methods, method) {
+		return false
+	}
+
+	code := status.Code(err)
+	for _, c := range policy.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// wait sleeps the delay of the attempt, it returns false when the context is
+// done first
+func (policy RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(policy.Delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Option configures a TodoClient or an AuthClient
+type Option func(*options)
+
+type options struct {
+	timeout            time.Duration
+	retryPolicy        RetryPolicy
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+}
+
+func newOptions(opts []Option) *options {
+	options := &options{
+		timeout:     defaultTimeout,
+		retryPolicy: DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithTimeout sets the timeout of every attempt of a unary call, 0 leaves the
+// deadline to the context of the call. Streaming calls only end with their
+// context.
+func WithTimeout(timeout time.Duration) Option {
+	return func(options *options) {
+		options.timeout = timeout
+	}
+}
+
+// WithRetryPolicy replaces the default retry policy, a MaxAttempts of 1
+// disables the retries. Interrupted image uploads are resumed with the attempts
+// and backoff of the policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(options *options) {
+		options.retryPolicy = policy
+	}
+}
+
+// WithUnaryInterceptors runs the interceptors around every unary call, the
+// first one is the outermost, they see every retry of a call as one call
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) Option {
+	return func(options *options) {
+		options.unaryInterceptors = append(options.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors runs the interceptors around every streaming call, the
+// first one is the outermost
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) Option {
+	return func(options *options) {
+		options.streamInterceptors = append(options.streamInterceptors, interceptors...)
+	}
+}
+
+// conn returns the connection making the calls through the interceptors, the
+// retries and the timeout of the options
+func (options *options) conn(cc *grpc.ClientConn) grpc.ClientConnInterface {
+	unaryInterceptors := append([]grpc.UnaryClientInterceptor{}, options.unaryInterceptors...)
+	if options.retryPolicy.MaxAttempts > 1 {
+		unaryInterceptors = append(unaryInterceptors, retryInterceptor(options.retryPolicy))
+	}
+	if options.timeout > 0 {
+		unaryInterceptors = append(unaryInterceptors, timeoutInterceptor(options.timeout))
+	}
+
+	return &interceptedConn{
+		cc:                 cc,
+		unaryInterceptors:  unaryInterceptors,
+		streamInterceptors: options.streamInterceptors,
+	}
+}
+
+func retryInterceptor(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || attempt >= policy.MaxAttempts || !policy.retries(method, err) {
+				return err
+			}
+
+			if !policy.wait(ctx, attempt) {
+				return err
+			}
+		}
+	}
+}
+
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// interceptedConn chains interceptors on a connection after it is dialed
+type interceptedConn struct {
+	cc                 *grpc.ClientConn
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
+}
+
+func (conn *interceptedConn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return cc.Invoke(ctx, method, req, reply, opts...)
+	}
+
+	for i := len(conn.unaryInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := conn.unaryInterceptors[i], invoker
+		invoker = func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return interceptor(ctx, method, req, reply, cc, next, opts...)
+		}
+	}
+	return invoker(ctx, method, args, reply, conn.cc, opts...)
+}
+
+func (conn *interceptedConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return cc.NewStream(ctx, desc, method, opts...)
+	}
+
+	for i := len(conn.streamInterceptors) - 1; i >= 0; i-- {
+		interceptor, next := conn.streamInterceptors[i], streamer
+		streamer = func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return interceptor(ctx, desc, cc, method, next, opts...)
+		}
+	}
+	return streamer(ctx, desc, conn.cc, method, opts...)
+}
@@ -0,0 +1,118 @@
+package client_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// serve serves the servers registered by register and returns a connection to
+// them
+func serve(t *testing.T, register func(srv *grpc.Server), opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+
+	srv := grpc.NewServer(opts...)
+	register(srv)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+// testServer serves a todo and auth server with the admin user philly and the
+// user reporter, it counts the logins and token refreshes. A token refresh
+// waits for the refresh gate to close when there is one, and is counted as
+// canceled when the client cancels it before.
+type testServer struct {
+	cc                *grpc.ClientConn
+	jwtManager        *service.JWTManager
+	revocationStore   service.RevocationStore
+	logins            atomic.Int32
+	refreshes         atomic.Int32
+	refreshGate       atomic.Pointer[chan struct{}]
+	canceledRefreshes atomic.Int32
+}
+
+func newTestServer(t *testing.T, tokenDuration time.Duration) *testServer {
+	t.Helper()
+
+	server := &testServer{
+		jwtManager:      service.NewJWTManager("secret", tokenDuration),
+		revocationStore: service.NewInMemoryRevocationStore(),
+	}
+	userStore := service.NewInMemoryUserStore()
+
+	for username, role := range map[string]string{"philly": "admin", "reporter": "user"} {
+		user, err := service.NewUser(username, "secret123", role)
+		if err != nil {
+			t.Fatalf("NewUser: %v", err)
+		}
+		if err := userStore.Save(user); err != nil {
+			t.Fatalf("Save user: %v", err)
+		}
+	}
+
+	uploadSessionStore, err := service.NewDiskUploadSessionStore(t.TempDir(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewDiskUploadSessionStore: %v", err)
+	}
+	t.Cleanup(uploadSessionStore.Close)
+
+	todoServer := service.NewTodoServer(
+		service.NewInMemoryTodoStore(),
+		service.NewDiskImageStore(t.TempDir()),
+		service.NewInMemoryFeedbackStore(),
+		service.NewInMemoryShareStore(),
+		userStore,
+		uploadSessionStore,
+		service.DefaultUploadPolicy(),
+		service.NewEventBus(10, 10),
+	)
+	authServer := service.NewAuthServer(server.jwtManager, userStore, service.NewInMemoryRefreshTokenStore(), server.revocationStore, time.Hour)
+
+	accessibleRoles := make(map[string][]string)
+	for _, method := range []string{"CreateTodo", "GetTodos", "GetTodo", "CreateUploadSession", "GetUploadSession", "UploadImage", "ListImages", "DownloadImage"} {
+		accessibleRoles["/todoGoGrpc.TodoService/"+method] = []string{"admin"}
+	}
+	interceptor := service.NewAuthInterceptor(server.jwtManager, userStore, server.revocationStore, accessibleRoles, nil)
+	counter := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		switch info.FullMethod {
+		case "/todoGoGrpc.AuthService/Login":
+			server.logins.Add(1)
+		case "/todoGoGrpc.AuthService/RefreshToken":
+			server.refreshes.Add(1)
+			if gate := server.refreshGate.Load(); gate != nil {
+				select {
+				case <-*gate:
+				case <-ctx.Done():
+					server.canceledRefreshes.Add(1)
+					return nil, ctx.Err()
+				}
+			}
+		}
+		return handler(ctx, req)
+	}
+
+	server.cc = serve(t, func(srv *grpc.Server) {
+		pb.RegisterTodoServiceServer(srv, todoServer)
+		pb.RegisterAuthServiceServer(srv, authServer)
+	}, grpc.ChainUnaryInterceptor(counter, interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	return server
+}
@@ -2,198 +2,347 @@ package client
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/chienaeae/todo-go-grpc/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
+// uploadChunkSize is the size of the chunks an image is uploaded in
+const uploadChunkSize = 32 << 10
+
 type TodoClient struct {
 	service pb.TodoServiceClient
+	options *options
 }
 
-func NewTodoClient(cc *grpc.ClientConn) *TodoClient {
-	service := pb.NewTodoServiceClient(cc)
-	return &TodoClient{service}
+func NewTodoClient(cc *grpc.ClientConn, opts ...Option) *TodoClient {
+	options := newOptions(opts)
+	service := pb.NewTodoServiceClient(options.conn(cc))
+	return &TodoClient{service, options}
 }
 
-func (todoClient *TodoClient) CreateTodo(todo *pb.Todo) {
-	log.Println("=== CreateTodo ===")
-
+// CreateTodo returns the ID of the created todo
+func (todoClient *TodoClient) CreateTodo(ctx context.Context, todo *pb.Todo) (string, error) {
 	req := &pb.CreateTodoRequest{
 		Todo: todo,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	res, err := todoClient.service.CreateTodo(ctx, req)
 	if err != nil {
-		st, ok := status.FromError(err)
-		if ok {
-			switch st.Code() {
-			case codes.AlreadyExists:
-				log.Print("todo already exists")
-			}
-		} else {
-			log.Fatal("cannot create todo: ", err)
-		}
-		return
+		return "", wrapError(err)
+	}
+
+	return res.GetId(), nil
+}
+
+// GetTodos iterates the todos matching the request, the next pages are
+// fetched as the iteration goes when the request has a page size
+func (todoClient *TodoClient) GetTodos(ctx context.Context, req *pb.GetTodosRequest) (*TodoIterator, error) {
+	iterator := &TodoIterator{
+		service: todoClient.service,
+		req:     proto.Clone(req).(*pb.GetTodosRequest),
+	}
+	iterator.ctx, iterator.cancel = context.WithCancel(ctx)
+
+	err := iterator.openStream()
+	if err != nil {
+		iterator.Close()
+		return nil, err
+	}
+	return iterator, nil
+}
+
+// GetTodo returns the todo with its feedback threads and attachments
+func (todoClient *TodoClient) GetTodo(ctx context.Context, id string) (*pb.GetTodoResponse, error) {
+	res, err := todoClient.service.GetTodo(ctx, &pb.GetTodoRequest{Id: id})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return res, nil
+}
+
+// UpdateTodo only updates the fields of the todo named by paths
+func (todoClient *TodoClient) UpdateTodo(ctx context.Context, todo *pb.Todo, paths []string) (*pb.TodoResult, error) {
+	res, err := todoClient.service.UpdateTodo(ctx, &pb.UpdateTodoRequest{
+		Todo:       todo,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: paths},
+	})
+	if err != nil {
+		return nil, wrapError(err)
 	}
 
-	log.Printf("created todo with ID: %s", res.Id)
+	return res.GetTodo(), nil
+}
+
+func (todoClient *TodoClient) DeleteTodo(ctx context.Context, id string) error {
+	_, err := todoClient.service.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: id})
+	return wrapError(err)
 }
 
-func (todoClient *TodoClient) GetTodos() {
-	log.Println("=== GetTodos ===")
-	req := &pb.GetTodosRequest{}
+// UploadImageFile uploads the image file, its extension is the image type
+func (todoClient *TodoClient) UploadImageFile(ctx context.Context, todoID string, imagePath string) (*pb.UploadImageResponse, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+	defer file.Close()
+
+	return todoClient.UploadImage(ctx, todoID, filepath.Ext(imagePath), file)
+}
+
+// UploadImage uploads the image in an upload session, the upload resumes from
+// the bytes the server received when it is interrupted. The image is read into
+// memory first unless the reader is an io.ReadSeeker.
+func (todoClient *TodoClient) UploadImage(ctx context.Context, todoID string, imageType string, image io.Reader) (*pb.UploadImageResponse, error) {
+	seeker, ok := image.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(image)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read image: %w", err)
+		}
+		seeker = bytes.NewReader(data)
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek image: %w", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, seeker)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image: %w", err)
+	}
+
+	createRes, err := todoClient.service.CreateUploadSession(ctx, &pb.CreateUploadSessionRequest{
+		ImageInfo: &pb.ImageInfo{
+			TodoId:    todoID,
+			ImageType: imageType,
+		},
+		Size:   uint64(size),
+		Sha256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	policy := todoClient.options.retryPolicy
+	session := createRes.GetSession()
+	for attempt := 1; ; attempt++ {
+		res, err := todoClient.uploadChunks(ctx, seeker, start, session)
+		if err == nil && res.GetId() != "" {
+			return res, nil
+		}
+
+		if err == nil {
+			return nil, fmt.Errorf("upload ended after %d of %d bytes", res.GetReceivedBytes(), size)
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if attempt >= policy.MaxAttempts || !isResumable(err) || !policy.wait(ctx, attempt) {
+			return nil, wrapError(err)
+		}
+
+		getRes, err := todoClient.service.GetUploadSession(ctx, &pb.GetUploadSessionRequest{
+			SessionId: session.GetId(),
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		session = getRes.GetSession()
+	}
+}
+
+// DownloadImage writes the image, or its variant when it is not empty, to the
+// writer and returns its attachment
+func (todoClient *TodoClient) DownloadImage(ctx context.Context, imageID string, variant string, w io.Writer) (*pb.Attachment, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	stream, err := todoClient.service.GetTodos(ctx, req)
+	stream, err := todoClient.service.DownloadImage(ctx, &pb.DownloadImageRequest{
+		ImageId: imageID,
+		Variant: variant,
+	})
 	if err != nil {
-		log.Fatal("cannot get todos: ", err)
+		return nil, wrapError(err)
 	}
 
+	var attachment *pb.Attachment
 	for {
 		res, err := stream.Recv()
 		if err == io.EOF {
-			return
+			return attachment, nil
+		}
+		if err != nil {
+			return nil, wrapError(err)
 		}
+
+		if res.GetAttachment() != nil {
+			attachment = res.GetAttachment()
+			continue
+		}
+
+		_, err = w.Write(res.GetChunkData())
 		if err != nil {
-			log.Fatal("cannot receive response: ", err)
+			return nil, fmt.Errorf("cannot write image: %w", err)
 		}
-		todo := res.GetTodo()
-		log.Printf("<%s>", todo.Id)
-		log.Print("title: ", todo.Title)
-		log.Print("from user: ", todo.FromUser)
 	}
 }
 
-func (laptopClient *TodoClient) UploadImage(todoID string, imagePath string) {
-	log.Println("=== UploadImage ===")
-	file, err := os.Open(imagePath)
+func (todoClient *TodoClient) ListImages(ctx context.Context, todoID string) ([]*pb.Attachment, error) {
+	res, err := todoClient.service.ListImages(ctx, &pb.ListImagesRequest{TodoId: todoID})
 	if err != nil {
-		log.Fatal("cannot open image file: ", err)
+		return nil, wrapError(err)
 	}
-	defer file.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	return res.GetAttachments(), nil
+}
+
+// uploadChunks sends the image from the received bytes of the session, the
+// image starts at the start offset of the reader
+func (todoClient *TodoClient) uploadChunks(ctx context.Context, image io.ReadSeeker, start int64, session *pb.UploadSession) (*pb.UploadImageResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	stream, err := laptopClient.service.UploadImage(ctx)
+	offset := session.GetReceivedBytes()
+	_, err := image.Seek(start+int64(offset), io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("cannot seek image: %w", err)
+	}
+
+	stream, err := todoClient.service.UploadImage(ctx)
 	if err != nil {
-		log.Fatal("cannot upload image: ", err)
+		return nil, err
 	}
 
 	req := &pb.UploadImageRequest{
-		Data: &pb.UploadImageRequest_ImageInfo{
-			ImageInfo: &pb.ImageInfo{
-				TodoId:    todoID,
-				ImageType: filepath.Ext(imagePath),
-			},
+		Data: &pb.UploadImageRequest_SessionId{
+			SessionId: session.GetId(),
 		},
 	}
 
 	err = stream.Send(req)
 	if err != nil {
-		log.Fatal("cannot send image info to server: ", err, stream.RecvMsg(nil))
+		_, err = stream.CloseAndRecv()
+		return nil, err
 	}
 
-	reader := bufio.NewReader(file)
-	buffer := make([]byte, 1024)
+	reader := bufio.NewReader(image)
+	buffer := make([]byte, uploadChunkSize)
 
 	for {
-		n, err := reader.Read(buffer)
+		n, err := io.ReadFull(reader, buffer)
 		if err == io.EOF {
 			break
 		}
-		if err != nil {
-			log.Fatal("cannot read chunk to buffer: ", err)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("cannot read chunk to buffer: %w", err)
 		}
 
+		digest := sha256.Sum256(buffer[:n])
 		req := &pb.UploadImageRequest{
-			Data: &pb.UploadImageRequest_ChunkData{
-				ChunkData: buffer[:n],
+			Data: &pb.UploadImageRequest_Chunk{
+				Chunk: &pb.ImageChunk{
+					Offset: offset,
+					Data:   buffer[:n],
+					Sha256: hex.EncodeToString(digest[:]),
+				},
 			},
 		}
 
 		err = stream.Send(req)
 		if err != nil {
-			log.Fatal("cannot send chunk to server: ", err, stream.RecvMsg(nil))
+			// the server closed the stream, its status is returned by CloseAndRecv
+			_, err = stream.CloseAndRecv()
+			return nil, err
 		}
-	}
-	res, err := stream.CloseAndRecv()
-	if err != nil {
-		log.Fatal("cannot receive response: ", err)
+		offset += uint64(n)
 	}
 
-	log.Printf("image uploaded with id: %s, size: %d", res.GetId(), res.GetSize())
+	return stream.CloseAndRecv()
+}
+
+// isResumable reports whether an upload can continue from the bytes the server
+// has received after the error
+func isResumable(err error) bool {
+	switch status.Code(err) {
+	case codes.OK, codes.Unavailable, codes.DeadlineExceeded, codes.Unknown, codes.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
 }
 
 type CreateFeedback struct {
 	TodoID  string
 	Content string
+	// ParentFeedbackID replies to a feedback when it is set
+	ParentFeedbackID string
 }
 
-func (laptopClient *TodoClient) FeedbackTodo(createFeedbacks []CreateFeedback) {
-	log.Println("=== FeedbackTodo ===")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// FeedbackTodo adds the feedbacks in one stream and returns the responses in
+// the same order
+func (todoClient *TodoClient) FeedbackTodo(ctx context.Context, createFeedbacks []CreateFeedback) ([]*pb.FeedbackTodoResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	stream, err := laptopClient.service.FeedbackTodo(ctx)
+	stream, err := todoClient.service.FeedbackTodo(ctx)
 	if err != nil {
-		log.Fatal("cannot feedback todo: ", err)
+		return nil, wrapError(err)
 	}
 
+	responses := make([]*pb.FeedbackTodoResponse, 0, len(createFeedbacks))
 	waitResponse := make(chan error)
 	go func() {
 		for {
 			res, err := stream.Recv()
 			if err == io.EOF {
-				log.Print("no more response")
 				waitResponse <- nil
 				return
 			}
 			if err != nil {
-				waitResponse <- fmt.Errorf("cannot receive stream response: %v", err)
+				waitResponse <- err
 				return
 			}
 
-			log.Print("received response: ", res)
+			responses = append(responses, res)
 		}
 	}()
 
 	for _, createFeedback := range createFeedbacks {
 		req := &pb.FeedbackTodoRequest{
-			TodoId:  createFeedback.TodoID,
-			Content: createFeedback.Content,
+			TodoId:           createFeedback.TodoID,
+			Content:          createFeedback.Content,
+			ParentFeedbackId: createFeedback.ParentFeedbackID,
 		}
 
 		err := stream.Send(req)
 		if err != nil {
-			log.Fatalf("cannot send stream request: %v - %v", err, stream.RecvMsg(nil))
+			// the server closed the stream, its status is returned by Recv
+			break
 		}
-
-		log.Print("sent request: ", req)
 	}
 
 	err = stream.CloseSend()
 	if err != nil {
-		log.Fatalf("cannot close send: %v", err)
+		return nil, fmt.Errorf("cannot close send: %w", err)
 	}
 
 	err = <-waitResponse
 	if err != nil {
-		log.Fatalf("received error: %v", err)
+		return nil, wrapError(err)
 	}
+	return responses, nil
 }
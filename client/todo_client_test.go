@@ -0,0 +1,282 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/client"
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestTodoClient returns a todo client of a test server logged in as philly
+func newTestTodoClient(t *testing.T, opts ...client.Option) *client.TodoClient {
+	t.Helper()
+
+	cc := newTestServer(t, time.Minute).cc
+	res, err := client.NewAuthClient(cc, "philly", "secret123").Login(context.Background())
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	accessToken := res.GetAccessToken()
+	opts = append(opts,
+		client.WithUnaryInterceptors(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		client.WithStreamInterceptors(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", accessToken)
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	)
+	return client.NewTodoClient(cc, opts...)
+}
+
+func TestTodoClientErrors(t *testing.T) {
+	todoClient := newTestTodoClient(t)
+	ctx := context.Background()
+
+	_, err := todoClient.GetTodo(ctx, "missing")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("GetTodo error = %v, want ErrNotFound", err)
+	}
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("status code = %v, want NotFound", status.Code(err))
+	}
+
+	todoID := uuid.NewString()
+	id, err := todoClient.CreateTodo(ctx, &pb.Todo{Id: todoID, Title: "first"})
+	if err != nil || id != todoID {
+		t.Fatalf("CreateTodo = %q, %v", id, err)
+	}
+
+	_, err = todoClient.CreateTodo(ctx, &pb.Todo{Id: todoID, Title: "again"})
+	var clientErr *client.Error
+	if !errors.Is(err, client.ErrAlreadyExists) || !errors.As(err, &clientErr) || clientErr.Code != codes.AlreadyExists {
+		t.Fatalf("CreateTodo error = %v, want ErrAlreadyExists", err)
+	}
+
+	_, err = todoClient.CreateTodo(ctx, &pb.Todo{Id: "not-a-uuid"})
+	if !errors.Is(err, client.ErrInvalidArgument) {
+		t.Fatalf("CreateTodo error = %v, want ErrInvalidArgument", err)
+	}
+}
+
+func TestTodoIteratorFetchesPages(t *testing.T) {
+	todoClient := newTestTodoClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := todoClient.CreateTodo(ctx, &pb.Todo{Title: fmt.Sprintf("todo %d", i)})
+		if err != nil {
+			t.Fatalf("CreateTodo: %v", err)
+		}
+	}
+
+	iterator, err := todoClient.GetTodos(ctx, &pb.GetTodosRequest{OrderBy: "title", PageSize: 2})
+	if err != nil {
+		t.Fatalf("GetTodos: %v", err)
+	}
+	defer iterator.Close()
+
+	titles := make([]string, 0)
+	pageEnds := 0
+	for iterator.Next() {
+		titles = append(titles, iterator.Todo().GetTitle())
+		if iterator.NextPageToken() != "" {
+			pageEnds++
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	if fmt.Sprint(titles) != "[todo 0 todo 1 todo 2 todo 3 todo 4]" {
+		t.Fatalf("titles = %v", titles)
+	}
+	if pageEnds != 2 {
+		t.Fatalf("page ends = %d, want 2", pageEnds)
+	}
+}
+
+func TestTodoIteratorStopsEarly(t *testing.T) {
+	todoClient := newTestTodoClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := todoClient.CreateTodo(ctx, &pb.Todo{Title: fmt.Sprintf("todo %d", i)})
+		if err != nil {
+			t.Fatalf("CreateTodo: %v", err)
+		}
+	}
+
+	iterator, err := todoClient.GetTodos(ctx, &pb.GetTodosRequest{})
+	if err != nil {
+		t.Fatalf("GetTodos: %v", err)
+	}
+	if !iterator.Next() {
+		t.Fatalf("Next = false, err = %v", iterator.Err())
+	}
+	iterator.Close()
+
+	if iterator.Next() {
+		t.Fatal("Next after Close = true")
+	}
+	if err := iterator.Err(); err != nil {
+		t.Fatalf("Err after Close = %v", err)
+	}
+}
+
+func TestUploadImageFromReader(t *testing.T) {
+	todoClient := newTestTodoClient(t)
+	ctx := context.Background()
+
+	todoID, err := todoClient.CreateTodo(ctx, &pb.Todo{Title: "with image"})
+	if err != nil {
+		t.Fatalf("CreateTodo: %v", err)
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 80, 60))); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	// a reader that is not an io.ReadSeeker is read into memory first
+	res, err := todoClient.UploadImage(ctx, todoID, ".png", io.MultiReader(bytes.NewReader(img.Bytes())))
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	if res.GetSize() != uint32(img.Len()) {
+		t.Fatalf("uploaded size = %d, want %d", res.GetSize(), img.Len())
+	}
+
+	attachments, err := todoClient.ListImages(ctx, todoID)
+	if err != nil || len(attachments) != 1 {
+		t.Fatalf("ListImages = %v, %v", attachments, err)
+	}
+
+	var downloaded bytes.Buffer
+	attachment, err := todoClient.DownloadImage(ctx, res.GetId(), "", &downloaded)
+	if err != nil {
+		t.Fatalf("DownloadImage: %v", err)
+	}
+	if attachment.GetId() != res.GetId() || downloaded.Len() == 0 {
+		t.Fatalf("downloaded %d bytes of %v", downloaded.Len(), attachment)
+	}
+}
+
+// flakyTodoServer fails the first GetTodo and CreateTodo calls as unavailable,
+// and sleeps in DeleteTodo
+type flakyTodoServer struct {
+	pb.UnimplementedTodoServiceServer
+	failures int32
+	calls    atomic.Int32
+}
+
+func (server *flakyTodoServer) GetTodo(ctx context.Context, req *pb.GetTodoRequest) (*pb.GetTodoResponse, error) {
+	if server.calls.Add(1) <= server.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &pb.GetTodoResponse{Todo: &pb.TodoResult{Id: req.GetId()}}, nil
+}
+
+func (server *flakyTodoServer) CreateTodo(ctx context.Context, req *pb.CreateTodoRequest) (*pb.CreateTodoResponse, error) {
+	if server.calls.Add(1) <= server.failures {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	return &pb.CreateTodoResponse{Id: req.GetTodo().GetId()}, nil
+}
+
+func (server *flakyTodoServer) DeleteTodo(ctx context.Context, req *pb.DeleteTodoRequest) (*pb.DeleteTodoResponse, error) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+	}
+	return &pb.DeleteTodoResponse{}, nil
+}
+
+func TestTodoClientRetriesUnavailable(t *testing.T) {
+	server := &flakyTodoServer{failures: 2}
+	cc := serve(t, func(srv *grpc.Server) { pb.RegisterTodoServiceServer(srv, server) })
+
+	policy := client.RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Codes: []codes.Code{codes.Unavailable}}
+	todoClient := client.NewTodoClient(cc, client.WithRetryPolicy(policy))
+
+	res, err := todoClient.GetTodo(context.Background(), "todo-1")
+	if err != nil || res.GetTodo().GetId() != "todo-1" {
+		t.Fatalf("GetTodo = %v, %v", res, err)
+	}
+	if calls := server.calls.Load(); calls != 3 {
+		t.Fatalf("calls = %d, want 3", calls)
+	}
+
+	server.calls.Store(0)
+	policy.MaxAttempts = 2
+	todoClient = client.NewTodoClient(cc, client.WithRetryPolicy(policy))
+
+	_, err = todoClient.GetTodo(context.Background(), "todo-1")
+	if !errors.Is(err, client.ErrUnavailable) {
+		t.Fatalf("GetTodo error = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestDefaultRetryPolicyRetriesIdempotentMethods(t *testing.T) {
+	server := &flakyTodoServer{failures: 1}
+	cc := serve(t, func(srv *grpc.Server) { pb.RegisterTodoServiceServer(srv, server) })
+
+	policy := client.DefaultRetryPolicy()
+	policy.Backoff = time.Millisecond
+	todoClient := client.NewTodoClient(cc, client.WithRetryPolicy(policy))
+
+	// the failed CreateTodo may have created the todo
+	_, err := todoClient.CreateTodo(context.Background(), &pb.Todo{Id: "todo-1"})
+	if !errors.Is(err, client.ErrUnavailable) {
+		t.Fatalf("CreateTodo error = %v, want ErrUnavailable", err)
+	}
+	if calls := server.calls.Load(); calls != 1 {
+		t.Fatalf("CreateTodo calls = %d, want 1", calls)
+	}
+
+	server.calls.Store(0)
+	res, err := todoClient.GetTodo(context.Background(), "todo-1")
+	if err != nil || res.GetTodo().GetId() != "todo-1" {
+		t.Fatalf("GetTodo = %v, %v", res, err)
+	}
+	if calls := server.calls.Load(); calls != 2 {
+		t.Fatalf("GetTodo calls = %d, want 2", calls)
+	}
+}
+
+func TestTodoClientTimeout(t *testing.T) {
+	cc := serve(t, func(srv *grpc.Server) { pb.RegisterTodoServiceServer(srv, &flakyTodoServer{}) })
+	todoClient := client.NewTodoClient(cc, client.WithTimeout(20*time.Millisecond))
+
+	err := todoClient.DeleteTodo(context.Background(), "todo-1")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("DeleteTodo error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := client.RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, delay := range want {
+		if got := policy.Delay(i + 1); got != delay {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, delay)
+		}
+	}
+}
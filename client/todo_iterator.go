@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+)
+
+// TodoIterator iterates the todos of GetTodos:
+//
+//	for iterator.Next() {
+//		todo := iterator.Todo()
+//	}
+//	if err := iterator.Err(); err != nil {
+//	}
+//
+// Close must be called when the iteration stops before Next returns false.
+type TodoIterator struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	service pb.TodoServiceClient
+	req     *pb.GetTodosRequest
+	stream  pb.TodoService_GetTodosClient
+
+	todo          *pb.TodoResult
+	nextPageToken string
+	err           error
+}
+
+// Next moves to the next todo, it returns false when there are no more todos or
+// on the first error
+func (iterator *TodoIterator) Next() bool {
+	for iterator.err == nil && iterator.stream != nil {
+		res, err := iterator.stream.Recv()
+		if err == io.EOF {
+			if iterator.nextPageToken == "" {
+				iterator.Close()
+				return false
+			}
+
+			iterator.req.PageToken = iterator.nextPageToken
+			iterator.err = iterator.openStream()
+			continue
+		}
+		if err != nil {
+			iterator.err = wrapError(err)
+			break
+		}
+
+		iterator.todo = res.GetTodo()
+		iterator.nextPageToken = res.GetNextPageToken()
+		return true
+	}
+
+	iterator.todo = nil
+	iterator.Close()
+	return false
+}
+
+// Todo returns the current todo
+func (iterator *TodoIterator) Todo() *pb.TodoResult {
+	return iterator.todo
+}
+
+// NextPageToken returns the token of the next page when the current todo is the
+// last of its page, so the iteration can stop at the end of a page and resume
+// with the token later
+func (iterator *TodoIterator) NextPageToken() string {
+	return iterator.nextPageToken
+}
+
+// Err returns the error that ended the iteration
+func (iterator *TodoIterator) Err() error {
+	return iterator.err
+}
+
+// Close ends the stream of the iteration, it is safe to call more than once
+func (iterator *TodoIterator) Close() {
+	iterator.cancel()
+	iterator.stream = nil
+}
+
+// All returns the remaining todos
+func (iterator *TodoIterator) All() ([]*pb.TodoResult, error) {
+	todos := make([]*pb.TodoResult, 0)
+	for iterator.Next() {
+		todos = append(todos, iterator.Todo())
+	}
+	return todos, iterator.Err()
+}
+
+func (iterator *TodoIterator) openStream() error {
+	stream, err := iterator.service.GetTodos(iterator.ctx, iterator.req)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	iterator.stream = stream
+	iterator.nextPageToken = ""
+	return nil
+}
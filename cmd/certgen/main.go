@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/certs"
+)
+
+func main() {
+	out := flag.String("out", "dev-certs", "the folder the certificates and keys are written to")
+	caName := flag.String("ca-name", "todo-go-grpc development CA", "the common name of the CA")
+	hosts := flag.String("hosts", "localhost,127.0.0.1,::1", "comma separated DNS names and IP addresses of the server certificate, none skips it")
+	clients := flag.String("clients", "", "comma separated names of the client certificates, the name is the identity of the client")
+	validFor := flag.Duration("valid-for", 365*24*time.Hour, "how long the certificates are valid")
+	flag.Parse()
+
+	err := os.MkdirAll(*out, 0o755)
+	if err != nil {
+		log.Fatal("cannot create output folder: ", err)
+	}
+
+	// the CA of a previous run is reused, so more certificates can be issued
+	// without replacing the ones it signed
+	caCertFile := filepath.Join(*out, "ca.pem")
+	caKeyFile := filepath.Join(*out, "ca-key.pem")
+	authority, err := certs.LoadAuthority(caCertFile, caKeyFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		authority, err = certs.NewAuthority(*caName, *validFor)
+		if err == nil {
+			err = writePair(caCertFile, caKeyFile, authority.Certificate, authority.Key)
+		}
+	}
+	if err != nil {
+		log.Fatal("cannot get CA: ", err)
+	}
+	log.Printf("CA: %s", caCertFile)
+
+	if hostList := splitList(*hosts); len(hostList) > 0 {
+		certificate, key, err := authority.IssueServer(hostList[0], hostList, *validFor)
+		if err == nil {
+			err = writePair(filepath.Join(*out, "server.pem"), filepath.Join(*out, "server-key.pem"), certificate, key)
+		}
+		if err != nil {
+			log.Fatal("cannot issue server certificate: ", err)
+		}
+		log.Printf("server certificate for %s: %s", strings.Join(hostList, ", "), filepath.Join(*out, "server.pem"))
+	}
+
+	for _, name := range splitList(*clients) {
+		certificate, key, err := authority.IssueClient(name, *validFor)
+		if err == nil {
+			err = writePair(filepath.Join(*out, "client-"+name+".pem"), filepath.Join(*out, "client-"+name+"-key.pem"), certificate, key)
+		}
+		if err != nil {
+			log.Fatalf("cannot issue client certificate of %s: %v", name, err)
+		}
+		log.Printf("client certificate of %s: %s", name, filepath.Join(*out, "client-"+name+".pem"))
+	}
+}
+
+func writePair(certFile string, keyFile string, certificate *x509.Certificate, key *ecdsa.PrivateKey) error {
+	// a server reloading the pair keeps the old one while the new key does not
+	// match the old certificate, and loads the new pair once both are written
+	err := certs.WriteKey(keyFile, key)
+	if err != nil {
+		return err
+	}
+	return certs.WriteCertificate(certFile, certificate)
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
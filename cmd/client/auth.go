@@ -1,16 +1,320 @@
 package main
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/chienaeae/todo-go-grpc/client"
+	"golang.org/x/term"
 )
 
-func testLogin(authClient *client.AuthClient) {
-	accessToken, err := authClient.Login()
+// tokenCredentials sends the access token with every call
+type tokenCredentials struct {
+	accessToken string
+}
+
+func (credentials *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": credentials.accessToken}, nil
+}
+
+func (credentials *tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func runLogin(app *app, args []string) error {
+	cmd := commands()["login"]
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	username := flags.String("username", "", "the username, the username of the profile by default")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password from the standard input instead of prompting for it")
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 0, 0); err != nil {
+		return err
+	}
+
+	if *username == "" && app.config.Profiles[app.profileName] != nil {
+		*username = app.config.Profiles[app.profileName].Username
+	}
+	if *username == "" {
+		return fmt.Errorf("-username is required, profile %q has no username", app.profileName)
+	}
+
+	password, err := readPassword(*passwordStdin)
 	if err != nil {
-		log.Fatalf("cannot login: %s", err)
+		return err
 	}
 
-	log.Printf("access token: %s", accessToken)
+	address, err := app.serverAddress()
+	if err != nil {
+		return err
+	}
+
+	cc, err := app.dial(address)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	res, err := client.NewAuthClient(cc, *username, password).Login(app.ctx)
+	if err != nil {
+		return err
+	}
+
+	err = app.saveTokens(&CachedTokens{
+		Username:              *username,
+		AccessToken:           res.GetAccessToken(),
+		RefreshToken:          res.GetRefreshToken(),
+		AccessTokenExpiresAt:  res.GetAccessTokenExpiresAt().AsTime(),
+		RefreshTokenExpiresAt: res.GetRefreshTokenExpiresAt().AsTime(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "logged in to %s as %s\n", address, *username)
+	return nil
+}
+
+// readPassword prompts for the password without echoing it when the standard
+// input is a terminal, otherwise it reads the first line
+func readPassword(fromStdin bool) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !fromStdin && term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("cannot read password: %w", err)
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("cannot read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runLogout(app *app, args []string) error {
+	cmd := commands()["logout"]
+	args, err := parseFlags(flag.NewFlagSet("logout", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 0, 0); err != nil {
+		return err
+	}
+
+	cached, err := app.cachedTokens()
+	if err != nil {
+		return err
+	}
+	if cached == nil {
+		return fmt.Errorf("not logged in to profile %q", app.profileName)
+	}
+
+	address, err := app.serverAddress()
+	if err != nil {
+		return err
+	}
+
+	cc, err := app.dial(address)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	// the tokens are forgotten even when the server cannot revoke them
+	logoutErr := client.NewAuthClient(cc, cached.Username, "").Logout(app.ctx, cached.AccessToken, cached.RefreshToken)
+	err = app.saveTokens(nil)
+	if err != nil {
+		return err
+	}
+
+	if logoutErr != nil {
+		return fmt.Errorf("tokens are forgotten but cannot be revoked: %w", logoutErr)
+	}
+	return nil
+}
+
+func runProfileList(app *app, args []string) error {
+	cmd := commands()["profile list"]
+	args, err := parseFlags(flag.NewFlagSet("profile list", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 0, 0); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(app.config.Profiles))
+	for name := range app.config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		profile := app.config.Profiles[name]
+		transport := "plaintext"
+		if profile.TLS && profile.TLSCertFile != "" {
+			transport = "mtls"
+		} else if profile.TLS {
+			transport = "tls"
+		}
+
+		rows = append(rows, map[string]any{
+			"name":      name,
+			"address":   profile.Address,
+			"username":  profile.Username,
+			"transport": transport,
+			"current":   name == app.profileName,
+		})
+	}
+
+	return app.printRows([]string{"name", "address", "username", "transport", "current"}, rows)
+}
+
+func runProfileSet(app *app, args []string) error {
+	cmd := commands()["profile set"]
+	flags := flag.NewFlagSet("profile set", flag.ContinueOnError)
+	address := flags.String("address", "", "the server address")
+	username := flags.String("username", "", "the default username of login")
+	useTLS := flags.Bool("tls", false, "dial the server over TLS, implied by the other -tls flags")
+	tlsCA := flags.String("tls-ca", "", "the PEM CA certificates the server is verified with, the system CAs by default")
+	tlsServerName := flags.String("tls-server-name", "", "the name the server certificate is verified for, the host of the address by default")
+	tlsCert := flags.String("tls-cert", "", "the PEM client certificate of mutual TLS")
+	tlsKey := flags.String("tls-key", "", "the PEM key of -tls-cert")
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	profile := app.config.Profiles[args[0]]
+	if profile == nil {
+		profile = &Profile{}
+		app.config.Profiles[args[0]] = profile
+	}
+
+	visited := visitedFlags(flags)
+	if visited["address"] {
+		profile.Address = *address
+	}
+	if visited["username"] {
+		profile.Username = *username
+	}
+	if visited["tls"] {
+		profile.TLS = *useTLS
+	}
+
+	// the files are kept as absolute paths, so the profile works from any
+	// folder
+	tlsFiles := []struct {
+		name  string
+		value string
+		field *string
+	}{
+		{"tls-ca", *tlsCA, &profile.TLSCAFile},
+		{"tls-cert", *tlsCert, &profile.TLSCertFile},
+		{"tls-key", *tlsKey, &profile.TLSKeyFile},
+	}
+	for _, file := range tlsFiles {
+		if !visited[file.name] {
+			continue
+		}
+
+		*file.field = file.value
+		if file.value != "" {
+			path, err := filepath.Abs(file.value)
+			if err != nil {
+				return fmt.Errorf("-%s: %w", file.name, err)
+			}
+			*file.field = path
+			profile.TLS = true
+		}
+	}
+	if visited["tls-server-name"] {
+		profile.TLSServerName = *tlsServerName
+		profile.TLS = profile.TLS || *tlsServerName != ""
+	}
+
+	if profile.Address == "" {
+		return fmt.Errorf("-address is required")
+	}
+	if (profile.TLSCertFile == "") != (profile.TLSKeyFile == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be set together")
+	}
+	if app.config.CurrentProfile == "" {
+		app.config.CurrentProfile = args[0]
+	}
+
+	return saveConfig(app.configPath, app.config)
+}
+
+func runProfileUse(app *app, args []string) error {
+	cmd := commands()["profile use"]
+	args, err := parseFlags(flag.NewFlagSet("profile use", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	if app.config.Profiles[args[0]] == nil {
+		return fmt.Errorf("unknown profile: %s", args[0])
+	}
+
+	app.config.CurrentProfile = args[0]
+	return saveConfig(app.configPath, app.config)
+}
+
+func runProfileDelete(app *app, args []string) error {
+	cmd := commands()["profile delete"]
+	args, err := parseFlags(flag.NewFlagSet("profile delete", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	if app.config.Profiles[args[0]] == nil {
+		return fmt.Errorf("unknown profile: %s", args[0])
+	}
+
+	delete(app.config.Profiles, args[0])
+	if app.config.CurrentProfile == args[0] {
+		app.config.CurrentProfile = ""
+	}
+
+	err = saveConfig(app.configPath, app.config)
+	if err != nil {
+		return err
+	}
+
+	app.profileName = args[0]
+	return app.saveTokens(nil)
+}
+
+// visitedFlags returns the names of the flags set on the command line
+func visitedFlags(flags *flag.FlagSet) map[string]bool {
+	visited := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+	return visited
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tokens returns the cached tokens of the default profile
+func (cli *testCLI) tokens() *CachedTokens {
+	cli.t.Helper()
+
+	tokens, err := loadTokenCache(filepath.Join(filepath.Dir(cli.configPath), tokenCacheFile))
+	if err != nil {
+		cli.t.Fatalf("loadTokenCache: %v", err)
+	}
+	return tokens[defaultProfileName]
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	cli := newTestCLI(t)
+	address := newTestServer(t, time.Minute)
+
+	_, err := cli.run(outputTable, "todo", "list")
+	if err == nil || !strings.Contains(err.Error(), `profile "default" has no server address`) {
+		t.Fatalf("todo list without a profile error = %v", err)
+	}
+
+	cli.login(address, "philly")
+	cached := cli.tokens()
+	if cached == nil || cached.Username != "philly" || cached.AccessToken == "" || cached.RefreshToken == "" {
+		t.Fatalf("cached tokens = %+v", cached)
+	}
+	info, err := os.Stat(filepath.Join(filepath.Dir(cli.configPath), tokenCacheFile))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("token cache = %v, %v, want a file only the user can read", info, err)
+	}
+	cli.mustRun(outputTable, "todo", "list")
+
+	cli.mustRun(outputTable, "logout")
+	if cached := cli.tokens(); cached != nil {
+		t.Fatalf("cached tokens after logout = %+v", cached)
+	}
+	_, err = cli.run(outputTable, "todo", "list")
+	if err == nil || !strings.Contains(err.Error(), `not logged in to profile "default"`) {
+		t.Fatalf("todo list after logout error = %v", err)
+	}
+
+	_, err = cli.run(outputTable, "logout")
+	if err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Fatalf("second logout error = %v", err)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	cli := newTestCLI(t)
+	address := newTestServer(t, time.Minute)
+	cli.mustRun(outputTable, "profile", "set", "-address", address, "default")
+
+	setStdin(t, "secret123\n")
+	_, err := cli.run(outputTable, "login", "-password-stdin")
+	if err == nil || !strings.Contains(err.Error(), "-username is required") {
+		t.Fatalf("login without a username error = %v", err)
+	}
+
+	setStdin(t, "wrong password\n")
+	_, err = cli.run(outputTable, "login", "-password-stdin", "-username", "philly")
+	if err == nil || !strings.Contains(err.Error(), "incorrect username/password") {
+		t.Fatalf("login with a wrong password error = %v", err)
+	}
+	if cached := cli.tokens(); cached != nil {
+		t.Fatalf("cached tokens after a failed login = %+v", cached)
+	}
+
+	_, err = cli.run(outputTable, "login", "-password")
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("login with an unknown flag error = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestCommandRefreshesExpiringToken(t *testing.T) {
+	cli := newTestCLI(t)
+	// the access tokens expire within the expiry margin, so every command
+	// refreshes them first
+	cli.login(newTestServer(t, tokenExpiryMargin/2), "philly")
+	before := cli.tokens()
+
+	cli.mustRun(outputTable, "todo", "list")
+	after := cli.tokens()
+	if after.AccessToken == before.AccessToken || after.RefreshToken == before.RefreshToken {
+		t.Fatal("todo list did not refresh the tokens")
+	}
+
+	// a rotated refresh token is revoked, the session needs a new login
+	if err := saveTokenCache(filepath.Join(filepath.Dir(cli.configPath), tokenCacheFile), map[string]*CachedTokens{defaultProfileName: before}); err != nil {
+		t.Fatalf("saveTokenCache: %v", err)
+	}
+	_, err := cli.run(outputTable, "todo", "list")
+	if err == nil || !strings.Contains(err.Error(), "cannot refresh the session, run: client login") {
+		t.Fatalf("todo list with a revoked refresh token error = %v", err)
+	}
+}
+
+func TestProfileCommands(t *testing.T) {
+	cli := newTestCLI(t)
+
+	// the first profile becomes the current one
+	cli.mustRun(outputTable, "profile", "set", "-address", "localhost:8080", "-username", "philly", "local")
+	cli.mustRun(outputTable, "profile", "set", "-address", "todo.example.com:443", "-tls", "staging")
+
+	var profiles []map[string]any
+	decodeJSON(t, cli.mustRun(outputJSON, "profile", "list"), &profiles)
+	if len(profiles) != 2 {
+		t.Fatalf("profiles = %v", profiles)
+	}
+	local, staging := profiles[0], profiles[1]
+	if local["name"] != "local" || local["username"] != "philly" || local["transport"] != "plaintext" || local["current"] != true {
+		t.Fatalf("local profile = %v", local)
+	}
+	if staging["name"] != "staging" || staging["address"] != "todo.example.com:443" || staging["transport"] != "tls" || staging["current"] != false {
+		t.Fatalf("staging profile = %v", staging)
+	}
+
+	cli.mustRun(outputTable, "profile", "use", "staging")
+	out := cli.mustRun(outputTable, "profile", "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[2], "true") {
+		t.Fatalf("profile list printed:\n%s", out)
+	}
+
+	_, err := cli.run(outputTable, "profile", "set", "-tls-cert", "client.pem", "staging")
+	if err == nil || !strings.Contains(err.Error(), "-tls-cert and -tls-key must be set together") {
+		t.Fatalf("profile set with a certificate without key error = %v", err)
+	}
+	_, err = cli.run(outputTable, "profile", "set", "other")
+	if err == nil || !strings.Contains(err.Error(), "-address is required") {
+		t.Fatalf("profile set without an address error = %v", err)
+	}
+	_, err = cli.run(outputTable, "profile", "use", "missing")
+	if err == nil || !strings.Contains(err.Error(), "unknown profile: missing") {
+		t.Fatalf("profile use of a missing profile error = %v", err)
+	}
+
+	cli.mustRun(outputTable, "profile", "delete", "staging")
+	config, err := loadConfig(cli.configPath)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if config.CurrentProfile != "" || config.Profiles["staging"] != nil || config.Profiles["local"] == nil {
+		t.Fatalf("config after delete = %+v", config)
+	}
+}
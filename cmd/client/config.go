@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/certs"
+	"github.com/chienaeae/todo-go-grpc/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultProfileName = "default"
+	// tokenCacheFile is the name of the token cache in the folder of the config
+	tokenCacheFile = "tokens.json"
+	// tokenExpiryMargin is how long before it expires an access token is
+	// refreshed, so it does not expire during a command
+	tokenExpiryMargin = 30 * time.Second
+)
+
+// Config has the server profiles of the CLI
+type Config struct {
+	CurrentProfile string              `yaml:"current_profile,omitempty"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile is a server the CLI connects to
+type Profile struct {
+	Address string `yaml:"address"`
+	// Username is the default username of the login command
+	Username string `yaml:"username,omitempty"`
+	// TLS dials the server over TLS, verifying it with the CAs of TLSCAFile or
+	// the system CAs
+	TLS           bool   `yaml:"tls,omitempty"`
+	TLSCAFile     string `yaml:"tls_ca_file,omitempty"`
+	TLSServerName string `yaml:"tls_server_name,omitempty"`
+	// TLSCertFile and TLSKeyFile are the client certificate of mutual TLS
+	TLSCertFile string `yaml:"tls_cert_file,omitempty"`
+	TLSKeyFile  string `yaml:"tls_key_file,omitempty"`
+}
+
+// transportCredentials returns the credentials of the connections to the
+// server of the profile
+func (profile *Profile) transportCredentials() (credentials.TransportCredentials, error) {
+	if profile == nil || !profile.TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	return certs.NewClientCredentials(profile.TLSCAFile, profile.TLSCertFile, profile.TLSKeyFile, profile.TLSServerName)
+}
+
+// CachedTokens are the tokens of the last login of a profile
+type CachedTokens struct {
+	Username              string    `json:"username"`
+	AccessToken           string    `json:"access_token"`
+	RefreshToken          string    `json:"refresh_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// defaultConfigPath is $TODO_CONFIG, or config.yaml in the todo-go-grpc folder
+// of the user config folder
+func defaultConfigPath() string {
+	if path := os.Getenv("TODO_CONFIG"); path != "" {
+		return path
+	}
+
+	folder, err := os.UserConfigDir()
+	if err != nil {
+		folder = "."
+	}
+	return filepath.Join(folder, "todo-go-grpc", "config.yaml")
+}
+
+// loadConfig returns an empty config when the file does not exist
+func loadConfig(path string) (*Config, error) {
+	config := &Config{Profiles: make(map[string]*Profile)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config %s: %w", path, err)
+	}
+
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]*Profile)
+	}
+	return config, nil
+}
+
+func saveConfig(path string, config *Config) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("cannot encode config: %w", err)
+	}
+
+	return writePrivateFile(path, data)
+}
+
+// loadTokenCache returns the cached tokens by profile name, it returns an
+// empty cache when the file does not exist
+func loadTokenCache(path string) (map[string]*CachedTokens, error) {
+	tokens := make(map[string]*CachedTokens)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read token cache: %w", err)
+	}
+
+	err = json.Unmarshal(data, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse token cache %s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+func saveTokenCache(path string, tokens map[string]*CachedTokens) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode token cache: %w", err)
+	}
+
+	return writePrivateFile(path, data)
+}
+
+// writePrivateFile replaces the file with one only the user can read
+func writePrivateFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return fmt.Errorf("cannot create folder: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot create file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write file: %w", err)
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// app is the state shared by the commands
+type app struct {
+	ctx         context.Context
+	configPath  string
+	config      *Config
+	profileName string
+	// address overrides the address of the profile when it is not empty
+	address string
+	output  string
+	out     io.Writer
+}
+
+func newApp(ctx context.Context, configPath string, profileName string, address string, output string, out io.Writer) (*app, error) {
+	switch output {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", output)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if profileName == "" {
+		profileName = config.CurrentProfile
+	}
+	if profileName == "" {
+		profileName = defaultProfileName
+	}
+
+	return &app{
+		ctx:         ctx,
+		configPath:  configPath,
+		config:      config,
+		profileName: profileName,
+		address:     address,
+		output:      output,
+		out:         out,
+	}, nil
+}
+
+func (app *app) tokenCachePath() string {
+	return filepath.Join(filepath.Dir(app.configPath), tokenCacheFile)
+}
+
+// serverAddress returns the address of the -address flag or of the profile
+func (app *app) serverAddress() (string, error) {
+	if app.address != "" {
+		return app.address, nil
+	}
+
+	profile := app.config.Profiles[app.profileName]
+	if profile == nil || profile.Address == "" {
+		return "", fmt.Errorf("profile %q has no server address, run: client profile set -address HOST:PORT %s", app.profileName, app.profileName)
+	}
+	return profile.Address, nil
+}
+
+// cachedTokens returns nil when the profile is not logged in
+func (app *app) cachedTokens() (*CachedTokens, error) {
+	tokens, err := loadTokenCache(app.tokenCachePath())
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens[app.profileName], nil
+}
+
+// saveTokens caches the tokens of the profile, nil forgets them
+func (app *app) saveTokens(cached *CachedTokens) error {
+	tokens, err := loadTokenCache(app.tokenCachePath())
+	if err != nil {
+		return err
+	}
+
+	if cached == nil {
+		delete(tokens, app.profileName)
+	} else {
+		tokens[app.profileName] = cached
+	}
+	return saveTokenCache(app.tokenCachePath(), tokens)
+}
+
+// authConn dials the server of the profile with the cached access token, the
+// token is refreshed first when it is about to expire. A profile with a client
+// certificate that is not logged in is authenticated by its certificate.
+func (app *app) authConn() (*grpc.ClientConn, error) {
+	address, err := app.serverAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	cached, err := app.cachedTokens()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if cached == nil || (now.Add(tokenExpiryMargin).After(cached.AccessTokenExpiresAt) && now.After(cached.RefreshTokenExpiresAt)) {
+		if profile := app.config.Profiles[app.profileName]; profile != nil && profile.TLS && profile.TLSCertFile != "" {
+			return app.dial(address)
+		}
+		return nil, fmt.Errorf("not logged in to profile %q, run: client login", app.profileName)
+	}
+
+	if now.Add(tokenExpiryMargin).After(cached.AccessTokenExpiresAt) {
+		cached, err = app.refreshTokens(address, cached)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return app.dial(address, grpc.WithPerRPCCredentials(&tokenCredentials{accessToken: cached.AccessToken}))
+}
+
+func (app *app) refreshTokens(address string, cached *CachedTokens) (*CachedTokens, error) {
+	cc, err := app.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Close()
+
+	res, err := client.NewAuthClient(cc, cached.Username, "").RefreshToken(app.ctx, cached.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("cannot refresh the session, run: client login: %w", err)
+	}
+
+	refreshed := &CachedTokens{
+		Username:              cached.Username,
+		AccessToken:           res.GetAccessToken(),
+		RefreshToken:          res.GetRefreshToken(),
+		AccessTokenExpiresAt:  res.GetAccessTokenExpiresAt().AsTime(),
+		RefreshTokenExpiresAt: res.GetRefreshTokenExpiresAt().AsTime(),
+	}
+
+	err = app.saveTokens(refreshed)
+	if err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
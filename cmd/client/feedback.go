@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/chienaeae/todo-go-grpc/client"
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var feedbackColumns = []string{"id", "from", "created", "content"}
+
+func runFeedbackAdd(app *app, args []string) error {
+	cmd := commands()["feedback add"]
+	flags := flag.NewFlagSet("feedback add", flag.ContinueOnError)
+	replyTo := flags.String("reply-to", "", "the ID of the feedback replied to")
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 2, -1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	responses, err := todoClient.FeedbackTodo(app.ctx, []client.CreateFeedback{{
+		TodoID:           args[0],
+		Content:          strings.Join(args[1:], " "),
+		ParentFeedbackID: *replyTo,
+	}})
+	if err != nil {
+		return err
+	}
+
+	messages := make([]proto.Message, 0, len(responses))
+	for _, res := range responses {
+		messages = append(messages, res)
+	}
+	return app.printMessages([]string{"todo_id", "feedback_id"}, messages, func(message proto.Message) []string {
+		res := message.(*pb.FeedbackTodoResponse)
+		return []string{res.GetTodoId(), res.GetFeedbackId()}
+	})
+}
+
+func runFeedbackList(app *app, args []string) error {
+	cmd := commands()["feedback list"]
+	args, err := parseFlags(flag.NewFlagSet("feedback list", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	res, err := todoClient.GetTodo(app.ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if app.output != outputTable {
+		messages := make([]proto.Message, 0, len(res.GetFeedbacks()))
+		for _, feedback := range res.GetFeedbacks() {
+			messages = append(messages, feedback)
+		}
+		return app.printMessages(nil, messages, nil)
+	}
+
+	// the replies are indented under the feedback they reply to
+	rows := make([][]string, 0)
+	var addRows func(feedbacks []*pb.FeedBack, depth int)
+	addRows = func(feedbacks []*pb.FeedBack, depth int) {
+		for _, feedback := range feedbacks {
+			rows = append(rows, []string{
+				feedback.GetId(),
+				feedback.GetFromUser(),
+				formatTime(feedback.GetCreatedAt()),
+				strings.Repeat("  ", depth) + feedback.GetContent(),
+			})
+			addRows(feedback.GetReplies(), depth+1)
+		}
+	}
+	addRows(res.GetFeedbacks(), 0)
+
+	return app.printTable(feedbackColumns, rows)
+}
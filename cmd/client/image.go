@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var attachmentColumns = []string{"id", "type", "size", "uploaded", "variants"}
+
+func attachmentRow(attachment *pb.Attachment) []string {
+	variants := make([]string, 0, len(attachment.GetVariants()))
+	for _, variant := range attachment.GetVariants() {
+		variants = append(variants, variant.GetName())
+	}
+
+	return []string{
+		attachment.GetId(),
+		attachment.GetImageType(),
+		strconv.FormatUint(attachment.GetSize(), 10),
+		formatTime(attachment.GetUploadedAt()),
+		strings.Join(variants, ","),
+	}
+}
+
+func runImageUpload(app *app, args []string) error {
+	cmd := commands()["image upload"]
+	args, err := parseFlags(flag.NewFlagSet("image upload", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 2, 2); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	res, err := todoClient.UploadImageFile(app.ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"id", "size"}
+	return app.printMessage(columns, res, []string{res.GetId(), strconv.FormatUint(uint64(res.GetSize()), 10)})
+}
+
+func runImageDownload(app *app, args []string) error {
+	cmd := commands()["image download"]
+	flags := flag.NewFlagSet("image download", flag.ContinueOnError)
+	variant := flags.String("variant", "", "the image variant, like thumbnail_64, the original image by default")
+	output := flags.String("o", "", "the file the image is written to, the image ID with the extension of its type by default, - for the standard output")
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	var image bytes.Buffer
+	attachment, err := todoClient.DownloadImage(app.ctx, args[0], *variant, &image)
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(image.Bytes())
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = args[0] + imageExtension(attachment, *variant)
+	}
+
+	err = os.WriteFile(path, image.Bytes(), 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot write image: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "downloaded %d bytes to %s\n", image.Len(), path)
+	return nil
+}
+
+// imageExtension returns the file extension of the image type of the variant
+func imageExtension(attachment *pb.Attachment, variant string) string {
+	imageType := attachment.GetImageType()
+	for _, v := range attachment.GetVariants() {
+		if v.GetName() == variant {
+			imageType = v.GetImageType()
+		}
+	}
+
+	if strings.HasPrefix(imageType, ".") {
+		return imageType
+	}
+
+	extensions, err := mime.ExtensionsByType(imageType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+	return extensions[0]
+}
+
+func runImageList(app *app, args []string) error {
+	cmd := commands()["image list"]
+	args, err := parseFlags(flag.NewFlagSet("image list", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	attachments, err := todoClient.ListImages(app.ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	messages := make([]proto.Message, 0, len(attachments))
+	for _, attachment := range attachments {
+		messages = append(messages, attachment)
+	}
+	return app.printMessages(attachmentColumns, messages, func(message proto.Message) []string {
+		return attachmentRow(message.(*pb.Attachment))
+	})
+}
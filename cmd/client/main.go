@@ -1,83 +1,164 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
-	"log"
-	"time"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
 
-	"github.com/chienaeae/todo-go-grpc/client"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-const (
-	username        = "philly"
-	password        = "secret"
-	refreshDuration = 30 * time.Second
-)
+const usageHeader = `Usage: client [flags] <command> [<subcommand>] [flags] [args]
 
-func dial(serverAddress string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
-	log.Printf("dial server %s", serverAddress)
-	transportOption := grpc.WithTransportCredentials(insecure.NewCredentials())
-	allOpts := append([]grpc.DialOption{transportOption}, opts...)
-	return grpc.NewClient(serverAddress, allOpts...)
-}
+Commands:
+`
 
-func testAuth(cc *grpc.ClientConn) {
-	authClient := client.NewAuthClient(cc, username, password)
-	testLogin(authClient)
+// command is a subcommand of the CLI, like "todo list"
+type command struct {
+	usage       string
+	description string
+	run         func(app *app, args []string) error
 }
 
-func testTodo(cc *grpc.ClientConn) {
-	todoClient := client.NewTodoClient(cc)
-	testCreateTodo(todoClient)
-	testGetTodos(todoClient)
-	testUploadImage(todoClient)
-	testCreateFeedbacks(todoClient)
+func commands() map[string]*command {
+	return map[string]*command{
+		"login":          {"login [-username NAME] [-password-stdin]", "log in to the server of the profile", runLogin},
+		"logout":         {"logout", "revoke and forget the tokens of the profile", runLogout},
+		"profile list":   {"profile list", "list the server profiles", runProfileList},
+		"profile set":    {"profile set -address HOST:PORT [-username NAME] [-tls] [-tls-ca FILE] [-tls-cert FILE -tls-key FILE] NAME", "create or update a server profile", runProfileSet},
+		"profile use":    {"profile use NAME", "use the profile by default", runProfileUse},
+		"profile delete": {"profile delete NAME", "delete a profile and its tokens", runProfileDelete},
+		"todo create":    {"todo create -title TITLE [-description TEXT] [-status STATUS] [-priority PRIORITY] [-due TIME]", "create a todo", runTodoCreate},
+		"todo list":      {"todo list [-status S,..] [-priority P,..] [-title-contains TEXT] [-due-before TIME] [-due-after TIME] [-order-by FIELD] [-shared]", "list the todos", runTodoList},
+		"todo get":       {"todo get ID", "show a todo", runTodoGet},
+		"todo update":    {"todo update [-title TITLE] [-description TEXT] [-status STATUS] [-priority PRIORITY] [-due TIME] ID", "update the given fields of a todo", runTodoUpdate},
+		"todo delete":    {"todo delete ID...", "delete todos", runTodoDelete},
+		"image upload":   {"image upload TODO_ID FILE", "attach an image to a todo", runImageUpload},
+		"image download": {"image download [-variant NAME] [-o FILE] IMAGE_ID", "download an image", runImageDownload},
+		"image list":     {"image list TODO_ID", "list the images of a todo", runImageList},
+		"feedback add":   {"feedback add [-reply-to FEEDBACK_ID] TODO_ID CONTENT", "add a feedback to a todo", runFeedbackAdd},
+		"feedback list":  {"feedback list TODO_ID", "list the feedback threads of a todo", runFeedbackList},
+	}
 }
 
-func authMethods() map[string]bool {
-	const todoServicePath = "/todoGoGrpc.TodoService/"
-	return map[string]bool{
-		todoServicePath + "CreateTodo":   true,
-		todoServicePath + "GetTodos":     true,
-		todoServicePath + "GetTodo":      true,
-		todoServicePath + "FeedbackTodo": true,
-		todoServicePath + "UploadImage":  true,
+func usage(w io.Writer) {
+	fmt.Fprint(w, usageHeader)
+
+	all := commands()
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
 	}
-}
+	sort.Strings(names)
 
-func main() {
-	serverAddress := flag.String("address", "", "the server address")
-	service := flag.String("service", "todo", "execute service target")
-	flag.Parse()
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, all[name].description)
+	}
 
-	cc1, err := dial(*serverAddress)
-	if err != nil {
-		log.Fatal("cannot dial server", err)
+	fmt.Fprint(w, "\nFlags:\n")
+	flag.CommandLine.SetOutput(w)
+	flag.PrintDefaults()
+}
+
+// findCommand returns the command named by the first one or two arguments and
+// the remaining arguments
+func findCommand(args []string) (*command, []string) {
+	all := commands()
+	if len(args) >= 2 {
+		if cmd, ok := all[args[0]+" "+args[1]]; ok {
+			return cmd, args[2:]
+		}
 	}
 
-	if *service == "todo" {
-		authClient := client.NewAuthClient(cc1, username, password)
-		interceptor, err := client.NewAuthInterceptor(authClient, authMethods(), refreshDuration)
-		if err != nil {
-			log.Fatal("cannot create auth interceptor: ", err)
+	if len(args) >= 1 {
+		if cmd, ok := all[args[0]]; ok {
+			return cmd, args[1:]
 		}
+	}
 
-		cc2, err := dial(
-			*serverAddress,
-			grpc.WithUnaryInterceptor(interceptor.Unary()),
-			grpc.WithStreamInterceptor(interceptor.Stream()),
-		)
+	return nil, nil
+}
+
+// parseFlags parses the flags of a subcommand wherever they are among its
+// positional arguments, and returns the positional arguments
+func parseFlags(flags *flag.FlagSet, cmd *command, args []string) ([]string, error) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: client %s\n", cmd.usage)
+		flags.PrintDefaults()
+	}
+
+	positional := make([]string, 0)
+	for {
+		err := flags.Parse(args)
 		if err != nil {
+			// the flag set already printed the error with the usage
+			return nil, flag.ErrHelp
+		}
 
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
 		}
 
-		testTodo(cc2)
-	} else if *service == "auth" {
-		testAuth(cc1)
-	} else {
-		log.Fatalf("unknown service: %s", *service)
+		positional = append(positional, args[0])
+		args = args[1:]
 	}
+}
 
+// wantArgs checks the number of positional arguments of a command, max is -1
+// when there is no maximum
+func wantArgs(cmd *command, args []string, min int, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("usage: client %s", cmd.usage)
+	}
+
+	return nil
+}
+
+// dial connects to the server with the TLS settings of the profile
+func (app *app) dial(serverAddress string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	transportCredentials, err := app.config.Profiles[app.profileName].transportCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	transportOption := grpc.WithTransportCredentials(transportCredentials)
+	allOpts := append([]grpc.DialOption{transportOption}, opts...)
+	return grpc.NewClient(serverAddress, allOpts...)
+}
+
+func main() {
+	configPath := flag.String("config", defaultConfigPath(), "the config file with the server profiles, the token cache is kept next to it")
+	profileName := flag.String("profile", "", "the server profile, the current profile of the config file by default")
+	address := flag.String("address", "", "the server address, overriding the address of the profile")
+	output := flag.String("output", "table", "the output format: table, json or yaml")
+	flag.Usage = func() { usage(os.Stderr) }
+	flag.Parse()
+
+	cmd, args := findCommand(flag.Args())
+	if cmd == nil {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// an interrupt cancels the calls of the command
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	app, err := newApp(ctx, *configPath, *profileName, *address, *output, os.Stdout)
+	if err == nil {
+		err = cmd.run(app, args)
+	}
+	stop()
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc"
+)
+
+// newTestServer serves a todo and auth server with the admin user philly and
+// the user reporter, both with the password secret123, and returns its address
+func newTestServer(t *testing.T, tokenDuration time.Duration) string {
+	t.Helper()
+
+	jwtManager := service.NewJWTManager("secret", tokenDuration)
+	userStore := service.NewInMemoryUserStore()
+	revocationStore := service.NewInMemoryRevocationStore()
+
+	for username, role := range map[string]string{"philly": "admin", "reporter": "user"} {
+		user, err := service.NewUser(username, "secret123", role)
+		if err != nil {
+			t.Fatalf("NewUser: %v", err)
+		}
+		if err := userStore.Save(user); err != nil {
+			t.Fatalf("Save user: %v", err)
+		}
+	}
+
+	uploadSessionStore, err := service.NewDiskUploadSessionStore(t.TempDir(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewDiskUploadSessionStore: %v", err)
+	}
+	t.Cleanup(uploadSessionStore.Close)
+
+	todoServer := service.NewTodoServer(
+		service.NewInMemoryTodoStore(),
+		service.NewDiskImageStore(t.TempDir()),
+		service.NewInMemoryFeedbackStore(),
+		service.NewInMemoryShareStore(),
+		userStore,
+		uploadSessionStore,
+		service.DefaultUploadPolicy(),
+		service.NewEventBus(10, 10),
+	)
+	authServer := service.NewAuthServer(jwtManager, userStore, service.NewInMemoryRefreshTokenStore(), revocationStore, time.Hour)
+
+	accessibleRoles := map[string][]string{"/todoGoGrpc.AuthService/Logout": {"admin", "user"}}
+	for _, method := range []string{"GetTodos", "GetTodo", "UpdateTodo", "DeleteTodo"} {
+		accessibleRoles["/todoGoGrpc.TodoService/"+method] = []string{"admin", "user"}
+	}
+	accessibleRoles["/todoGoGrpc.TodoService/CreateTodo"] = []string{"admin"}
+	interceptor := service.NewAuthInterceptor(jwtManager, userStore, revocationStore, accessibleRoles, nil)
+
+	srv := grpc.NewServer(grpc.UnaryInterceptor(interceptor.Unary()), grpc.StreamInterceptor(interceptor.Stream()))
+	pb.RegisterTodoServiceServer(srv, todoServer)
+	pb.RegisterAuthServiceServer(srv, authServer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	return listener.Addr().String()
+}
+
+// testCLI runs commands with a config file in a temporary folder
+type testCLI struct {
+	t          *testing.T
+	configPath string
+}
+
+func newTestCLI(t *testing.T) *testCLI {
+	return &testCLI{t: t, configPath: filepath.Join(t.TempDir(), "config.yaml")}
+}
+
+// run runs the command line of a command with the output format, and returns
+// what the command printed
+func (cli *testCLI) run(output string, line ...string) (string, error) {
+	cli.t.Helper()
+
+	cmd, args := findCommand(line)
+	if cmd == nil {
+		cli.t.Fatalf("no command in %q", line)
+	}
+
+	var out bytes.Buffer
+	app, err := newApp(context.Background(), cli.configPath, "", "", output, &out)
+	if err != nil {
+		cli.t.Fatalf("newApp: %v", err)
+	}
+	err = cmd.run(app, args)
+	return out.String(), err
+}
+
+// mustRun runs the command line and fails the test when the command fails
+func (cli *testCLI) mustRun(output string, line ...string) string {
+	cli.t.Helper()
+
+	out, err := cli.run(output, line...)
+	if err != nil {
+		cli.t.Fatalf("%q: %v", line, err)
+	}
+	return out
+}
+
+// login logs in to the default profile of the server as the user
+func (cli *testCLI) login(address string, username string) {
+	cli.t.Helper()
+
+	cli.mustRun(outputTable, "profile", "set", "-address", address, "-username", username, "default")
+	setStdin(cli.t, "secret123\n")
+	cli.mustRun(outputTable, "login", "-password-stdin")
+}
+
+// setStdin replaces the standard input with the input until the test ends
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		line     []string
+		wantName string
+		wantArgs []string
+	}{
+		{[]string{"login", "-username", "philly"}, "login", []string{"-username", "philly"}},
+		{[]string{"todo", "list", "-shared"}, "todo list", []string{"-shared"}},
+		{[]string{"todo", "delete", "a", "b"}, "todo delete", []string{"a", "b"}},
+		{[]string{"profile", "use", "staging"}, "profile use", []string{"staging"}},
+		{[]string{"todo"}, "", nil},
+		{[]string{"todo", "archive", "a"}, "", nil},
+		{[]string{"list", "todo"}, "", nil},
+		{nil, "", nil},
+	}
+
+	all := commands()
+	for _, tt := range tests {
+		cmd, args := findCommand(tt.line)
+		if tt.wantName == "" {
+			if cmd != nil {
+				t.Errorf("findCommand(%q) = %q, want no command", tt.line, cmd.usage)
+			}
+			continue
+		}
+		if cmd == nil || cmd.usage != all[tt.wantName].usage || !slices.Equal(args, tt.wantArgs) {
+			t.Errorf("findCommand(%q) returned the args %q, want the %s command and %q", tt.line, args, tt.wantName, tt.wantArgs)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	cmd := commands()["todo update"]
+
+	newFlags := func() (*flag.FlagSet, *todoFlags) {
+		flags := flag.NewFlagSet("todo update", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		return flags, newTodoFlags(flags)
+	}
+
+	// the flags are parsed wherever they are among the arguments
+	flags, todoFlags := newFlags()
+	args, err := parseFlags(flags, cmd, []string{"-title", "Buy milk", "a", "-status", "done", "b"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if !slices.Equal(args, []string{"a", "b"}) {
+		t.Fatalf("positional arguments = %q, want a and b", args)
+	}
+	if *todoFlags.title != "Buy milk" || *todoFlags.status != "done" {
+		t.Fatalf("title = %q, status = %q", *todoFlags.title, *todoFlags.status)
+	}
+
+	todo, paths, err := todoFlags.todo(visitedFlags(flags))
+	if err != nil {
+		t.Fatalf("todo: %v", err)
+	}
+	if todo.GetTitle() != "Buy milk" || todo.GetStatus() != pb.TodoStatus_TODO_STATUS_DONE {
+		t.Fatalf("todo = %v", todo)
+	}
+	if !slices.Equal(paths, []string{"title", "status"}) {
+		t.Fatalf("paths = %q, want title and status", paths)
+	}
+
+	// an empty due time clears the due date
+	flags, todoFlags = newFlags()
+	if _, err := parseFlags(flags, cmd, []string{"-due", "", "a"}); err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	todo, paths, err = todoFlags.todo(visitedFlags(flags))
+	if err != nil || todo.GetDueAt() != nil || !slices.Equal(paths, []string{"due_at"}) {
+		t.Fatalf("todo = %v, paths = %q, err = %v, want no due date at due_at", todo, paths, err)
+	}
+
+	flags, _ = newFlags()
+	_, err = parseFlags(flags, cmd, []string{"a", "-color", "red"})
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("parseFlags error = %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestNewAppOutput(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for _, output := range []string{outputTable, outputJSON, outputYAML} {
+		if _, err := newApp(context.Background(), configPath, "", "", output, io.Discard); err != nil {
+			t.Errorf("newApp with output %s: %v", output, err)
+		}
+	}
+
+	if _, err := newApp(context.Background(), configPath, "", "", "xml", io.Discard); err == nil {
+		t.Error("newApp with output xml succeeded")
+	}
+}
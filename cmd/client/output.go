@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printMessages prints a table row per message, or the messages as a JSON or
+// YAML list
+func (app *app) printMessages(columns []string, messages []proto.Message, row func(message proto.Message) []string) error {
+	if app.output == outputTable {
+		rows := make([][]string, 0, len(messages))
+		for _, message := range messages {
+			rows = append(rows, row(message))
+		}
+		return app.printTable(columns, rows)
+	}
+
+	values := make([]any, 0, len(messages))
+	for _, message := range messages {
+		value, err := messageValue(message)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	return app.printValue(values)
+}
+
+// printMessage prints the message as a table row, or as a JSON or YAML object
+func (app *app) printMessage(columns []string, message proto.Message, row []string) error {
+	if app.output == outputTable {
+		return app.printTable(columns, [][]string{row})
+	}
+
+	value, err := messageValue(message)
+	if err != nil {
+		return err
+	}
+	return app.printValue(value)
+}
+
+// printRows prints rows that are not messages, keyed by column
+func (app *app) printRows(columns []string, rows []map[string]any) error {
+	if app.output == outputTable {
+		cells := make([][]string, 0, len(rows))
+		for _, row := range rows {
+			line := make([]string, 0, len(columns))
+			for _, column := range columns {
+				line = append(line, fmt.Sprint(row[column]))
+			}
+			cells = append(cells, line)
+		}
+		return app.printTable(columns, cells)
+	}
+
+	return app.printValue(rows)
+}
+
+func (app *app) printTable(columns []string, rows [][]string) error {
+	writer := tabwriter.NewWriter(app.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+func (app *app) printValue(value any) error {
+	var (
+		data []byte
+		err  error
+	)
+	if app.output == outputJSON {
+		data, err = json.MarshalIndent(value, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(value)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot encode output: %w", err)
+	}
+
+	_, err = app.out.Write(data)
+	return err
+}
+
+// messageValue converts the message to the JSON value of its protojson
+// encoding, so it is printed with the field names of the protos
+func messageValue(message proto.Message) (any, error) {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode message: %w", err)
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("cannot decode message: %w", err)
+	}
+	return value, nil
+}
+
+// formatEnum shortens an enum name for a table, TODO_STATUS_IN_PROGRESS with
+// the TODO_STATUS_ prefix is in_progress
+func formatEnum(name string, prefix string) string {
+	if name == prefix+"UNSPECIFIED" {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(name, prefix))
+}
+
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+
+	return ts.AsTime().Local().Format("2006-01-02 15:04")
+}
+
+// parseTime parses an RFC 3339 time or a local date
+func parseTime(value string) (*timestamppb.Timestamp, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return timestamppb.New(t), nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, want RFC 3339 or YYYY-MM-DD", value)
+	}
+	return timestamppb.New(t), nil
+}
+
+// parseEnum parses the short name of an enum value, like in_progress for
+// TODO_STATUS_IN_PROGRESS
+func parseEnum(values map[string]int32, prefix string, name string) (int32, error) {
+	value, ok := values[prefix+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))]
+	if !ok || value == 0 {
+		return 0, fmt.Errorf("unknown value %q", name)
+	}
+
+	return value, nil
+}
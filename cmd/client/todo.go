@@ -1,49 +1,327 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"strings"
 
 	"github.com/chienaeae/todo-go-grpc/client"
-	"github.com/chienaeae/todo-go-grpc/sample"
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
 )
 
-func testCreateTodo(todoClient *client.TodoClient) {
-	todoClient.CreateTodo(sample.NewTodo())
+var todoColumns = []string{"id", "title", "status", "priority", "due", "from", "updated"}
+
+func todoRow(todo *pb.TodoResult) []string {
+	return []string{
+		todo.GetId(),
+		todo.GetTitle(),
+		formatEnum(todo.GetStatus().String(), "TODO_STATUS_"),
+		formatEnum(todo.GetPriority().String(), "TODO_PRIORITY_"),
+		formatTime(todo.GetDueAt()),
+		todo.GetFromUser(),
+		formatTime(todo.GetUpdatedAt()),
+	}
+}
+
+// todoClient dials the server of the profile, the returned connection must be
+// closed
+func (app *app) todoClient() (*client.TodoClient, *grpc.ClientConn, error) {
+	cc, err := app.authConn()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client.NewTodoClient(cc), cc, nil
 }
 
-func testGetTodos(todoClient *client.TodoClient) {
-	todoClient.GetTodos()
+// todoFlags are the flags setting the fields of a todo
+type todoFlags struct {
+	title       *string
+	description *string
+	status      *string
+	priority    *string
+	due         *string
 }
 
-func testUploadImage(todoClient *client.TodoClient) {
-	todo := sample.NewTodo()
-	todoClient.CreateTodo(todo)
-	todoClient.UploadImage(todo.Id, "tmp/todo.png")
-	todoClient.UploadImage(todo.Id, "tmp/aoi.jpeg")
+func newTodoFlags(flags *flag.FlagSet) *todoFlags {
+	return &todoFlags{
+		title:       flags.String("title", "", "the title"),
+		description: flags.String("description", "", "the description"),
+		status:      flags.String("status", "", "the status: open, in_progress, done or cancelled"),
+		priority:    flags.String("priority", "", "the priority: low, medium, high or urgent"),
+		due:         flags.String("due", "", "the due time, RFC 3339 or YYYY-MM-DD"),
+	}
 }
 
-func testCreateFeedbacks(todoClient *client.TodoClient) {
-	todo := sample.NewTodo()
-	todoClient.CreateTodo(todo)
+// todo returns the todo with the fields of the visited flags, and the paths of
+// those fields
+func (todoFlags *todoFlags) todo(visited map[string]bool) (*pb.Todo, []string, error) {
+	todo := &pb.Todo{}
+	paths := make([]string, 0)
+
+	if visited["title"] {
+		todo.Title = *todoFlags.title
+		paths = append(paths, "title")
+	}
+
+	if visited["description"] {
+		todo.Description = *todoFlags.description
+		paths = append(paths, "description")
+	}
 
-	n := 3
-	createFeedbacks := make([]client.CreateFeedback, n)
-	for {
-		for i := 0; i < n; i++ {
-			createFeedbacks[i] = client.CreateFeedback{
-				TodoID:  todo.Id,
-				Content: sample.NewContent(),
+	if visited["status"] {
+		status, err := parseEnum(pb.TodoStatus_value, "TODO_STATUS_", *todoFlags.status)
+		if err != nil {
+			return nil, nil, fmt.Errorf("-status: %w", err)
+		}
+		todo.Status = pb.TodoStatus(status)
+		paths = append(paths, "status")
+	}
+
+	if visited["priority"] {
+		priority, err := parseEnum(pb.TodoPriority_value, "TODO_PRIORITY_", *todoFlags.priority)
+		if err != nil {
+			return nil, nil, fmt.Errorf("-priority: %w", err)
+		}
+		todo.Priority = pb.TodoPriority(priority)
+		paths = append(paths, "priority")
+	}
+
+	if visited["due"] {
+		if *todoFlags.due != "" {
+			dueAt, err := parseTime(*todoFlags.due)
+			if err != nil {
+				return nil, nil, fmt.Errorf("-due: %w", err)
 			}
+			todo.DueAt = dueAt
 		}
+		paths = append(paths, "due_at")
+	}
+
+	return todo, paths, nil
+}
+
+func runTodoCreate(app *app, args []string) error {
+	cmd := commands()["todo create"]
+	flags := flag.NewFlagSet("todo create", flag.ContinueOnError)
+	todoFlags := newTodoFlags(flags)
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 0, 0); err != nil {
+		return err
+	}
+
+	todo, _, err := todoFlags.todo(visitedFlags(flags))
+	if err != nil {
+		return err
+	}
+	if todo.GetTitle() == "" {
+		return fmt.Errorf("-title is required")
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	id, err := todoClient.CreateTodo(app.ctx, todo)
+	if err != nil {
+		return err
+	}
+
+	res, err := todoClient.GetTodo(app.ctx, id)
+	if err != nil {
+		return err
+	}
+	return app.printMessage(todoColumns, res.GetTodo(), todoRow(res.GetTodo()))
+}
+
+func runTodoList(app *app, args []string) error {
+	cmd := commands()["todo list"]
+	flags := flag.NewFlagSet("todo list", flag.ContinueOnError)
+	statuses := flags.String("status", "", "comma separated statuses of the todos")
+	priorities := flags.String("priority", "", "comma separated priorities of the todos")
+	titleContains := flags.String("title-contains", "", "text the title of the todos contains")
+	dueBefore := flags.String("due-before", "", "the time the todos are due before, RFC 3339 or YYYY-MM-DD")
+	dueAfter := flags.String("due-after", "", "the time the todos are due after, RFC 3339 or YYYY-MM-DD")
+	orderBy := flags.String("order-by", "", `created_at, updated_at, due_at, priority or title, optionally followed by " desc"`)
+	shared := flags.Bool("shared", false, "also list the todos shared with you")
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 0, 0); err != nil {
+		return err
+	}
+
+	filter := &pb.TodoFilter{TitleContains: *titleContains}
+	for _, name := range splitList(*statuses) {
+		status, err := parseEnum(pb.TodoStatus_value, "TODO_STATUS_", name)
+		if err != nil {
+			return fmt.Errorf("-status: %w", err)
+		}
+		filter.Statuses = append(filter.Statuses, pb.TodoStatus(status))
+	}
+
+	for _, name := range splitList(*priorities) {
+		priority, err := parseEnum(pb.TodoPriority_value, "TODO_PRIORITY_", name)
+		if err != nil {
+			return fmt.Errorf("-priority: %w", err)
+		}
+		filter.Priorities = append(filter.Priorities, pb.TodoPriority(priority))
+	}
+
+	if *dueBefore != "" {
+		filter.DueBefore, err = parseTime(*dueBefore)
+		if err != nil {
+			return fmt.Errorf("-due-before: %w", err)
+		}
+	}
 
-		todoClient.FeedbackTodo(createFeedbacks)
+	if *dueAfter != "" {
+		filter.DueAfter, err = parseTime(*dueAfter)
+		if err != nil {
+			return fmt.Errorf("-due-after: %w", err)
+		}
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	iterator, err := todoClient.GetTodos(app.ctx, &pb.GetTodosRequest{
+		Filter:        filter,
+		OrderBy:       *orderBy,
+		IncludeShared: *shared,
+	})
+	if err != nil {
+		return err
+	}
+	defer iterator.Close()
+
+	messages := make([]proto.Message, 0)
+	for iterator.Next() {
+		messages = append(messages, iterator.Todo())
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	return app.printMessages(todoColumns, messages, func(message proto.Message) []string {
+		return todoRow(message.(*pb.TodoResult))
+	})
+}
+
+func runTodoGet(app *app, args []string) error {
+	cmd := commands()["todo get"]
+	args, err := parseFlags(flag.NewFlagSet("todo get", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	res, err := todoClient.GetTodo(app.ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	if app.output != outputTable {
+		return app.printMessage(nil, res, nil)
+	}
+
+	todo := res.GetTodo()
+	err = app.printTable(todoColumns, [][]string{todoRow(todo)})
+	if err != nil {
+		return err
+	}
+
+	if todo.GetDescription() != "" {
+		fmt.Fprintf(app.out, "\n%s\n", todo.GetDescription())
+	}
+	fmt.Fprintf(app.out, "\n%d feedback threads, %d images\n", len(res.GetFeedbacks()), len(res.GetAttachments()))
+	return nil
+}
+
+func runTodoUpdate(app *app, args []string) error {
+	cmd := commands()["todo update"]
+	flags := flag.NewFlagSet("todo update", flag.ContinueOnError)
+	todoFlags := newTodoFlags(flags)
+	args, err := parseFlags(flags, cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, 1); err != nil {
+		return err
+	}
+
+	todo, paths, err := todoFlags.todo(visitedFlags(flags))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("nothing to update, set at least one field flag")
+	}
+	todo.Id = args[0]
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	updated, err := todoClient.UpdateTodo(app.ctx, todo, paths)
+	if err != nil {
+		return err
+	}
+	return app.printMessage(todoColumns, updated, todoRow(updated))
+}
+
+func runTodoDelete(app *app, args []string) error {
+	cmd := commands()["todo delete"]
+	args, err := parseFlags(flag.NewFlagSet("todo delete", flag.ContinueOnError), cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(cmd, args, 1, -1); err != nil {
+		return err
+	}
+
+	todoClient, cc, err := app.todoClient()
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	for _, id := range args {
+		err := todoClient.DeleteTodo(app.ctx, id)
+		if err != nil {
+			return fmt.Errorf("cannot delete todo %s: %w", id, err)
+		}
+	}
+	return nil
+}
 
-		fmt.Print("continue to create feedback (y/N)?")
-		var ans string
-		fmt.Scan(&ans)
-		if strings.ToLower(ans) != "y" {
-			break
+// splitList splits a comma separated flag value, ignoring empty items
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
 }
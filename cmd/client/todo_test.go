@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/client"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeJSON decodes the JSON output of a command
+func decodeJSON(t *testing.T, out string, value any) {
+	t.Helper()
+
+	if err := json.Unmarshal([]byte(out), value); err != nil {
+		t.Fatalf("output %q is not JSON: %v", out, err)
+	}
+}
+
+func TestTodoCommands(t *testing.T) {
+	cli := newTestCLI(t)
+	cli.login(newTestServer(t, time.Minute), "philly")
+
+	var created map[string]any
+	decodeJSON(t, cli.mustRun(outputJSON, "todo", "create", "-title", "Buy milk", "-priority", "high", "-due", "2030-05-01T10:00:00Z"), &created)
+	id, _ := created["id"].(string)
+	if id == "" || created["title"] != "Buy milk" || created["priority"] != "TODO_PRIORITY_HIGH" || created["from_user"] != "philly" {
+		t.Fatalf("created todo = %v", created)
+	}
+	if created["due_at"] != "2030-05-01T10:00:00Z" {
+		t.Fatalf("due_at = %v, want 2030-05-01T10:00:00Z", created["due_at"])
+	}
+	cli.mustRun(outputTable, "todo", "create", "-title", "Call mom", "-status", "in_progress")
+
+	// the table has a header and a row per todo with the short enum names
+	out := cli.mustRun(outputTable, "todo", "list", "-order-by", "title")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("todo list printed %d lines, want a header and 2 todos:\n%s", len(lines), out)
+	}
+	if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "ID TITLE STATUS PRIORITY DUE FROM UPDATED" {
+		t.Fatalf("header = %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], id+"  Buy milk") || !strings.Contains(lines[1], "  high  ") {
+		t.Fatalf("row = %q, want the todo %s with high priority", lines[1], id)
+	}
+	if !strings.Contains(lines[2], "Call mom") || !strings.Contains(lines[2], "in_progress") {
+		t.Fatalf("row = %q, want the todo in progress", lines[2])
+	}
+
+	var listed []map[string]any
+	decodeJSON(t, cli.mustRun(outputJSON, "todo", "list", "-status", "open,in_progress", "-priority", "high"), &listed)
+	if len(listed) != 1 || listed[0]["id"] != id {
+		t.Fatalf("todos with high priority = %v, want %s", listed, id)
+	}
+
+	var updated map[string]any
+	decodeJSON(t, cli.mustRun(outputJSON, "todo", "update", id, "-status", "done", "-due", ""), &updated)
+	if updated["status"] != "TODO_STATUS_DONE" || updated["title"] != "Buy milk" || updated["due_at"] != nil {
+		t.Fatalf("updated todo = %v, want it done without a due date", updated)
+	}
+
+	var got map[string]any
+	if err := yaml.Unmarshal([]byte(cli.mustRun(outputYAML, "todo", "get", id)), &got); err != nil {
+		t.Fatalf("todo get output is not YAML: %v", err)
+	}
+	if todo, _ := got["todo"].(map[string]any); todo["id"] != id {
+		t.Fatalf("todo get = %v, want the todo %s", got, id)
+	}
+
+	out = cli.mustRun(outputTable, "todo", "get", id)
+	if !strings.Contains(out, "done") || !strings.HasSuffix(out, "\n0 feedback threads, 0 images\n") {
+		t.Fatalf("todo get printed:\n%s", out)
+	}
+
+	cli.mustRun(outputTable, "todo", "delete", id)
+	_, err := cli.run(outputTable, "todo", "get", id)
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("todo get of a deleted todo error = %v, want %v", err, client.ErrNotFound)
+	}
+}
+
+func TestTodoCommandErrors(t *testing.T) {
+	cli := newTestCLI(t)
+	cli.login(newTestServer(t, time.Minute), "philly")
+
+	// the commands fail before calling the server
+	tests := []struct {
+		line    []string
+		wantErr string
+	}{
+		{[]string{"todo", "create", "-description", "no title"}, "-title is required"},
+		{[]string{"todo", "create", "-title", "a", "-priority", "extreme"}, `-priority: unknown value "extreme"`},
+		{[]string{"todo", "create", "-title", "a", "extra"}, "usage: client todo create"},
+		{[]string{"todo", "list", "-status", "open,unspecified"}, `-status: unknown value "unspecified"`},
+		{[]string{"todo", "list", "-due-before", "tomorrow"}, `-due-before: invalid time "tomorrow"`},
+		{[]string{"todo", "update", "id"}, "nothing to update"},
+		{[]string{"todo", "update", "-title", "a"}, "usage: client todo update"},
+		{[]string{"todo", "get"}, "usage: client todo get ID"},
+		{[]string{"todo", "delete"}, "usage: client todo delete ID..."},
+	}
+	for _, tt := range tests {
+		out, err := cli.run(outputTable, tt.line...)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q error = %v, want %q", tt.line, err, tt.wantErr)
+		}
+		if out != "" {
+			t.Errorf("%q printed %q", tt.line, out)
+		}
+	}
+
+	// a user cannot create todos
+	reporter := newTestCLI(t)
+	reporter.login(newTestServer(t, time.Minute), "reporter")
+	_, err := reporter.run(outputTable, "todo", "create", "-title", "a")
+	if !errors.Is(err, client.ErrPermissionDenied) {
+		t.Fatalf("todo create error = %v, want %v", err, client.ErrPermissionDenied)
+	}
+}
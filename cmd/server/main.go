@@ -1,27 +1,56 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/chienaeae/todo-go-grpc/certs"
 	"github.com/chienaeae/todo-go-grpc/pb"
 	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
 	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 )
 
 const (
-	secretKey     = "secret"
-	tokenDuration = 15 * time.Minute
+	tokenDuration        = 15 * time.Minute
+	refreshTokenDuration = 7 * 24 * time.Hour
+	// eventHistorySize is the number of events a WatchTodos client can resume
+	// after reconnecting
+	eventHistorySize = 1000
+	// watchBufferSize is the number of events a WatchTodos client can fall
+	// behind before it is disconnected
+	watchBufferSize = 100
+	// webhookTimeout is how long a webhook has to respond to a delivery attempt
+	webhookTimeout = 10 * time.Second
 )
 
+// seedUsers creates the demo users philly (admin) and user, their password is
+// public so they are only created for the memory store or with -seed-users
 func seedUsers(userStore service.UserStore) error {
-	_, err := createUser(userStore, "philly", "secret", "admin")
-	_, err = createUser(userStore, "user", "secret", "user")
-	if err != nil {
+	_, err := createUser(userStore, "philly", "secret123", "admin")
+	if err != nil && !errors.Is(err, service.ErrAlreadyExists) {
+		return err
+	}
+
+	_, err = createUser(userStore, "user", "secret123", "user")
+	if err != nil && !errors.Is(err, service.ErrAlreadyExists) {
 		return err
 	}
 
@@ -43,34 +72,342 @@ func createUser(userStore service.UserStore, username, password, role string) (*
 
 func accessibleRoles() map[string][]string {
 	const todoServicePath = "/todoGoGrpc.TodoService/"
+	const authServicePath = "/todoGoGrpc.AuthService/"
+	const webhookServicePath = "/todoGoGrpc.WebhookService/"
 	return map[string][]string{
-		todoServicePath + "CreateTodo":   {"admin"},
-		todoServicePath + "GetTodos":     {"admin", "user"},
-		todoServicePath + "GetTodo":      {"admin", "user"},
-		todoServicePath + "FeedbackTodo": {"admin"},
-		todoServicePath + "UploadImage":  {"admin"},
+		authServicePath + "Logout":         {"admin", "user"},
+		authServicePath + "ChangePassword": {"admin", "user"},
+		authServicePath + "GetMe":          {"admin", "user"},
+		authServicePath + "ListUsers":      {"admin"},
+		authServicePath + "SetUserRole":    {"admin"},
+		authServicePath + "DisableUser":    {"admin"},
+
+		todoServicePath + "CreateTodo":          {"admin"},
+		todoServicePath + "GetTodos":            {"admin", "user"},
+		todoServicePath + "GetTodo":             {"admin", "user"},
+		todoServicePath + "UpdateTodo":          {"admin", "user"},
+		todoServicePath + "DeleteTodo":          {"admin", "user"},
+		todoServicePath + "FeedbackTodo":        {"admin", "user"},
+		todoServicePath + "CreateUploadSession": {"admin", "user"},
+		todoServicePath + "GetUploadSession":    {"admin", "user"},
+		todoServicePath + "UploadImage":         {"admin", "user"},
+		todoServicePath + "DownloadImage":       {"admin", "user"},
+		todoServicePath + "GetImageURL":         {"admin", "user"},
+		todoServicePath + "ListImages":          {"admin", "user"},
+		todoServicePath + "DeleteImage":         {"admin", "user"},
+		todoServicePath + "EditFeedback":        {"admin", "user"},
+		todoServicePath + "DeleteFeedback":      {"admin", "user"},
+		todoServicePath + "WatchTodos":          {"admin", "user"},
+		todoServicePath + "ShareTodo":           {"admin", "user"},
+		todoServicePath + "UnshareTodo":         {"admin", "user"},
+		todoServicePath + "ListCollaborators":   {"admin", "user"},
+
+		webhookServicePath + "CreateWebhook":         {"admin"},
+		webhookServicePath + "ListWebhooks":          {"admin"},
+		webhookServicePath + "DeleteWebhook":         {"admin"},
+		webhookServicePath + "ListWebhookDeliveries": {"admin"},
+		webhookServicePath + "ReplayWebhookDelivery": {"admin"},
+	}
+}
+
+// newTLSConfig returns the TLS config of the listeners, or nil when they serve
+// plaintext
+func newTLSConfig(certFile string, keyFile string, clientCAFile string, clientCertOptional bool) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("-tls-client-ca needs -tls-cert and -tls-key")
+		}
+		return nil, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("-tls-cert and -tls-key must be set together")
+	}
+	return certs.NewServerConfig(certFile, keyFile, clientCAFile, clientCertOptional)
+}
+
+// newCertificateRoles parses the comma separated identity=role list of the
+// client certificates that authenticate calls without an access token
+func newCertificateRoles(certificateRoles string, clientCAFile string) (map[string]string, error) {
+	if certificateRoles == "" {
+		return nil, nil
+	}
+	if clientCAFile == "" {
+		return nil, errors.New("-tls-client-roles needs -tls-client-ca")
+	}
+
+	roles := make(map[string]string)
+	for _, mapping := range strings.Split(certificateRoles, ",") {
+		identity, role, ok := strings.Cut(strings.TrimSpace(mapping), "=")
+		if !ok || identity == "" {
+			return nil, fmt.Errorf("invalid client certificate role %q, want identity=role", mapping)
+		}
+		if !service.IsValidRole(role) {
+			return nil, fmt.Errorf("unknown role %q of client certificate %s", role, identity)
+		}
+		roles[identity] = role
+	}
+	return roles, nil
+}
+
+// newJWTManager signs tokens with the first key of the comma separated PEM
+// files and verifies tokens with all of them. Without key files it signs with
+// an Ed25519 key generated for this process, so tokens cannot be forged with a
+// well-known secret but do not outlive a restart.
+func newJWTManager(keyFiles string) (*service.JWTManager, error) {
+	if keyFiles == "" {
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("cannot generate signing key: %w", err)
+		}
+
+		key, err := service.NewSigningKey("ephemeral-"+time.Now().UTC().Format("20060102T150405"), privateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("WARNING: no -jwt-keys given, access tokens are signed with the ephemeral key %s and are invalid after a restart", key.ID)
+		return service.NewJWTManagerWithKeys(key, nil, tokenDuration)
+	}
+
+	keys := make([]*service.SigningKey, 0)
+	for _, path := range strings.Split(keyFiles, ",") {
+		key, err := service.LoadSigningKey(strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return service.NewJWTManagerWithKeys(keys[0], keys[1:], tokenDuration)
+}
+
+// newUploadPolicy limits the image size of every role to maxImageSize unless
+// roleMaxImageSizes, a comma separated list of role=bytes, sets another limit,
+// and only allows the comma separated MIME types of imageTypes
+func newUploadPolicy(maxImageSize int64, roleMaxImageSizes string, imageTypes string, maxDimension int, maxFrames int, maxPixels int64) (*service.UploadPolicy, error) {
+	policy := service.DefaultUploadPolicy()
+	policy.DefaultMaxSize = maxImageSize
+	policy.MaxDimension = maxDimension
+	policy.MaxFrames = maxFrames
+	policy.MaxPixels = maxPixels
+
+	if roleMaxImageSizes != "" {
+		for _, limit := range strings.Split(roleMaxImageSizes, ",") {
+			role, value, ok := strings.Cut(strings.TrimSpace(limit), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid image size limit %q, want role=bytes", limit)
+			}
+
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid image size limit %q, want role=bytes", limit)
+			}
+			policy.MaxSizes[role] = size
+		}
+	}
+
+	allowedTypes := make(map[string]string)
+	for _, mimeType := range strings.Split(imageTypes, ",") {
+		mimeType = strings.TrimSpace(mimeType)
+		extension, ok := policy.AllowedTypes[mimeType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported image type %q", mimeType)
+		}
+		allowedTypes[mimeType] = extension
+	}
+	policy.AllowedTypes = allowedTypes
+
+	return policy, nil
+}
+
+// newBlobStore returns the blob store of the content image store, the S3
+// credentials are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+func newBlobStore(blobStoreType string, imageFolder string, s3Endpoint string, s3Bucket string, s3Region string, s3Insecure bool, s3PartSize uint64) (service.BlobStore, error) {
+	switch blobStoreType {
+	case "file":
+		return service.NewFileBlobStore(imageFolder)
+	case "s3":
+		client, err := minio.New(s3Endpoint, &minio.Options{
+			Creds:  credentials.NewEnvAWS(),
+			Secure: !s3Insecure,
+			Region: s3Region,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create S3 client: %w", err)
+		}
+
+		return service.NewS3BlobStore(client, s3Bucket, s3PartSize)
+	default:
+		return nil, fmt.Errorf("unknown blob store: %s", blobStoreType)
 	}
 }
 
 func main() {
 	port := flag.Int("port", 0, "the server port")
+	httpPort := flag.Int("http-port", -1, "the HTTP port serving the JWKS document and the REST/JSON gateway, disabled when negative")
+	jwtKeys := flag.String(
+		"jwt-keys",
+		"",
+		"comma separated PEM key files, the first one signs access tokens and all of them verify tokens",
+	)
+	storeType := flag.String("store", "memory", "where todos, feedbacks and users are stored: memory or disk")
+	dbPath := flag.String("db", "todo.db", "the database file of the disk store")
+	seed := flag.Bool("seed-users", false, "create the demo users philly (admin) and user with the password secret123 in the disk store, they are always created in the memory store")
+	imageStoreType := flag.String(
+		"image-store",
+		"disk",
+		"how images are stored: disk, a file per upload, or content, a file per distinct image shared by every todo it is attached to",
+	)
+	imageFolder := flag.String("image-folder", "img", "the folder images are stored in")
+	blobStoreType := flag.String("blob-store", "file", "where the content image store keeps images: file, in -image-folder, or s3")
+	s3Endpoint := flag.String("s3-endpoint", "s3.amazonaws.com", "the host and port of the S3 compatible server")
+	s3Bucket := flag.String("s3-bucket", "todo-images", "the bucket images are stored in, it is created when missing and must not be shared with another server")
+	s3Region := flag.String("s3-region", "", "the region of the bucket")
+	s3Insecure := flag.Bool("s3-insecure", false, "connect to the S3 server over plain HTTP")
+	s3PartSize := flag.Uint64("s3-part-size", 16<<20, "the part size in bytes of multipart uploads, larger images are uploaded in parts")
+	maxImageSize := flag.Int64("max-image-size", 1<<20, "the maximum size of an uploaded image in bytes")
+	roleMaxImageSizes := flag.String(
+		"role-max-image-sizes",
+		"",
+		"comma separated role=bytes image size limits overriding -max-image-size, e.g. admin=10485760",
+	)
+	imageTypes := flag.String("image-types", "image/png,image/jpeg,image/gif", "comma separated MIME types of the images that can be uploaded")
+	maxImageDimension := flag.Int("max-image-dimension", 8192, "the maximum width and height of an uploaded image in pixels")
+	maxImageFrames := flag.Int("max-image-frames", 100, "the maximum number of frames of an uploaded animated GIF")
+	maxImagePixels := flag.Int64("max-image-pixels", 8192*8192, "the maximum number of pixels of an uploaded image, counting every frame of an animated GIF")
+	maxUploadSessions := flag.Int("max-upload-sessions", 10, "the maximum number of resumable uploads a user can have in progress")
+	tlsCert := flag.String("tls-cert", "", "the PEM certificate gRPC and HTTP are served over TLS with, reloaded when the file changes")
+	tlsKey := flag.String("tls-key", "", "the PEM key of -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "the PEM CA certificates client certificates are verified with, clients must present one when set")
+	tlsClientCertOptional := flag.Bool("tls-client-cert-optional", false, "with -tls-client-ca, also accept clients without a certificate")
+	tlsClientRoles := flag.String(
+		"tls-client-roles",
+		"",
+		"comma separated identity=role roles of client certificates authenticating calls without an access token, the identity is the subject common name or a SAN as dns:, email: or uri:value, e.g. batch-job=admin,dns:sync.example.com=user",
+	)
 	flag.Parse()
 
-	jwtManager := service.NewJWTManager(secretKey, tokenDuration)
-	userStore := service.NewInMemoryUserStore()
-	err := seedUsers(userStore)
+	var (
+		todoStore         service.TodoStore
+		feedbackStore     service.FeedbackStore
+		userStore         service.UserStore
+		refreshTokenStore service.RefreshTokenStore
+		revocationStore   service.RevocationStore
+		shareStore        service.ShareStore
+		webhookStore      service.WebhookStore
+	)
+	switch *storeType {
+	case "memory":
+		todoStore = service.NewInMemoryTodoStore()
+		feedbackStore = service.NewInMemoryFeedbackStore()
+		userStore = service.NewInMemoryUserStore()
+		refreshTokenStore = service.NewInMemoryRefreshTokenStore()
+		revocationStore = service.NewInMemoryRevocationStore()
+		shareStore = service.NewInMemoryShareStore()
+		webhookStore = service.NewInMemoryWebhookStore()
+	case "disk":
+		db, err := service.OpenBoltDB(*dbPath)
+		if err != nil {
+			log.Fatal("cannot open database: ", err)
+		}
+		defer db.Close()
+
+		todoStore = service.NewBoltTodoStore(db)
+		feedbackStore = service.NewBoltFeedbackStore(db)
+		userStore = service.NewBoltUserStore(db)
+		refreshTokenStore = service.NewBoltRefreshTokenStore(db)
+		revocationStore = service.NewBoltRevocationStore(db)
+		shareStore = service.NewBoltShareStore(db)
+		webhookStore = service.NewBoltWebhookStore(db)
+	default:
+		log.Fatalf("unknown store: %s", *storeType)
+	}
+
+	jwtManager, err := newJWTManager(*jwtKeys)
 	if err != nil {
-		log.Fatal("cannot seed users: ", err)
+		log.Fatal("cannot load JWT signing keys: ", err)
 	}
-	todoStore := service.NewInMemoryTodoStore()
-	imageStore := service.NewDiskImageStore("img")
-	feedbackStore := service.NewInMemoryFeedbackStore()
+
+	if *storeType == "memory" || *seed {
+		err = seedUsers(userStore)
+		if err != nil {
+			log.Fatal("cannot seed users: ", err)
+		}
+	}
+	uploadPolicy, err := newUploadPolicy(*maxImageSize, *roleMaxImageSizes, *imageTypes, *maxImageDimension, *maxImageFrames, *maxImagePixels)
+	if err != nil {
+		log.Fatal("cannot create upload policy: ", err)
+	}
+
+	var imageStore service.ImageStore
+	switch *imageStoreType {
+	case "disk":
+		if *blobStoreType != "file" {
+			log.Fatal("-blob-store needs -image-store content")
+		}
+		imageStore = service.NewDiskImageStore(*imageFolder)
+	case "content":
+		blobStore, err := newBlobStore(*blobStoreType, *imageFolder, *s3Endpoint, *s3Bucket, *s3Region, *s3Insecure, *s3PartSize)
+		if err != nil {
+			log.Fatal("cannot open blob store: ", err)
+		}
+
+		imageStore, err = service.NewContentAddressedImageStore(blobStore)
+		if err != nil {
+			log.Fatal("cannot open image store: ", err)
+		}
+	default:
+		log.Fatalf("unknown image store: %s", *imageStoreType)
+	}
+
+	eventBus := service.NewEventBus(eventHistorySize, watchBufferSize)
+	webhookDispatcher := service.NewWebhookDispatcher(
+		webhookStore,
+		eventBus,
+		&http.Client{Timeout: webhookTimeout},
+		service.DefaultWebhookRetryPolicy(),
+	)
+	err = webhookDispatcher.Start()
+	if err != nil {
+		log.Fatal("cannot start webhook dispatcher: ", err)
+	}
+	defer webhookDispatcher.Close()
+
+	uploadSessionStore, err := service.NewDiskUploadSessionStore(filepath.Join(os.TempDir(), "todo-go-grpc-uploads"), *maxUploadSessions, time.Minute)
+	if err != nil {
+		log.Fatal("cannot create upload session store: ", err)
+	}
+	defer uploadSessionStore.Close()
+
 	todoServer := service.NewTodoServer(
 		todoStore,
 		imageStore,
 		feedbackStore,
+		shareStore,
+		userStore,
+		uploadSessionStore,
+		uploadPolicy,
+		eventBus,
 	)
-	authServer := service.NewAuthServer(jwtManager, userStore)
+	authServer := service.NewAuthServer(
+		jwtManager,
+		userStore,
+		refreshTokenStore,
+		revocationStore,
+		refreshTokenDuration,
+	)
+	webhookServer := service.NewWebhookServer(webhookStore, webhookDispatcher)
+
+	tlsConfig, err := newTLSConfig(*tlsCert, *tlsKey, *tlsClientCA, *tlsClientCertOptional)
+	if err != nil {
+		log.Fatal("cannot load TLS config: ", err)
+	}
+
+	certificateRoles, err := newCertificateRoles(*tlsClientRoles, *tlsClientCA)
+	if err != nil {
+		log.Fatal("cannot parse client certificate roles: ", err)
+	}
 
 	address := fmt.Sprintf("0.0.0.0:%d", *port)
 	listener, err := net.Listen("tcp", address)
@@ -78,17 +415,67 @@ func main() {
 		log.Fatal("cannot start server: ", err)
 	}
 
-	interceptor := service.NewAuthInterceptor(jwtManager, accessibleRoles())
+	interceptor := service.NewAuthInterceptor(jwtManager, userStore, revocationStore, accessibleRoles(), certificateRoles)
 	serverOptions := []grpc.ServerOption{
 		grpc.UnaryInterceptor(interceptor.Unary()),
 		grpc.StreamInterceptor(interceptor.Stream()),
 	}
+	registerServices := func(srv *grpc.Server) {
+		pb.RegisterTodoServiceServer(srv, todoServer)
+		pb.RegisterAuthServiceServer(srv, authServer)
+		pb.RegisterWebhookServiceServer(srv, webhookServer)
+	}
 
-	srv := grpc.NewServer(serverOptions...)
-	pb.RegisterTodoServiceServer(srv, todoServer)
-	pb.RegisterAuthServiceServer(srv, authServer)
+	listenerOptions := append([]grpc.ServerOption{}, serverOptions...)
+	if tlsConfig != nil {
+		listenerOptions = append(listenerOptions, grpc.Creds(grpccredentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(listenerOptions...)
+	registerServices(srv)
 	reflection.Register(srv)
 
+	if *httpPort >= 0 {
+		httpListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", *httpPort))
+		if err != nil {
+			log.Fatal("cannot start HTTP server: ", err)
+		}
+
+		// the gateway calls the services through a server on an in-memory
+		// listener, so it needs no client certificate when the network
+		// listener requires one
+		gatewayListener := service.NewPipeListener()
+		gatewaySrv := grpc.NewServer(serverOptions...)
+		registerServices(gatewaySrv)
+		go func() {
+			log.Fatal("cannot serve gateway: ", gatewaySrv.Serve(gatewayListener))
+		}()
+
+		gateway, err := service.NewGatewayHandler(
+			context.Background(),
+			"passthrough:///gateway",
+			[]grpc.DialOption{
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+				grpc.WithContextDialer(gatewayListener.DialContext),
+			},
+		)
+		if err != nil {
+			log.Fatal("cannot create gateway: ", err)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(service.JWKSPath, service.NewJWKSHandler(jwtManager))
+		mux.Handle(service.GatewayPathPrefix, gateway)
+
+		log.Printf("Start HTTP server at %s", httpListener.Addr().String())
+		go func() {
+			httpServer := &http.Server{Handler: mux, TLSConfig: tlsConfig}
+			if tlsConfig != nil {
+				log.Fatal("cannot serve HTTPS: ", httpServer.ServeTLS(httpListener, "", ""))
+			}
+			log.Fatal("cannot serve HTTP: ", httpServer.Serve(httpListener))
+		}()
+	}
+
 	log.Printf("Start GRPC server at %s", listener.Addr().String())
 	err = srv.Serve(listener)
 	if err != nil {
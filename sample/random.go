@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/chienaeae/todo-go-grpc/pb"
 	"github.com/google/uuid"
 )
 
@@ -34,3 +35,7 @@ func randomString(n int) string {
 
 	return sb.String()
 }
+
+func randomTodoPriority() pb.TodoPriority {
+	return pb.TodoPriority(randomInt(1, len(pb.TodoPriority_name)-1))
+}
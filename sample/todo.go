@@ -2,15 +2,20 @@ package sample
 
 import (
 	"math/rand"
+	"time"
 
 	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func NewTodo() *pb.Todo {
 	length := rand.Intn(20)
 	todo := &pb.Todo{
-		Id:    randomID(),
-		Title: randomString(length),
+		Id:          randomID(),
+		Title:       randomString(length),
+		Description: NewContent(),
+		Priority:    randomTodoPriority(),
+		DueAt:       timestamppb.New(time.Now().Add(time.Duration(randomInt(1, 72)) * time.Hour)),
 	}
 
 	return todo
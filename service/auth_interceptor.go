@@ -2,23 +2,51 @@ package service
 
 import (
 	"context"
+	"crypto/x509"
 	"log"
+	"strings"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+// CertificatePrincipalPrefix starts the usernames of the calls authenticated by
+// a client certificate, usernames of users cannot contain its colon
+const CertificatePrincipalPrefix = "cert:"
+
 type AuthInterceptor struct {
-	jwtManager      *JWTManager
-	accessibleRoles map[string][]string
+	jwtManager       *JWTManager
+	userStore        UserStore
+	revocationStore  RevocationStore
+	accessibleRoles  map[string][]string
+	certificateRoles map[string]string
 }
 
-func NewAuthInterceptor(jwtManager *JWTManager, accessibleRoles map[string][]string) *AuthInterceptor {
+// NewAuthInterceptor authorizes calls with the access token of the
+// authorization metadata. Calls without one are authorized with the client
+// certificate of mutual TLS when certificateRoles maps one of its identities
+// to a role: the subject common name, or a SAN prefixed with its type as in
+// dns:host, email:address or uri:value. The username of such a call is the
+// identity prefixed with CertificatePrincipalPrefix, which no registered user
+// can have. The certificate must have been verified by the TLS config of the
+// server, like the one of certs.NewServerConfig.
+func NewAuthInterceptor(
+	jwtManager *JWTManager,
+	userStore UserStore,
+	revocationStore RevocationStore,
+	accessibleRoles map[string][]string,
+	certificateRoles map[string]string,
+) *AuthInterceptor {
 	return &AuthInterceptor{
-		jwtManager:      jwtManager,
-		accessibleRoles: accessibleRoles,
+		jwtManager:       jwtManager,
+		userStore:        userStore,
+		revocationStore:  revocationStore,
+		accessibleRoles:  accessibleRoles,
+		certificateRoles: certificateRoles,
 	}
 }
 
@@ -80,26 +108,120 @@ func (interceptor *AuthInterceptor) authorize(ctx context.Context, method string
 		return nil, nil
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return nil, status.Errorf(codes.Unauthenticated, "metadata is not provided")
-	}
+	md, _ := metadata.FromIncomingContext(ctx)
 	values := md["authorization"]
 	if len(values) == 0 {
-		return nil, status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+		claims, err := interceptor.certificateClaims(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return authorizeRole(claims, accessibleRoles)
 	}
 
-	accessToken := values[0]
+	accessToken := bearerToken(values[0])
 	claims, err := interceptor.jwtManager.Verify(accessToken)
 	if err != nil {
 		return nil, status.Errorf(codes.Unauthenticated, "access token is invalid: %v", err)
 	}
 
+	revoked, err := interceptor.revocationStore.IsRevoked(claims.ID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot check token revocation: %v", err)
+	}
+
+	if revoked {
+		return nil, status.Errorf(codes.Unauthenticated, "access token is revoked")
+	}
+
+	user, err := interceptor.userStore.Find(claims.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "user does not exist")
+	}
+
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "user is disabled")
+	}
+
+	// the stored role wins over the token so role changes apply right away
+	claims.Role = user.Role
+
+	return authorizeRole(claims, accessibleRoles)
+}
+
+func authorizeRole(claims *UserClaims, accessibleRoles []string) (*UserClaims, error) {
 	for _, role := range accessibleRoles {
 		if claims.Role == role {
 			return claims, nil
 		}
 	}
 
-	return nil, status.Errorf(codes.Unauthenticated, "no permission to access this RPC")
+	// the caller is authenticated, a new token would not have another role
+	return nil, status.Errorf(codes.PermissionDenied, "no permission to access this RPC")
+}
+
+// certificateClaims returns the claims of the client certificate of the call,
+// the username is its first identity with a role
+func (interceptor *AuthInterceptor) certificateClaims(ctx context.Context) (*UserClaims, error) {
+	certificate := peerCertificate(ctx)
+	if len(interceptor.certificateRoles) == 0 || certificate == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "authorization token is not provided")
+	}
+
+	for _, identity := range certificateIdentities(certificate) {
+		role, ok := interceptor.certificateRoles[identity]
+		if ok {
+			return &UserClaims{Username: CertificatePrincipalPrefix + identity, Role: role}, nil
+		}
+	}
+
+	return nil, status.Errorf(codes.Unauthenticated, "client certificate %q has no role", certificate.Subject.CommonName)
+}
+
+func peerCertificate(ctx context.Context) *x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return nil
+	}
+	return tlsInfo.State.PeerCertificates[0]
+}
+
+// certificateIdentities are the subject common name and the DNS, email and URI
+// SANs of the certificate, the SANs are prefixed with their type so a SAN
+// cannot match the identity of a common name. A common name with a colon is
+// left out, so it cannot pass for a SAN either.
+func certificateIdentities(certificate *x509.Certificate) []string {
+	identities := make([]string, 0)
+	if commonName := certificate.Subject.CommonName; commonName != "" && !strings.Contains(commonName, ":") {
+		identities = append(identities, certificate.Subject.CommonName)
+	}
+	for _, name := range certificate.DNSNames {
+		identities = append(identities, "dns:"+name)
+	}
+	for _, address := range certificate.EmailAddresses {
+		identities = append(identities, "email:"+address)
+	}
+	for _, uri := range certificate.URIs {
+		identities = append(identities, "uri:"+uri.String())
+	}
+	return identities
+}
+
+// bearerToken strips the optional "Bearer " scheme of an authorization value,
+// the REST gateway forwards the Authorization header with it
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return authorization
+	}
+
+	return strings.TrimSpace(token)
 }
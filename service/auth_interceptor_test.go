@@ -0,0 +1,293 @@
+package service_test
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/certs"
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// mtlsTestServer serves the test servers over mutual TLS, the client
+// certificates batch-job and the DNS SAN sync.example have the admin role and
+// reporter the user role. The user batch-job has the user role.
+type mtlsTestServer struct {
+	*testServers
+	listener  *service.PipeListener
+	authority *certs.Authority
+	caFile    string
+}
+
+func newMTLSTestServer(t *testing.T) *mtlsTestServer {
+	t.Helper()
+
+	authority, err := certs.NewAuthority("test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewAuthority: %v", err)
+	}
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := certs.WriteCertificate(caFile, authority.Certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+	certificate, key, err := authority.IssueServer("localhost", []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueServer: %v", err)
+	}
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	if err := certs.WriteKey(keyFile, key); err != nil {
+		t.Fatalf("WriteKey: %v", err)
+	}
+	if err := certs.WriteCertificate(certFile, certificate); err != nil {
+		t.Fatalf("WriteCertificate: %v", err)
+	}
+
+	tlsConfig, err := certs.NewServerConfig(certFile, keyFile, caFile, true)
+	if err != nil {
+		t.Fatalf("NewServerConfig: %v", err)
+	}
+
+	servers := newTestServers(t, newInMemoryAuthStores(), map[string]string{"batch-job": "user"})
+	interceptor := servers.interceptor(map[string][]string{
+		"/todoGoGrpc.TodoService/CreateTodo":     {"admin"},
+		"/todoGoGrpc.TodoService/GetTodo":        {"admin", "user"},
+		"/todoGoGrpc.AuthService/Logout":         {"admin", "user"},
+		"/todoGoGrpc.AuthService/ChangePassword": {"admin", "user"},
+		"/todoGoGrpc.AuthService/GetMe":          {"admin", "user"},
+	}, map[string]string{
+		"batch-job":         "admin",
+		"reporter":          "user",
+		"dns:sync.example":  "admin",
+		"dns:dns:batch-job": "admin",
+	})
+	listener := servers.serve(t, interceptor, grpc.Creds(credentials.NewTLS(tlsConfig)))
+
+	return &mtlsTestServer{servers, listener, authority, caFile}
+}
+
+// dial connects to the todo server with a client certificate of the common
+// name and DNS SANs, or without one when the common name is empty
+func (server *mtlsTestServer) dial(t *testing.T, commonName string, dnsNames ...string) pb.TodoServiceClient {
+	t.Helper()
+
+	return pb.NewTodoServiceClient(server.dialConn(t, commonName, dnsNames...))
+}
+
+func (server *mtlsTestServer) dialConn(t *testing.T, commonName string, dnsNames ...string) *grpc.ClientConn {
+	t.Helper()
+
+	clientConfig, err := certs.NewClientConfig(server.caFile, "", "", "localhost")
+	if err != nil {
+		t.Fatalf("NewClientConfig: %v", err)
+	}
+	if commonName != "" {
+		certificate, key, err := server.authority.IssueClient(commonName, time.Hour)
+		if len(dnsNames) > 0 {
+			certificate, key, err = server.authority.IssueServer(commonName, dnsNames, time.Hour)
+		}
+		if err != nil {
+			t.Fatalf("IssueClient: %v", err)
+		}
+		clientConfig.Certificates = []tls.Certificate{{
+			Certificate: [][]byte{certificate.Raw},
+			PrivateKey:  key,
+			Leaf:        certificate,
+		}}
+	}
+
+	cc, err := grpc.NewClient(
+		"passthrough:///localhost",
+		grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)),
+		grpc.WithContextDialer(server.listener.DialContext),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func TestAuthInterceptorClientCertificate(t *testing.T) {
+	server := newMTLSTestServer(t)
+	ctx := context.Background()
+
+	batchJob := server.dial(t, "batch-job")
+	id := uuid.NewString()
+	_, err := batchJob.CreateTodo(ctx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: id, Title: "nightly report"}})
+	if err != nil {
+		t.Fatalf("CreateTodo with an admin certificate: %v", err)
+	}
+
+	res, err := batchJob.GetTodo(ctx, &pb.GetTodoRequest{Id: id})
+	if err != nil {
+		t.Fatalf("GetTodo: %v", err)
+	}
+	if fromUser := res.GetTodo().GetFromUser(); fromUser != "cert:batch-job" {
+		t.Fatalf("from user = %q, want cert:batch-job", fromUser)
+	}
+
+	// the SAN matches its typed identity, the common name has no role
+	id = uuid.NewString()
+	_, err = server.dial(t, "sync", "sync.example").CreateTodo(ctx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: id}})
+	if err != nil {
+		t.Fatalf("CreateTodo with an admin SAN: %v", err)
+	}
+	res, err = server.dial(t, "sync", "sync.example").GetTodo(ctx, &pb.GetTodoRequest{Id: id})
+	if err != nil {
+		t.Fatalf("GetTodo: %v", err)
+	}
+	if fromUser := res.GetTodo().GetFromUser(); fromUser != "cert:dns:sync.example" {
+		t.Fatalf("from user = %q, want cert:dns:sync.example", fromUser)
+	}
+
+	tests := []struct {
+		name       string
+		commonName string
+		dnsNames   []string
+		want       codes.Code
+	}{
+		{"role without access", "reporter", nil, codes.PermissionDenied},
+		{"identity without role", "stranger", nil, codes.Unauthenticated},
+		{"SAN named like a common name", "stranger", []string{"batch-job"}, codes.Unauthenticated},
+		{"common name named like a SAN", "dns:batch-job", nil, codes.Unauthenticated},
+		{"no certificate", "", nil, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.dial(t, tt.commonName, tt.dnsNames...).CreateTodo(ctx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: uuid.NewString()}})
+			if status.Code(err) != tt.want {
+				t.Fatalf("CreateTodo error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthInterceptorTokenWinsOverClientCertificate(t *testing.T) {
+	server := newMTLSTestServer(t)
+	ctx := context.Background()
+
+	batchJob := server.dial(t, "batch-job")
+	id := uuid.NewString()
+	_, err := batchJob.CreateTodo(ctx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: id}})
+	if err != nil {
+		t.Fatalf("CreateTodo: %v", err)
+	}
+
+	// the certificate batch-job has the admin role, the token of the user
+	// batch-job the user role
+	token, _, err := service.NewJWTManager("secret", time.Minute).Generate(&service.User{Username: "batch-job", Role: "user"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	tokenCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+	_, err = batchJob.CreateTodo(tokenCtx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: uuid.NewString()}})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("CreateTodo with a user token error = %v, want PermissionDenied", err)
+	}
+
+	// the user batch-job is not the owner of the todos of the certificate
+	_, err = batchJob.GetTodo(tokenCtx, &pb.GetTodoRequest{Id: id})
+	if status.Code(err) == codes.OK {
+		t.Fatal("GetTodo with the token of the user batch-job got the todo of the certificate batch-job")
+	}
+}
+
+func TestAuthServerClientCertificateHasNoAccount(t *testing.T) {
+	server := newMTLSTestServer(t)
+	ctx := context.Background()
+
+	// the certificate batch-job is not the user batch-job, and has no access
+	// token to log out
+	cc := server.dialConn(t, "batch-job")
+	authClient := pb.NewAuthServiceClient(cc)
+
+	_, err := authClient.Logout(ctx, &pb.LogoutRequest{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("Logout error = %v, want FailedPrecondition", err)
+	}
+
+	_, err = authClient.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: "secret123", NewPassword: "changed123"})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("ChangePassword error = %v, want FailedPrecondition", err)
+	}
+
+	_, err = authClient.GetMe(ctx, &pb.GetMeRequest{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("GetMe error = %v, want FailedPrecondition", err)
+	}
+
+	user, err := server.userStore.Find("batch-job")
+	if err != nil {
+		t.Fatalf("Find user: %v", err)
+	}
+	if !user.IsCorrectPassword("secret123") {
+		t.Fatal("the certificate batch-job changed the password of the user batch-job")
+	}
+
+	// the server is still serving
+	_, err = pb.NewTodoServiceClient(cc).CreateTodo(ctx, &pb.CreateTodoRequest{Todo: &pb.Todo{Id: uuid.NewString()}})
+	if err != nil {
+		t.Fatalf("CreateTodo after Logout: %v", err)
+	}
+}
+
+func TestAuthInterceptorRoles(t *testing.T) {
+	servers := newTestServers(t, newInMemoryAuthStores(), map[string]string{"reporter": "user"})
+	interceptor := servers.interceptor(map[string][]string{
+		"/todoGoGrpc.TodoService/CreateTodo": {"admin"},
+		"/todoGoGrpc.TodoService/GetTodo":    {"admin", "user"},
+	}, nil)
+
+	user, err := servers.userStore.Find("reporter")
+	if err != nil {
+		t.Fatalf("Find user: %v", err)
+	}
+	token, _, err := servers.jwtManager.Generate(user)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	call := func(method string, token string) error {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", token))
+		}
+
+		_, err := interceptor.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return nil, nil
+		})
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   codes.Code
+	}{
+		{"role with access", "/todoGoGrpc.TodoService/GetTodo", token, codes.OK},
+		{"role without access", "/todoGoGrpc.TodoService/CreateTodo", token, codes.PermissionDenied},
+		{"invalid token", "/todoGoGrpc.TodoService/GetTodo", "not a token", codes.Unauthenticated},
+		{"no token", "/todoGoGrpc.TodoService/GetTodo", "", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := call(tt.method, tt.token)
+			if status.Code(err) != tt.want {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,22 +2,40 @@ package service
 
 import (
 	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type AuthServer struct {
 	pb.UnimplementedAuthServiceServer
-	jwtManager *JWTManager
-	userStore  UserStore
+	jwtManager           *JWTManager
+	userStore            UserStore
+	refreshTokenStore    RefreshTokenStore
+	revocationStore      RevocationStore
+	refreshTokenDuration time.Duration
 }
 
-func NewAuthServer(jwtManager *JWTManager, userStore UserStore) *AuthServer {
+func NewAuthServer(
+	jwtManager *JWTManager,
+	userStore UserStore,
+	refreshTokenStore RefreshTokenStore,
+	revocationStore RevocationStore,
+	refreshTokenDuration time.Duration,
+) *AuthServer {
 	return &AuthServer{
-		jwtManager: jwtManager,
-		userStore:  userStore,
+		jwtManager:           jwtManager,
+		userStore:            userStore,
+		refreshTokenStore:    refreshTokenStore,
+		revocationStore:      revocationStore,
+		refreshTokenDuration: refreshTokenDuration,
 	}
 }
 
@@ -37,11 +55,368 @@ func (server *AuthServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.
 		return nil, status.Errorf(codes.InvalidArgument, "incorrect username/password")
 	}
 
-	token, err := server.jwtManager.Generate(user)
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "user is disabled")
+	}
+
+	familyID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate token family id: %v", err)
+	}
+
+	tokens, err := server.generateTokens(user, familyID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.LoginResponse{
+		AccessToken:           tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		AccessTokenExpiresAt:  tokens.AccessTokenExpiresAt,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+	}
+	return res, nil
+}
+
+// RefreshToken rotates the refresh token, presenting an already used refresh
+// token revokes every token rotated from the same login
+func (server *AuthServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	if req.GetRefreshToken() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "refresh token is required")
+	}
+
+	// the token is revoked before anything else, so a token presented twice at
+	// the same time is seen as reused by one of the calls
+	refreshToken, err := server.refreshTokenStore.Consume(HashRefreshToken(req.GetRefreshToken()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot consume refresh token: %v", err)
+	}
+
+	if refreshToken == nil || refreshToken.ExpiresAt.Before(time.Now()) {
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token is invalid")
+	}
+
+	if refreshToken.Revoked {
+		err := server.refreshTokenStore.RevokeFamily(refreshToken.FamilyID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+		}
+
+		log.Printf("revoked refresh tokens of user %s after a token reuse", refreshToken.Username)
+		return nil, status.Errorf(codes.Unauthenticated, "refresh token is revoked")
+	}
+
+	user, err := server.userStore.Find(refreshToken.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.Unauthenticated, "user does not exist")
+	}
+
+	if user.Disabled {
+		return nil, status.Errorf(codes.PermissionDenied, "user is disabled")
+	}
+
+	tokens, err := server.generateTokens(user, refreshToken.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (server *AuthServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	userClaims, err := accessTokenClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.revocationStore.Revoke(userClaims.ID, userClaims.ExpiresAt.Time)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot revoke access token: %v", err)
+	}
+
+	if req.GetRefreshToken() != "" {
+		refreshToken, err := server.refreshTokenStore.Find(HashRefreshToken(req.GetRefreshToken()))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot find refresh token: %v", err)
+		}
+
+		if refreshToken != nil && refreshToken.Username == userClaims.Username {
+			err := server.refreshTokenStore.RevokeFamily(refreshToken.FamilyID)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+			}
+		}
+	}
+
+	log.Printf("logged out user: %s", userClaims.Username)
+	return &pb.LogoutResponse{}, nil
+}
+
+// generateTokens generates an access token and a refresh token of the family
+func (server *AuthServer) generateTokens(user *User, familyID string) (*pb.RefreshTokenResponse, error) {
+	accessToken, claims, err := server.jwtManager.Generate(user)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "cannot generate access token")
 	}
 
-	res := &pb.LoginResponse{AccessToken: token}
+	value, err := NewRefreshTokenValue()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate refresh token")
+	}
+
+	refreshToken := &RefreshToken{
+		Hash:      HashRefreshToken(value),
+		Username:  user.Username,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(server.refreshTokenDuration),
+	}
+	err = server.refreshTokenStore.Save(refreshToken)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot save refresh token: %v", err)
+	}
+
+	res := &pb.RefreshTokenResponse{
+		AccessToken:           accessToken,
+		RefreshToken:          value,
+		AccessTokenExpiresAt:  timestamppb.New(claims.ExpiresAt.Time),
+		RefreshTokenExpiresAt: timestamppb.New(refreshToken.ExpiresAt),
+	}
 	return res, nil
 }
+
+func (server *AuthServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	username := req.GetUsername()
+	password := req.GetPassword()
+	if username == "" || password == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "username and password are required")
+	}
+
+	user, err := NewUser(username, password, "user")
+	if err != nil {
+		return nil, userError(err, "cannot create user")
+	}
+
+	err = server.userStore.Save(user)
+	if err != nil {
+		return nil, userError(err, "cannot save user")
+	}
+
+	log.Printf("registered user: %s", user.Username)
+
+	res := &pb.RegisterResponse{User: toPbUserInfo(user)}
+	return res, nil
+}
+
+func (server *AuthServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	user, err := server.findCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsCorrectPassword(req.GetOldPassword()) {
+		return nil, status.Errorf(codes.InvalidArgument, "incorrect password")
+	}
+
+	err = user.SetPassword(req.GetNewPassword())
+	if err != nil {
+		return nil, userError(err, "cannot change password")
+	}
+
+	err = server.userStore.Update(user)
+	if err != nil {
+		return nil, userError(err, "cannot update user")
+	}
+
+	// whoever had the old password may hold a refresh token
+	err = server.refreshTokenStore.RevokeUser(user.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+	}
+
+	log.Printf("changed password of user: %s", user.Username)
+	return &pb.ChangePasswordResponse{}, nil
+}
+
+func (server *AuthServer) GetMe(ctx context.Context, req *pb.GetMeRequest) (*pb.GetMeResponse, error) {
+	user, err := server.findCurrentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.GetMeResponse{User: toPbUserInfo(user)}
+	return res, nil
+}
+
+func (server *AuthServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	users, err := server.userStore.List()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot list users: %v", err)
+	}
+
+	res := &pb.ListUsersResponse{
+		Users: make([]*pb.UserInfo, 0, len(users)),
+	}
+	for _, user := range users {
+		res.Users = append(res.Users, toPbUserInfo(user))
+	}
+	return res, nil
+}
+
+func (server *AuthServer) SetUserRole(ctx context.Context, req *pb.SetUserRoleRequest) (*pb.SetUserRoleResponse, error) {
+	if !IsValidRole(req.GetRole()) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown role: %s", req.GetRole())
+	}
+
+	user, err := server.findOtherUser(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = req.GetRole()
+	err = server.userStore.Update(user)
+	if err != nil {
+		return nil, userError(err, "cannot update user")
+	}
+
+	log.Printf("set role of user %s to %s", user.Username, user.Role)
+
+	res := &pb.SetUserRoleResponse{User: toPbUserInfo(user)}
+	return res, nil
+}
+
+func (server *AuthServer) DisableUser(ctx context.Context, req *pb.DisableUserRequest) (*pb.DisableUserResponse, error) {
+	user, err := server.findOtherUser(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	user.Disabled = !req.GetEnable()
+	err = server.userStore.Update(user)
+	if err != nil {
+		return nil, userError(err, "cannot update user")
+	}
+
+	// enabling the user again does not bring back the sessions
+	if user.Disabled {
+		err = server.refreshTokenStore.RevokeUser(user.Username)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot revoke refresh tokens: %v", err)
+		}
+	}
+
+	log.Printf("set disabled of user %s to %t", user.Username, user.Disabled)
+
+	res := &pb.DisableUserResponse{User: toPbUserInfo(user)}
+	return res, nil
+}
+
+func (server *AuthServer) GetJwks(ctx context.Context, req *pb.GetJwksRequest) (*pb.GetJwksResponse, error) {
+	keySet := server.jwtManager.JWKS()
+
+	res := &pb.GetJwksResponse{
+		Keys: make([]*pb.JsonWebKey, 0, len(keySet.Keys)),
+	}
+	for _, key := range keySet.Keys {
+		res.Keys = append(res.Keys, &pb.JsonWebKey{
+			Kty: key.KeyType,
+			Kid: key.KeyID,
+			Use: key.Use,
+			Alg: key.Algorithm,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+	return res, nil
+}
+
+// accessTokenClaims returns the claims of the access token of the request, a
+// request authenticated by a client certificate has no token to revoke
+func accessTokenClaims(ctx context.Context) (*UserClaims, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	if userClaims.ID == "" || userClaims.ExpiresAt == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "request is not authenticated by an access token")
+	}
+
+	return userClaims, nil
+}
+
+// findCurrentUser finds the user who sent the request, a client certificate
+// principal is not a user
+func (server *AuthServer) findCurrentUser(ctx context.Context) (*User, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	if strings.HasPrefix(userClaims.Username, CertificatePrincipalPrefix) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s is a client certificate, not a user", userClaims.Username)
+	}
+
+	user, err := server.userStore.Find(userClaims.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "cannot find user: %s", userClaims.Username)
+	}
+
+	return user, nil
+}
+
+// findOtherUser finds a user managed by the sender of the request, admins
+// cannot manage themselves so they cannot lock themselves out
+func (server *AuthServer) findOtherUser(ctx context.Context, username string) (*User, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	if username == userClaims.Username {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot change your own account")
+	}
+
+	user, err := server.userStore.Find(username)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot find user: %v", err)
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "cannot find user: %s", username)
+	}
+
+	return user, nil
+}
+
+func userError(err error, message string) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrWeakPassword), errors.Is(err, ErrInvalidUsername):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrAlreadyExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, ErrNotFound):
+		code = codes.NotFound
+	}
+
+	return status.Errorf(code, "%s: %v", message, err)
+}
+
+func toPbUserInfo(user *User) *pb.UserInfo {
+	return &pb.UserInfo{
+		Username: user.Username,
+		Role:     user.Role,
+		Disabled: user.Disabled,
+	}
+}
@@ -0,0 +1,411 @@
+package service_test
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authStoreKinds are the stores the auth server tests run against
+var authStoreKinds = []struct {
+	name      string
+	newStores func(t *testing.T) authStores
+}{
+	{"InMemory", func(*testing.T) authStores { return newInMemoryAuthStores() }},
+	{"Bolt", func(t *testing.T) authStores {
+		db := newTestBoltDB(t)
+		return authStores{
+			userStore:         service.NewBoltUserStore(db),
+			refreshTokenStore: service.NewBoltRefreshTokenStore(db),
+			revocationStore:   service.NewBoltRevocationStore(db),
+		}
+	}},
+}
+
+// authTestServer serves an auth server with the admin philly and the users
+// alice and bob, with the roles of the auth service of the server command
+type authTestServer struct {
+	*testServers
+	client pb.AuthServiceClient
+}
+
+func newAuthTestServer(t *testing.T, stores authStores) *authTestServer {
+	t.Helper()
+
+	servers := newTestServers(t, stores, map[string]string{"philly": "admin", "alice": "user", "bob": "user"})
+
+	const authServicePath = "/todoGoGrpc.AuthService/"
+	listener := servers.serve(t, servers.interceptor(map[string][]string{
+		authServicePath + "Logout":         {"admin", "user"},
+		authServicePath + "ChangePassword": {"admin", "user"},
+		authServicePath + "GetMe":          {"admin", "user"},
+		authServicePath + "ListUsers":      {"admin"},
+		authServicePath + "SetUserRole":    {"admin"},
+		authServicePath + "DisableUser":    {"admin"},
+	}, nil))
+
+	cc, err := grpc.NewClient(
+		"passthrough:///auth",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(listener.DialContext),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+
+	return &authTestServer{servers, pb.NewAuthServiceClient(cc)}
+}
+
+// login logs in with the password secret123 of the test users
+func (server *authTestServer) login(t *testing.T, username string) *pb.LoginResponse {
+	t.Helper()
+
+	res, err := server.client.Login(context.Background(), &pb.LoginRequest{Username: username, Password: "secret123"})
+	if err != nil {
+		t.Fatalf("Login %s: %v", username, err)
+	}
+	return res
+}
+
+// withAccessToken returns a context sending the access token
+func withAccessToken(accessToken string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+accessToken)
+}
+
+func TestAuthServerRefreshTokenRotation(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			ctx := context.Background()
+			login := server.login(t, "alice")
+
+			rotated, err := server.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+			if err != nil {
+				t.Fatalf("RefreshToken: %v", err)
+			}
+			if rotated.GetRefreshToken() == login.GetRefreshToken() {
+				t.Fatal("RefreshToken returned the refresh token of the request")
+			}
+
+			me, err := server.client.GetMe(withAccessToken(rotated.GetAccessToken()), &pb.GetMeRequest{})
+			if err != nil {
+				t.Fatalf("GetMe with the rotated access token: %v", err)
+			}
+			if me.GetUser().GetUsername() != "alice" {
+				t.Fatalf("GetMe user = %q, want alice", me.GetUser().GetUsername())
+			}
+
+			// the rotated refresh token is used again, the family is revoked
+			_, err = server.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("RefreshToken with a used refresh token error = %v, want Unauthenticated", err)
+			}
+			_, err = server.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: rotated.GetRefreshToken()})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("RefreshToken with the last refresh token of a revoked family error = %v, want Unauthenticated", err)
+			}
+
+			// other logins are other families
+			other := server.login(t, "alice")
+			_, err = server.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: other.GetRefreshToken()})
+			if err != nil {
+				t.Fatalf("RefreshToken of another login: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerLogout(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			login := server.login(t, "alice")
+			other := server.login(t, "alice")
+			ctx := withAccessToken(login.GetAccessToken())
+
+			if _, err := server.client.GetMe(ctx, &pb.GetMeRequest{}); err != nil {
+				t.Fatalf("GetMe before Logout: %v", err)
+			}
+
+			_, err := server.client.Logout(ctx, &pb.LogoutRequest{RefreshToken: login.GetRefreshToken()})
+			if err != nil {
+				t.Fatalf("Logout: %v", err)
+			}
+
+			_, err = server.client.GetMe(ctx, &pb.GetMeRequest{})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("GetMe after Logout error = %v, want Unauthenticated", err)
+			}
+			_, err = server.client.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("RefreshToken after Logout error = %v, want Unauthenticated", err)
+			}
+
+			// the other login is not logged out
+			if _, err := server.client.GetMe(withAccessToken(other.GetAccessToken()), &pb.GetMeRequest{}); err != nil {
+				t.Fatalf("GetMe of another login: %v", err)
+			}
+			_, err = server.client.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: other.GetRefreshToken()})
+			if err != nil {
+				t.Fatalf("RefreshToken of another login: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerChangePasswordAndDisableUserRevokeRefreshTokens(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			ctx := context.Background()
+			refresh := func(login *pb.LoginResponse) error {
+				_, err := server.client.RefreshToken(ctx, &pb.RefreshTokenRequest{RefreshToken: login.GetRefreshToken()})
+				return err
+			}
+
+			alice := server.login(t, "alice")
+			otherAlice := server.login(t, "alice")
+			bob := server.login(t, "bob")
+
+			_, err := server.client.ChangePassword(withAccessToken(alice.GetAccessToken()), &pb.ChangePasswordRequest{OldPassword: "secret123", NewPassword: "changed123"})
+			if err != nil {
+				t.Fatalf("ChangePassword: %v", err)
+			}
+			for _, login := range []*pb.LoginResponse{alice, otherAlice} {
+				if err := refresh(login); status.Code(err) != codes.Unauthenticated {
+					t.Fatalf("RefreshToken after ChangePassword error = %v, want Unauthenticated", err)
+				}
+			}
+
+			philly := server.login(t, "philly")
+			_, err = server.client.DisableUser(withAccessToken(philly.GetAccessToken()), &pb.DisableUserRequest{Username: "bob"})
+			if err != nil {
+				t.Fatalf("DisableUser: %v", err)
+			}
+			_, err = server.client.DisableUser(withAccessToken(philly.GetAccessToken()), &pb.DisableUserRequest{Username: "bob", Enable: true})
+			if err != nil {
+				t.Fatalf("DisableUser to enable: %v", err)
+			}
+			// the sessions stay revoked when the user is enabled again
+			if err := refresh(bob); status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("RefreshToken after DisableUser error = %v, want Unauthenticated", err)
+			}
+
+			if err := refresh(philly); err != nil {
+				t.Fatalf("RefreshToken of another user: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerRegister(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+
+			tests := []struct {
+				name     string
+				username string
+				password string
+				want     codes.Code
+			}{
+				{"valid", "carol", "sunflower42", codes.OK},
+				{"duplicate username", "alice", "another42", codes.AlreadyExists},
+				{"short username", "ca", "sunflower42", codes.InvalidArgument},
+				{"username with spaces", "carol smith", "sunflower42", codes.InvalidArgument},
+				{"no password", "dave", "", codes.InvalidArgument},
+				{"short password", "dave", "abc12", codes.InvalidArgument},
+				{"password without digits", "dave", "abcdefghij", codes.InvalidArgument},
+				{"password with the username", "dave", "dave12345", codes.InvalidArgument},
+				{"over-long password", "dave", strings.Repeat("a1", 37), codes.InvalidArgument},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					res, err := server.client.Register(context.Background(), &pb.RegisterRequest{Username: tt.username, Password: tt.password})
+					if status.Code(err) != tt.want {
+						t.Fatalf("Register error = %v, want %v", err, tt.want)
+					}
+					if err != nil {
+						return
+					}
+
+					if res.GetUser().GetUsername() != tt.username || res.GetUser().GetRole() != "user" {
+						t.Fatalf("Register user = %v, want %s with the role user", res.GetUser(), tt.username)
+					}
+					login, err := server.client.Login(context.Background(), &pb.LoginRequest{Username: tt.username, Password: tt.password})
+					if err != nil {
+						t.Fatalf("Login of the registered user: %v", err)
+					}
+					if _, err := server.client.GetMe(withAccessToken(login.GetAccessToken()), &pb.GetMeRequest{}); err != nil {
+						t.Fatalf("GetMe of the registered user: %v", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestAuthServerChangePassword(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			ctx := withAccessToken(server.login(t, "alice").GetAccessToken())
+
+			tests := []struct {
+				name        string
+				oldPassword string
+				newPassword string
+				want        codes.Code
+			}{
+				{"incorrect old password", "wrong123", "changed123", codes.InvalidArgument},
+				{"weak new password", "secret123", "short1", codes.InvalidArgument},
+				{"over-long new password", "secret123", strings.Repeat("a1", 37), codes.InvalidArgument},
+				{"new password with the username", "secret123", "alice12345", codes.InvalidArgument},
+				{"valid", "secret123", "changed123", codes.OK},
+			}
+			for _, tt := range tests {
+				_, err := server.client.ChangePassword(ctx, &pb.ChangePasswordRequest{OldPassword: tt.oldPassword, NewPassword: tt.newPassword})
+				if status.Code(err) != tt.want {
+					t.Fatalf("ChangePassword with %s error = %v, want %v", tt.name, err, tt.want)
+				}
+			}
+
+			_, err := server.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret123"})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Login with the old password error = %v, want InvalidArgument", err)
+			}
+			_, err = server.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "changed123"})
+			if err != nil {
+				t.Fatalf("Login with the new password: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerAdminOnly(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			ctx := withAccessToken(server.login(t, "alice").GetAccessToken())
+
+			_, err := server.client.ListUsers(ctx, &pb.ListUsersRequest{})
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("ListUsers as a user error = %v, want PermissionDenied", err)
+			}
+			_, err = server.client.SetUserRole(ctx, &pb.SetUserRoleRequest{Username: "bob", Role: "admin"})
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("SetUserRole as a user error = %v, want PermissionDenied", err)
+			}
+			_, err = server.client.DisableUser(ctx, &pb.DisableUserRequest{Username: "bob"})
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("DisableUser as a user error = %v, want PermissionDenied", err)
+			}
+
+			_, err = server.client.ListUsers(context.Background(), &pb.ListUsersRequest{})
+			if status.Code(err) != codes.Unauthenticated {
+				t.Fatalf("ListUsers without a token error = %v, want Unauthenticated", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerListUsersAndSetUserRole(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			admin := withAccessToken(server.login(t, "philly").GetAccessToken())
+			bob := withAccessToken(server.login(t, "bob").GetAccessToken())
+
+			res, err := server.client.ListUsers(admin, &pb.ListUsersRequest{})
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			roles := make(map[string]string)
+			for _, user := range res.GetUsers() {
+				roles[user.GetUsername()] = user.GetRole()
+			}
+			want := map[string]string{"philly": "admin", "alice": "user", "bob": "user"}
+			if !maps.Equal(roles, want) {
+				t.Fatalf("ListUsers roles = %v, want %v", roles, want)
+			}
+
+			_, err = server.client.SetUserRole(admin, &pb.SetUserRoleRequest{Username: "bob", Role: "owner"})
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("SetUserRole to an unknown role error = %v, want InvalidArgument", err)
+			}
+			_, err = server.client.SetUserRole(admin, &pb.SetUserRoleRequest{Username: "carol", Role: "admin"})
+			if status.Code(err) != codes.NotFound {
+				t.Fatalf("SetUserRole of an unknown user error = %v, want NotFound", err)
+			}
+			_, err = server.client.SetUserRole(admin, &pb.SetUserRoleRequest{Username: "philly", Role: "user"})
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("SetUserRole of the admin itself error = %v, want FailedPrecondition", err)
+			}
+
+			set, err := server.client.SetUserRole(admin, &pb.SetUserRoleRequest{Username: "bob", Role: "admin"})
+			if err != nil {
+				t.Fatalf("SetUserRole: %v", err)
+			}
+			if set.GetUser().GetRole() != "admin" {
+				t.Fatalf("SetUserRole user = %v, want the role admin", set.GetUser())
+			}
+
+			// the role applies to the access token bob already has
+			if _, err := server.client.ListUsers(bob, &pb.ListUsersRequest{}); err != nil {
+				t.Fatalf("ListUsers as the promoted bob: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthServerDisableUser(t *testing.T) {
+	for _, kind := range authStoreKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			server := newAuthTestServer(t, kind.newStores(t))
+			admin := withAccessToken(server.login(t, "philly").GetAccessToken())
+			alice := withAccessToken(server.login(t, "alice").GetAccessToken())
+
+			_, err := server.client.DisableUser(admin, &pb.DisableUserRequest{Username: "philly"})
+			if status.Code(err) != codes.FailedPrecondition {
+				t.Fatalf("DisableUser of the admin itself error = %v, want FailedPrecondition", err)
+			}
+
+			res, err := server.client.DisableUser(admin, &pb.DisableUserRequest{Username: "alice"})
+			if err != nil {
+				t.Fatalf("DisableUser: %v", err)
+			}
+			if !res.GetUser().GetDisabled() {
+				t.Fatalf("DisableUser user = %v, want disabled", res.GetUser())
+			}
+
+			_, err = server.client.Login(context.Background(), &pb.LoginRequest{Username: "alice", Password: "secret123"})
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("Login of a disabled user error = %v, want PermissionDenied", err)
+			}
+			// the interceptor refuses the access token alice already has
+			_, err = server.client.GetMe(alice, &pb.GetMeRequest{})
+			if status.Code(err) != codes.PermissionDenied {
+				t.Fatalf("GetMe of a disabled user error = %v, want PermissionDenied", err)
+			}
+
+			_, err = server.client.DisableUser(admin, &pb.DisableUserRequest{Username: "alice", Enable: true})
+			if err != nil {
+				t.Fatalf("DisableUser to enable: %v", err)
+			}
+			if _, err := server.client.GetMe(alice, &pb.GetMeRequest{}); err != nil {
+				t.Fatalf("GetMe of an enabled user: %v", err)
+			}
+			server.login(t, "alice")
+		})
+	}
+}
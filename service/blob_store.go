@@ -0,0 +1,188 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrPresignNotSupported is returned by the blob stores that cannot give out
+// download URLs
+var ErrPresignNotSupported = errors.New("blob store does not support presigned URLs")
+
+// BlobStore stores data under slash separated keys, like a file system or an
+// object storage bucket
+type BlobStore interface {
+	// Put stores the data under the key, replacing the blob stored under it, the
+	// size is -1 when it is unknown
+	Put(key string, data io.Reader, size int64) error
+	// Get returns a reader of the blob, the caller must close it, it returns
+	// ErrNotFound when there is no blob with the key
+	Get(key string) (io.ReadCloser, error)
+	// Delete deletes the blob, deleting a missing blob is not an error
+	Delete(key string) error
+	// List returns the keys starting with the prefix in lexical order
+	List(prefix string) ([]string, error)
+	// PresignGet returns a URL the blob can be downloaded from without
+	// credentials until the expiry
+	PresignGet(key string, expiry time.Duration) (string, error)
+}
+
+// FileBlobStore stores every blob in a file of its folder
+type FileBlobStore struct {
+	folder string
+}
+
+// fileBlobTmpFolder holds the files being written, it is not a valid key
+const fileBlobTmpFolder = ".tmp"
+
+func NewFileBlobStore(folder string) (*FileBlobStore, error) {
+	tmpFolder := filepath.Join(folder, fileBlobTmpFolder)
+	err := os.MkdirAll(tmpFolder, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create blob folder: %w", err)
+	}
+
+	// files left by a crash while they were written
+	entries, err := os.ReadDir(tmpFolder)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read blob folder: %w", err)
+	}
+	for _, entry := range entries {
+		os.Remove(filepath.Join(tmpFolder, entry.Name()))
+	}
+
+	return &FileBlobStore{folder: folder}, nil
+}
+
+func (store *FileBlobStore) Put(key string, data io.Reader, size int64) error {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Join(store.folder, fileBlobTmpFolder), "blob-*")
+	if err != nil {
+		return fmt.Errorf("cannot create blob file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write blob file: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create blob folder: %w", err)
+	}
+
+	// the blob is renamed into place so readers never see a partial blob
+	err = os.Rename(file.Name(), blobPath)
+	if err != nil {
+		return fmt.Errorf("cannot save blob file: %w", err)
+	}
+
+	return nil
+}
+
+func (store *FileBlobStore) Get(key string) (io.ReadCloser, error) {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(blobPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open blob file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (store *FileBlobStore) Delete(key string) error {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(blobPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete blob file: %w", err)
+	}
+
+	return nil
+}
+
+func (store *FileBlobStore) List(prefix string) ([]string, error) {
+	// only the folder of the prefix can hold its keys
+	root := store.folder
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		var err error
+		root, err = store.path(prefix[:i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob prefix: %q", prefix)
+		}
+	}
+
+	keys := make([]string, 0)
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(store.folder, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(name)
+
+		if entry.IsDir() {
+			if key == fileBlobTmpFolder {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) && root != store.folder {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot list blobs: %w", err)
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (store *FileBlobStore) PresignGet(key string, expiry time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// path returns the file of the key, keys cannot leave the folder
+func (store *FileBlobStore) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." || path.IsAbs(key) || path.Clean(key) != key || strings.HasPrefix(key, "../") ||
+		strings.ContainsAny(key, "\\\x00") || strings.HasPrefix(key, fileBlobTmpFolder+"/") {
+		return "", fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	return filepath.Join(store.folder, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/s3test"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestFileBlobStore(t *testing.T) {
+	storetest.RunBlobStoreTests(t, func(t *testing.T) service.BlobStore {
+		store, err := service.NewFileBlobStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileBlobStore: %v", err)
+		}
+
+		return store
+	})
+}
+
+func TestFileBlobStoreRejectsKeysOutsideFolder(t *testing.T) {
+	store, err := service.NewFileBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+
+	for _, key := range []string{"", "..", "../escape", "a/../../escape", "/absolute", ".tmp/blob"} {
+		if err := store.Put(key, strings.NewReader("data"), 4); err == nil {
+			t.Errorf("Put %q: got no error", key)
+		}
+	}
+
+	for _, prefix := range []string{"../", "../escape/", "a/../../escape/", "/absolute/"} {
+		if _, err := store.List(prefix); err == nil {
+			t.Errorf("List %q: got no error", prefix)
+		}
+	}
+
+	if _, err := store.PresignGet("blob", time.Minute); !errors.Is(err, service.ErrPresignNotSupported) {
+		t.Fatalf("PresignGet: got %v, want %v", err, service.ErrPresignNotSupported)
+	}
+}
+
+func TestS3BlobStore(t *testing.T) {
+	storetest.RunBlobStoreTests(t, func(t *testing.T) service.BlobStore {
+		return newTestS3BlobStore(t)
+	})
+}
+
+func TestS3BlobStoreMultipartUpload(t *testing.T) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+	store := newTestS3BlobStoreOn(t, server)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (service.MinS3PartSize*2+100)/16)
+	if err := store.Put("large", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if got := server.CompletedMultipartUploads(); got != 1 {
+		t.Fatalf("multipart uploads: got %d, want 1", got)
+	}
+
+	reader, err := store.Get("large")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer reader.Close()
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read blob: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get: got %d bytes, want the %d bytes put", len(got), len(data))
+	}
+}
+
+func TestS3BlobStorePresignGet(t *testing.T) {
+	store := newTestS3BlobStore(t)
+	if err := store.Put("blob", strings.NewReader("data"), 4); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	url, err := store.PresignGet("blob", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGet: %v", err)
+	}
+	if !strings.Contains(url, "X-Amz-Signature=") {
+		t.Fatalf("PresignGet: got URL %s, want a signed URL", url)
+	}
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET presigned URL: %v", err)
+	}
+	defer res.Body.Close()
+
+	got, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(got) != "data" {
+		t.Fatalf("GET presigned URL: got %d %q, want 200 %q", res.StatusCode, got, "data")
+	}
+}
+
+func newTestS3BlobStore(t *testing.T) *service.S3BlobStore {
+	t.Helper()
+
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+
+	return newTestS3BlobStoreOn(t, server)
+}
+
+func newTestS3BlobStoreOn(t *testing.T, server *s3test.Server) *service.S3BlobStore {
+	t.Helper()
+
+	client, err := minio.New(server.Endpoint(), &minio.Options{
+		Creds:        credentials.NewStaticV4("access", "secret", ""),
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatalf("cannot create S3 client: %v", err)
+	}
+
+	store, err := service.NewS3BlobStore(client, "images", service.MinS3PartSize)
+	if err != nil {
+		t.Fatalf("NewS3BlobStore: %v", err)
+	}
+
+	return store
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket          = []byte("meta")
+	todosBucket         = []byte("todos")
+	todosByUserBucket   = []byte("todos_by_user")
+	feedbacksBucket     = []byte("feedbacks")
+	usersBucket         = []byte("users")
+	refreshTokensBucket = []byte("refresh_tokens")
+	revokedTokensBucket = []byte("revoked_tokens")
+	sharesBucket        = []byte("shares")
+	sharesByUserBucket  = []byte("shares_by_user")
+
+	webhooksBucket                   = []byte("webhooks")
+	webhookDeliveriesBucket          = []byte("webhook_deliveries")
+	webhookDeliveriesByWebhookBucket = []byte("webhook_deliveries_by_webhook")
+
+	// the expiry indexes are keyed by expiry time and then the key of the
+	// record, so expired records are found without a scan
+	refreshTokensByExpiryBucket = []byte("refresh_tokens_by_expiry")
+	revokedTokensByExpiryBucket = []byte("revoked_tokens_by_expiry")
+
+	// the family and user indexes are keyed by family or username and then
+	// token hash
+	refreshTokensByFamilyBucket = []byte("refresh_tokens_by_family")
+	refreshTokensByUserBucket   = []byte("refresh_tokens_by_user")
+
+	// the order index is keyed by user, order field, field value and todo ID,
+	// see todoOrderKey
+	todosByOrderBucket = []byte("todos_by_order")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// boltMigrations upgrade the schema of the database one version at a time,
+// the schema version is the number of migrations applied. Records are stored
+// as JSON, so new fields do not need a migration unless they must be backfilled.
+// Migrations are only ever appended to this list.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	// 1: initial schema
+	func(tx *bolt.Tx) error {
+		return createBuckets(tx, todosBucket, todosByUserBucket, feedbacksBucket, usersBucket)
+	},
+	// 2: refresh tokens and revoked access tokens
+	func(tx *bolt.Tx) error {
+		return createBuckets(tx, refreshTokensBucket, revokedTokensBucket)
+	},
+	// 3: todo shares
+	func(tx *bolt.Tx) error {
+		return createBuckets(tx, sharesBucket, sharesByUserBucket)
+	},
+	// 4: webhooks and their delivery log
+	func(tx *bolt.Tx) error {
+		return createBuckets(tx, webhooksBucket, webhookDeliveriesBucket, webhookDeliveriesByWebhookBucket)
+	},
+	// 5: expiry indexes of the refresh tokens and revoked access tokens
+	func(tx *bolt.Tx) error {
+		err := createBuckets(tx, refreshTokensByExpiryBucket, revokedTokensByExpiryBucket)
+		if err != nil {
+			return err
+		}
+
+		refreshTokensByExpiry := tx.Bucket(refreshTokensByExpiryBucket)
+		err = tx.Bucket(refreshTokensBucket).ForEach(func(key, data []byte) error {
+			token := &RefreshToken{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return fmt.Errorf("cannot decode refresh token: %w", err)
+			}
+			return refreshTokensByExpiry.Put(expiryKey(token.ExpiresAt, key), nil)
+		})
+		if err != nil {
+			return err
+		}
+
+		revokedTokensByExpiry := tx.Bucket(revokedTokensByExpiryBucket)
+		return tx.Bucket(revokedTokensBucket).ForEach(func(key, data []byte) error {
+			expiresAt, err := time.Parse(time.RFC3339Nano, string(data))
+			if err != nil {
+				return fmt.Errorf("cannot decode token expiry: %w", err)
+			}
+			return revokedTokensByExpiry.Put(expiryKey(expiresAt, key), nil)
+		})
+	},
+	// 6: family index of the refresh tokens
+	func(tx *bolt.Tx) error {
+		err := createBuckets(tx, refreshTokensByFamilyBucket)
+		if err != nil {
+			return err
+		}
+
+		refreshTokensByFamily := tx.Bucket(refreshTokensByFamilyBucket)
+		return tx.Bucket(refreshTokensBucket).ForEach(func(key, data []byte) error {
+			token := &RefreshToken{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return fmt.Errorf("cannot decode refresh token: %w", err)
+			}
+			return refreshTokensByFamily.Put(indexKey(token.FamilyID, string(key)), nil)
+		})
+	},
+	// 7: user index of the refresh tokens
+	func(tx *bolt.Tx) error {
+		err := createBuckets(tx, refreshTokensByUserBucket)
+		if err != nil {
+			return err
+		}
+
+		refreshTokensByUser := tx.Bucket(refreshTokensByUserBucket)
+		return tx.Bucket(refreshTokensBucket).ForEach(func(key, data []byte) error {
+			token := &RefreshToken{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return fmt.Errorf("cannot decode refresh token: %w", err)
+			}
+			return refreshTokensByUser.Put(indexKey(token.Username, string(key)), nil)
+		})
+	},
+	// 8: order index of the todos
+	func(tx *bolt.Tx) error {
+		err := createBuckets(tx, todosByOrderBucket)
+		if err != nil {
+			return err
+		}
+
+		todosByOrder := tx.Bucket(todosByOrderBucket)
+		return tx.Bucket(todosBucket).ForEach(func(_, data []byte) error {
+			todo := &Todo{}
+			if err := json.Unmarshal(data, todo); err != nil {
+				return fmt.Errorf("cannot decode todo: %w", err)
+			}
+			return putTodoOrderKeys(todosByOrder, todo)
+		})
+	},
+}
+
+// OpenBoltDB opens the database file and migrates its schema to the latest version
+func OpenBoltDB(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %w", err)
+	}
+
+	err = migrateBoltDB(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func migrateBoltDB(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return fmt.Errorf("cannot create meta bucket: %w", err)
+		}
+
+		version := uint64(0)
+		if value := meta.Get(schemaVersionKey); value != nil {
+			version = binary.BigEndian.Uint64(value)
+		}
+
+		if version > uint64(len(boltMigrations)) {
+			return fmt.Errorf("database schema version %d is newer than the supported version %d", version, len(boltMigrations))
+		}
+
+		for ; version < uint64(len(boltMigrations)); version++ {
+			err := boltMigrations[version](tx)
+			if err != nil {
+				return fmt.Errorf("cannot migrate database to schema version %d: %w", version+1, err)
+			}
+		}
+
+		return meta.Put(schemaVersionKey, binary.BigEndian.AppendUint64(nil, version))
+	})
+}
+
+func createBuckets(tx *bolt.Tx, names ...[]byte) error {
+	for _, name := range names {
+		if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+			return fmt.Errorf("cannot create bucket %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// indexKey joins the parts of a composite key with a zero byte
+func indexKey(parts ...string) []byte {
+	key := make([]byte, 0)
+	for i, part := range parts {
+		if i > 0 {
+			key = append(key, 0)
+		}
+		key = append(key, part...)
+	}
+
+	return key
+}
+
+// expiryKey is the key of a record in an expiry index
+func expiryKey(expiresAt time.Time, key []byte) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(expiresAt.UnixNano())), key...)
+}
+
+// deleteExpired deletes the records of the bucket that expired before now,
+// walking the expiry index from the oldest entry until the first one that has
+// not expired. deleted, when not nil, gets each record before it is deleted,
+// to delete it from the other indexes.
+func deleteExpired(tx *bolt.Tx, bucketName []byte, indexName []byte, now time.Time, deleted func(key []byte, data []byte) error) error {
+	bucket := tx.Bucket(bucketName)
+	index := tx.Bucket(indexName)
+	end := binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))
+
+	expired := make([][]byte, 0)
+	cursor := index.Cursor()
+	for key, _ := cursor.First(); key != nil && bytes.Compare(key[:8], end) < 0; key, _ = cursor.Next() {
+		expired = append(expired, append([]byte(nil), key...))
+	}
+
+	for _, key := range expired {
+		if data := bucket.Get(key[8:]); data != nil && deleted != nil {
+			if err := deleted(key[8:], data); err != nil {
+				return err
+			}
+		}
+		if err := bucket.Delete(key[8:]); err != nil {
+			return err
+		}
+		if err := index.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"context"
+	"encoding/binary"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestBoltDB(t *testing.T) *bolt.DB {
+	t.Helper()
+
+	db, err := service.OpenBoltDB(filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestOpenBoltDBRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.db")
+
+	db, err := service.OpenBoltDB(path)
+	if err != nil {
+		t.Fatalf("OpenBoltDB: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("meta")).Put([]byte("schema_version"), binary.BigEndian.AppendUint64(nil, 1<<32))
+	})
+	if err != nil {
+		t.Fatalf("cannot bump schema version: %v", err)
+	}
+	db.Close()
+
+	db, err = service.OpenBoltDB(path)
+	if err == nil {
+		db.Close()
+		t.Fatal("OpenBoltDB with a newer schema version: got no error")
+	}
+}
+
+func TestOpenBoltDBIndexesTheOrderOfTodos(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.db")
+
+	db, err := service.OpenBoltDB(path)
+	if err != nil {
+		t.Fatalf("OpenBoltDB: %v", err)
+	}
+
+	store := service.NewBoltTodoStore(db)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ids := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		todo := &service.Todo{ID: uuid.NewString(), FromUser: "alice", Title: "todo", CreatedAt: now.Add(-time.Duration(i) * time.Second)}
+		if err := store.Save(todo); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		ids = append(ids, todo.ID)
+	}
+
+	// the database of a version before the order index
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket([]byte("todos_by_order")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("meta")).Put([]byte("schema_version"), binary.BigEndian.AppendUint64(nil, 7))
+	})
+	if err != nil {
+		t.Fatalf("cannot downgrade the schema: %v", err)
+	}
+	db.Close()
+
+	db, err = service.OpenBoltDB(path)
+	if err != nil {
+		t.Fatalf("OpenBoltDB: %v", err)
+	}
+	defer db.Close()
+
+	got := make([]string, 0)
+	query := &service.TodoQuery{FromUser: "alice", Limit: 2}
+	err = service.NewBoltTodoStore(db).GetMany(context.Background(), query, func(todo *service.Todo) error {
+		got = append(got, todo.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+
+	if want := []string{ids[2], ids[1]}; !slices.Equal(got, want) {
+		t.Fatalf("GetMany after the migration = %v, want %v", got, want)
+	}
+}
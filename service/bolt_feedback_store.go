@@ -0,0 +1,217 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltFeedbackStore stores the feedbacks of each todo in a nested bucket keyed
+// by a sequence number, so they are read in the order they were added
+type BoltFeedbackStore struct {
+	db *bolt.DB
+}
+
+func NewBoltFeedbackStore(db *bolt.DB) *BoltFeedbackStore {
+	return &BoltFeedbackStore{
+		db: db,
+	}
+}
+
+func (store *BoltFeedbackStore) Add(todoID string, feedback *Feedback) (*Feedback, error) {
+	feedbackID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate feedback id: %w", err)
+	}
+
+	newFeedback := &Feedback{
+		ID:        feedbackID.String(),
+		Content:   feedback.Content,
+		FromUser:  feedback.FromUser,
+		ParentID:  feedback.ParentID,
+		CreatedAt: feedback.CreatedAt,
+	}
+
+	data, err := json.Marshal(newFeedback)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode feedback: %w", err)
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(feedbacksBucket).CreateBucketIfNotExists([]byte(todoID))
+		if err != nil {
+			return err
+		}
+
+		if newFeedback.ParentID != "" {
+			key, _, err := findBoltFeedback(bucket, newFeedback.ParentID)
+			if err != nil {
+				return err
+			}
+
+			if key == nil {
+				return ErrNotFound
+			}
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(binary.BigEndian.AppendUint64(nil, seq), data)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newFeedback, nil
+}
+
+func (store *BoltFeedbackStore) Find(todoID string) ([]*Feedback, error) {
+	var feedbacks []*Feedback
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(feedbacksBucket).Bucket([]byte(todoID))
+		if bucket == nil {
+			return nil
+		}
+
+		return bucket.ForEach(func(_, data []byte) error {
+			feedback, err := decodeFeedback(data)
+			if err != nil {
+				return err
+			}
+
+			feedbacks = append(feedbacks, feedback)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feedbacks, nil
+}
+
+func (store *BoltFeedbackStore) Get(todoID string, feedbackID string) (*Feedback, error) {
+	var feedback *Feedback
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(feedbacksBucket).Bucket([]byte(todoID))
+		if bucket == nil {
+			return nil
+		}
+
+		var err error
+		_, feedback, err = findBoltFeedback(bucket, feedbackID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return feedback, nil
+}
+
+func (store *BoltFeedbackStore) Update(todoID string, feedback *Feedback) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(feedbacksBucket).Bucket([]byte(todoID))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		key, found, err := findBoltFeedback(bucket, feedback.ID)
+		if err != nil {
+			return err
+		}
+
+		if found == nil {
+			return ErrNotFound
+		}
+
+		found.Content = feedback.Content
+		found.EditedAt = feedback.EditedAt
+
+		data, err := json.Marshal(found)
+		if err != nil {
+			return fmt.Errorf("cannot encode feedback: %w", err)
+		}
+
+		return bucket.Put(key, data)
+	})
+}
+
+func (store *BoltFeedbackStore) Delete(todoID string, feedbackID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(feedbacksBucket).Bucket([]byte(todoID))
+		if bucket == nil {
+			return ErrNotFound
+		}
+
+		var keys [][]byte
+		var feedbacks []*Feedback
+		err := bucket.ForEach(func(key, data []byte) error {
+			feedback, err := decodeFeedback(data)
+			if err != nil {
+				return err
+			}
+
+			keys = append(keys, slices.Clone(key))
+			feedbacks = append(feedbacks, feedback)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if indexOfFeedback(feedbacks, feedbackID) < 0 {
+			return ErrNotFound
+		}
+
+		deleted := feedbackThread(feedbacks, feedbackID)
+		for i, feedback := range feedbacks {
+			if !deleted[feedback.ID] {
+				continue
+			}
+
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// findBoltFeedback returns the key and the feedback with the ID, or nil when
+// the bucket has no feedback with the ID. A todo has few feedbacks, so they
+// are scanned rather than indexed by ID.
+func findBoltFeedback(bucket *bolt.Bucket, feedbackID string) ([]byte, *Feedback, error) {
+	cursor := bucket.Cursor()
+	for key, data := cursor.First(); key != nil; key, data = cursor.Next() {
+		feedback, err := decodeFeedback(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if feedback.ID == feedbackID {
+			return slices.Clone(key), feedback, nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+func decodeFeedback(data []byte) (*Feedback, error) {
+	feedback := &Feedback{}
+	if err := json.Unmarshal(data, feedback); err != nil {
+		return nil, fmt.Errorf("cannot decode feedback: %w", err)
+	}
+
+	return feedback, nil
+}
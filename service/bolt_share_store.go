@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltShareStore stores shares in a bolt database keyed by todo ID and
+// username, with an index keyed by username and todo ID to list the todos
+// shared with a user
+type BoltShareStore struct {
+	db *bolt.DB
+}
+
+func NewBoltShareStore(db *bolt.DB) *BoltShareStore {
+	return &BoltShareStore{
+		db: db,
+	}
+}
+
+func (store *BoltShareStore) Save(share *Share) error {
+	if !share.Role.IsValid() {
+		return fmt.Errorf("invalid share role: %q", share.Role)
+	}
+
+	data, err := json.Marshal(share)
+	if err != nil {
+		return fmt.Errorf("cannot encode share: %w", err)
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(sharesBucket).Put(indexKey(share.TodoID, share.Username), data)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(sharesByUserBucket).Put(indexKey(share.Username, share.TodoID), []byte{})
+	})
+}
+
+func (store *BoltShareStore) Find(todoID, username string) (*Share, error) {
+	var share *Share
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sharesBucket).Get(indexKey(todoID, username))
+		if data == nil {
+			return nil
+		}
+
+		var err error
+		share, err = decodeShare(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return share, nil
+}
+
+func (store *BoltShareStore) Delete(todoID, username string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sharesBucket)
+		key := indexKey(todoID, username)
+		if bucket.Get(key) == nil {
+			return ErrNotFound
+		}
+
+		if err := bucket.Delete(key); err != nil {
+			return err
+		}
+
+		return tx.Bucket(sharesByUserBucket).Delete(indexKey(username, todoID))
+	})
+}
+
+func (store *BoltShareStore) ListByTodo(todoID string) ([]*Share, error) {
+	shares := make([]*Share, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		prefix := indexKey(todoID, "")
+		cursor := tx.Bucket(sharesBucket).Cursor()
+		for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+			share, err := decodeShare(data)
+			if err != nil {
+				return err
+			}
+			shares = append(shares, share)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func (store *BoltShareStore) ListByUser(username string) ([]*Share, error) {
+	shares := make([]*Share, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sharesBucket)
+		prefix := indexKey(username, "")
+		cursor := tx.Bucket(sharesByUserBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			data := bucket.Get(indexKey(string(key[len(prefix):]), username))
+			if data == nil {
+				continue
+			}
+
+			share, err := decodeShare(data)
+			if err != nil {
+				return err
+			}
+			shares = append(shares, share)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func decodeShare(data []byte) (*Share, error) {
+	share := &Share{}
+	if err := json.Unmarshal(data, share); err != nil {
+		return nil, fmt.Errorf("cannot decode share: %w", err)
+	}
+
+	return share, nil
+}
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltTodoStore stores todos in a bolt database
+type BoltTodoStore struct {
+	db *bolt.DB
+}
+
+func NewBoltTodoStore(db *bolt.DB) *BoltTodoStore {
+	return &BoltTodoStore{
+		db: db,
+	}
+}
+
+func (store *BoltTodoStore) Save(todo *Todo) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(todosBucket).Get([]byte(todo.ID)) != nil {
+			return ErrAlreadyExists
+		}
+
+		return putTodo(tx, todo)
+	})
+}
+
+func (store *BoltTodoStore) GetById(id string) (*Todo, error) {
+	var todo *Todo
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		todo, err = getTodo(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return todo, nil
+}
+
+func (store *BoltTodoStore) GetMany(ctx context.Context, query *TodoQuery, found func(todo *Todo) error) error {
+	todos := make([]*Todo, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(todosBucket)
+		decode := func(data []byte) (*Todo, error) {
+			todo := &Todo{}
+			if err := json.Unmarshal(data, todo); err != nil {
+				return nil, fmt.Errorf("cannot decode todo: %w", err)
+			}
+			return todo, nil
+		}
+
+		if query.FromUser == "" {
+			// the server always queries the todos of a user, the todos of
+			// every user are not indexed
+			return bucket.ForEach(func(_, data []byte) error {
+				todo, err := decode(data)
+				if err == nil && query.Matches(todo) && query.IsAfterCursor(todo) {
+					todos = append(todos, todo)
+				}
+				return err
+			})
+		}
+
+		// the order index gives the todos of the user in the query order, so
+		// the scan starts at the cursor and stops at the limit
+		err := scanTodoOrderIndex(tx, query, func(id []byte) (bool, error) {
+			data := bucket.Get(id)
+			if data == nil {
+				return true, nil
+			}
+
+			todo, err := decode(data)
+			if err != nil {
+				return false, err
+			}
+
+			if query.Matches(todo) {
+				todos = append(todos, todo)
+			}
+			return query.Limit == 0 || len(todos) < query.Limit, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the shared todos are merged in by the sort, the first todos of the
+		// user up to the limit are enough for it
+		for _, id := range query.SharedIDs {
+			data := bucket.Get([]byte(id))
+			if data == nil || tx.Bucket(todosByUserBucket).Get(indexKey(query.FromUser, id)) != nil {
+				continue
+			}
+
+			todo, err := decode(data)
+			if err != nil {
+				return err
+			}
+
+			if query.Matches(todo) && query.IsAfterCursor(todo) {
+				todos = append(todos, todo)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, todo := range query.SortAndLimit(todos) {
+		err := ctx.Err()
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			log.Print("context is cancelled")
+			return err
+		}
+
+		err = found(todo)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *BoltTodoStore) Update(todo *Todo) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		old, err := getTodo(tx, todo.ID)
+		if err != nil {
+			return err
+		}
+
+		if old == nil {
+			return ErrNotFound
+		}
+
+		if err := deleteTodo(tx, old); err != nil {
+			return err
+		}
+
+		return putTodo(tx, todo)
+	})
+}
+
+func (store *BoltTodoStore) Delete(id string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		todo, err := getTodo(tx, id)
+		if err != nil {
+			return err
+		}
+
+		if todo == nil {
+			return ErrNotFound
+		}
+
+		return deleteTodo(tx, todo)
+	})
+}
+
+func getTodo(tx *bolt.Tx, id string) (*Todo, error) {
+	data := tx.Bucket(todosBucket).Get([]byte(id))
+	if data == nil {
+		return nil, nil
+	}
+
+	todo := &Todo{}
+	if err := json.Unmarshal(data, todo); err != nil {
+		return nil, fmt.Errorf("cannot decode todo: %w", err)
+	}
+
+	return todo, nil
+}
+
+func putTodo(tx *bolt.Tx, todo *Todo) error {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return fmt.Errorf("cannot encode todo: %w", err)
+	}
+
+	if err := tx.Bucket(todosBucket).Put([]byte(todo.ID), data); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(todosByUserBucket).Put(indexKey(todo.FromUser, todo.ID), []byte{}); err != nil {
+		return err
+	}
+
+	return putTodoOrderKeys(tx.Bucket(todosByOrderBucket), todo)
+}
+
+func deleteTodo(tx *bolt.Tx, todo *Todo) error {
+	if err := tx.Bucket(todosBucket).Delete([]byte(todo.ID)); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(todosByUserBucket).Delete(indexKey(todo.FromUser, todo.ID)); err != nil {
+		return err
+	}
+
+	byOrder := tx.Bucket(todosByOrderBucket)
+	for _, orderBy := range todoOrderFields {
+		cursor := (&TodoQuery{OrderBy: orderBy}).Cursor(todo)
+		if err := byOrder.Delete(todoOrderKey(todo.FromUser, cursor)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// todoOrderFields are the fields of the order index
+var todoOrderFields = []TodoOrderField{
+	TodoOrderByCreatedAt,
+	TodoOrderByUpdatedAt,
+	TodoOrderByDueAt,
+	TodoOrderByPriority,
+	TodoOrderByTitle,
+}
+
+func putTodoOrderKeys(byOrder *bolt.Bucket, todo *Todo) error {
+	for _, orderBy := range todoOrderFields {
+		cursor := (&TodoQuery{OrderBy: orderBy}).Cursor(todo)
+		if err := byOrder.Put(todoOrderKey(todo.FromUser, cursor), []byte(todo.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// todoOrderKey returns the key of the order index at the cursor. The keys are
+// the user, the order field, the value of the field encoded so the keys sort
+// in the ascending order of the field, and the todo ID; the values are the
+// todo IDs.
+func todoOrderKey(username string, cursor *TodoCursor) []byte {
+	key := indexKey(username, string(cursor.OrderBy), "")
+
+	switch cursor.OrderBy {
+	case TodoOrderByDueAt:
+		// todos without a due date come last in both directions, so they
+		// have a range of their own
+		if cursor.Time.IsZero() {
+			key = append(key, 1)
+		} else {
+			key = appendOrderedTime(append(key, 0), cursor.Time)
+		}
+	case TodoOrderByPriority:
+		key = binary.BigEndian.AppendUint64(key, uint64(cursor.Priority)^1<<63)
+	case TodoOrderByTitle:
+		// the zero bytes are escaped and the title ends with 0 1, so a title
+		// sorts before the titles it is a prefix of
+		for _, b := range []byte(cursor.Title) {
+			key = append(key, b)
+			if b == 0 {
+				key = append(key, 0xff)
+			}
+		}
+		key = append(key, 0, 1)
+	default:
+		key = appendOrderedTime(key, cursor.Time)
+	}
+
+	return append(key, cursor.ID...)
+}
+
+// appendOrderedTime appends the time as Unix seconds and nanoseconds, with
+// the sign bit flipped so times before 1970 sort first
+func appendOrderedTime(key []byte, t time.Time) []byte {
+	key = binary.BigEndian.AppendUint64(key, uint64(t.Unix())^1<<63)
+	return binary.BigEndian.AppendUint32(key, uint32(t.Nanosecond()))
+}
+
+// scanTodoOrderIndex calls next with the todo IDs of the user of the query in
+// the query order, from the cursor of the query, until next returns false
+func scanTodoOrderIndex(tx *bolt.Tx, query *TodoQuery, next func(id []byte) (bool, error)) error {
+	orderBy := query.orderBy()
+	prefix := indexKey(query.FromUser, string(orderBy), "")
+
+	// the ranges of the index in the query order, each is scanned in the
+	// direction of the query
+	ranges := [][]byte{prefix}
+	if orderBy == TodoOrderByDueAt {
+		ranges = [][]byte{append(slices.Clip(prefix), 0), append(slices.Clip(prefix), 1)}
+	}
+
+	var after []byte
+	if query.After != nil {
+		after = todoOrderKey(query.FromUser, query.After)
+	}
+
+	cursor := tx.Bucket(todosByOrderBucket).Cursor()
+	started := after == nil
+	for _, keyRange := range ranges {
+		var key, id []byte
+		switch {
+		case !started && !bytes.HasPrefix(after, keyRange):
+			// the cursor is in a later range
+			continue
+		case !started && !query.Descending:
+			key, id = cursor.Seek(after)
+			if bytes.Equal(key, after) {
+				key, id = cursor.Next()
+			}
+		case !started:
+			key, id = cursor.Seek(after)
+			key, id = seekPrev(cursor, key)
+		case !query.Descending:
+			key, id = cursor.Seek(keyRange)
+		default:
+			// the first key after the range
+			end := slices.Clone(keyRange)
+			end[len(end)-1]++
+			key, id = cursor.Seek(end)
+			key, id = seekPrev(cursor, key)
+		}
+		started = true
+
+		for ; key != nil && bytes.HasPrefix(key, keyRange); key, id = step(cursor, query.Descending) {
+			more, err := next(id)
+			if err != nil || !more {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// seekPrev moves the cursor from the key Seek returned to the key before it
+func seekPrev(cursor *bolt.Cursor, key []byte) ([]byte, []byte) {
+	if key == nil {
+		return cursor.Last()
+	}
+	return cursor.Prev()
+}
+
+func step(cursor *bolt.Cursor, descending bool) ([]byte, []byte) {
+	if descending {
+		return cursor.Prev()
+	}
+	return cursor.Next()
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltRefreshTokenStore stores refresh tokens in a bolt database keyed by hash
+type BoltRefreshTokenStore struct {
+	db *bolt.DB
+}
+
+func NewBoltRefreshTokenStore(db *bolt.DB) *BoltRefreshTokenStore {
+	return &BoltRefreshTokenStore{
+		db: db,
+	}
+}
+
+func (store *BoltRefreshTokenStore) Save(token *RefreshToken) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		byFamily := tx.Bucket(refreshTokensByFamilyBucket)
+		byUser := tx.Bucket(refreshTokensByUserBucket)
+
+		// expired tokens are useless even for reuse detection
+		err := deleteExpired(tx, refreshTokensBucket, refreshTokensByExpiryBucket, time.Now(), func(key, data []byte) error {
+			token := &RefreshToken{}
+			if err := json.Unmarshal(data, token); err != nil {
+				return fmt.Errorf("cannot decode refresh token: %w", err)
+			}
+			if err := byFamily.Delete(indexKey(token.FamilyID, string(key))); err != nil {
+				return err
+			}
+			return byUser.Delete(indexKey(token.Username, string(key)))
+		})
+		if err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(refreshTokensBucket)
+		if bucket.Get([]byte(token.Hash)) != nil {
+			return ErrAlreadyExists
+		}
+
+		err = tx.Bucket(refreshTokensByExpiryBucket).Put(expiryKey(token.ExpiresAt, []byte(token.Hash)), nil)
+		if err != nil {
+			return err
+		}
+		err = byFamily.Put(indexKey(token.FamilyID, token.Hash), nil)
+		if err != nil {
+			return err
+		}
+		err = byUser.Put(indexKey(token.Username, token.Hash), nil)
+		if err != nil {
+			return err
+		}
+		return putRefreshToken(bucket, token)
+	})
+}
+
+func (store *BoltRefreshTokenStore) Find(hash string) (*RefreshToken, error) {
+	var token *RefreshToken
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		var err error
+		token, err = getRefreshToken(tx.Bucket(refreshTokensBucket), hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (store *BoltRefreshTokenStore) Consume(hash string) (*RefreshToken, error) {
+	var token *RefreshToken
+
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(refreshTokensBucket)
+
+		var err error
+		token, err = getRefreshToken(bucket, hash)
+		if err != nil || token == nil || token.Revoked {
+			return err
+		}
+
+		consumed := *token
+		consumed.Revoked = true
+		return putRefreshToken(bucket, &consumed)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (store *BoltRefreshTokenStore) RevokeFamily(familyID string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return revokeRefreshTokens(tx, refreshTokensByFamilyBucket, familyID)
+	})
+}
+
+func (store *BoltRefreshTokenStore) RevokeUser(username string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return revokeRefreshTokens(tx, refreshTokensByUserBucket, username)
+	})
+}
+
+// revokeRefreshTokens revokes the refresh tokens under the key in the index
+func revokeRefreshTokens(tx *bolt.Tx, indexName []byte, key string) error {
+	bucket := tx.Bucket(refreshTokensBucket)
+
+	tokens := make([]*RefreshToken, 0)
+	prefix := indexKey(key, "")
+	cursor := tx.Bucket(indexName).Cursor()
+	for indexed, _ := cursor.Seek(prefix); indexed != nil && bytes.HasPrefix(indexed, prefix); indexed, _ = cursor.Next() {
+		token, err := getRefreshToken(bucket, string(indexed[len(prefix):]))
+		if err != nil {
+			return err
+		}
+		if token != nil {
+			tokens = append(tokens, token)
+		}
+	}
+
+	for _, token := range tokens {
+		token.Revoked = true
+		if err := putRefreshToken(bucket, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRefreshToken(bucket *bolt.Bucket, hash string) (*RefreshToken, error) {
+	data := bucket.Get([]byte(hash))
+	if data == nil {
+		return nil, nil
+	}
+
+	token := &RefreshToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, fmt.Errorf("cannot decode refresh token: %w", err)
+	}
+	return token, nil
+}
+
+func putRefreshToken(bucket *bolt.Bucket, token *RefreshToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("cannot encode refresh token: %w", err)
+	}
+
+	return bucket.Put([]byte(token.Hash), data)
+}
+
+// BoltRevocationStore stores the revoked access token IDs with their expiry
+type BoltRevocationStore struct {
+	db *bolt.DB
+}
+
+func NewBoltRevocationStore(db *bolt.DB) *BoltRevocationStore {
+	return &BoltRevocationStore{
+		db: db,
+	}
+}
+
+func (store *BoltRevocationStore) Revoke(tokenID string, expiresAt time.Time) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		// expired tokens are rejected anyway, so they do not need to be kept
+		err := deleteExpired(tx, revokedTokensBucket, revokedTokensByExpiryBucket, time.Now(), nil)
+		if err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(revokedTokensBucket)
+		index := tx.Bucket(revokedTokensByExpiryBucket)
+		if data := bucket.Get([]byte(tokenID)); data != nil {
+			other, err := time.Parse(time.RFC3339Nano, string(data))
+			if err != nil {
+				return fmt.Errorf("cannot decode token expiry: %w", err)
+			}
+			if err := index.Delete(expiryKey(other, []byte(tokenID))); err != nil {
+				return err
+			}
+		}
+
+		err = index.Put(expiryKey(expiresAt, []byte(tokenID)), nil)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(tokenID), []byte(expiresAt.Format(time.RFC3339Nano)))
+	})
+}
+
+func (store *BoltRevocationStore) IsRevoked(tokenID string) (bool, error) {
+	revoked := false
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		revoked = tx.Bucket(revokedTokensBucket).Get([]byte(tokenID)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltUserStore stores users in a bolt database keyed by username, so they are
+// listed in username order
+type BoltUserStore struct {
+	db *bolt.DB
+}
+
+func NewBoltUserStore(db *bolt.DB) *BoltUserStore {
+	return &BoltUserStore{
+		db: db,
+	}
+}
+
+func (store *BoltUserStore) Save(user *User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("cannot encode user: %w", err)
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		if bucket.Get([]byte(user.Username)) != nil {
+			return ErrAlreadyExists
+		}
+
+		return bucket.Put([]byte(user.Username), data)
+	})
+}
+
+func (store *BoltUserStore) Find(username string) (*User, error) {
+	var user *User
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(usersBucket).Get([]byte(username))
+		if data == nil {
+			return nil
+		}
+
+		user = &User{}
+		if err := json.Unmarshal(data, user); err != nil {
+			return fmt.Errorf("cannot decode user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (store *BoltUserStore) Update(user *User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("cannot encode user: %w", err)
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usersBucket)
+		if bucket.Get([]byte(user.Username)) == nil {
+			return ErrNotFound
+		}
+
+		return bucket.Put([]byte(user.Username), data)
+	})
+}
+
+func (store *BoltUserStore) List() ([]*User, error) {
+	users := make([]*User, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(usersBucket).ForEach(func(_, data []byte) error {
+			user := &User{}
+			if err := json.Unmarshal(data, user); err != nil {
+				return fmt.Errorf("cannot decode user: %w", err)
+			}
+
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
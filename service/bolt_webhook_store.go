@@ -0,0 +1,193 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltWebhookStore stores webhooks and deliveries in a bolt database keyed by
+// ID, with an index keyed by webhook ID and delivery ID to list the deliveries
+// of a webhook
+type BoltWebhookStore struct {
+	db *bolt.DB
+}
+
+func NewBoltWebhookStore(db *bolt.DB) *BoltWebhookStore {
+	return &BoltWebhookStore{
+		db: db,
+	}
+}
+
+func (store *BoltWebhookStore) Save(webhook *Webhook) error {
+	data, err := json.Marshal(webhook)
+	if err != nil {
+		return fmt.Errorf("cannot encode webhook: %w", err)
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).Put([]byte(webhook.ID), data)
+	})
+}
+
+func (store *BoltWebhookStore) Find(id string) (*Webhook, error) {
+	var webhook *Webhook
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(webhooksBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+
+		var err error
+		webhook, err = decodeWebhook(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (store *BoltWebhookStore) List() ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(_, data []byte) error {
+			webhook, err := decodeWebhook(data)
+			if err != nil {
+				return err
+			}
+
+			webhooks = append(webhooks, webhook)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// webhooks are keyed by ID, so they are sorted here
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (store *BoltWebhookStore) Delete(id string) error {
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhooksBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrNotFound
+		}
+
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		var keys [][]byte
+		prefix := indexKey(id, "")
+		cursor := tx.Bucket(webhookDeliveriesByWebhookBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			keys = append(keys, bytes.Clone(key))
+		}
+
+		deliveries := tx.Bucket(webhookDeliveriesBucket)
+		index := tx.Bucket(webhookDeliveriesByWebhookBucket)
+		for _, key := range keys {
+			if err := deliveries.Delete(key[len(prefix):]); err != nil {
+				return err
+			}
+
+			if err := index.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (store *BoltWebhookStore) SaveDelivery(delivery *WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("cannot encode webhook delivery: %w", err)
+	}
+
+	return store.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(webhookDeliveriesBucket).Put([]byte(delivery.ID), data)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(webhookDeliveriesByWebhookBucket).Put(indexKey(delivery.WebhookID, delivery.ID), []byte{})
+	})
+}
+
+func (store *BoltWebhookStore) FindDelivery(id string) (*WebhookDelivery, error) {
+	var delivery *WebhookDelivery
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(webhookDeliveriesBucket).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+
+		var err error
+		delivery, err = decodeWebhookDelivery(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (store *BoltWebhookStore) ListDeliveries(webhookID string) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(webhookDeliveriesBucket)
+		prefix := indexKey(webhookID, "")
+		cursor := tx.Bucket(webhookDeliveriesByWebhookBucket).Cursor()
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			data := bucket.Get(key[len(prefix):])
+			if data == nil {
+				continue
+			}
+
+			delivery, err := decodeWebhookDelivery(data)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortWebhookDeliveries(deliveries)
+	return deliveries, nil
+}
+
+func decodeWebhook(data []byte) (*Webhook, error) {
+	webhook := &Webhook{}
+	if err := json.Unmarshal(data, webhook); err != nil {
+		return nil, fmt.Errorf("cannot decode webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func decodeWebhookDelivery(data []byte) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	if err := json.Unmarshal(data, delivery); err != nil {
+		return nil, fmt.Errorf("cannot decode webhook delivery: %w", err)
+	}
+
+	return delivery, nil
+}
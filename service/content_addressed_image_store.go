@@ -0,0 +1,606 @@
+package service
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ContentAddressedImageStore stores the data of images as blobs named by their
+// SHA-256 hash, so identical images are stored once however many todos they
+// are attached to. Every image is a reference to its blobs, a blob is deleted
+// once no image references it.
+//
+// Servers may share the blob store. A blob is referenced before it is checked
+// for or uploaded, and a delete writes a marker before it checks the
+// references one last time. A server referencing a blob waits for the markers
+// of the blob to go before it checks whether the blob is stored, so either the
+// delete sees the reference and keeps the blob, or the reference sees the
+// blob deleted and uploads it again. The keys of the blob store are:
+//
+//	blobs/<first 2 hex digits>/<hash>  the image data
+//	images/<image id>.json             the images
+//	todos/<todo id>/<image id>         the images of each todo
+//	blobrefs/<hash>/<image id>         the images referencing each blob, the
+//	                                   variants add .<variant name>
+//	blobdeletes/<hash>/<time>-<id>     the deletes of each blob in progress,
+//	                                   by the Unix time they started in ns
+type ContentAddressedImageStore struct {
+	// mutex serializes the changes to references of this server
+	mutex sync.Mutex
+	blobs BlobStore
+}
+
+// blobDeleteLease is how long the marker of a blob delete holds off the
+// servers referencing the blob, an older marker was left by a crash
+const blobDeleteLease = time.Minute
+
+// blobDeletePoll is how often a server waiting for the deletes of a blob
+// checks their markers
+const blobDeletePoll = 20 * time.Millisecond
+
+// imageRef is the record of an image in the blob store
+type imageRef struct {
+	ID         string         `json:"id"`
+	TodoID     string         `json:"todo_id"`
+	Type       string         `json:"type"`
+	Blob       string         `json:"blob"`
+	Size       int64          `json:"size"`
+	UploadedAt time.Time      `json:"uploaded_at"`
+	Variants   []imageVariant `json:"variants,omitempty"`
+}
+
+type imageVariant struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Blob   string `json:"blob"`
+	Size   int64  `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// NewContentAddressedImageStore deletes the blobs no image references anymore,
+// like the ones left by a crash
+func NewContentAddressedImageStore(blobs BlobStore) (*ContentAddressedImageStore, error) {
+	store := &ContentAddressedImageStore{blobs: blobs}
+
+	err := store.collectGarbage()
+	if err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (store *ContentAddressedImageStore) Save(todoID string, imageType string, imageData io.Reader) (string, error) {
+	if err := ValidateImageType(imageType); err != nil {
+		return "", err
+	}
+
+	imageID, err := uuid.NewRandom()
+	if err != nil {
+		return "", fmt.Errorf("cannot generate image id: %w", err)
+	}
+
+	file, hash, size, err := writeTempBlob(imageData)
+	if err != nil {
+		return "", err
+	}
+	defer removeTempBlob(file)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := &ImageInfo{
+		ID:         imageID.String(),
+		TodoID:     todoID,
+		Type:       imageType,
+		Path:       blobKey(hash),
+		Size:       size,
+		UploadedAt: time.Now(),
+	}
+
+	err = store.addBlob(image.ID, "", hash, file, size)
+	if err != nil {
+		return "", err
+	}
+
+	err = store.putRef(image)
+	if err != nil {
+		return "", err
+	}
+
+	err = store.blobs.Put(todoImageKey(todoID, image.ID), strings.NewReader(""), 0)
+	if err != nil {
+		return "", fmt.Errorf("cannot save todo image: %w", err)
+	}
+
+	return image.ID, nil
+}
+
+func (store *ContentAddressedImageStore) SaveVariant(imageID string, variant ImageVariant, imageData io.Reader) error {
+	if err := ValidateImageType(variant.Type); err != nil {
+		return err
+	}
+
+	if err := ValidateImageType(variant.Name); err != nil || variant.Name == "" {
+		return fmt.Errorf("invalid variant name: %q", variant.Name)
+	}
+
+	file, hash, size, err := writeTempBlob(imageData)
+	if err != nil {
+		return err
+	}
+	defer removeTempBlob(file)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image, err := store.getRef(imageID)
+	if err != nil {
+		return err
+	}
+
+	if image == nil {
+		return ErrNotFound
+	}
+
+	variant.Path = blobKey(hash)
+	variant.Size = size
+
+	var replaced string
+	if existing := image.Variant(variant.Name); existing != nil {
+		replaced = blobHash(existing.Path)
+		*existing = variant
+	} else {
+		image.Variants = append(image.Variants, variant)
+	}
+
+	if replaced != hash {
+		err = store.addBlob(imageID, variant.Name, hash, file, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = store.putRef(image)
+	if err != nil {
+		return err
+	}
+
+	if replaced != "" && replaced != hash {
+		return store.releaseBlob(imageID, variant.Name, replaced)
+	}
+	return nil
+}
+
+func (store *ContentAddressedImageStore) Find(imageID string) (*ImageInfo, error) {
+	return store.getRef(imageID)
+}
+
+func (store *ContentAddressedImageStore) List(todoID string) ([]*ImageInfo, error) {
+	prefix := todoImageKey(todoID, "")
+	keys, err := store.blobs.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*ImageInfo, 0, len(keys))
+	for _, key := range keys {
+		image, err := store.getRef(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			return nil, err
+		}
+
+		// the image is being saved or deleted
+		if image == nil {
+			continue
+		}
+		images = append(images, image)
+	}
+
+	slices.SortFunc(images, func(a, b *ImageInfo) int {
+		if c := a.UploadedAt.Compare(b.UploadedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return images, nil
+}
+
+func (store *ContentAddressedImageStore) Open(imageID string, variant string) (io.ReadCloser, error) {
+	key, err := store.variantKey(imageID, variant)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.blobs.Get(key)
+}
+
+// PresignURL returns ErrPresignNotSupported when the blob store cannot give out
+// URLs
+func (store *ContentAddressedImageStore) PresignURL(imageID string, variant string, expiry time.Duration) (string, error) {
+	key, err := store.variantKey(imageID, variant)
+	if err != nil {
+		return "", err
+	}
+
+	return store.blobs.PresignGet(key, expiry)
+}
+
+func (store *ContentAddressedImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image, err := store.getRef(imageID)
+	if err != nil {
+		return err
+	}
+
+	if image == nil {
+		return ErrNotFound
+	}
+
+	err = store.blobs.Delete(imageRefKey(imageID))
+	if err != nil {
+		return fmt.Errorf("cannot delete image reference: %w", err)
+	}
+
+	err = store.blobs.Delete(todoImageKey(image.TodoID, imageID))
+	if err != nil {
+		return fmt.Errorf("cannot delete todo image: %w", err)
+	}
+
+	err = store.releaseBlob(imageID, "", blobHash(image.Path))
+	for _, variant := range image.Variants {
+		err = errors.Join(err, store.releaseBlob(imageID, variant.Name, blobHash(variant.Path)))
+	}
+	return err
+}
+
+func (store *ContentAddressedImageStore) variantKey(imageID string, variant string) (string, error) {
+	image, err := store.getRef(imageID)
+	if err != nil {
+		return "", err
+	}
+
+	if image == nil {
+		return "", ErrNotFound
+	}
+
+	if variant == "" {
+		return image.Path, nil
+	}
+
+	found := image.Variant(variant)
+	if found == nil {
+		return "", ErrNotFound
+	}
+	return found.Path, nil
+}
+
+// addBlob references the blob from the image, then uploads the blob unless it
+// is already stored, the caller must hold the lock
+func (store *ContentAddressedImageStore) addBlob(imageID string, variant string, hash string, file *os.File, size int64) error {
+	err := store.blobs.Put(blobRefKey(hash, imageID, variant), strings.NewReader(""), 0)
+	if err != nil {
+		return fmt.Errorf("cannot save blob reference: %w", err)
+	}
+
+	// a delete that started before the reference may not have seen it
+	err = store.waitForBlobDeletes(hash)
+	if err != nil {
+		return err
+	}
+
+	exists, err := store.blobExists(blobKey(hash))
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("cannot read image file: %w", err)
+	}
+
+	err = store.blobs.Put(blobKey(hash), file, size)
+	if err != nil {
+		return fmt.Errorf("cannot save blob: %w", err)
+	}
+
+	return nil
+}
+
+// blobExists reports whether the blob store has a blob with the key
+func (store *ContentAddressedImageStore) blobExists(key string) (bool, error) {
+	reader, err := store.blobs.Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot check blob: %w", err)
+	}
+
+	reader.Close()
+	return true, nil
+}
+
+// releaseBlob removes a reference of the image to a blob and deletes the blob
+// once it has no references, the caller must hold the lock
+func (store *ContentAddressedImageStore) releaseBlob(imageID string, variant string, hash string) error {
+	err := store.blobs.Delete(blobRefKey(hash, imageID, variant))
+	if err != nil {
+		return fmt.Errorf("cannot delete blob reference: %w", err)
+	}
+
+	refs, err := store.blobs.List(blobRefKey(hash, "", ""))
+	if err != nil {
+		return err
+	}
+
+	if len(refs) > 0 {
+		return nil
+	}
+
+	return store.deleteBlob(hash)
+}
+
+// deleteBlob deletes the blob unless an image references it, the caller must
+// hold the lock
+func (store *ContentAddressedImageStore) deleteBlob(hash string) error {
+	deleteID, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("cannot generate blob delete id: %w", err)
+	}
+
+	marker := blobDeleteKey(hash, fmt.Sprintf("%d-%s", time.Now().UnixNano(), deleteID))
+	err = store.blobs.Put(marker, strings.NewReader(""), 0)
+	if err != nil {
+		return fmt.Errorf("cannot save blob delete marker: %w", err)
+	}
+
+	// another server may have referenced the blob before the marker
+	refs, err := store.blobs.List(blobRefKey(hash, "", ""))
+	if err == nil && len(refs) == 0 {
+		err = store.blobs.Delete(blobKey(hash))
+		if err != nil {
+			err = fmt.Errorf("cannot delete blob: %w", err)
+		}
+	}
+
+	if deleteErr := store.blobs.Delete(marker); deleteErr != nil {
+		err = errors.Join(err, fmt.Errorf("cannot delete blob delete marker: %w", deleteErr))
+	}
+	return err
+}
+
+// waitForBlobDeletes returns once no delete of the blob is in progress, it
+// deletes the markers older than the lease
+func (store *ContentAddressedImageStore) waitForBlobDeletes(hash string) error {
+	for {
+		markers, err := store.blobs.List(blobDeleteKey(hash, ""))
+		if err != nil {
+			return err
+		}
+
+		active := false
+		for _, marker := range markers {
+			started, _, _ := strings.Cut(path.Base(marker), "-")
+			nanos, err := strconv.ParseInt(started, 10, 64)
+			if err == nil && time.Since(time.Unix(0, nanos)) < blobDeleteLease {
+				active = true
+				continue
+			}
+
+			log.Printf("delete stale blob delete marker %s", marker)
+			err = store.blobs.Delete(marker)
+			if err != nil {
+				return fmt.Errorf("cannot delete blob delete marker: %w", err)
+			}
+		}
+
+		if !active {
+			return nil
+		}
+		time.Sleep(blobDeletePoll)
+	}
+}
+
+// getRef returns nil when there is no image with the ID
+func (store *ContentAddressedImageStore) getRef(imageID string) (*ImageInfo, error) {
+	// image IDs are UUIDs, anything else cannot be a key of an image
+	if _, err := uuid.Parse(imageID); err != nil {
+		return nil, nil
+	}
+
+	reader, err := store.blobs.Get(imageRefKey(imageID))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image reference: %w", err)
+	}
+	defer reader.Close()
+
+	ref := imageRef{}
+	err = json.NewDecoder(reader).Decode(&ref)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image reference %s: %w", imageID, err)
+	}
+
+	hashes := []string{ref.Blob}
+	for _, variant := range ref.Variants {
+		hashes = append(hashes, variant.Blob)
+	}
+	for _, hash := range hashes {
+		if !isBlobHash(hash) {
+			return nil, fmt.Errorf("image reference %s has an invalid blob hash %q", imageID, hash)
+		}
+	}
+
+	image := &ImageInfo{
+		ID:         ref.ID,
+		TodoID:     ref.TodoID,
+		Type:       ref.Type,
+		Path:       blobKey(ref.Blob),
+		Size:       ref.Size,
+		UploadedAt: ref.UploadedAt,
+	}
+
+	for _, variant := range ref.Variants {
+		image.Variants = append(image.Variants, ImageVariant{
+			Name:   variant.Name,
+			Type:   variant.Type,
+			Path:   blobKey(variant.Blob),
+			Size:   variant.Size,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+	}
+
+	return image, nil
+}
+
+func (store *ContentAddressedImageStore) putRef(image *ImageInfo) error {
+	ref := imageRef{
+		ID:         image.ID,
+		TodoID:     image.TodoID,
+		Type:       image.Type,
+		Blob:       blobHash(image.Path),
+		Size:       image.Size,
+		UploadedAt: image.UploadedAt,
+	}
+	for _, variant := range image.Variants {
+		ref.Variants = append(ref.Variants, imageVariant{
+			Name:   variant.Name,
+			Type:   variant.Type,
+			Blob:   blobHash(variant.Path),
+			Size:   variant.Size,
+			Width:  variant.Width,
+			Height: variant.Height,
+		})
+	}
+
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return fmt.Errorf("cannot encode image reference: %w", err)
+	}
+
+	err = store.blobs.Put(imageRefKey(image.ID), strings.NewReader(string(data)), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("cannot save image reference: %w", err)
+	}
+
+	return nil
+}
+
+// collectGarbage deletes the blobs without references, like the ones of a
+// delete interrupted by a crash
+func (store *ContentAddressedImageStore) collectGarbage() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	blobs, err := store.blobs.List("blobs/")
+	if err != nil {
+		return fmt.Errorf("cannot collect unreferenced blobs: %w", err)
+	}
+
+	refs, err := store.blobs.List("blobrefs/")
+	if err != nil {
+		return fmt.Errorf("cannot collect unreferenced blobs: %w", err)
+	}
+
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		referenced[strings.Split(ref, "/")[1]] = true
+	}
+
+	for _, key := range blobs {
+		if referenced[blobHash(key)] {
+			continue
+		}
+
+		log.Printf("delete unreferenced blob %s", key)
+		err = store.deleteBlob(blobHash(key))
+		if err != nil {
+			return fmt.Errorf("cannot collect unreferenced blobs: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeTempBlob copies the data to a temporary file and returns it with the
+// hex encoded SHA-256 hash of the data and its size
+func writeTempBlob(data io.Reader) (*os.File, string, int64, error) {
+	file, err := os.CreateTemp("", "todo-image-*")
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("cannot create image file: %w", err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), data)
+	if err != nil {
+		removeTempBlob(file)
+		return nil, "", 0, fmt.Errorf("cannot write image to file: %w", err)
+	}
+
+	return file, hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func removeTempBlob(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// isBlobHash reports whether the name is a hex encoded SHA-256 hash
+func isBlobHash(name string) bool {
+	_, err := hex.DecodeString(name)
+	return err == nil && len(name) == sha256.Size*2 && strings.ToLower(name) == name
+}
+
+func blobKey(hash string) string {
+	return fmt.Sprintf("blobs/%s/%s", hash[:2], hash)
+}
+
+// blobHash returns the hash a blob key is named after
+func blobHash(key string) string {
+	return path.Base(key)
+}
+
+func blobRefKey(hash string, imageID string, variant string) string {
+	if variant != "" {
+		imageID += "." + variant
+	}
+	return fmt.Sprintf("blobrefs/%s/%s", hash, imageID)
+}
+
+func blobDeleteKey(hash string, deleteID string) string {
+	return fmt.Sprintf("blobdeletes/%s/%s", hash, deleteID)
+}
+
+func imageRefKey(imageID string) string {
+	return fmt.Sprintf("images/%s.json", imageID)
+}
+
+func todoImageKey(todoID string, imageID string) string {
+	return fmt.Sprintf("todos/%s/%s", todoID, imageID)
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEventsExpired is returned when the events after a sequence number are not
+// kept anymore, or the sequence number was never published
+var ErrEventsExpired = errors.New("events after the sequence number are not available")
+
+// ErrSubscriberTooSlow is returned once a subscriber has received every event
+// queued before its buffer overflowed
+var ErrSubscriberTooSlow = errors.New("subscriber did not keep up with the events")
+
+type TodoEventType int
+
+const (
+	TodoEventCreated TodoEventType = iota + 1
+	TodoEventUpdated
+	TodoEventDeleted
+	TodoEventFeedbackAdded
+	TodoEventFeedbackEdited
+	TodoEventFeedbackDeleted
+)
+
+// TodoEvent is a change of a todo or of its feedbacks
+type TodoEvent struct {
+	// Epoch and Sequence are set by the bus, the sequence increases by one with
+	// every event of the epoch
+	Epoch    string
+	Sequence uint64
+	Type     TodoEventType
+	// Todo is the todo after the change, or before it was deleted
+	Todo *Todo
+	// Feedback is only set by the feedback events
+	Feedback *Feedback
+	// Usernames are the users who could view the todo when it changed, admins
+	// can view every todo
+	Usernames   []string
+	PublishedAt time.Time
+}
+
+// EventBus delivers the published events to its subscribers and keeps the
+// latest events, so a subscriber that reconnects can resume after the last
+// event it received. Publishing never blocks: every subscriber has a bounded
+// buffer and is dropped when it overflows. The sequence numbers of a bus
+// belong to its random epoch, a new bus starts them again in another epoch.
+type EventBus struct {
+	epoch    string
+	mutex    sync.Mutex
+	sequence uint64
+	// history is a ring buffer of the latest events, oldest is the index of the
+	// oldest one
+	history     []*TodoEvent
+	oldest      int
+	bufferSize  int
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	bus *EventBus
+	// after is the sequence number of the event before the first one received
+	after uint64
+	mutex sync.Mutex
+	queue []*TodoEvent
+	// limit is the buffer size, plus the missed events queued on subscribe
+	limit      int
+	overflowed bool
+	closed     bool
+	// notify has a value when events were queued since the last Next call
+	notify chan struct{}
+}
+
+// NewEventBus keeps the latest historySize events and buffers up to bufferSize
+// events for every subscriber
+func NewEventBus(historySize int, bufferSize int) *EventBus {
+	return &EventBus{
+		epoch:       uuid.NewString(),
+		history:     make([]*TodoEvent, 0, historySize),
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+// Publish sets the sequence number of the event and delivers it
+func (bus *EventBus) Publish(event *TodoEvent) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.sequence++
+	event.Epoch = bus.epoch
+	event.Sequence = bus.sequence
+	if event.PublishedAt.IsZero() {
+		event.PublishedAt = time.Now()
+	}
+
+	if len(bus.history) < cap(bus.history) {
+		bus.history = append(bus.history, event)
+	} else if len(bus.history) > 0 {
+		bus.history[bus.oldest] = event
+		bus.oldest = (bus.oldest + 1) % len(bus.history)
+	}
+
+	for subscription := range bus.subscribers {
+		if !subscription.push(event) {
+			delete(bus.subscribers, subscription)
+		}
+	}
+}
+
+// Subscribe returns a subscription receiving the events published after the
+// sequence number, it returns ErrEventsExpired when some of them are not kept
+// anymore. A sequence number of 0 only receives new events.
+func (bus *EventBus) Subscribe(after uint64) (*Subscription, error) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	subscription := &Subscription{
+		bus:    bus,
+		after:  bus.sequence,
+		limit:  bus.bufferSize,
+		notify: make(chan struct{}, 1),
+	}
+
+	if after > 0 {
+		if after > bus.sequence {
+			return nil, ErrEventsExpired
+		}
+
+		missed := bus.sequence - after
+		if missed > uint64(len(bus.history)) {
+			return nil, ErrEventsExpired
+		}
+
+		subscription.after = after
+		events := bus.orderedHistory()
+		subscription.queue = slices.Clone(events[len(events)-int(missed):])
+		subscription.limit += len(subscription.queue)
+		if len(subscription.queue) > 0 {
+			subscription.notify <- struct{}{}
+		}
+	}
+
+	bus.subscribers[subscription] = true
+	return subscription, nil
+}
+
+// Epoch returns the epoch of the sequence numbers
+func (bus *EventBus) Epoch() string {
+	return bus.epoch
+}
+
+// Sequence returns the sequence number of the latest event
+func (bus *EventBus) Sequence() uint64 {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	return bus.sequence
+}
+
+func (bus *EventBus) orderedHistory() []*TodoEvent {
+	events := make([]*TodoEvent, 0, len(bus.history))
+	events = append(events, bus.history[bus.oldest:]...)
+	return append(events, bus.history[:bus.oldest]...)
+}
+
+// After returns the sequence number of the event before the first one the
+// subscription receives
+func (subscription *Subscription) After() uint64 {
+	return subscription.after
+}
+
+// Next waits for the next event, it returns ErrSubscriberTooSlow after the
+// queued events when the subscription overflowed
+func (subscription *Subscription) Next(ctx context.Context) (*TodoEvent, error) {
+	for {
+		subscription.mutex.Lock()
+		if len(subscription.queue) > 0 {
+			event := subscription.queue[0]
+			subscription.queue[0] = nil
+			subscription.queue = subscription.queue[1:]
+			subscription.mutex.Unlock()
+			return event, nil
+		}
+
+		overflowed, closed := subscription.overflowed, subscription.closed
+		subscription.mutex.Unlock()
+
+		if overflowed {
+			return nil, ErrSubscriberTooSlow
+		}
+
+		if closed {
+			return nil, context.Canceled
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-subscription.notify:
+		}
+	}
+}
+
+// Close stops the delivery of events to the subscription
+func (subscription *Subscription) Close() {
+	subscription.bus.mutex.Lock()
+	delete(subscription.bus.subscribers, subscription)
+	subscription.bus.mutex.Unlock()
+
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+
+	subscription.closed = true
+	subscription.queue = nil
+	select {
+	case subscription.notify <- struct{}{}:
+	default:
+	}
+}
+
+// push queues the event, it returns false when the subscription overflowed and
+// must not receive more events
+func (subscription *Subscription) push(event *TodoEvent) bool {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+
+	if subscription.closed {
+		return false
+	}
+
+	if len(subscription.queue) >= subscription.limit {
+		subscription.overflowed = true
+	} else {
+		subscription.queue = append(subscription.queue, event)
+	}
+
+	select {
+	case subscription.notify <- struct{}{}:
+	default:
+	}
+	return !subscription.overflowed
+}
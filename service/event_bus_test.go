@@ -0,0 +1,129 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+func TestEventBusDeliversInOrder(t *testing.T) {
+	bus := service.NewEventBus(10, 10)
+	subscription := mustSubscribe(t, bus, 0)
+	defer subscription.Close()
+
+	publishEvents(bus, 3)
+	assertNextSequences(t, subscription, 1, 2, 3)
+}
+
+func TestEventBusResumesAfterSequence(t *testing.T) {
+	bus := service.NewEventBus(3, 10)
+	publishEvents(bus, 5)
+
+	subscription := mustSubscribe(t, bus, 3)
+	defer subscription.Close()
+	if subscription.After() != 3 {
+		t.Fatalf("After: got %d, want 3", subscription.After())
+	}
+
+	publishEvents(bus, 1)
+	assertNextSequences(t, subscription, 4, 5, 6)
+
+	for _, after := range []uint64{1, 7} {
+		if _, err := bus.Subscribe(after); !errors.Is(err, service.ErrEventsExpired) {
+			t.Fatalf("Subscribe after %d: got %v, want %v", after, err, service.ErrEventsExpired)
+		}
+	}
+}
+
+func TestEventBusEpoch(t *testing.T) {
+	bus := service.NewEventBus(10, 10)
+	if other := service.NewEventBus(10, 10); bus.Epoch() == "" || bus.Epoch() == other.Epoch() {
+		t.Fatalf("Epoch: got %q and %q, want two different epochs", bus.Epoch(), other.Epoch())
+	}
+
+	event := &service.TodoEvent{Type: service.TodoEventCreated, Todo: &service.Todo{}}
+	bus.Publish(event)
+	if event.Epoch != bus.Epoch() {
+		t.Fatalf("published event of epoch %q, want %q", event.Epoch, bus.Epoch())
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := service.NewEventBus(10, 2)
+	slow := mustSubscribe(t, bus, 0)
+	defer slow.Close()
+	fast := mustSubscribe(t, bus, 0)
+	defer fast.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		publishEvents(bus, 5)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow subscriber")
+	}
+
+	assertNextSequences(t, slow, 1, 2)
+	if _, err := slow.Next(context.Background()); !errors.Is(err, service.ErrSubscriberTooSlow) {
+		t.Fatalf("Next after overflow: got %v, want %v", err, service.ErrSubscriberTooSlow)
+	}
+
+	// the dropped subscriber can resume from the last event it received
+	resumed := mustSubscribe(t, bus, 2)
+	defer resumed.Close()
+	assertNextSequences(t, resumed, 3, 4, 5)
+}
+
+func TestEventBusNextStopsWithContext(t *testing.T) {
+	bus := service.NewEventBus(10, 10)
+	subscription := mustSubscribe(t, bus, 0)
+	defer subscription.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := subscription.Next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Next without events: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func mustSubscribe(t *testing.T, bus *service.EventBus, after uint64) *service.Subscription {
+	t.Helper()
+
+	subscription, err := bus.Subscribe(after)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	return subscription
+}
+
+func publishEvents(bus *service.EventBus, count int) {
+	for i := 0; i < count; i++ {
+		bus.Publish(&service.TodoEvent{Type: service.TodoEventUpdated, Todo: &service.Todo{ID: "todo"}})
+	}
+}
+
+func assertNextSequences(t *testing.T, subscription *service.Subscription, want ...uint64) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, sequence := range want {
+		event, err := subscription.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if event.Sequence != sequence {
+			t.Fatalf("Next: got sequence %d, want %d", event.Sequence, sequence)
+		}
+	}
+}
@@ -2,21 +2,40 @@ package service
 
 import (
 	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
 )
 
 type FeedbackStore interface {
+	// Add returns ErrNotFound when the parent of the feedback is not a feedback
+	// of the todo
 	Add(todoID string, feedback *Feedback) (*Feedback, error)
+	// Find returns the feedbacks of the todo in the order they were added
 	Find(todoID string) ([]*Feedback, error)
+	// Get returns nil when the todo has no feedback with the ID
+	Get(todoID string, feedbackID string) (*Feedback, error)
+	// Update replaces the content and edit time of the feedback, it returns
+	// ErrNotFound when the todo has no feedback with the ID
+	Update(todoID string, feedback *Feedback) error
+	// Delete deletes the feedback and its replies, it returns ErrNotFound when
+	// the todo has no feedback with the ID
+	Delete(todoID string, feedbackID string) error
 }
 
 type Feedback struct {
 	ID       string
 	Content  string
 	FromUser string
+	// ParentID is the ID of the feedback this one replies to, it is empty for
+	// the feedbacks starting a thread
+	ParentID  string
+	CreatedAt time.Time
+	// EditedAt is zero until the content is edited
+	EditedAt time.Time
 }
 
 type InMemoryFeedbackStore struct {
@@ -33,9 +52,11 @@ func NewInMemoryFeedbackStore() *InMemoryFeedbackStore {
 func (store *InMemoryFeedbackStore) Add(todoID string, feedback *Feedback) (*Feedback, error) {
 	feedbackID, err := uuid.NewRandom()
 	newFeedback := &Feedback{
-		ID:       feedbackID.String(),
-		Content:  feedback.Content,
-		FromUser: feedback.FromUser,
+		ID:        feedbackID.String(),
+		Content:   feedback.Content,
+		FromUser:  feedback.FromUser,
+		ParentID:  feedback.ParentID,
+		CreatedAt: feedback.CreatedAt,
 	}
 
 	if err != nil {
@@ -49,6 +70,10 @@ func (store *InMemoryFeedbackStore) Add(todoID string, feedback *Feedback) (*Fee
 	if feedbacks == nil {
 		feedbacks = make([]*Feedback, 0)
 	}
+
+	if newFeedback.ParentID != "" && indexOfFeedback(feedbacks, newFeedback.ParentID) < 0 {
+		return nil, ErrNotFound
+	}
 	feedbacks = append(feedbacks, newFeedback)
 
 	store.feedbacks[todoID] = feedbacks
@@ -59,10 +84,80 @@ func (store *InMemoryFeedbackStore) Find(todoID string) ([]*Feedback, error) {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
 
-	fs := store.feedbacks[todoID]
+	fs := make([]*Feedback, 0, len(store.feedbacks[todoID]))
+	for _, feedback := range store.feedbacks[todoID] {
+		other, err := deepCopyFeedback(feedback)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, other)
+	}
 	return fs, nil
 }
 
+func (store *InMemoryFeedbackStore) Get(todoID string, feedbackID string) (*Feedback, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	feedbacks := store.feedbacks[todoID]
+	i := indexOfFeedback(feedbacks, feedbackID)
+	if i < 0 {
+		return nil, nil
+	}
+
+	return deepCopyFeedback(feedbacks[i])
+}
+
+func (store *InMemoryFeedbackStore) Update(todoID string, feedback *Feedback) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	feedbacks := store.feedbacks[todoID]
+	i := indexOfFeedback(feedbacks, feedback.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	feedbacks[i].Content = feedback.Content
+	feedbacks[i].EditedAt = feedback.EditedAt
+	return nil
+}
+
+func (store *InMemoryFeedbackStore) Delete(todoID string, feedbackID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	feedbacks := store.feedbacks[todoID]
+	if indexOfFeedback(feedbacks, feedbackID) < 0 {
+		return ErrNotFound
+	}
+
+	deleted := feedbackThread(feedbacks, feedbackID)
+	store.feedbacks[todoID] = slices.DeleteFunc(feedbacks, func(feedback *Feedback) bool {
+		return deleted[feedback.ID]
+	})
+	return nil
+}
+
+func indexOfFeedback(feedbacks []*Feedback, feedbackID string) int {
+	return slices.IndexFunc(feedbacks, func(feedback *Feedback) bool {
+		return feedback.ID == feedbackID
+	})
+}
+
+// feedbackThread returns the IDs of the feedback and of all its replies, the
+// feedbacks must be in the order they were added so replies follow their parent
+func feedbackThread(feedbacks []*Feedback, feedbackID string) map[string]bool {
+	thread := map[string]bool{feedbackID: true}
+	for _, feedback := range feedbacks {
+		if thread[feedback.ParentID] {
+			thread[feedback.ID] = true
+		}
+	}
+
+	return thread
+}
+
 func deepCopyFeedback(feedback *Feedback) (*Feedback, error) {
 	other := &Feedback{}
 
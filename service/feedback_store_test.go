@@ -0,0 +1,20 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryFeedbackStore(t *testing.T) {
+	storetest.RunFeedbackStoreTests(t, func(t *testing.T) service.FeedbackStore {
+		return service.NewInMemoryFeedbackStore()
+	})
+}
+
+func TestBoltFeedbackStore(t *testing.T) {
+	storetest.RunFeedbackStoreTests(t, func(t *testing.T) service.FeedbackStore {
+		return service.NewBoltFeedbackStore(newTestBoltDB(t))
+	})
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// GatewayPathPrefix is the path prefix of the REST/JSON API
+const GatewayPathPrefix = "/v1/"
+
+// NewGatewayHandler serves TodoService and AuthService over REST/JSON, as
+// mapped by the google.api.http options of the protos, by calling the gRPC
+// server at grpcAddress. The Authorization header is sent as the authorization
+// metadata, and streamed responses are newline delimited JSON objects with the
+// message in "result" or the status in "error".
+func NewGatewayHandler(ctx context.Context, grpcAddress string, dialOptions []grpc.DialOption) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+	)
+
+	err := pb.RegisterTodoServiceHandlerFromEndpoint(ctx, mux, grpcAddress, dialOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot register todo service gateway: %w", err)
+	}
+
+	err = pb.RegisterAuthServiceHandlerFromEndpoint(ctx, mux, grpcAddress, dialOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot register auth service gateway: %w", err)
+	}
+
+	return mux, nil
+}
+
+// PipeListener is an in-memory listener, the gateway reaches a gRPC server
+// served on it without a network connection, so without the TLS and the
+// client certificate the network listener may require
+type PipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (listener *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-listener.conns:
+		return conn, nil
+	case <-listener.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (listener *PipeListener) Close() error {
+	listener.closeOnce.Do(func() {
+		close(listener.done)
+	})
+	return nil
+}
+
+func (listener *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// DialContext connects to the listener, it is the dialer of
+// grpc.WithContextDialer
+func (listener *PipeListener) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	clientConn, serverConn := net.Pipe()
+	select {
+	case listener.conns <- serverConn:
+		return clientConn, nil
+	case <-listener.done:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
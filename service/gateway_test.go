@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// newTestGateway serves a todo and auth server with the admin user philly
+// through the gateway
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	servers := newTestServers(t, newInMemoryAuthStores(), map[string]string{"philly": "admin"})
+	listener := servers.serve(t, servers.interceptor(map[string][]string{
+		"/todoGoGrpc.TodoService/CreateTodo": {"admin"},
+		"/todoGoGrpc.TodoService/GetTodos":   {"admin"},
+	}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	gateway, err := service.NewGatewayHandler(
+		ctx,
+		"passthrough:///gateway",
+		[]grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(listener.DialContext),
+		},
+	)
+	if err != nil {
+		t.Fatalf("NewGatewayHandler: %v", err)
+	}
+
+	server := httptest.NewServer(gateway)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGatewayBearerToken(t *testing.T) {
+	server := newTestGateway(t)
+
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	res := gatewayRequest(t, server, http.MethodPost, "/v1/auth/login", "", `{"username":"philly","password":"secret123"}`)
+	decodeGatewayResponse(t, res, http.StatusOK, &login)
+
+	res = gatewayRequest(t, server, http.MethodPost, "/v1/todos", "", `{"title":"todo"}`)
+	decodeGatewayResponse(t, res, http.StatusUnauthorized, nil)
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	res = gatewayRequest(t, server, http.MethodPost, "/v1/todos", "Bearer "+login.AccessToken, `{"title":"todo"}`)
+	decodeGatewayResponse(t, res, http.StatusOK, &created)
+	if created.ID == "" {
+		t.Fatal("CreateTodo: got no ID")
+	}
+}
+
+func TestGatewayStreamsNewlineDelimitedJSON(t *testing.T) {
+	server := newTestGateway(t)
+
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	res := gatewayRequest(t, server, http.MethodPost, "/v1/auth/login", "", `{"username":"philly","password":"secret123"}`)
+	decodeGatewayResponse(t, res, http.StatusOK, &login)
+
+	for _, title := range []string{"b", "a", "c"} {
+		res = gatewayRequest(t, server, http.MethodPost, "/v1/todos", "Bearer "+login.AccessToken, `{"title":"`+title+`"}`)
+		decodeGatewayResponse(t, res, http.StatusOK, nil)
+	}
+
+	res = gatewayRequest(t, server, http.MethodGet, "/v1/todos?order_by=title", "Bearer "+login.AccessToken, "")
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GetTodos: got status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	titles := make([]string, 0)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var line struct {
+			Result struct {
+				Todo struct {
+					Title string `json:"title"`
+				} `json:"todo"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		titles = append(titles, line.Result.Todo.Title)
+	}
+
+	if strings.Join(titles, ",") != "a,b,c" {
+		t.Fatalf("GetTodos: got titles %v, want [a b c]", titles)
+	}
+}
+
+func gatewayRequest(t *testing.T, server *httptest.Server, method, path, authorization, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return res
+}
+
+func decodeGatewayResponse(t *testing.T, res *http.Response, statusCode int, v any) {
+	t.Helper()
+	defer res.Body.Close()
+
+	if res.StatusCode != statusCode {
+		t.Fatalf("%s %s: got status %d, want %d", res.Request.Method, res.Request.URL.Path, res.StatusCode, statusCode)
+	}
+
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+}
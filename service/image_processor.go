@@ -0,0 +1,248 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailSizes are the sizes of the boxes the thumbnails of every image fit in
+var ThumbnailSizes = []int{64, 256}
+
+// jpegQuality is the quality JPEG images are re-encoded with
+const jpegQuality = 90
+
+// ProcessedImage is an image re-encoded without its metadata, with its thumbnails
+type ProcessedImage struct {
+	Data       []byte
+	Thumbnails []*Thumbnail
+}
+
+type Thumbnail struct {
+	Variant ImageVariant
+	Data    []byte
+}
+
+// ProcessImage re-encodes the image, so the stored original has no EXIF or
+// other metadata, and generates its thumbnails. The EXIF orientation of a JPEG
+// image is applied to its pixels before it is dropped.
+func ProcessImage(imageData io.Reader) (*ProcessedImage, error) {
+	data, err := io.ReadAll(imageData)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read image: %w", err)
+	}
+
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image: %w", err)
+	}
+
+	var img image.Image
+	processed := &ProcessedImage{}
+	if format == "gif" {
+		// every frame is kept, only the extensions holding metadata are dropped
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode image: %w", err)
+		}
+
+		var buffer bytes.Buffer
+		if err := gif.EncodeAll(&buffer, animation); err != nil {
+			return nil, fmt.Errorf("cannot encode image: %w", err)
+		}
+
+		img = animation.Image[0]
+		processed.Data = buffer.Bytes()
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode image: %w", err)
+		}
+
+		if format == "jpeg" {
+			img = applyOrientation(img, jpegOrientation(data))
+		}
+
+		processed.Data, err = encodeImage(img, format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, size := range ThumbnailSizes {
+		thumbnail, err := newThumbnail(img, format, size)
+		if err != nil {
+			return nil, err
+		}
+		processed.Thumbnails = append(processed.Thumbnails, thumbnail)
+	}
+
+	return processed, nil
+}
+
+// newThumbnail scales the image down to fit in a size by size box, JPEG images
+// have JPEG thumbnails and the other images have PNG thumbnails
+func newThumbnail(img image.Image, format string, size int) (*Thumbnail, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+
+	extension := ".jpg"
+	if format != "jpeg" {
+		format, extension = "png", ".png"
+	}
+
+	data, err := encodeImage(scaled, format)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := &Thumbnail{
+		Variant: ImageVariant{
+			Name:   fmt.Sprintf("thumbnail_%d", size),
+			Type:   extension,
+			Width:  width,
+			Height: height,
+		},
+		Data: data,
+	}
+	return thumbnail, nil
+}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		err = png.Encode(&buffer, img)
+	default:
+		return nil, fmt.Errorf("cannot encode %s images", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode image: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG image, from 1 to 8,
+// or 1 when it has none
+func jpegOrientation(data []byte) int {
+	const (
+		markerSOS         = 0xda
+		markerAPP1        = 0xe1
+		tagOrientation    = 0x0112
+		ifdEntryLength    = 12
+		segmentHeaderSize = 4
+	)
+
+	// segments start after the SOI marker and each one has a 2 byte marker and
+	// a 2 byte length including the length itself
+	for i := 2; i+segmentHeaderSize <= len(data) && data[i] == 0xff; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == markerSOS || length < 2 || i+2+length > len(data) {
+			break
+		}
+
+		segment := data[i+segmentHeaderSize : i+2+length]
+		i += 2 + length
+		if marker != markerAPP1 || !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			continue
+		}
+
+		tiff := segment[6:]
+		if len(tiff) < 8 {
+			return 1
+		}
+
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+
+		count := int(order.Uint16(tiff[ifd:]))
+		for entry := ifd + 2; entry+ifdEntryLength <= len(tiff) && count > 0; entry, count = entry+ifdEntryLength, count-1 {
+			if order.Uint16(tiff[entry:]) != tagOrientation {
+				continue
+			}
+
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+		return 1
+	}
+
+	return 1
+}
+
+// applyOrientation flips and rotates the image as the EXIF orientation says
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var srcX, srcY int
+			switch orientation {
+			case 2:
+				srcX, srcY = width-1-x, y
+			case 3:
+				srcX, srcY = width-1-x, height-1-y
+			case 4:
+				srcX, srcY = x, height-1-y
+			case 5:
+				srcX, srcY = y, x
+			case 6:
+				srcX, srcY = y, height-1-x
+			case 7:
+				srcX, srcY = width-1-y, height-1-x
+			case 8:
+				srcX, srcY = width-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+srcX, bounds.Min.Y+srcY))
+		}
+	}
+
+	return dst
+}
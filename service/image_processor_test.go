@@ -0,0 +1,100 @@
+package service_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+// withExifOrientation inserts an APP1 segment with the EXIF orientation after
+// the SOI marker of a JPEG image
+func withExifOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func TestProcessImage(t *testing.T) {
+	// a 400x100 image, red on the left half and blue on the right half
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 200 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, nil); err != nil {
+		t.Fatalf("cannot encode JPEG: %v", err)
+	}
+
+	// orientation 6 rotates the image 90 degrees clockwise when it is displayed
+	data := withExifOrientation(buffer.Bytes(), 6)
+	processed, err := service.ProcessImage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ProcessImage: %v", err)
+	}
+
+	if bytes.Contains(processed.Data, []byte("Exif")) {
+		t.Error("processed image still has EXIF metadata")
+	}
+
+	original, err := jpeg.Decode(bytes.NewReader(processed.Data))
+	if err != nil {
+		t.Fatalf("cannot decode processed image: %v", err)
+	}
+	if size := original.Bounds().Size(); size != image.Pt(100, 400) {
+		t.Fatalf("processed image size: got %v, want 100x400", size)
+	}
+
+	// the left half ends up on top after the rotation
+	if r, _, b, _ := original.At(50, 100).RGBA(); r < b {
+		t.Errorf("processed image top is not red: r=%d b=%d", r, b)
+	}
+	if r, _, b, _ := original.At(50, 300).RGBA(); b < r {
+		t.Errorf("processed image bottom is not blue: r=%d b=%d", r, b)
+	}
+
+	if len(processed.Thumbnails) != len(service.ThumbnailSizes) {
+		t.Fatalf("got %d thumbnails, want %d", len(processed.Thumbnails), len(service.ThumbnailSizes))
+	}
+
+	want := map[string]image.Point{
+		"thumbnail_64":  image.Pt(16, 64),
+		"thumbnail_256": image.Pt(64, 256),
+	}
+	for _, thumbnail := range processed.Thumbnails {
+		variant := thumbnail.Variant
+		if image.Pt(variant.Width, variant.Height) != want[variant.Name] || variant.Type != ".jpg" {
+			t.Errorf("thumbnail %s: got %dx%d %s, want %v .jpg", variant.Name, variant.Width, variant.Height, variant.Type, want[variant.Name])
+		}
+
+		decoded, err := jpeg.Decode(bytes.NewReader(thumbnail.Data))
+		if err != nil {
+			t.Fatalf("cannot decode thumbnail %s: %v", variant.Name, err)
+		}
+		if decoded.Bounds().Size() != want[variant.Name] {
+			t.Errorf("thumbnail %s: got data of size %v, want %v", variant.Name, decoded.Bounds().Size(), want[variant.Name])
+		}
+	}
+}
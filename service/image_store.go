@@ -1,23 +1,79 @@
 package service
 
 import (
-	"bytes"
+	"cmp"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type ImageStore interface {
 	// Save saves a new todo image to the store
-	Save(todoID string, imageType string, imageData bytes.Buffer) (string, error)
+	Save(todoID string, imageType string, imageData io.Reader) (string, error)
+	// Find returns nil when there is no image with the ID
+	Find(imageID string) (*ImageInfo, error)
+	// List returns the images of a todo in upload order
+	List(todoID string) ([]*ImageInfo, error)
+	// SaveVariant saves a resized copy of an image, its size is set by the store
+	SaveVariant(imageID string, variant ImageVariant, imageData io.Reader) error
+	// Open returns a reader of the image data, or of the data of one of its
+	// variants when the variant name is not empty, the caller must close it
+	Open(imageID string, variant string) (io.ReadCloser, error)
+	// Delete deletes the image and its variants, it returns ErrNotFound when
+	// there is no image with the ID
+	Delete(imageID string) error
+}
+
+// ImagePresigner is implemented by the image stores that can give out URLs
+// images can be downloaded from without going through the server
+type ImagePresigner interface {
+	// PresignURL returns a URL of the image, or of one of its variants when the
+	// variant name is not empty, that can be used until the expiry
+	PresignURL(imageID string, variant string, expiry time.Duration) (string, error)
 }
 
 type ImageInfo struct {
-	TodoID string
+	ID         string
+	TodoID     string
+	Type       string
+	Path       string
+	Size       int64
+	UploadedAt time.Time
+	Variants   []ImageVariant
+}
+
+// ImageVariant is a resized copy of an image, like a thumbnail
+type ImageVariant struct {
+	Name   string
 	Type   string
 	Path   string
+	Size   int64
+	Width  int
+	Height int
+}
+
+// Variant returns nil when the image has no variant with the name
+func (image *ImageInfo) Variant(name string) *ImageVariant {
+	for i := range image.Variants {
+		if image.Variants[i].Name == name {
+			return &image.Variants[i]
+		}
+	}
+
+	return nil
+}
+
+func (image *ImageInfo) clone() *ImageInfo {
+	other := *image
+	other.Variants = slices.Clone(image.Variants)
+	return &other
 }
 
 type DiskImageStore struct {
@@ -33,7 +89,11 @@ func NewDiskImageStore(imageFolder string) *DiskImageStore {
 	}
 }
 
-func (store *DiskImageStore) Save(todoID string, imageType string, imageData bytes.Buffer) (string, error) {
+func (store *DiskImageStore) Save(todoID string, imageType string, imageData io.Reader) (string, error) {
+	if err := ValidateImageType(imageType); err != nil {
+		return "", err
+	}
+
 	imageID, err := uuid.NewRandom()
 	if err != nil {
 		return "", fmt.Errorf("cannot generate image id: %w", err)
@@ -45,8 +105,9 @@ func (store *DiskImageStore) Save(todoID string, imageType string, imageData byt
 	if err != nil {
 		return "", fmt.Errorf("cannot create image file: %w", err)
 	}
+	defer file.Close()
 
-	_, err = imageData.WriteTo(file)
+	size, err := io.Copy(file, imageData)
 	if err != nil {
 		return "", fmt.Errorf("cannot wrtie image to file: %w", err)
 	}
@@ -55,10 +116,145 @@ func (store *DiskImageStore) Save(todoID string, imageType string, imageData byt
 	defer store.mutex.Unlock()
 
 	store.images[imageID.String()] = &ImageInfo{
-		TodoID: todoID,
-		Type:   imageType,
-		Path:   imagePath,
+		ID:         imageID.String(),
+		TodoID:     todoID,
+		Type:       imageType,
+		Path:       imagePath,
+		Size:       size,
+		UploadedAt: time.Now(),
 	}
 
 	return imageID.String(), nil
 }
+
+func (store *DiskImageStore) Find(imageID string) (*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return nil, nil
+	}
+
+	return image.clone(), nil
+}
+
+func (store *DiskImageStore) List(todoID string) ([]*ImageInfo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	images := make([]*ImageInfo, 0)
+	for _, image := range store.images {
+		if image.TodoID == todoID {
+			images = append(images, image.clone())
+		}
+	}
+
+	slices.SortFunc(images, func(a, b *ImageInfo) int {
+		if c := a.UploadedAt.Compare(b.UploadedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return images, nil
+}
+
+func (store *DiskImageStore) SaveVariant(imageID string, variant ImageVariant, imageData io.Reader) error {
+	if err := ValidateImageType(variant.Type); err != nil {
+		return err
+	}
+
+	if err := ValidateImageType(variant.Name); err != nil {
+		return fmt.Errorf("invalid variant name: %w", err)
+	}
+
+	image, err := store.Find(imageID)
+	if err != nil {
+		return err
+	}
+
+	if image == nil {
+		return ErrNotFound
+	}
+
+	variant.Path = fmt.Sprintf("%s/%s_%s%s", store.imageFolder, imageID, variant.Name, variant.Type)
+
+	file, err := os.Create(variant.Path)
+	if err != nil {
+		return fmt.Errorf("cannot create image file: %w", err)
+	}
+	defer file.Close()
+
+	variant.Size, err = io.Copy(file, imageData)
+	if err != nil {
+		return fmt.Errorf("cannot write image to file: %w", err)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image = store.images[imageID]
+	if image == nil {
+		os.Remove(variant.Path)
+		return ErrNotFound
+	}
+
+	if existing := image.Variant(variant.Name); existing != nil {
+		*existing = variant
+	} else {
+		image.Variants = append(image.Variants, variant)
+	}
+	return nil
+}
+
+func (store *DiskImageStore) Open(imageID string, variant string) (io.ReadCloser, error) {
+	image, err := store.Find(imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if image == nil {
+		return nil, ErrNotFound
+	}
+
+	path := image.Path
+	if variant != "" {
+		found := image.Variant(variant)
+		if found == nil {
+			return nil, ErrNotFound
+		}
+		path = found.Path
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open image file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (store *DiskImageStore) Delete(imageID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	image := store.images[imageID]
+	if image == nil {
+		return ErrNotFound
+	}
+
+	paths := []string{image.Path}
+	for _, variant := range image.Variants {
+		paths = append(paths, variant.Path)
+	}
+
+	for _, path := range paths {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("cannot delete image file: %w", err)
+		}
+	}
+
+	delete(store.images, imageID)
+	return nil
+}
@@ -0,0 +1,268 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/s3test"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestDiskImageStore(t *testing.T) {
+	storetest.RunImageStoreTests(t, func(t *testing.T) service.ImageStore {
+		return service.NewDiskImageStore(t.TempDir())
+	})
+}
+
+func TestContentAddressedImageStore(t *testing.T) {
+	storetest.RunImageStoreTests(t, func(t *testing.T) service.ImageStore {
+		return newTestContentAddressedImageStore(t, t.TempDir())
+	})
+}
+
+func TestContentAddressedImageStoreOnS3(t *testing.T) {
+	storetest.RunImageStoreTests(t, func(t *testing.T) service.ImageStore {
+		store, err := service.NewContentAddressedImageStore(newTestS3BlobStore(t))
+		if err != nil {
+			t.Fatalf("NewContentAddressedImageStore: %v", err)
+		}
+
+		return store
+	})
+}
+
+func TestContentAddressedImageStoreSharesBlobs(t *testing.T) {
+	folder := t.TempDir()
+	store := newTestContentAddressedImageStore(t, folder)
+
+	first := mustSaveImage(t, store, "todo-1", "screenshot")
+	second := mustSaveImage(t, store, "todo-2", "screenshot")
+	if got := countBlobs(t, folder); got != 1 {
+		t.Fatalf("blobs after saving the same image twice: got %d, want 1", got)
+	}
+
+	if err := store.Delete(first); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := countBlobs(t, folder); got != 1 {
+		t.Fatalf("blobs after deleting one reference: got %d, want 1", got)
+	}
+
+	if err := store.Delete(second); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := countBlobs(t, folder); got != 0 {
+		t.Fatalf("blobs after deleting every reference: got %d, want 0", got)
+	}
+}
+
+func TestContentAddressedImageStoreReload(t *testing.T) {
+	folder := t.TempDir()
+	store := newTestContentAddressedImageStore(t, folder)
+
+	id := mustSaveImage(t, store, "todo-1", "image")
+	variant := service.ImageVariant{Name: "thumbnail_64", Type: ".png", Width: 64, Height: 64}
+	if err := store.SaveVariant(id, variant, strings.NewReader("thumbnail")); err != nil {
+		t.Fatalf("SaveVariant: %v", err)
+	}
+
+	// a blob left by a crash between writing it and its reference
+	orphan := filepath.Join(folder, "blobs", "00", strings.Repeat("0", 64))
+	if err := os.MkdirAll(filepath.Dir(orphan), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orphan, []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestContentAddressedImageStore(t, folder)
+	image, err := reloaded.Find(id)
+	if err != nil || image == nil {
+		t.Fatalf("Find after reload: got (%v, %v), want the image", image, err)
+	}
+	if image.TodoID != "todo-1" || image.Size != int64(len("image")) || image.Variant("thumbnail_64") == nil {
+		t.Fatalf("Find after reload: got %+v, want the image with its thumbnail", image)
+	}
+
+	if got := readImage(t, reloaded, id, "thumbnail_64"); got != "thumbnail" {
+		t.Fatalf("Open variant after reload: got %q, want %q", got, "thumbnail")
+	}
+
+	if _, err := os.Stat(orphan); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("unreferenced blob after reload: got %v, want it deleted", err)
+	}
+	if got := countBlobs(t, folder); got != 2 {
+		t.Fatalf("blobs after reload: got %d, want 2", got)
+	}
+}
+
+// slowBlobDeletes delays the deletes of image data, it signals the start of
+// each on deleting
+type slowBlobDeletes struct {
+	service.BlobStore
+	deleting chan struct{}
+}
+
+func (store *slowBlobDeletes) Delete(key string) error {
+	if strings.HasPrefix(key, "blobs/") {
+		store.deleting <- struct{}{}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return store.BlobStore.Delete(key)
+}
+
+func TestContentAddressedImageStoreSaveWhileAnotherServerDeletes(t *testing.T) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+
+	blobs := &slowBlobDeletes{newTestS3BlobStoreOn(t, server), make(chan struct{})}
+	deleting, err := service.NewContentAddressedImageStore(blobs)
+	if err != nil {
+		t.Fatalf("NewContentAddressedImageStore: %v", err)
+	}
+	saving, err := service.NewContentAddressedImageStore(newTestS3BlobStoreOn(t, server))
+	if err != nil {
+		t.Fatalf("NewContentAddressedImageStore: %v", err)
+	}
+
+	id := mustSaveImage(t, deleting, "todo-1", "screenshot")
+	deleted := make(chan error)
+	go func() { deleted <- deleting.Delete(id) }()
+
+	// the other server references the blob while it is being deleted
+	<-blobs.deleting
+	saved := mustSaveImage(t, saving, "todo-2", "screenshot")
+	if err := <-deleted; err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if got := readImage(t, saving, saved, ""); got != "screenshot" {
+		t.Fatalf("Open the image saved during the delete: got %q, want %q", got, "screenshot")
+	}
+}
+
+func TestContentAddressedImageStoreConcurrentServers(t *testing.T) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+
+	stores := make([]*service.ContentAddressedImageStore, 2)
+	for i := range stores {
+		store, err := service.NewContentAddressedImageStore(newTestS3BlobStoreOn(t, server))
+		if err != nil {
+			t.Fatalf("NewContentAddressedImageStore: %v", err)
+		}
+		stores[i] = store
+	}
+
+	// both servers save and delete the same images, the images they keep must
+	// still have their data
+	const rounds = 20
+	kept := make([][]string, len(stores))
+	errs := make(chan error, len(stores))
+	for i, store := range stores {
+		go func(i int, store *service.ContentAddressedImageStore) {
+			for round := 0; round < rounds; round++ {
+				data := fmt.Sprintf("image %d", round%3)
+				id, err := store.Save(fmt.Sprintf("todo-%d", i), ".png", strings.NewReader(data))
+				if err != nil {
+					errs <- fmt.Errorf("Save: %w", err)
+					return
+				}
+
+				if round%2 == 0 {
+					kept[i] = append(kept[i], id)
+					continue
+				}
+				if err := store.Delete(id); err != nil {
+					errs <- fmt.Errorf("Delete: %w", err)
+					return
+				}
+			}
+			errs <- nil
+		}(i, store)
+	}
+	for range stores {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, ids := range kept {
+		for _, id := range ids {
+			image, err := stores[i].Find(id)
+			if err != nil || image == nil {
+				t.Fatalf("Find: got (%v, %v), want the image", image, err)
+			}
+			readImage(t, stores[1-i], id, "")
+		}
+	}
+}
+
+func newTestContentAddressedImageStore(t *testing.T, folder string) *service.ContentAddressedImageStore {
+	t.Helper()
+
+	blobStore, err := service.NewFileBlobStore(folder)
+	if err != nil {
+		t.Fatalf("NewFileBlobStore: %v", err)
+	}
+
+	store, err := service.NewContentAddressedImageStore(blobStore)
+	if err != nil {
+		t.Fatalf("NewContentAddressedImageStore: %v", err)
+	}
+
+	return store
+}
+
+func mustSaveImage(t *testing.T, store service.ImageStore, todoID string, data string) string {
+	t.Helper()
+
+	id, err := store.Save(todoID, ".png", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	return id
+}
+
+func readImage(t *testing.T, store service.ImageStore, imageID string, variant string) string {
+	t.Helper()
+
+	reader, err := store.Open(imageID, variant)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read image: %v", err)
+	}
+
+	return string(data)
+}
+
+func countBlobs(t *testing.T, folder string) int {
+	t.Helper()
+
+	count := 0
+	err := filepath.WalkDir(filepath.Join(folder, "blobs"), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("cannot walk blobs: %v", err)
+	}
+
+	return count
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// JWKSPath is where the JWKS document is conventionally served
+const JWKSPath = "/.well-known/jwks.json"
+
+// NewJWKSHandler serves the public keys of the manager as a JWKS document so
+// other services can verify access tokens on their own
+func NewJWKSHandler(jwtManager *JWTManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		err := json.NewEncoder(w).Encode(jwtManager.JWKS())
+		if err != nil {
+			log.Printf("cannot write JWKS: %v", err)
+		}
+	})
+}
@@ -3,17 +3,24 @@ package service
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type contextKey string
 
 const userClaimsKey = contextKey("userClaims")
 
+// JWTManager signs access tokens either with an HMAC secret key or with an
+// asymmetric signing key
 type JWTManager struct {
 	secretKey     string
+	signingKey    *SigningKey
+	keys          map[string]*SigningKey
 	tokenDuration time.Duration
 }
 
@@ -23,6 +30,8 @@ type UserClaims struct {
 	Role     string `json:"role"`
 }
 
+// NewJWTManager signs tokens with an HMAC secret key, it is meant for tests as
+// everyone knowing the secret can forge tokens
 func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 	return &JWTManager{
 		secretKey:     secretKey,
@@ -30,17 +39,64 @@ func NewJWTManager(secretKey string, tokenDuration time.Duration) *JWTManager {
 	}
 }
 
-func (manager *JWTManager) Generate(user *User) (string, error) {
-	claims := UserClaims{
+// NewJWTManagerWithKeys signs tokens with the signing key and verifies tokens
+// signed by any of the keys, so keys can be rotated by first adding the new key,
+// then signing with it and finally removing the old key once its tokens expired
+func NewJWTManagerWithKeys(signingKey *SigningKey, verificationKeys []*SigningKey, tokenDuration time.Duration) (*JWTManager, error) {
+	if signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %s has no private key", signingKey.ID)
+	}
+
+	keys := map[string]*SigningKey{
+		signingKey.ID: signingKey,
+	}
+	for _, key := range verificationKeys {
+		if other := keys[key.ID]; other != nil && other != key {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return &JWTManager{
+		signingKey:    signingKey,
+		keys:          keys,
+		tokenDuration: tokenDuration,
+	}, nil
+}
+
+// Generate signs a new access token for the user, the claims carry a unique
+// token ID (jti) so the token can be revoked
+func (manager *JWTManager) Generate(user *User) (string, *UserClaims, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot generate token id: %w", err)
+	}
+
+	now := time.Now()
+	claims := &UserClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(manager.tokenDuration)),
+			ID:        tokenID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(manager.tokenDuration)),
 		},
 		Username: user.Username,
 		Role:     user.Role,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(manager.secretKey))
+	var signed string
+	if manager.signingKey == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		signed, err = token.SignedString([]byte(manager.secretKey))
+	} else {
+		token := jwt.NewWithClaims(manager.signingKey.Method, claims)
+		token.Header["kid"] = manager.signingKey.ID
+		signed, err = token.SignedString(manager.signingKey.PrivateKey)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
 }
 
 func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
@@ -49,14 +105,7 @@ func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		accessToken,
 		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			_, ok := token.Method.(*jwt.SigningMethodHMAC)
-			if !ok {
-				return nil, fmt.Errorf("unexpected token signing method")
-			}
-
-			return []byte(manager.secretKey), nil
-		},
+		manager.verificationKey,
 	)
 
 	if err != nil {
@@ -70,6 +119,48 @@ func (manager *JWTManager) Verify(accessToken string) (*UserClaims, error) {
 	return claims, nil
 }
 
+// verificationKey finds the key of the token, the signing method of the token
+// must match the method of the key
+func (manager *JWTManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if manager.signingKey == nil {
+		_, ok := token.Method.(*jwt.SigningMethodHMAC)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token signing method")
+		}
+
+		return []byte(manager.secretKey), nil
+	}
+
+	keyID, _ := token.Header["kid"].(string)
+	key := manager.keys[keyID]
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected token signing method")
+	}
+
+	return key.PublicKey, nil
+}
+
+// JWKS returns the public keys that verify tokens, it is empty when tokens are
+// signed with a secret key
+func (manager *JWTManager) JWKS() *JSONWebKeySet {
+	keySet := &JSONWebKeySet{
+		Keys: make([]JSONWebKey, 0, len(manager.keys)),
+	}
+
+	for _, key := range manager.keys {
+		keySet.Keys = append(keySet.Keys, key.JSONWebKey())
+	}
+
+	slices.SortFunc(keySet.Keys, func(a, b JSONWebKey) int {
+		return strings.Compare(a.KeyID, b.KeyID)
+	})
+	return keySet
+}
+
 func GetUserClaims(ctx context.Context) (*UserClaims, error) {
 	claims, ok := ctx.Value(userClaimsKey).(*UserClaims)
 	if !ok {
@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+func newTestSigningKeys(t *testing.T) []*service.SigningKey {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate ECDSA key: %v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate Ed25519 key: %v", err)
+	}
+
+	keys := make([]*service.SigningKey, 0)
+	for id, key := range map[string]any{"rsa": rsaKey, "ec": ecKey, "ed": edKey} {
+		signingKey, err := service.NewSigningKey(id, key)
+		if err != nil {
+			t.Fatalf("NewSigningKey %s: %v", id, err)
+		}
+		keys = append(keys, signingKey)
+	}
+
+	return keys
+}
+
+func TestJWTManagerKeyRotation(t *testing.T) {
+	user, err := service.NewUser("alice", "secret123", "user")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+
+	keys := newTestSigningKeys(t)
+	for i, oldKey := range keys {
+		newKey := keys[(i+1)%len(keys)]
+
+		t.Run(oldKey.Method.Alg(), func(t *testing.T) {
+			oldManager, err := service.NewJWTManagerWithKeys(oldKey, nil, time.Minute)
+			if err != nil {
+				t.Fatalf("NewJWTManagerWithKeys: %v", err)
+			}
+
+			token, _, err := oldManager.Generate(user)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+
+			rotatedManager, err := service.NewJWTManagerWithKeys(newKey, []*service.SigningKey{oldKey}, time.Minute)
+			if err != nil {
+				t.Fatalf("NewJWTManagerWithKeys: %v", err)
+			}
+
+			claims, err := rotatedManager.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify with the old key still active: %v", err)
+			}
+			if claims.Username != user.Username || claims.ID == "" {
+				t.Fatalf("Verify: got claims %+v", claims)
+			}
+
+			if len(rotatedManager.JWKS().Keys) != 2 {
+				t.Fatalf("JWKS: got %d keys, want 2", len(rotatedManager.JWKS().Keys))
+			}
+
+			newManager, err := service.NewJWTManagerWithKeys(newKey, nil, time.Minute)
+			if err != nil {
+				t.Fatalf("NewJWTManagerWithKeys: %v", err)
+			}
+
+			if _, err := newManager.Verify(token); err == nil {
+				t.Fatal("Verify with the old key removed: got no error")
+			}
+		})
+	}
+}
+
+func TestJWTManagerRejectsSecretKeyTokens(t *testing.T) {
+	user, err := service.NewUser("alice", "secret123", "user")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+
+	token, _, err := service.NewJWTManager("secret", time.Minute).Generate(user)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	keys := newTestSigningKeys(t)
+	manager, err := service.NewJWTManagerWithKeys(keys[0], keys[1:], time.Minute)
+	if err != nil {
+		t.Fatalf("NewJWTManagerWithKeys: %v", err)
+	}
+
+	if _, err := manager.Verify(token); err == nil {
+		t.Fatal("Verify HMAC token with asymmetric keys: got no error")
+	}
+}
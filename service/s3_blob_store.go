@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// MinS3PartSize is the smallest part size of a multipart upload S3 accepts
+const MinS3PartSize = 5 << 20
+
+// S3BlobStore stores every blob in an object of an S3 compatible bucket, blobs
+// larger than the part size are sent with a multipart upload
+type S3BlobStore struct {
+	client   *minio.Client
+	bucket   string
+	partSize uint64
+}
+
+// NewS3BlobStore creates the bucket when it does not exist
+func NewS3BlobStore(client *minio.Client, bucket string, partSize uint64) (*S3BlobStore, error) {
+	if partSize < MinS3PartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinS3PartSize)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot check bucket %s: %w", bucket, err)
+	}
+
+	if !exists {
+		err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("cannot create bucket %s: %w", bucket, err)
+		}
+	}
+
+	store := &S3BlobStore{
+		client:   client,
+		bucket:   bucket,
+		partSize: partSize,
+	}
+	return store, nil
+}
+
+func (store *S3BlobStore) Put(key string, data io.Reader, size int64) error {
+	_, err := store.client.PutObject(context.Background(), store.bucket, key, data, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    store.partSize,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot upload object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (store *S3BlobStore) Get(key string) (io.ReadCloser, error) {
+	object, err := store.client.GetObject(context.Background(), store.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get object %s: %w", key, err)
+	}
+
+	// GetObject sends no request until the object is read or stated
+	_, err = object.Stat()
+	if err != nil {
+		object.Close()
+		if isS3NotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("cannot get object %s: %w", key, err)
+	}
+
+	return object, nil
+}
+
+func (store *S3BlobStore) Delete(key string) error {
+	err := store.client.RemoveObject(context.Background(), store.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil && !isS3NotFound(err) {
+		return fmt.Errorf("cannot delete object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (store *S3BlobStore) List(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	objects := store.client.ListObjects(context.Background(), store.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, fmt.Errorf("cannot list objects: %w", object.Err)
+		}
+		keys = append(keys, object.Key)
+	}
+
+	return keys, nil
+}
+
+func (store *S3BlobStore) PresignGet(key string, expiry time.Duration) (string, error) {
+	url, err := store.client.PresignedGetObject(context.Background(), store.bucket, key, expiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot presign object %s: %w", key, err)
+	}
+
+	return url.String(), nil
+}
+
+func isS3NotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
@@ -0,0 +1,341 @@
+// Package s3test provides an in-memory S3 server for tests.
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Server implements the S3 requests the blob store sends: buckets, objects,
+// listing and multipart uploads. It does not check signatures, so presigned
+// URLs can be fetched from it too.
+type Server struct {
+	*httptest.Server
+
+	mutex   sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*multipartUpload
+	// completedUploads is the number of completed multipart uploads
+	completedUploads int
+}
+
+type object struct {
+	data     []byte
+	etag     string
+	modified time.Time
+}
+
+type multipartUpload struct {
+	bucket string
+	key    string
+	parts  map[int]*object
+}
+
+func NewServer() *Server {
+	server := &Server{
+		buckets: make(map[string]map[string]*object),
+		uploads: make(map[string]*multipartUpload),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+// Endpoint returns the host and port of the server, without the scheme
+func (server *Server) Endpoint() string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// CompletedMultipartUploads returns the number of completed multipart uploads
+func (server *Server) CompletedMultipartUploads() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.completedUploads
+}
+
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	if key == "" {
+		server.handleBucket(w, r, bucket)
+		return
+	}
+
+	objects := server.buckets[bucket]
+	if objects == nil {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := uuid.New().String()
+		server.uploads[id] = &multipartUpload{bucket: bucket, key: key, parts: make(map[int]*object)}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		upload := server.uploads[query.Get("uploadId")]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if upload == nil || err != nil {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+
+		part, err := readObject(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		upload.parts[number] = part
+		w.Header().Set("ETag", part.etag)
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		server.completeUpload(w, r, query.Get("uploadId"))
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(server.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		object, err := readObject(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		objects[key] = object
+		w.Header().Set("ETag", object.etag)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object := objects[key]
+		if object == nil {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		w.Header().Set("ETag", object.etag)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		http.ServeContent(w, r, "", object.modified, bytes.NewReader(object.data))
+
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (server *Server) handleBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	objects := server.buckets[bucket]
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodPut:
+		if objects == nil {
+			server.buckets[bucket] = make(map[string]*object)
+		}
+
+	case objects == nil:
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+
+	case r.Method == http.MethodHead:
+
+	case r.Method == http.MethodGet && query.Has("location"):
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+		}{})
+
+	case r.Method == http.MethodGet:
+		server.listObjects(w, objects, query.Get("prefix"))
+
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+type listedObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+	StorageClass string
+}
+
+// listObjects returns every object with the prefix in a single page
+func (server *Server) listObjects(w http.ResponseWriter, objects map[string]*object, prefix string) {
+	keys := make([]string, 0)
+	for key := range objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	contents := make([]listedObject, 0, len(keys))
+	for _, key := range keys {
+		object := objects[key]
+		contents = append(contents, listedObject{
+			Key:          key,
+			LastModified: object.modified.UTC().Format(time.RFC3339),
+			ETag:         object.etag,
+			Size:         len(object.data),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	writeXML(w, struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []listedObject
+	}{Prefix: prefix, KeyCount: len(contents), MaxKeys: len(contents), Contents: contents})
+}
+
+func (server *Server) completeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	upload := server.uploads[id]
+	if upload == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	err := xml.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data []byte
+	for _, requested := range request.Parts {
+		part := upload.parts[requested.PartNumber]
+		if part == nil || strings.Trim(requested.ETag, `"`) != strings.Trim(part.etag, `"`) {
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		data = append(data, part.data...)
+	}
+
+	object := newObject(data)
+	object.etag = fmt.Sprintf(`"%s-%d"`, strings.Trim(object.etag, `"`), len(request.Parts))
+	server.buckets[upload.bucket][upload.key] = object
+	delete(server.uploads, id)
+	server.completedUploads++
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+		ETag    string
+	}{Bucket: upload.bucket, Key: upload.key, ETag: object.etag})
+}
+
+// readObject reads the request body, decoding the aws-chunked encoding the
+// client uses to stream signed data over plain HTTP
+func readObject(r *http.Request) (*object, error) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = newChunkedReader(r.Body)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newObject(data), nil
+}
+
+func newObject(data []byte) *object {
+	sum := md5.Sum(data)
+	return &object{
+		data:     data,
+		etag:     `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified: time.Now().Truncate(time.Second),
+	}
+}
+
+// newChunkedReader decodes an aws-chunked body, where every chunk is a line
+// with its hex size and signature followed by its data, until an empty chunk
+func newChunkedReader(body io.Reader) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		buffered := bufio.NewReader(body)
+		for {
+			line, err := buffered.ReadString('\n')
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+
+			hexSize, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+			size, err := strconv.ParseInt(hexSize, 16, 64)
+			if err != nil {
+				writer.CloseWithError(fmt.Errorf("invalid chunk size %q", hexSize))
+				return
+			}
+
+			if size == 0 {
+				writer.Close()
+				return
+			}
+
+			_, err = io.CopyN(writer, buffered, size)
+			if err == nil {
+				_, err = buffered.Discard(2)
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return reader
+}
+
+func writeXML(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
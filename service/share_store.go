@@ -0,0 +1,164 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ShareRole is the access a share grants to a collaborator of a todo
+type ShareRole string
+
+const (
+	ShareRoleViewer    ShareRole = "viewer"
+	ShareRoleCommenter ShareRole = "commenter"
+	ShareRoleEditor    ShareRole = "editor"
+)
+
+// IsValid reports whether the role is one of the known share roles
+func (role ShareRole) IsValid() bool {
+	switch role {
+	case ShareRoleViewer, ShareRoleCommenter, ShareRoleEditor:
+		return true
+	default:
+		return false
+	}
+}
+
+// Allows reports whether the role grants the permission, sharing and deleting
+// a todo are never granted by a share
+func (role ShareRole) Allows(permission TodoPermission) bool {
+	switch role {
+	case ShareRoleViewer:
+		return permission <= TodoPermissionView
+	case ShareRoleCommenter:
+		return permission <= TodoPermissionComment
+	case ShareRoleEditor:
+		return permission <= TodoPermissionEdit
+	default:
+		return false
+	}
+}
+
+// Share grants a user other than the owner access to a todo
+type Share struct {
+	TodoID    string
+	Username  string
+	Role      ShareRole
+	CreatedAt time.Time
+}
+
+type ShareStore interface {
+	// Save creates the share or replaces the role of an existing one
+	Save(share *Share) error
+	// Find returns nil when the todo is not shared with the user
+	Find(todoID, username string) (*Share, error)
+	// Delete returns ErrNotFound when the todo is not shared with the user
+	Delete(todoID, username string) error
+	// ListByTodo returns the shares of a todo ordered by username
+	ListByTodo(todoID string) ([]*Share, error)
+	// ListByUser returns the shares granted to a user ordered by todo ID
+	ListByUser(username string) ([]*Share, error)
+}
+
+type InMemoryShareStore struct {
+	mutex  sync.RWMutex
+	shares map[string]map[string]*Share
+	// byUser indexes the shared todo IDs by the user they are shared with
+	byUser map[string]map[string]bool
+}
+
+func NewInMemoryShareStore() *InMemoryShareStore {
+	return &InMemoryShareStore{
+		shares: make(map[string]map[string]*Share),
+		byUser: make(map[string]map[string]bool),
+	}
+}
+
+func (store *InMemoryShareStore) Save(share *Share) error {
+	if !share.Role.IsValid() {
+		return fmt.Errorf("invalid share role: %q", share.Role)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.shares[share.TodoID] == nil {
+		store.shares[share.TodoID] = make(map[string]*Share)
+	}
+	if store.byUser[share.Username] == nil {
+		store.byUser[share.Username] = make(map[string]bool)
+	}
+
+	other := *share
+	store.shares[share.TodoID][share.Username] = &other
+	store.byUser[share.Username][share.TodoID] = true
+	return nil
+}
+
+func (store *InMemoryShareStore) Find(todoID, username string) (*Share, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	share := store.shares[todoID][username]
+	if share == nil {
+		return nil, nil
+	}
+
+	other := *share
+	return &other, nil
+}
+
+func (store *InMemoryShareStore) Delete(todoID, username string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.shares[todoID][username] == nil {
+		return ErrNotFound
+	}
+
+	delete(store.shares[todoID], username)
+	if len(store.shares[todoID]) == 0 {
+		delete(store.shares, todoID)
+	}
+
+	delete(store.byUser[username], todoID)
+	if len(store.byUser[username]) == 0 {
+		delete(store.byUser, username)
+	}
+	return nil
+}
+
+func (store *InMemoryShareStore) ListByTodo(todoID string) ([]*Share, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	shares := make([]*Share, 0, len(store.shares[todoID]))
+	for _, share := range store.shares[todoID] {
+		other := *share
+		shares = append(shares, &other)
+	}
+
+	slices.SortFunc(shares, func(a, b *Share) int {
+		return cmp.Compare(a.Username, b.Username)
+	})
+	return shares, nil
+}
+
+func (store *InMemoryShareStore) ListByUser(username string) ([]*Share, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	shares := make([]*Share, 0, len(store.byUser[username]))
+	for todoID := range store.byUser[username] {
+		other := *store.shares[todoID][username]
+		shares = append(shares, &other)
+	}
+
+	slices.SortFunc(shares, func(a, b *Share) int {
+		return cmp.Compare(a.TodoID, b.TodoID)
+	})
+	return shares, nil
+}
@@ -0,0 +1,20 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryShareStore(t *testing.T) {
+	storetest.RunShareStoreTests(t, func(t *testing.T) service.ShareStore {
+		return service.NewInMemoryShareStore()
+	})
+}
+
+func TestBoltShareStore(t *testing.T) {
+	storetest.RunShareStoreTests(t, func(t *testing.T) service.ShareStore {
+		return service.NewBoltShareStore(newTestBoltDB(t))
+	})
+}
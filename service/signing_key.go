@@ -0,0 +1,147 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric key used to sign or verify access tokens, its ID
+// is sent as the kid header of the tokens it signs
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// PrivateKey is nil when the key is only used to verify tokens
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// JSONWebKey is the public part of a signing key as defined by RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadSigningKey loads an RSA, ECDSA or Ed25519 key from a PEM file, the file
+// may hold a private key or only a public key. The key ID is the file name
+// without its extension.
+func LoadSigningKey(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in key file %s", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q in key file %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse key file %s: %w", path, err)
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return NewSigningKey(id, key)
+}
+
+// NewSigningKey picks the signing method from the type of the key: RS256 for
+// RSA, ES256/ES384/ES512 for ECDSA depending on the curve and EdDSA for Ed25519
+func NewSigningKey(id string, key any) (*SigningKey, error) {
+	signingKey := &SigningKey{ID: id}
+
+	if signer, ok := key.(crypto.Signer); ok {
+		signingKey.PrivateKey = signer
+		key = signer.Public()
+	}
+	signingKey.PublicKey = key
+
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		signingKey.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch publicKey.Curve {
+		case elliptic.P256():
+			signingKey.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			signingKey.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			signingKey.Method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", publicKey.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		signingKey.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return signingKey, nil
+}
+
+// JSONWebKey returns the public key in the JWK format
+func (key *SigningKey) JSONWebKey() JSONWebKey {
+	jwk := JSONWebKey{
+		KeyID:     key.ID,
+		Use:       "sig",
+		Algorithm: key.Method.Alg(),
+	}
+
+	switch publicKey := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeJWKValue(publicKey.N.Bytes())
+		jwk.E = encodeJWKValue(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = publicKey.Curve.Params().Name
+		jwk.X = encodeJWKValue(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeJWKValue(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encodeJWKValue(publicKey)
+	}
+
+	return jwk
+}
+
+func encodeJWKValue(value []byte) string {
+	return base64.RawURLEncoding.EncodeToString(value)
+}
@@ -0,0 +1,111 @@
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+// RunBlobStoreTests runs the BlobStore conformance tests, newStore must return
+// an empty store for every call
+func RunBlobStoreTests(t *testing.T, newStore func(t *testing.T) service.BlobStore) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		store := newStore(t)
+		mustPutBlob(t, store, "images/a.json", "first")
+		mustPutBlob(t, store, "images/a.json", "second")
+
+		if got := mustGetBlob(t, store, "images/a.json"); got != "second" {
+			t.Fatalf("Get: got %q, want %q", got, "second")
+		}
+	})
+
+	t.Run("UnknownSize", func(t *testing.T) {
+		store := newStore(t)
+		if err := store.Put("blob", strings.NewReader("data"), -1); err != nil {
+			t.Fatalf("Put with unknown size: %v", err)
+		}
+
+		if got := mustGetBlob(t, store, "blob"); got != "data" {
+			t.Fatalf("Get: got %q, want %q", got, "data")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+
+		if _, err := store.Get("missing"); !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Get missing blob: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		if err := store.Delete("missing"); err != nil {
+			t.Fatalf("Delete missing blob: %v", err)
+		}
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		store := newStore(t)
+		for _, key := range []string{"todos/b/2", "todos/a/1", "todos/b/1", "blobs/x"} {
+			mustPutBlob(t, store, key, key)
+		}
+
+		assertBlobKeys(t, store, "todos/", "todos/a/1", "todos/b/1", "todos/b/2")
+		assertBlobKeys(t, store, "todos/b/", "todos/b/1", "todos/b/2")
+		assertBlobKeys(t, store, "none/")
+		assertBlobKeys(t, store, "todos/b/1", "todos/b/1")
+		assertBlobKeys(t, store, "todo", "todos/a/1", "todos/b/1", "todos/b/2")
+		assertBlobKeys(t, store, "", "blobs/x", "todos/a/1", "todos/b/1", "todos/b/2")
+
+		if err := store.Delete("todos/b/1"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		assertBlobKeys(t, store, "todos/b/", "todos/b/2")
+
+		if _, err := store.Get("todos/b/1"); !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Get deleted blob: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+}
+
+func mustPutBlob(t *testing.T, store service.BlobStore, key string, data string) {
+	t.Helper()
+
+	err := store.Put(key, strings.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+}
+
+func mustGetBlob(t *testing.T, store service.BlobStore, key string) string {
+	t.Helper()
+
+	reader, err := store.Get(key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer reader.Close()
+
+	var buffer bytes.Buffer
+	if _, err := io.Copy(&buffer, reader); err != nil {
+		t.Fatalf("read blob: %v", err)
+	}
+
+	return buffer.String()
+}
+
+func assertBlobKeys(t *testing.T, store service.BlobStore, prefix string, want ...string) {
+	t.Helper()
+
+	keys, err := store.List(prefix)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Fatalf("List %q: got keys %v, want %v", prefix, keys, want)
+	}
+}
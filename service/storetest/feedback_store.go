@@ -0,0 +1,239 @@
+package storetest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunFeedbackStoreTests runs the FeedbackStore conformance tests, newStore must
+// return an empty store for every call
+func RunFeedbackStoreTests(t *testing.T, newStore func(t *testing.T) service.FeedbackStore) {
+	t.Run("AddAndFind", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		first := mustAddFeedback(t, store, todoID, "first")
+		second := mustAddFeedback(t, store, todoID, "second")
+		mustAddFeedback(t, store, uuid.New().String(), "other todo")
+
+		if first.ID == "" || first.ID == second.ID {
+			t.Fatalf("Add: got feedback IDs %q and %q, want distinct IDs", first.ID, second.ID)
+		}
+
+		feedbacks, err := store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if len(feedbacks) != 2 {
+			t.Fatalf("Find: got %d feedbacks, want 2", len(feedbacks))
+		}
+		assertFeedback(t, first, feedbacks[0])
+		assertFeedback(t, second, feedbacks[1])
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		feedbacks, err := store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find unknown todo: %v", err)
+		}
+		if len(feedbacks) != 0 {
+			t.Fatalf("Find unknown todo: got %d feedbacks, want none", len(feedbacks))
+		}
+
+		feedback, err := store.Get(todoID, uuid.New().String())
+		if err != nil || feedback != nil {
+			t.Fatalf("Get unknown feedback: got (%v, %v), want (nil, nil)", feedback, err)
+		}
+
+		err = store.Update(todoID, &service.Feedback{ID: uuid.New().String(), Content: "content"})
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Update unknown feedback: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.Delete(todoID, uuid.New().String())
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown feedback: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("GetAndUpdate", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		createdAt := time.Now().Add(-time.Hour)
+		added, err := store.Add(todoID, &service.Feedback{Content: "typo", FromUser: "alice", CreatedAt: createdAt})
+		if err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+
+		editedAt := time.Now()
+		err = store.Update(todoID, &service.Feedback{ID: added.ID, Content: "fixed", FromUser: "mallory", EditedAt: editedAt})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		want := *added
+		want.Content = "fixed"
+		want.EditedAt = editedAt
+
+		got, err := store.Get(todoID, added.ID)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		assertFeedback(t, &want, got)
+
+		if other, err := store.Get(uuid.New().String(), added.ID); err != nil || other != nil {
+			t.Fatalf("Get feedback of another todo: got (%v, %v), want (nil, nil)", other, err)
+		}
+	})
+
+	t.Run("Replies", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		parent := mustAddFeedback(t, store, todoID, "question")
+		reply, err := store.Add(todoID, &service.Feedback{Content: "answer", FromUser: "bob", ParentID: parent.ID})
+		if err != nil {
+			t.Fatalf("Add reply: %v", err)
+		}
+		if reply.ParentID != parent.ID {
+			t.Fatalf("Add reply: got parent %q, want %q", reply.ParentID, parent.ID)
+		}
+
+		_, err = store.Add(todoID, &service.Feedback{Content: "orphan", ParentID: uuid.New().String()})
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Add reply to unknown feedback: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		_, err = store.Add(uuid.New().String(), &service.Feedback{Content: "elsewhere", ParentID: parent.ID})
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Add reply to feedback of another todo: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("DeleteThread", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		first := mustAddFeedback(t, store, todoID, "first")
+		second := mustAddFeedback(t, store, todoID, "second")
+		reply := mustAddReply(t, store, todoID, first.ID, "reply")
+		mustAddReply(t, store, todoID, reply.ID, "nested reply")
+		secondReply := mustAddReply(t, store, todoID, second.ID, "reply to second")
+
+		if err := store.Delete(todoID, first.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		feedbacks, err := store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if len(feedbacks) != 2 {
+			t.Fatalf("Find after deleting a thread: got %d feedbacks, want 2", len(feedbacks))
+		}
+		assertFeedback(t, second, feedbacks[0])
+		assertFeedback(t, secondReply, feedbacks[1])
+	})
+
+	t.Run("DeepCopy", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		feedback := &service.Feedback{Content: "content", FromUser: "alice"}
+		added, err := store.Add(todoID, feedback)
+		if err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		want := *added
+
+		feedback.Content = "changed after add"
+		added.Content = "changed in added"
+
+		feedbacks, err := store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertFeedback(t, &want, feedbacks[0])
+
+		feedbacks[0].Content = "changed after find"
+
+		feedbacks, err = store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertFeedback(t, &want, feedbacks[0])
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+		const writers = 10
+		const feedbacksPerWriter = 10
+
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < feedbacksPerWriter; j++ {
+					if _, err := store.Add(todoID, &service.Feedback{Content: "content", FromUser: "alice"}); err != nil {
+						t.Errorf("concurrent Add: %v", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		feedbacks, err := store.Find(todoID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if len(feedbacks) != writers*feedbacksPerWriter {
+			t.Fatalf("Find after concurrent writes: got %d feedbacks, want %d", len(feedbacks), writers*feedbacksPerWriter)
+		}
+	})
+}
+
+func mustAddFeedback(t *testing.T, store service.FeedbackStore, todoID string, content string) *service.Feedback {
+	t.Helper()
+
+	feedback, err := store.Add(todoID, &service.Feedback{Content: content, FromUser: "alice"})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	return feedback
+}
+
+func mustAddReply(t *testing.T, store service.FeedbackStore, todoID string, parentID string, content string) *service.Feedback {
+	t.Helper()
+
+	feedback, err := store.Add(todoID, &service.Feedback{Content: content, FromUser: "bob", ParentID: parentID})
+	if err != nil {
+		t.Fatalf("Add reply: %v", err)
+	}
+
+	return feedback
+}
+
+func assertFeedback(t *testing.T, want, got *service.Feedback) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no feedback, want %+v", want)
+	}
+
+	if got.ID != want.ID || got.Content != want.Content || got.FromUser != want.FromUser || got.ParentID != want.ParentID ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.EditedAt.Equal(want.EditedAt) {
+		t.Fatalf("got feedback %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package storetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunImageStoreTests runs the ImageStore conformance tests, newStore must return
+// an empty store for every call
+func RunImageStoreTests(t *testing.T, newStore func(t *testing.T) service.ImageStore) {
+	t.Run("Save", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		first := mustSaveImage(t, store, todoID, []byte("first image"))
+		second := mustSaveImage(t, store, todoID, []byte("first image"))
+		if first == "" || first == second {
+			t.Fatalf("Save: got image IDs %q and %q, want distinct IDs", first, second)
+		}
+	})
+
+	t.Run("FindAndOpen", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+		data := []byte("image data")
+		id := mustSaveImage(t, store, todoID, data)
+
+		image, err := store.Find(id)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if image == nil || image.ID != id || image.TodoID != todoID || image.Type != ".png" ||
+			image.Size != int64(len(data)) || image.UploadedAt.IsZero() {
+			t.Fatalf("Find: got %+v, want image %s of todo %s with size %d", image, id, todoID, len(data))
+		}
+
+		if got := mustReadImage(t, store, id, ""); !bytes.Equal(got, data) {
+			t.Fatalf("Open: got data %q, want %q", got, data)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		id := uuid.New().String()
+
+		image, err := store.Find(id)
+		if err != nil || image != nil {
+			t.Fatalf("Find unknown image: got (%v, %v), want (nil, nil)", image, err)
+		}
+
+		_, err = store.Open(id, "")
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Open unknown image: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.Delete(id)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown image: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+
+		first := mustSaveImage(t, store, todoID, []byte("first image"))
+		second := mustSaveImage(t, store, todoID, []byte("second image"))
+		mustSaveImage(t, store, uuid.New().String(), []byte("other todo"))
+
+		assertImageIDs(t, store, todoID, first, second)
+
+		err := store.Delete(first)
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		assertImageIDs(t, store, todoID, second)
+		if _, err := store.Open(first, ""); !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Open deleted image: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		store := newStore(t)
+		id := mustSaveImage(t, store, uuid.New().String(), []byte("original"))
+
+		variant := service.ImageVariant{Name: "thumbnail_64", Type: ".png", Width: 64, Height: 32}
+		err := store.SaveVariant(id, variant, bytes.NewReader([]byte("thumbnail")))
+		if err != nil {
+			t.Fatalf("SaveVariant: %v", err)
+		}
+
+		image, err := store.Find(id)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		found := image.Variant(variant.Name)
+		if found == nil || found.Type != variant.Type || found.Width != 64 || found.Height != 32 || found.Size != 9 {
+			t.Fatalf("Find: got variant %+v, want %+v with size 9", found, variant)
+		}
+
+		if got := mustReadImage(t, store, id, variant.Name); string(got) != "thumbnail" {
+			t.Fatalf("Open variant: got data %q, want %q", got, "thumbnail")
+		}
+		if got := mustReadImage(t, store, id, ""); string(got) != "original" {
+			t.Fatalf("Open: got data %q, want %q", got, "original")
+		}
+
+		if _, err := store.Open(id, "thumbnail_1024"); !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Open unknown variant: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.SaveVariant(uuid.New().String(), variant, bytes.NewReader([]byte("thumbnail")))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("SaveVariant of unknown image: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.Delete(id)
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Open(id, variant.Name); !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Open variant of deleted image: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+		const writers = 10
+
+		var mutex sync.Mutex
+		ids := make(map[string]bool)
+
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				id, err := store.Save(todoID, ".png", strings.NewReader("image"))
+				if err != nil {
+					t.Errorf("concurrent Save: %v", err)
+					return
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				ids[id] = true
+			}()
+		}
+		wg.Wait()
+
+		if len(ids) != writers {
+			t.Fatalf("concurrent Save: got %d distinct image IDs, want %d", len(ids), writers)
+		}
+	})
+}
+
+func mustSaveImage(t *testing.T, store service.ImageStore, todoID string, data []byte) string {
+	t.Helper()
+
+	id, err := store.Save(todoID, ".png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	return id
+}
+
+func mustReadImage(t *testing.T, store service.ImageStore, imageID, variant string) []byte {
+	t.Helper()
+
+	reader, err := store.Open(imageID, variant)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read image: %v", err)
+	}
+
+	return data
+}
+
+func assertImageIDs(t *testing.T, store service.ImageStore, todoID string, want ...string) {
+	t.Helper()
+
+	images, err := store.List(todoID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	got := make([]string, 0, len(images))
+	for _, image := range images {
+		got = append(got, image.ID)
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("List: got image IDs %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,175 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunShareStoreTests runs the ShareStore conformance tests, newStore must
+// return an empty store for every call
+func RunShareStoreTests(t *testing.T, newStore func(t *testing.T) service.ShareStore) {
+	t.Run("SaveAndFind", func(t *testing.T) {
+		store := newStore(t)
+		share := newShare(uuid.New().String(), "alice", service.ShareRoleViewer)
+		mustSaveShare(t, store, share)
+
+		found, err := store.Find(share.TodoID, share.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertShare(t, share, found)
+
+		// saving again replaces the role
+		share.Role = service.ShareRoleEditor
+		mustSaveShare(t, store, share)
+
+		found, err = store.Find(share.TodoID, share.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertShare(t, share, found)
+	})
+
+	t.Run("SaveInvalidRole", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.Save(newShare(uuid.New().String(), "alice", "owner"))
+		if err == nil {
+			t.Fatal("Save invalid role: got no error")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		todoID := uuid.New().String()
+		mustSaveShare(t, store, newShare(todoID, "alice", service.ShareRoleViewer))
+
+		found, err := store.Find(todoID, "bob")
+		if err != nil || found != nil {
+			t.Fatalf("Find unknown user: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		err = store.Delete(todoID, "bob")
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown share: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		store := newStore(t)
+		firstID := uuid.New().String()
+		secondID := uuid.New().String()
+		if secondID < firstID {
+			firstID, secondID = secondID, firstID
+		}
+
+		mustSaveShare(t, store, newShare(firstID, "carol", service.ShareRoleEditor))
+		mustSaveShare(t, store, newShare(firstID, "alice", service.ShareRoleViewer))
+		mustSaveShare(t, store, newShare(secondID, "alice", service.ShareRoleCommenter))
+
+		assertShareKeys(t, mustListByTodo(t, store, firstID), "alice", "carol")
+		assertShareKeys(t, mustListByUser(t, store, "alice"), firstID, secondID)
+
+		err := store.Delete(firstID, "alice")
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		assertShareKeys(t, mustListByTodo(t, store, firstID), "carol")
+		assertShareKeys(t, mustListByUser(t, store, "alice"), secondID)
+		assertShareKeys(t, mustListByUser(t, store, "bob"))
+	})
+
+	t.Run("DeepCopy", func(t *testing.T) {
+		store := newStore(t)
+		share := newShare(uuid.New().String(), "alice", service.ShareRoleViewer)
+		mustSaveShare(t, store, share)
+
+		share.Role = service.ShareRoleEditor
+		found, err := store.Find(share.TodoID, share.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if found.Role != service.ShareRoleViewer {
+			t.Fatalf("Find: got role %q after modifying the saved share, want %q", found.Role, service.ShareRoleViewer)
+		}
+
+		found.Role = service.ShareRoleEditor
+		shares := mustListByTodo(t, store, share.TodoID)
+		if shares[0].Role != service.ShareRoleViewer {
+			t.Fatalf("ListByTodo: got role %q after modifying a found share, want %q", shares[0].Role, service.ShareRoleViewer)
+		}
+	})
+}
+
+func newShare(todoID, username string, role service.ShareRole) *service.Share {
+	return &service.Share{
+		TodoID:    todoID,
+		Username:  username,
+		Role:      role,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+func mustSaveShare(t *testing.T, store service.ShareStore, share *service.Share) {
+	t.Helper()
+
+	if err := store.Save(share); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func mustListByTodo(t *testing.T, store service.ShareStore, todoID string) []*service.Share {
+	t.Helper()
+
+	shares, err := store.ListByTodo(todoID)
+	if err != nil {
+		t.Fatalf("ListByTodo: %v", err)
+	}
+	return shares
+}
+
+func mustListByUser(t *testing.T, store service.ShareStore, username string) []*service.Share {
+	t.Helper()
+
+	shares, err := store.ListByUser(username)
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	return shares
+}
+
+// assertShareKeys checks the usernames of the shares of a todo or the todo IDs
+// of the shares of a user, in order
+func assertShareKeys(t *testing.T, shares []*service.Share, want ...string) {
+	t.Helper()
+
+	if len(shares) != len(want) {
+		t.Fatalf("got %d shares, want %d", len(shares), len(want))
+	}
+
+	for i, share := range shares {
+		if share.Username != want[i] && share.TodoID != want[i] {
+			t.Fatalf("share %d: got %s/%s, want %s", i, share.TodoID, share.Username, want[i])
+		}
+	}
+}
+
+func assertShare(t *testing.T, want, got *service.Share) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no share, want %+v", want)
+	}
+
+	if got.TodoID != want.TodoID ||
+		got.Username != want.Username ||
+		got.Role != want.Role ||
+		!got.CreatedAt.Equal(want.CreatedAt) {
+		t.Fatalf("got share %+v, want %+v", got, want)
+	}
+}
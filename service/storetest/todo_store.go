@@ -0,0 +1,372 @@
+// Package storetest provides conformance tests that every store
+// implementation of the service package must pass.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunTodoStoreTests runs the TodoStore conformance tests, newStore must return
+// an empty store for every call
+func RunTodoStoreTests(t *testing.T, newStore func(t *testing.T) service.TodoStore) {
+	t.Run("SaveAndGetById", func(t *testing.T) {
+		store := newStore(t)
+		todo := newTodo("alice")
+
+		mustSaveTodo(t, store, todo)
+
+		found, err := store.GetById(todo.ID)
+		if err != nil {
+			t.Fatalf("GetById: %v", err)
+		}
+		assertTodo(t, todo, found)
+	})
+
+	t.Run("SaveDuplicateID", func(t *testing.T) {
+		store := newStore(t)
+		todo := newTodo("alice")
+		mustSaveTodo(t, store, todo)
+
+		other := newTodo("bob")
+		other.ID = todo.ID
+		err := store.Save(other)
+		if !errors.Is(err, service.ErrAlreadyExists) {
+			t.Fatalf("Save duplicate ID: got %v, want %v", err, service.ErrAlreadyExists)
+		}
+
+		found, err := store.GetById(todo.ID)
+		if err != nil {
+			t.Fatalf("GetById: %v", err)
+		}
+		assertTodo(t, todo, found)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		id := uuid.New().String()
+
+		found, err := store.GetById(id)
+		if err != nil || found != nil {
+			t.Fatalf("GetById unknown ID: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		err = store.Update(newTodo("alice"))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Update unknown ID: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.Delete(id)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown ID: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		store := newStore(t)
+		todo := newTodo("alice")
+		mustSaveTodo(t, store, todo)
+
+		todo.Title = "updated"
+		todo.SetStatus(service.TodoStatusDone, time.Now())
+		if err := store.Update(todo); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		found, err := store.GetById(todo.ID)
+		if err != nil {
+			t.Fatalf("GetById: %v", err)
+		}
+		assertTodo(t, todo, found)
+
+		if err := store.Delete(todo.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		found, err = store.GetById(todo.ID)
+		if err != nil || found != nil {
+			t.Fatalf("GetById deleted todo: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		ids := getManyIDs(t, store, &service.TodoQuery{FromUser: "alice"})
+		if len(ids) != 0 {
+			t.Fatalf("GetMany after Delete: got %v, want no todos", ids)
+		}
+	})
+
+	t.Run("DeepCopy", func(t *testing.T) {
+		store := newStore(t)
+		todo := newTodo("alice")
+		want := *todo
+		mustSaveTodo(t, store, todo)
+
+		todo.Title = "changed after save"
+
+		found, err := store.GetById(want.ID)
+		if err != nil {
+			t.Fatalf("GetById: %v", err)
+		}
+		assertTodo(t, &want, found)
+
+		found.Title = "changed after get"
+
+		err = store.GetMany(context.Background(), &service.TodoQuery{FromUser: "alice"}, func(todo *service.Todo) error {
+			assertTodo(t, &want, todo)
+			todo.Title = "changed in get many"
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("GetMany: %v", err)
+		}
+
+		found, err = store.GetById(want.ID)
+		if err != nil {
+			t.Fatalf("GetById: %v", err)
+		}
+		assertTodo(t, &want, found)
+	})
+
+	t.Run("GetManyQuery", func(t *testing.T) {
+		store := newStore(t)
+		now := time.Now()
+
+		todos := make([]*service.Todo, 0)
+		for i := 0; i < 6; i++ {
+			todo := newTodo("alice")
+			todo.Title = fmt.Sprintf("todo %d", i)
+			todo.Priority = service.TodoPriority(i % 3)
+			todo.CreatedAt = now.Add(time.Duration(i) * time.Second)
+			mustSaveTodo(t, store, todo)
+			todos = append(todos, todo)
+		}
+		mustSaveTodo(t, store, newTodo("bob"))
+
+		ids := getManyIDs(t, store, &service.TodoQuery{FromUser: "alice"})
+		assertIDs(t, ids, todos[0].ID, todos[1].ID, todos[2].ID, todos[3].ID, todos[4].ID, todos[5].ID)
+
+		ids = getManyIDs(t, store, &service.TodoQuery{
+			FromUser:   "alice",
+			Filter:     service.TodoFilter{Priorities: []service.TodoPriority{2}},
+			OrderBy:    service.TodoOrderByCreatedAt,
+			Descending: true,
+		})
+		assertIDs(t, ids, todos[5].ID, todos[2].ID)
+
+		query := &service.TodoQuery{FromUser: "alice", Limit: 4}
+		ids = getManyIDs(t, store, query)
+		assertIDs(t, ids, todos[0].ID, todos[1].ID, todos[2].ID, todos[3].ID)
+
+		// a todo inserted before the cursor does not shift the next page
+		inserted := newTodo("alice")
+		inserted.CreatedAt = now.Add(-time.Second)
+		mustSaveTodo(t, store, inserted)
+
+		query.After = query.Cursor(todos[3])
+		ids = getManyIDs(t, store, query)
+		assertIDs(t, ids, todos[4].ID, todos[5].ID)
+	})
+
+	t.Run("GetManySharedIDs", func(t *testing.T) {
+		store := newStore(t)
+		now := time.Now()
+
+		own := newTodo("alice")
+		own.CreatedAt = now
+		shared := newTodo("bob")
+		shared.CreatedAt = now.Add(time.Second)
+		notShared := newTodo("bob")
+		mustSaveTodo(t, store, own)
+		mustSaveTodo(t, store, shared)
+		mustSaveTodo(t, store, notShared)
+
+		ids := getManyIDs(t, store, &service.TodoQuery{
+			FromUser:  "alice",
+			SharedIDs: []string{shared.ID, own.ID, uuid.New().String()},
+		})
+		assertIDs(t, ids, own.ID, shared.ID)
+	})
+
+	t.Run("GetManyPagesWithSharedIDs", func(t *testing.T) {
+		store := newStore(t)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+
+		// the todos of alice and the todos shared with her alternate
+		want := make([]string, 0)
+		shared := make([]string, 0)
+		for i := 0; i < 6; i++ {
+			todo := newTodo("alice")
+			if i%2 == 1 {
+				todo = newTodo("bob")
+				shared = append(shared, todo.ID)
+			}
+			todo.CreatedAt = now.Add(time.Duration(i) * time.Second)
+			mustSaveTodo(t, store, todo)
+			want = append(want, todo.ID)
+		}
+
+		for _, descending := range []bool{false, true} {
+			if descending {
+				slices.Reverse(want)
+			}
+
+			ids := make([]string, 0)
+			var after *service.TodoCursor
+			for len(ids) < len(want) {
+				query := &service.TodoQuery{FromUser: "alice", SharedIDs: shared, Descending: descending, Limit: 2, After: after}
+				page := make([]*service.Todo, 0)
+				err := store.GetMany(context.Background(), query, func(todo *service.Todo) error {
+					page = append(page, todo)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("GetMany: %v", err)
+				}
+				if len(page) == 0 || len(page) > 2 {
+					t.Fatalf("GetMany after %v: got %d todos, want 1 or 2", ids, len(page))
+				}
+
+				for _, todo := range page {
+					ids = append(ids, todo.ID)
+				}
+				after = query.Cursor(page[len(page)-1])
+			}
+			assertIDs(t, ids, want...)
+		}
+	})
+
+	t.Run("GetManyContextCancelled", func(t *testing.T) {
+		store := newStore(t)
+		for i := 0; i < 3; i++ {
+			mustSaveTodo(t, store, newTodo("alice"))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		count := 0
+		err := store.GetMany(ctx, &service.TodoQuery{FromUser: "alice"}, func(todo *service.Todo) error {
+			count++
+			cancel()
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("GetMany with cancelled context: got %v, want %v", err, context.Canceled)
+		}
+		if count != 1 {
+			t.Fatalf("GetMany with cancelled context: found %d todos, want 1", count)
+		}
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		store := newStore(t)
+		const writers = 10
+		const todosPerWriter = 10
+
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*todosPerWriter)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < todosPerWriter; j++ {
+					todo := newTodo("alice")
+					if err := store.Save(todo); err != nil {
+						errs <- err
+						continue
+					}
+
+					todo.Title = "updated"
+					if err := store.Update(todo); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("concurrent write: %v", err)
+		}
+
+		ids := getManyIDs(t, store, &service.TodoQuery{FromUser: "alice"})
+		if len(ids) != writers*todosPerWriter {
+			t.Fatalf("GetMany after concurrent writes: found %d todos, want %d", len(ids), writers*todosPerWriter)
+		}
+	})
+}
+
+func newTodo(fromUser string) *service.Todo {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return &service.Todo{
+		ID:          uuid.New().String(),
+		Title:       "title",
+		Description: "description",
+		FromUser:    fromUser,
+		Status:      service.TodoStatusOpen,
+		Priority:    service.TodoPriorityMedium,
+		DueAt:       now.Add(time.Hour),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+func mustSaveTodo(t *testing.T, store service.TodoStore, todo *service.Todo) {
+	t.Helper()
+
+	if err := store.Save(todo); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func getManyIDs(t *testing.T, store service.TodoStore, query *service.TodoQuery) []string {
+	t.Helper()
+
+	ids := make([]string, 0)
+	err := store.GetMany(context.Background(), query, func(todo *service.Todo) error {
+		ids = append(ids, todo.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+
+	return ids
+}
+
+func assertIDs(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got todo IDs %v, want %v", got, want)
+	}
+}
+
+func assertTodo(t *testing.T, want, got *service.Todo) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no todo, want %+v", want)
+	}
+
+	if got.ID != want.ID ||
+		got.Title != want.Title ||
+		got.Description != want.Description ||
+		got.FromUser != want.FromUser ||
+		got.Status != want.Status ||
+		got.Priority != want.Priority ||
+		!got.DueAt.Equal(want.DueAt) ||
+		!got.CompletedAt.Equal(want.CompletedAt) ||
+		!got.CreatedAt.Equal(want.CreatedAt) ||
+		!got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Fatalf("got todo %+v, want %+v", got, want)
+	}
+}
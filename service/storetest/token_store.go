@@ -0,0 +1,301 @@
+package storetest
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunRefreshTokenStoreTests runs the RefreshTokenStore conformance tests,
+// newStore must return an empty store for every call
+func RunRefreshTokenStoreTests(t *testing.T, newStore func(t *testing.T) service.RefreshTokenStore) {
+	t.Run("SaveAndFind", func(t *testing.T) {
+		store := newStore(t)
+		token := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, token)
+
+		found, err := store.Find(token.Hash)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertRefreshToken(t, token, found)
+	})
+
+	t.Run("SaveDuplicateHash", func(t *testing.T) {
+		store := newStore(t)
+		token := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, token)
+
+		err := store.Save(token)
+		if !errors.Is(err, service.ErrAlreadyExists) {
+			t.Fatalf("Save duplicate hash: got %v, want %v", err, service.ErrAlreadyExists)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		token := newRefreshToken(uuid.New().String())
+
+		found, err := store.Find(token.Hash)
+		if err != nil || found != nil {
+			t.Fatalf("Find unknown hash: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		found, err = store.Consume(token.Hash)
+		if err != nil || found != nil {
+			t.Fatalf("Consume unknown hash: got (%v, %v), want (nil, nil)", found, err)
+		}
+	})
+
+	t.Run("Consume", func(t *testing.T) {
+		store := newStore(t)
+		token := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, token)
+
+		consumed, err := store.Consume(token.Hash)
+		if err != nil {
+			t.Fatalf("Consume: %v", err)
+		}
+		assertRefreshToken(t, token, consumed)
+
+		revoked := *token
+		revoked.Revoked = true
+		consumed, err = store.Consume(token.Hash)
+		if err != nil {
+			t.Fatalf("Consume again: %v", err)
+		}
+		assertRefreshToken(t, &revoked, consumed)
+
+		found, err := store.Find(token.Hash)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertRefreshToken(t, &revoked, found)
+	})
+
+	t.Run("ConcurrentConsume", func(t *testing.T) {
+		store := newStore(t)
+		token := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, token)
+
+		const calls = 10
+		var unrevoked atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < calls; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				consumed, err := store.Consume(token.Hash)
+				if err != nil {
+					t.Errorf("Consume: %v", err)
+					return
+				}
+				if !consumed.Revoked {
+					unrevoked.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if got := unrevoked.Load(); got != 1 {
+			t.Fatalf("%d of %d concurrent Consume calls got the token unrevoked, want 1", got, calls)
+		}
+	})
+
+	t.Run("SaveDeletesExpired", func(t *testing.T) {
+		store := newStore(t)
+		expired := newRefreshToken(uuid.New().String())
+		expired.ExpiresAt = time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)
+		mustSaveRefreshToken(t, store, expired)
+		token := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, token)
+
+		found, err := store.Find(expired.Hash)
+		if err != nil || found != nil {
+			t.Fatalf("Find expired token: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		found, err = store.Find(token.Hash)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertRefreshToken(t, token, found)
+	})
+
+	t.Run("RevokeFamily", func(t *testing.T) {
+		store := newStore(t)
+		familyID := uuid.New().String()
+		first := newRefreshToken(familyID)
+		second := newRefreshToken(familyID)
+		other := newRefreshToken(uuid.New().String())
+		mustSaveRefreshToken(t, store, first)
+		mustSaveRefreshToken(t, store, second)
+		mustSaveRefreshToken(t, store, other)
+
+		if err := store.RevokeFamily(familyID); err != nil {
+			t.Fatalf("RevokeFamily: %v", err)
+		}
+
+		for _, token := range []*service.RefreshToken{first, second, other} {
+			found, err := store.Find(token.Hash)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+
+			want := *token
+			want.Revoked = token.FamilyID == familyID
+			assertRefreshToken(t, &want, found)
+		}
+	})
+
+	t.Run("RevokeUser", func(t *testing.T) {
+		store := newStore(t)
+		first := newRefreshToken(uuid.New().String())
+		second := newRefreshToken(uuid.New().String())
+		other := newRefreshToken(uuid.New().String())
+		other.Username = "bob"
+		// a user whose name starts with the name of the other user
+		longer := newRefreshToken(uuid.New().String())
+		longer.Username = "alice2"
+		for _, token := range []*service.RefreshToken{first, second, other, longer} {
+			mustSaveRefreshToken(t, store, token)
+		}
+
+		if err := store.RevokeUser("alice"); err != nil {
+			t.Fatalf("RevokeUser: %v", err)
+		}
+
+		for _, token := range []*service.RefreshToken{first, second, other, longer} {
+			found, err := store.Find(token.Hash)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+
+			want := *token
+			want.Revoked = token.Username == "alice"
+			assertRefreshToken(t, &want, found)
+		}
+	})
+
+	t.Run("RevokeFamilyAfterExpiredMember", func(t *testing.T) {
+		store := newStore(t)
+		familyID := uuid.New().String()
+		expired := newRefreshToken(familyID)
+		expired.ExpiresAt = time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)
+		mustSaveRefreshToken(t, store, expired)
+		token := newRefreshToken(familyID)
+		mustSaveRefreshToken(t, store, token)
+		// a family whose ID starts with the ID of the other family
+		other := newRefreshToken(familyID + "-other")
+		mustSaveRefreshToken(t, store, other)
+
+		if err := store.RevokeFamily(familyID); err != nil {
+			t.Fatalf("RevokeFamily: %v", err)
+		}
+
+		found, err := store.Find(token.Hash)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		want := *token
+		want.Revoked = true
+		assertRefreshToken(t, &want, found)
+
+		found, err = store.Find(other.Hash)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertRefreshToken(t, other, found)
+	})
+}
+
+// RunRevocationStoreTests runs the RevocationStore conformance tests, newStore
+// must return an empty store for every call
+func RunRevocationStoreTests(t *testing.T, newStore func(t *testing.T) service.RevocationStore) {
+	t.Run("Revoke", func(t *testing.T) {
+		store := newStore(t)
+		tokenID := uuid.New().String()
+
+		revoked, err := store.IsRevoked(tokenID)
+		if err != nil || revoked {
+			t.Fatalf("IsRevoked before Revoke: got (%t, %v), want (false, nil)", revoked, err)
+		}
+
+		if err := store.Revoke(tokenID, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+
+		revoked, err = store.IsRevoked(tokenID)
+		if err != nil || !revoked {
+			t.Fatalf("IsRevoked after Revoke: got (%t, %v), want (true, nil)", revoked, err)
+		}
+
+		revoked, err = store.IsRevoked(uuid.New().String())
+		if err != nil || revoked {
+			t.Fatalf("IsRevoked unknown ID: got (%t, %v), want (false, nil)", revoked, err)
+		}
+	})
+
+	t.Run("RevokeDeletesExpired", func(t *testing.T) {
+		store := newStore(t)
+		expired := uuid.New().String()
+		if err := store.Revoke(expired, time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+
+		tokenID := uuid.New().String()
+		if err := store.Revoke(tokenID, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+
+		revoked, err := store.IsRevoked(expired)
+		if err != nil || revoked {
+			t.Fatalf("IsRevoked expired ID: got (%t, %v), want (false, nil)", revoked, err)
+		}
+
+		revoked, err = store.IsRevoked(tokenID)
+		if err != nil || !revoked {
+			t.Fatalf("IsRevoked: got (%t, %v), want (true, nil)", revoked, err)
+		}
+	})
+}
+
+func newRefreshToken(familyID string) *service.RefreshToken {
+	value, _ := service.NewRefreshTokenValue()
+	return &service.RefreshToken{
+		Hash:      service.HashRefreshToken(value),
+		Username:  "alice",
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Millisecond),
+	}
+}
+
+func mustSaveRefreshToken(t *testing.T, store service.RefreshTokenStore, token *service.RefreshToken) {
+	t.Helper()
+
+	if err := store.Save(token); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func assertRefreshToken(t *testing.T, want, got *service.RefreshToken) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no refresh token, want %+v", want)
+	}
+
+	if got.Hash != want.Hash ||
+		got.Username != want.Username ||
+		got.FamilyID != want.FamilyID ||
+		!got.ExpiresAt.Equal(want.ExpiresAt) ||
+		got.Revoked != want.Revoked {
+		t.Fatalf("got refresh token %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package storetest
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunUploadSessionStoreTests runs the UploadSessionStore conformance tests,
+// newStore must return an empty store for every call
+func RunUploadSessionStoreTests(t *testing.T, newStore func(t *testing.T) service.UploadSessionStore) {
+	t.Run("CreateAndAppend", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, time.Hour)
+		mustCreateUploadSession(t, store, session)
+
+		mustAppend(t, store, session.ID, 0, []byte("hello"))
+		updated := mustAppend(t, store, session.ID, 5, []byte("world"))
+		if updated.Received != 10 {
+			t.Fatalf("Append: got %d received bytes, want 10", updated.Received)
+		}
+
+		found, err := store.Find(session.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if found == nil || found.Received != 10 || found.TodoID != session.TodoID || found.SHA256 != session.SHA256 {
+			t.Fatalf("Find: got %+v, want %+v with 10 received bytes", found, session)
+		}
+
+		if got := mustReadUpload(t, store, session.ID); string(got) != "helloworld" {
+			t.Fatalf("Open: got data %q, want %q", got, "helloworld")
+		}
+	})
+
+	t.Run("AppendWrongOffset", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, time.Hour)
+		mustCreateUploadSession(t, store, session)
+		mustAppend(t, store, session.ID, 0, []byte("hello"))
+
+		// a chunk sent again after a dropped stream must not be written twice
+		_, err := store.Append(session.ID, 0, []byte("hello"))
+		if !errors.Is(err, service.ErrUploadOffset) {
+			t.Fatalf("Append at a received offset: got %v, want %v", err, service.ErrUploadOffset)
+		}
+
+		_, err = store.Append(session.ID, 5, []byte("too large"))
+		if err == nil {
+			t.Fatal("Append past the upload size: got no error")
+		}
+
+		found, err := store.Find(session.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if found.Received != 5 {
+			t.Fatalf("Find: got %d received bytes after rejected chunks, want 5", found.Received)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+		id := uuid.New().String()
+
+		found, err := store.Find(id)
+		if err != nil || found != nil {
+			t.Fatalf("Find unknown session: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		_, err = store.Append(id, 0, []byte("data"))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Append unknown session: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		err = store.Delete(id)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown session: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, -time.Second)
+		mustCreateUploadSession(t, store, session)
+
+		found, err := store.Find(session.ID)
+		if err != nil || found != nil {
+			t.Fatalf("Find expired session: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		_, err = store.Append(session.ID, 0, []byte("data"))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Append expired session: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("Claim", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, time.Hour)
+		mustCreateUploadSession(t, store, session)
+		mustAppend(t, store, session.ID, 0, []byte("helloworld"))
+
+		reader, err := store.Claim(session.ID)
+		if err != nil {
+			t.Fatalf("Claim: %v", err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil || string(data) != "helloworld" {
+			t.Fatalf("read claimed upload: got (%q, %v), want %q", data, err, "helloworld")
+		}
+		if _, err := reader.Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("Seek claimed upload: %v", err)
+		}
+
+		found, err := store.Find(session.ID)
+		if err != nil || found != nil {
+			t.Fatalf("Find claimed session: got (%v, %v), want (nil, nil)", found, err)
+		}
+		_, err = store.Append(session.ID, 10, []byte("more"))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Append claimed session: got %v, want %v", err, service.ErrNotFound)
+		}
+		_, err = store.Claim(session.ID)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Claim claimed session: got %v, want %v", err, service.ErrNotFound)
+		}
+
+		if err := reader.Close(); err != nil {
+			t.Fatalf("Close claimed upload: %v", err)
+		}
+	})
+
+	t.Run("ConcurrentClaim", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(5, time.Hour)
+		mustCreateUploadSession(t, store, session)
+		mustAppend(t, store, session.ID, 0, []byte("hello"))
+
+		// streams that complete the same session commit it once
+		const claims = 10
+		var wg sync.WaitGroup
+		claimed := make(chan io.ReadSeekCloser, claims)
+		for i := 0; i < claims; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				reader, err := store.Claim(session.ID)
+				if err == nil {
+					claimed <- reader
+				} else if !errors.Is(err, service.ErrNotFound) {
+					t.Errorf("Claim: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(claimed)
+
+		if len(claimed) != 1 {
+			t.Fatalf("Claim: %d of %d concurrent claims succeeded, want 1", len(claimed), claims)
+		}
+		for reader := range claimed {
+			reader.Close()
+		}
+	})
+
+	t.Run("ClaimExpired", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, -time.Second)
+		mustCreateUploadSession(t, store, session)
+
+		_, err := store.Claim(session.ID)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Claim expired session: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t)
+		session := newUploadSession(10, time.Hour)
+		mustCreateUploadSession(t, store, session)
+
+		err := store.Delete(session.ID)
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		_, err = store.Open(session.ID)
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Open deleted session: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+}
+
+func newUploadSession(size int64, duration time.Duration) *service.UploadSession {
+	return &service.UploadSession{
+		ID:        uuid.New().String(),
+		TodoID:    uuid.New().String(),
+		Username:  "alice",
+		ImageType: ".png",
+		Size:      size,
+		SHA256:    "936a185caaa266bb9cbe981e9e05cb78cd732b0b3280eb944412bb6f8f8f07af",
+		ExpiresAt: time.Now().Add(duration),
+	}
+}
+
+func mustCreateUploadSession(t *testing.T, store service.UploadSessionStore, session *service.UploadSession) {
+	t.Helper()
+
+	if err := store.Create(session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+}
+
+func mustAppend(t *testing.T, store service.UploadSessionStore, id string, offset int64, data []byte) *service.UploadSession {
+	t.Helper()
+
+	session, err := store.Append(id, offset, data)
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	return session
+}
+
+func mustReadUpload(t *testing.T, store service.UploadSessionStore, id string) []byte {
+	t.Helper()
+
+	reader, err := store.Open(id)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read upload: %v", err)
+	}
+
+	return data
+}
@@ -0,0 +1,182 @@
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+// RunUserStoreTests runs the UserStore conformance tests, newStore must return
+// an empty store for every call
+func RunUserStoreTests(t *testing.T, newStore func(t *testing.T) service.UserStore) {
+	t.Run("SaveAndFind", func(t *testing.T) {
+		store := newStore(t)
+		user := newUser(t, "alice")
+		mustSaveUser(t, store, user)
+
+		found, err := store.Find(user.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertUser(t, user, found)
+	})
+
+	t.Run("SaveDuplicateUsername", func(t *testing.T) {
+		store := newStore(t)
+		user := newUser(t, "alice")
+		mustSaveUser(t, store, user)
+
+		other := user.Clone()
+		other.Role = "admin"
+		err := store.Save(other)
+		if !errors.Is(err, service.ErrAlreadyExists) {
+			t.Fatalf("Save duplicate username: got %v, want %v", err, service.ErrAlreadyExists)
+		}
+
+		found, err := store.Find(user.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertUser(t, user, found)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+
+		found, err := store.Find("nobody")
+		if err != nil || found != nil {
+			t.Fatalf("Find unknown user: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		err = store.Update(newUser(t, "nobody"))
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Update unknown user: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("UpdateAndList", func(t *testing.T) {
+		store := newStore(t)
+		bob := newUser(t, "bob")
+		alice := newUser(t, "alice")
+		mustSaveUser(t, store, bob)
+		mustSaveUser(t, store, alice)
+
+		bob.Role = "admin"
+		bob.Disabled = true
+		if err := store.Update(bob); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+
+		users, err := store.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(users) != 2 {
+			t.Fatalf("List: got %d users, want 2", len(users))
+		}
+		assertUser(t, alice, users[0])
+		assertUser(t, bob, users[1])
+	})
+
+	t.Run("DeepCopy", func(t *testing.T) {
+		store := newStore(t)
+		user := newUser(t, "alice")
+		want := user.Clone()
+		mustSaveUser(t, store, user)
+
+		user.Role = "admin"
+
+		found, err := store.Find(want.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertUser(t, want, found)
+
+		found.Role = "admin"
+
+		users, err := store.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		assertUser(t, want, users[0])
+
+		users[0].Role = "admin"
+
+		found, err = store.Find(want.Username)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertUser(t, want, found)
+	})
+
+	t.Run("ConcurrentWriters", func(t *testing.T) {
+		store := newStore(t)
+		user := newUser(t, "alice")
+		const writers = 10
+
+		var wg sync.WaitGroup
+		errs := make(chan error, writers*2)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				other := user.Clone()
+				other.Username = fmt.Sprintf("user-%d", i)
+				errs <- store.Save(other)
+
+				// every writer races to save the same user, only one of them wins
+				errs <- store.Save(user)
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		saved := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				saved++
+			case !errors.Is(err, service.ErrAlreadyExists):
+				t.Errorf("concurrent Save: %v", err)
+			}
+		}
+		if saved != writers+1 {
+			t.Fatalf("concurrent Save: saved %d users, want %d", saved, writers+1)
+		}
+	})
+}
+
+func newUser(t *testing.T, username string) *service.User {
+	t.Helper()
+
+	user, err := service.NewUser(username, "secret123", "user")
+	if err != nil {
+		t.Fatalf("NewUser: %v", err)
+	}
+
+	return user
+}
+
+func mustSaveUser(t *testing.T, store service.UserStore, user *service.User) {
+	t.Helper()
+
+	if err := store.Save(user); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func assertUser(t *testing.T, want, got *service.User) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no user, want %+v", want)
+	}
+
+	if *got != *want {
+		t.Fatalf("got user %+v, want %+v", got, want)
+	}
+}
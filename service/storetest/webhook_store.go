@@ -0,0 +1,255 @@
+package storetest
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// RunWebhookStoreTests runs the WebhookStore conformance tests, newStore must
+// return an empty store for every call
+func RunWebhookStoreTests(t *testing.T, newStore func(t *testing.T) service.WebhookStore) {
+	t.Run("SaveAndFind", func(t *testing.T) {
+		store := newStore(t)
+		webhook := newWebhook(time.Now())
+		mustSaveWebhook(t, store, webhook)
+
+		found, err := store.Find(webhook.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertWebhook(t, webhook, found)
+
+		// saving again replaces the webhook
+		webhook.URL = "https://example.com/other"
+		webhook.EventTypes = nil
+		mustSaveWebhook(t, store, webhook)
+
+		found, err = store.Find(webhook.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		assertWebhook(t, webhook, found)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStore(t)
+
+		found, err := store.Find(uuid.New().String())
+		if err != nil || found != nil {
+			t.Fatalf("Find unknown webhook: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		delivery, err := store.FindDelivery(uuid.New().String())
+		if err != nil || delivery != nil {
+			t.Fatalf("FindDelivery unknown delivery: got (%v, %v), want (nil, nil)", delivery, err)
+		}
+
+		err = store.Delete(uuid.New().String())
+		if !errors.Is(err, service.ErrNotFound) {
+			t.Fatalf("Delete unknown webhook: got %v, want %v", err, service.ErrNotFound)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		store := newStore(t)
+		now := time.Now()
+		second := newWebhook(now.Add(time.Second))
+		first := newWebhook(now)
+		mustSaveWebhook(t, store, second)
+		mustSaveWebhook(t, store, first)
+
+		webhooks, err := store.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+
+		if len(webhooks) != 2 {
+			t.Fatalf("List: got %d webhooks, want 2", len(webhooks))
+		}
+		assertWebhook(t, first, webhooks[0])
+		assertWebhook(t, second, webhooks[1])
+	})
+
+	t.Run("Deliveries", func(t *testing.T) {
+		store := newStore(t)
+		now := time.Now()
+		webhook := newWebhook(now)
+		other := newWebhook(now)
+		mustSaveWebhook(t, store, webhook)
+		mustSaveWebhook(t, store, other)
+
+		second := newWebhookDelivery(webhook.ID, now.Add(time.Second))
+		first := newWebhookDelivery(webhook.ID, now)
+		mustSaveWebhookDelivery(t, store, second)
+		mustSaveWebhookDelivery(t, store, first)
+		mustSaveWebhookDelivery(t, store, newWebhookDelivery(other.ID, now))
+
+		// saving again records the attempt
+		first.Status = service.WebhookDeliverySucceeded
+		first.Attempts = 2
+		first.ResponseStatus = 204
+		first.LastAttemptAt = now.Add(time.Minute).UTC().Truncate(time.Millisecond)
+		mustSaveWebhookDelivery(t, store, first)
+
+		found, err := store.FindDelivery(first.ID)
+		if err != nil {
+			t.Fatalf("FindDelivery: %v", err)
+		}
+		assertWebhookDelivery(t, first, found)
+
+		deliveries := mustListWebhookDeliveries(t, store, webhook.ID)
+		if len(deliveries) != 2 {
+			t.Fatalf("ListDeliveries: got %d deliveries, want 2", len(deliveries))
+		}
+		assertWebhookDelivery(t, first, deliveries[0])
+		assertWebhookDelivery(t, second, deliveries[1])
+	})
+
+	t.Run("DeleteDeliveries", func(t *testing.T) {
+		store := newStore(t)
+		webhook := newWebhook(time.Now())
+		other := newWebhook(time.Now())
+		mustSaveWebhook(t, store, webhook)
+		mustSaveWebhook(t, store, other)
+
+		delivery := newWebhookDelivery(webhook.ID, time.Now())
+		mustSaveWebhookDelivery(t, store, delivery)
+		mustSaveWebhookDelivery(t, store, newWebhookDelivery(other.ID, time.Now()))
+
+		if err := store.Delete(webhook.ID); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		found, err := store.FindDelivery(delivery.ID)
+		if err != nil || found != nil {
+			t.Fatalf("FindDelivery of deleted webhook: got (%v, %v), want (nil, nil)", found, err)
+		}
+
+		if deliveries := mustListWebhookDeliveries(t, store, webhook.ID); len(deliveries) != 0 {
+			t.Fatalf("ListDeliveries of deleted webhook: got %d deliveries, want 0", len(deliveries))
+		}
+
+		if deliveries := mustListWebhookDeliveries(t, store, other.ID); len(deliveries) != 1 {
+			t.Fatalf("ListDeliveries of other webhook: got %d deliveries, want 1", len(deliveries))
+		}
+	})
+
+	t.Run("DeepCopy", func(t *testing.T) {
+		store := newStore(t)
+		webhook := newWebhook(time.Now())
+		mustSaveWebhook(t, store, webhook)
+		delivery := newWebhookDelivery(webhook.ID, time.Now())
+		mustSaveWebhookDelivery(t, store, delivery)
+
+		webhook.EventTypes[0] = service.TodoEventDeleted
+		delivery.Payload[0] = 'x'
+
+		found, err := store.Find(webhook.ID)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		if found.EventTypes[0] != service.TodoEventCreated {
+			t.Fatalf("Find: got event type %d after modifying the saved webhook, want %d", found.EventTypes[0], service.TodoEventCreated)
+		}
+
+		foundDelivery, err := store.FindDelivery(delivery.ID)
+		if err != nil {
+			t.Fatalf("FindDelivery: %v", err)
+		}
+		if string(foundDelivery.Payload) != "{}" {
+			t.Fatalf("FindDelivery: got payload %q after modifying the saved delivery, want %q", foundDelivery.Payload, "{}")
+		}
+	})
+}
+
+func newWebhook(createdAt time.Time) *service.Webhook {
+	return &service.Webhook{
+		ID:         uuid.New().String(),
+		URL:        "https://example.com/hook",
+		Secret:     "secret",
+		EventTypes: []service.TodoEventType{service.TodoEventCreated, service.TodoEventFeedbackAdded},
+		CreatedAt:  createdAt.UTC().Truncate(time.Millisecond),
+	}
+}
+
+func newWebhookDelivery(webhookID string, createdAt time.Time) *service.WebhookDelivery {
+	return &service.WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     webhookID,
+		EventSequence: 1,
+		EventType:     service.TodoEventCreated,
+		Payload:       []byte("{}"),
+		Status:        service.WebhookDeliveryPending,
+		CreatedAt:     createdAt.UTC().Truncate(time.Millisecond),
+	}
+}
+
+func mustSaveWebhook(t *testing.T, store service.WebhookStore, webhook *service.Webhook) {
+	t.Helper()
+
+	if err := store.Save(webhook); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func mustSaveWebhookDelivery(t *testing.T, store service.WebhookStore, delivery *service.WebhookDelivery) {
+	t.Helper()
+
+	if err := store.SaveDelivery(delivery); err != nil {
+		t.Fatalf("SaveDelivery: %v", err)
+	}
+}
+
+func mustListWebhookDeliveries(t *testing.T, store service.WebhookStore, webhookID string) []*service.WebhookDelivery {
+	t.Helper()
+
+	deliveries, err := store.ListDeliveries(webhookID)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+func assertWebhook(t *testing.T, want, got *service.Webhook) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no webhook, want %+v", want)
+	}
+
+	if got.ID != want.ID ||
+		got.URL != want.URL ||
+		got.Secret != want.Secret ||
+		!slices.Equal(got.EventTypes, want.EventTypes) ||
+		!got.CreatedAt.Equal(want.CreatedAt) {
+		t.Fatalf("got webhook %+v, want %+v", got, want)
+	}
+}
+
+func assertWebhookDelivery(t *testing.T, want, got *service.WebhookDelivery) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("got no delivery, want %+v", want)
+	}
+
+	if got.ID != want.ID ||
+		got.WebhookID != want.WebhookID ||
+		got.EventSequence != want.EventSequence ||
+		got.EventType != want.EventType ||
+		string(got.Payload) != string(want.Payload) ||
+		got.Status != want.Status ||
+		got.Attempts != want.Attempts ||
+		got.ResponseStatus != want.ResponseStatus ||
+		got.Error != want.Error ||
+		!got.CreatedAt.Equal(want.CreatedAt) ||
+		!got.LastAttemptAt.Equal(want.LastAttemptAt) ||
+		got.ReplayOf != want.ReplayOf {
+		t.Fatalf("got delivery %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc"
+)
+
+// authStores are the user and token stores of the auth server
+type authStores struct {
+	userStore         service.UserStore
+	refreshTokenStore service.RefreshTokenStore
+	revocationStore   service.RevocationStore
+}
+
+func newInMemoryAuthStores() authStores {
+	return authStores{
+		userStore:         service.NewInMemoryUserStore(),
+		refreshTokenStore: service.NewInMemoryRefreshTokenStore(),
+		revocationStore:   service.NewInMemoryRevocationStore(),
+	}
+}
+
+// testServers are a todo and an auth server over the auth stores and in-memory
+// todo stores, the tests serve them with the interceptor they need
+type testServers struct {
+	authStores
+	jwtManager    *service.JWTManager
+	todoStore     service.TodoStore
+	imageStore    service.ImageStore
+	feedbackStore service.FeedbackStore
+	shareStore    service.ShareStore
+	todoServer    *service.TodoServer
+	authServer    *service.AuthServer
+}
+
+// newTestServers creates the servers with the users of the roles, every user
+// has the password secret123
+func newTestServers(t *testing.T, stores authStores, roles map[string]string) *testServers {
+	t.Helper()
+
+	for username, role := range roles {
+		user, err := service.NewUser(username, "secret123", role)
+		if err != nil {
+			t.Fatalf("NewUser: %v", err)
+		}
+		if err := stores.userStore.Save(user); err != nil {
+			t.Fatalf("Save user: %v", err)
+		}
+	}
+
+	servers := &testServers{
+		authStores:    stores,
+		jwtManager:    service.NewJWTManager("secret", time.Minute),
+		todoStore:     service.NewInMemoryTodoStore(),
+		imageStore:    service.NewDiskImageStore(t.TempDir()),
+		feedbackStore: service.NewInMemoryFeedbackStore(),
+		shareStore:    service.NewInMemoryShareStore(),
+	}
+	servers.todoServer = service.NewTodoServer(
+		servers.todoStore,
+		servers.imageStore,
+		servers.feedbackStore,
+		servers.shareStore,
+		stores.userStore,
+		newTestUploadSessionStore(t, 10, time.Minute),
+		service.DefaultUploadPolicy(),
+		service.NewEventBus(10, 10),
+	)
+	servers.authServer = service.NewAuthServer(servers.jwtManager, stores.userStore, stores.refreshTokenStore, stores.revocationStore, time.Hour)
+	return servers
+}
+
+// interceptor returns an auth interceptor of the servers
+func (servers *testServers) interceptor(accessibleRoles map[string][]string, certificateRoles map[string]string) *service.AuthInterceptor {
+	return service.NewAuthInterceptor(servers.jwtManager, servers.userStore, servers.revocationStore, accessibleRoles, certificateRoles)
+}
+
+// serve serves the servers with the interceptor until the test ends, and
+// returns the listener to dial them
+func (servers *testServers) serve(t *testing.T, interceptor *service.AuthInterceptor, opts ...grpc.ServerOption) *service.PipeListener {
+	t.Helper()
+
+	opts = append(opts,
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	srv := grpc.NewServer(opts...)
+	pb.RegisterTodoServiceServer(srv, servers.todoServer)
+	pb.RegisterAuthServiceServer(srv, servers.authServer)
+
+	listener := service.NewPipeListener()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+	return listener
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TodoPermission is an action on a single todo, each permission includes the
+// permissions below it
+type TodoPermission int
+
+const (
+	TodoPermissionView TodoPermission = iota + 1
+	TodoPermissionComment
+	TodoPermissionEdit
+	// TodoPermissionManage allows deleting and sharing the todo, only the owner
+	// and admins have it
+	TodoPermissionManage
+)
+
+func (permission TodoPermission) String() string {
+	switch permission {
+	case TodoPermissionView:
+		return "view"
+	case TodoPermissionComment:
+		return "comment on"
+	case TodoPermissionEdit:
+		return "edit"
+	case TodoPermissionManage:
+		return "manage"
+	default:
+		return "access"
+	}
+}
+
+// TodoAuthorizer checks the access to a single todo. It complements the
+// method level accessibleRoles of the AuthInterceptor: the owner of a todo and
+// admins can do anything, other users need a share granting the permission.
+type TodoAuthorizer struct {
+	shareStore ShareStore
+}
+
+func NewTodoAuthorizer(shareStore ShareStore) *TodoAuthorizer {
+	return &TodoAuthorizer{
+		shareStore: shareStore,
+	}
+}
+
+// Authorize returns a PermissionDenied status error when the user does not have
+// the permission on the todo
+func (authorizer *TodoAuthorizer) Authorize(userClaims *UserClaims, todo *Todo, permission TodoPermission) error {
+	if userClaims.Role == "admin" || userClaims.Username == todo.FromUser {
+		return nil
+	}
+
+	if permission < TodoPermissionManage {
+		share, err := authorizer.shareStore.Find(todo.ID, userClaims.Username)
+		if err != nil {
+			return status.Errorf(codes.Internal, "cannot find share: %v", err)
+		}
+
+		if share != nil && share.Role.Allows(permission) {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.PermissionDenied, "no permission to %s todo %s", permission, todo.ID)
+}
@@ -0,0 +1,62 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTodoAuthorizer(t *testing.T) {
+	shareStore := service.NewInMemoryShareStore()
+	authorizer := service.NewTodoAuthorizer(shareStore)
+	todo := &service.Todo{ID: "todo-1", FromUser: "owner"}
+
+	for username, role := range map[string]service.ShareRole{
+		"viewer":    service.ShareRoleViewer,
+		"commenter": service.ShareRoleCommenter,
+		"editor":    service.ShareRoleEditor,
+	} {
+		err := shareStore.Save(&service.Share{TodoID: todo.ID, Username: username, Role: role})
+		if err != nil {
+			t.Fatalf("Save share: %v", err)
+		}
+	}
+
+	permissions := []service.TodoPermission{
+		service.TodoPermissionView,
+		service.TodoPermissionComment,
+		service.TodoPermissionEdit,
+		service.TodoPermissionManage,
+	}
+
+	tests := []struct {
+		claims *service.UserClaims
+		// allowed is the number of permissions granted, from the lowest one
+		allowed int
+	}{
+		{&service.UserClaims{Username: "owner", Role: "user"}, 4},
+		{&service.UserClaims{Username: "admin", Role: "admin"}, 4},
+		{&service.UserClaims{Username: "editor", Role: "user"}, 3},
+		{&service.UserClaims{Username: "commenter", Role: "user"}, 2},
+		{&service.UserClaims{Username: "viewer", Role: "user"}, 1},
+		{&service.UserClaims{Username: "stranger", Role: "user"}, 0},
+	}
+
+	for _, tt := range tests {
+		for i, permission := range permissions {
+			err := authorizer.Authorize(tt.claims, todo, permission)
+			if i < tt.allowed {
+				if err != nil {
+					t.Errorf("%s cannot %s the todo: %v", tt.claims.Username, permission, err)
+				}
+				continue
+			}
+
+			if status.Code(err) != codes.PermissionDenied {
+				t.Errorf("%s can %s the todo: got %v, want PermissionDenied", tt.claims.Username, permission, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toPbTodoResult(todo *Todo) *pb.TodoResult {
+	return &pb.TodoResult{
+		Id:          todo.ID,
+		Title:       todo.Title,
+		FromUser:    todo.FromUser,
+		Description: todo.Description,
+		Status:      toPbTodoStatus(todo.Status),
+		Priority:    pb.TodoPriority(todo.Priority),
+		DueAt:       toPbTimestamp(todo.DueAt),
+		CompletedAt: toPbTimestamp(todo.CompletedAt),
+		CreatedAt:   toPbTimestamp(todo.CreatedAt),
+		UpdatedAt:   toPbTimestamp(todo.UpdatedAt),
+	}
+}
+
+func toPbTodoStatus(todoStatus TodoStatus) pb.TodoStatus {
+	switch todoStatus {
+	case TodoStatusOpen:
+		return pb.TodoStatus_TODO_STATUS_OPEN
+	case TodoStatusInProgress:
+		return pb.TodoStatus_TODO_STATUS_IN_PROGRESS
+	case TodoStatusDone:
+		return pb.TodoStatus_TODO_STATUS_DONE
+	case TodoStatusCancelled:
+		return pb.TodoStatus_TODO_STATUS_CANCELLED
+	default:
+		return pb.TodoStatus_TODO_STATUS_UNSPECIFIED
+	}
+}
+
+// fromPbTodoStatus converts a status from the request, an unspecified status is
+// converted to the empty TodoStatus
+func fromPbTodoStatus(todoStatus pb.TodoStatus) (TodoStatus, error) {
+	switch todoStatus {
+	case pb.TodoStatus_TODO_STATUS_UNSPECIFIED:
+		return "", nil
+	case pb.TodoStatus_TODO_STATUS_OPEN:
+		return TodoStatusOpen, nil
+	case pb.TodoStatus_TODO_STATUS_IN_PROGRESS:
+		return TodoStatusInProgress, nil
+	case pb.TodoStatus_TODO_STATUS_DONE:
+		return TodoStatusDone, nil
+	case pb.TodoStatus_TODO_STATUS_CANCELLED:
+		return TodoStatusCancelled, nil
+	default:
+		return "", fmt.Errorf("unknown todo status: %d", todoStatus)
+	}
+}
+
+func fromPbTodoPriority(priority pb.TodoPriority) (TodoPriority, error) {
+	if _, ok := pb.TodoPriority_name[int32(priority)]; !ok {
+		return TodoPriorityNone, fmt.Errorf("unknown todo priority: %d", priority)
+	}
+
+	return TodoPriority(priority), nil
+}
+
+func toPbFeedback(feedback *Feedback) *pb.FeedBack {
+	return &pb.FeedBack{
+		Id:               feedback.ID,
+		Content:          feedback.Content,
+		FromUser:         feedback.FromUser,
+		CreatedAt:        toPbTimestamp(feedback.CreatedAt),
+		EditedAt:         toPbTimestamp(feedback.EditedAt),
+		ParentFeedbackId: feedback.ParentID,
+	}
+}
+
+// toPbFeedbackThreads nests every feedback in the replies of its parent, the
+// feedbacks must be in the order they were added so parents come first
+func toPbFeedbackThreads(feedbacks []*Feedback) []*pb.FeedBack {
+	threads := make([]*pb.FeedBack, 0)
+	converted := make(map[string]*pb.FeedBack, len(feedbacks))
+	for _, feedback := range feedbacks {
+		pbFeedback := toPbFeedback(feedback)
+		converted[feedback.ID] = pbFeedback
+
+		if parent := converted[feedback.ParentID]; parent != nil {
+			parent.Replies = append(parent.Replies, pbFeedback)
+		} else {
+			threads = append(threads, pbFeedback)
+		}
+	}
+
+	return threads
+}
+
+func toPbTodoEvent(event *TodoEvent) *pb.WatchTodosResponse {
+	res := &pb.WatchTodosResponse{
+		Sequence:    event.Sequence,
+		Type:        toPbTodoEventType(event.Type),
+		Todo:        toPbTodoResult(event.Todo),
+		PublishedAt: toPbTimestamp(event.PublishedAt),
+		Epoch:       event.Epoch,
+	}
+
+	if event.Feedback != nil {
+		res.Feedback = toPbFeedback(event.Feedback)
+	}
+	return res
+}
+
+func toPbTodoEventType(eventType TodoEventType) pb.TodoEventType {
+	switch eventType {
+	case TodoEventCreated:
+		return pb.TodoEventType_TODO_EVENT_TYPE_CREATED
+	case TodoEventUpdated:
+		return pb.TodoEventType_TODO_EVENT_TYPE_UPDATED
+	case TodoEventDeleted:
+		return pb.TodoEventType_TODO_EVENT_TYPE_DELETED
+	case TodoEventFeedbackAdded:
+		return pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_ADDED
+	case TodoEventFeedbackEdited:
+		return pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_EDITED
+	case TodoEventFeedbackDeleted:
+		return pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_DELETED
+	default:
+		return pb.TodoEventType_TODO_EVENT_TYPE_UNSPECIFIED
+	}
+}
+
+func fromPbTodoEventType(eventType pb.TodoEventType) (TodoEventType, error) {
+	switch eventType {
+	case pb.TodoEventType_TODO_EVENT_TYPE_CREATED:
+		return TodoEventCreated, nil
+	case pb.TodoEventType_TODO_EVENT_TYPE_UPDATED:
+		return TodoEventUpdated, nil
+	case pb.TodoEventType_TODO_EVENT_TYPE_DELETED:
+		return TodoEventDeleted, nil
+	case pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_ADDED:
+		return TodoEventFeedbackAdded, nil
+	case pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_EDITED:
+		return TodoEventFeedbackEdited, nil
+	case pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_DELETED:
+		return TodoEventFeedbackDeleted, nil
+	default:
+		return 0, fmt.Errorf("unknown todo event type: %d", eventType)
+	}
+}
+
+func toPbCollaborator(share *Share) *pb.Collaborator {
+	return &pb.Collaborator{
+		Username:  share.Username,
+		Role:      toPbCollaboratorRole(share.Role),
+		CreatedAt: toPbTimestamp(share.CreatedAt),
+	}
+}
+
+func toPbCollaboratorRole(role ShareRole) pb.CollaboratorRole {
+	switch role {
+	case ShareRoleViewer:
+		return pb.CollaboratorRole_COLLABORATOR_ROLE_VIEWER
+	case ShareRoleCommenter:
+		return pb.CollaboratorRole_COLLABORATOR_ROLE_COMMENTER
+	case ShareRoleEditor:
+		return pb.CollaboratorRole_COLLABORATOR_ROLE_EDITOR
+	default:
+		return pb.CollaboratorRole_COLLABORATOR_ROLE_UNSPECIFIED
+	}
+}
+
+func fromPbCollaboratorRole(role pb.CollaboratorRole) (ShareRole, error) {
+	switch role {
+	case pb.CollaboratorRole_COLLABORATOR_ROLE_VIEWER:
+		return ShareRoleViewer, nil
+	case pb.CollaboratorRole_COLLABORATOR_ROLE_COMMENTER:
+		return ShareRoleCommenter, nil
+	case pb.CollaboratorRole_COLLABORATOR_ROLE_EDITOR:
+		return ShareRoleEditor, nil
+	default:
+		return "", fmt.Errorf("unknown collaborator role: %d", role)
+	}
+}
+
+func toPbAttachment(image *ImageInfo) *pb.Attachment {
+	return &pb.Attachment{
+		Id:         image.ID,
+		TodoId:     image.TodoID,
+		ImageType:  image.Type,
+		Size:       uint64(image.Size),
+		UploadedAt: toPbTimestamp(image.UploadedAt),
+		Variants:   toPbImageVariants(image.Variants),
+	}
+}
+
+func toPbImageVariants(variants []ImageVariant) []*pb.ImageVariant {
+	pbVariants := make([]*pb.ImageVariant, 0, len(variants))
+	for _, variant := range variants {
+		pbVariants = append(pbVariants, &pb.ImageVariant{
+			Name:      variant.Name,
+			ImageType: variant.Type,
+			Size:      uint64(variant.Size),
+			Width:     uint32(variant.Width),
+			Height:    uint32(variant.Height),
+		})
+	}
+
+	return pbVariants
+}
+
+func toPbAttachments(images []*ImageInfo) []*pb.Attachment {
+	attachments := make([]*pb.Attachment, 0, len(images))
+	for _, image := range images {
+		attachments = append(attachments, toPbAttachment(image))
+	}
+
+	return attachments
+}
+
+func toPbUploadSession(session *UploadSession) *pb.UploadSession {
+	return &pb.UploadSession{
+		Id: session.ID,
+		ImageInfo: &pb.ImageInfo{
+			TodoId:    session.TodoID,
+			ImageType: session.ImageType,
+		},
+		Size:          uint64(session.Size),
+		Sha256:        session.SHA256,
+		ReceivedBytes: uint64(session.Received),
+		ExpiresAt:     toPbTimestamp(session.ExpiresAt),
+	}
+}
+
+// toTodoQuery converts the request into a query of the todos created by the user
+func toTodoQuery(username string, req *pb.GetTodosRequest) (*TodoQuery, error) {
+	if req.GetPageSize() < 0 {
+		return nil, fmt.Errorf("page size must not be negative: %d", req.GetPageSize())
+	}
+
+	orderBy, descending, err := ParseTodoOrder(req.GetOrderBy())
+	if err != nil {
+		return nil, err
+	}
+
+	query := &TodoQuery{
+		FromUser:   username,
+		OrderBy:    orderBy,
+		Descending: descending,
+	}
+
+	filter := req.GetFilter()
+	for _, s := range filter.GetStatuses() {
+		todoStatus, err := fromPbTodoStatus(s)
+		if err != nil {
+			return nil, err
+		}
+		if todoStatus == "" {
+			return nil, fmt.Errorf("status filter must be specified")
+		}
+		query.Filter.Statuses = append(query.Filter.Statuses, todoStatus)
+	}
+
+	for _, p := range filter.GetPriorities() {
+		priority, err := fromPbTodoPriority(p)
+		if err != nil {
+			return nil, err
+		}
+		query.Filter.Priorities = append(query.Filter.Priorities, priority)
+	}
+
+	query.Filter.DueBefore, err = fromPbTimestamp(filter.GetDueBefore())
+	if err != nil {
+		return nil, fmt.Errorf("due_before is invalid: %w", err)
+	}
+
+	query.Filter.DueAfter, err = fromPbTimestamp(filter.GetDueAfter())
+	if err != nil {
+		return nil, fmt.Errorf("due_after is invalid: %w", err)
+	}
+
+	query.Filter.TitleContains = filter.GetTitleContains()
+
+	if req.GetPageToken() != "" {
+		cursor, err := DecodeTodoCursor(req.GetPageToken())
+		if err != nil {
+			return nil, err
+		}
+		if err := query.StartAfter(cursor); err != nil {
+			return nil, err
+		}
+
+		queryHash, err := todoQueryHash(username, req)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.QueryHash != queryHash {
+			return nil, fmt.Errorf("page token does not match the filter of the request")
+		}
+	}
+
+	return query, nil
+}
+
+// todoQueryHash identifies the todos of the user a GetTodos request asks for,
+// the page token and page size do not change them
+func todoQueryHash(username string, req *pb.GetTodosRequest) (string, error) {
+	other := proto.Clone(req).(*pb.GetTodosRequest)
+	other.PageToken = ""
+	other.PageSize = 0
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(other)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode todos request: %w", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(username))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)[:16]), nil
+}
+
+// toPbTimestamp converts the zero time to a nil timestamp
+func toPbTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+
+	return timestamppb.New(t)
+}
+
+// fromPbTimestamp converts a nil timestamp to the zero time
+func fromPbTimestamp(ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, err
+	}
+
+	return ts.AsTime(), nil
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type TodoOrderField string
+
+const (
+	TodoOrderByCreatedAt TodoOrderField = "created_at"
+	TodoOrderByUpdatedAt TodoOrderField = "updated_at"
+	TodoOrderByDueAt     TodoOrderField = "due_at"
+	TodoOrderByPriority  TodoOrderField = "priority"
+	TodoOrderByTitle     TodoOrderField = "title"
+)
+
+type TodoFilter struct {
+	Statuses      []TodoStatus
+	Priorities    []TodoPriority
+	DueBefore     time.Time
+	DueAfter      time.Time
+	TitleContains string
+}
+
+type TodoQuery struct {
+	FromUser string
+	// SharedIDs are todos of other users returned along with the ones of FromUser
+	SharedIDs  []string
+	Filter     TodoFilter
+	OrderBy    TodoOrderField
+	Descending bool
+	// After only keeps the todos ordered after the cursor
+	After *TodoCursor
+	// Limit is the maximum number of todos to return, 0 means no limit
+	Limit int
+}
+
+// TodoCursor holds the position of a todo in the order of a query, it stays
+// valid when todos are inserted or deleted
+type TodoCursor struct {
+	OrderBy    TodoOrderField `json:"o"`
+	Descending bool           `json:"d,omitempty"`
+	ID         string         `json:"i"`
+	Time       time.Time      `json:"t,omitempty"`
+	Priority   TodoPriority   `json:"p,omitempty"`
+	Title      string         `json:"s,omitempty"`
+	// QueryHash identifies the filter and the user of the query the cursor was
+	// created for, so a page token is not used with another query
+	QueryHash string `json:"q,omitempty"`
+}
+
+// ParseTodoOrder parses an order clause like "due_at desc"
+func ParseTodoOrder(orderBy string) (TodoOrderField, bool, error) {
+	fields := strings.Fields(orderBy)
+	if len(fields) == 0 {
+		return TodoOrderByCreatedAt, false, nil
+	}
+
+	if len(fields) > 2 {
+		return "", false, fmt.Errorf("invalid order clause: %q", orderBy)
+	}
+
+	descending := false
+	if len(fields) == 2 {
+		switch strings.ToLower(fields[1]) {
+		case "asc":
+		case "desc":
+			descending = true
+		default:
+			return "", false, fmt.Errorf("invalid order direction: %q", fields[1])
+		}
+	}
+
+	field := TodoOrderField(fields[0])
+	switch field {
+	case TodoOrderByCreatedAt, TodoOrderByUpdatedAt, TodoOrderByDueAt, TodoOrderByPriority, TodoOrderByTitle:
+		return field, descending, nil
+	default:
+		return "", false, fmt.Errorf("unknown order field: %q", fields[0])
+	}
+}
+
+// Matches reports whether the todo passes the owner and the filter of the query
+func (query *TodoQuery) Matches(todo *Todo) bool {
+	if query.FromUser != "" && todo.FromUser != query.FromUser && !slices.Contains(query.SharedIDs, todo.ID) {
+		return false
+	}
+
+	filter := query.Filter
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, todo.Status) {
+		return false
+	}
+
+	if len(filter.Priorities) > 0 && !slices.Contains(filter.Priorities, todo.Priority) {
+		return false
+	}
+
+	if !filter.DueBefore.IsZero() && (todo.DueAt.IsZero() || !todo.DueAt.Before(filter.DueBefore)) {
+		return false
+	}
+
+	if !filter.DueAfter.IsZero() && (todo.DueAt.IsZero() || !todo.DueAt.After(filter.DueAfter)) {
+		return false
+	}
+
+	if filter.TitleContains != "" &&
+		!strings.Contains(strings.ToLower(todo.Title), strings.ToLower(filter.TitleContains)) {
+		return false
+	}
+
+	return true
+}
+
+// Compare orders two todos by the order field of the query, ties are broken by ID
+// so the order is total and stable
+func (query *TodoQuery) Compare(a, b *Todo) int {
+	return query.compareCursors(query.Cursor(a), query.Cursor(b))
+}
+
+// SortAndLimit sorts the todos in the query order and keeps at most Limit of them
+func (query *TodoQuery) SortAndLimit(todos []*Todo) []*Todo {
+	slices.SortFunc(todos, query.Compare)
+	if query.Limit > 0 && len(todos) > query.Limit {
+		todos = todos[:query.Limit]
+	}
+
+	return todos
+}
+
+// IsAfterCursor reports whether the todo comes after the cursor of the query
+func (query *TodoQuery) IsAfterCursor(todo *Todo) bool {
+	if query.After == nil {
+		return true
+	}
+
+	return query.compareCursors(query.Cursor(todo), query.After) > 0
+}
+
+// StartAfter only keeps the todos after the cursor, which must have been
+// created for the order of the query
+func (query *TodoQuery) StartAfter(cursor *TodoCursor) error {
+	if cursor.OrderBy != query.orderBy() || cursor.Descending != query.Descending {
+		return fmt.Errorf("page token does not match the order of the request")
+	}
+
+	query.After = cursor
+	return nil
+}
+
+// Cursor returns the position of the todo in the order of the query
+func (query *TodoQuery) Cursor(todo *Todo) *TodoCursor {
+	cursor := &TodoCursor{
+		OrderBy:    query.orderBy(),
+		Descending: query.Descending,
+		ID:         todo.ID,
+	}
+
+	switch cursor.OrderBy {
+	case TodoOrderByCreatedAt:
+		cursor.Time = todo.CreatedAt
+	case TodoOrderByUpdatedAt:
+		cursor.Time = todo.UpdatedAt
+	case TodoOrderByDueAt:
+		cursor.Time = todo.DueAt
+	case TodoOrderByPriority:
+		cursor.Priority = todo.Priority
+	case TodoOrderByTitle:
+		cursor.Title = todo.Title
+	}
+
+	return cursor
+}
+
+func (query *TodoQuery) orderBy() TodoOrderField {
+	if query.OrderBy == "" {
+		return TodoOrderByCreatedAt
+	}
+
+	return query.OrderBy
+}
+
+func (query *TodoQuery) compareCursors(a, b *TodoCursor) int {
+	var c int
+	switch query.orderBy() {
+	case TodoOrderByDueAt:
+		// todos without a due date come last in both directions
+		switch {
+		case a.Time.IsZero() && !b.Time.IsZero():
+			return 1
+		case !a.Time.IsZero() && b.Time.IsZero():
+			return -1
+		default:
+			c = a.Time.Compare(b.Time)
+		}
+	case TodoOrderByPriority:
+		c = cmp.Compare(a.Priority, b.Priority)
+	case TodoOrderByTitle:
+		c = strings.Compare(a.Title, b.Title)
+	default:
+		c = a.Time.Compare(b.Time)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+
+	if query.Descending {
+		return -c
+	}
+	return c
+}
+
+// EncodeTodoCursor encodes the cursor into an opaque page token
+func EncodeTodoCursor(cursor *TodoCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeTodoCursor decodes a page token created by EncodeTodoCursor
+func DecodeTodoCursor(pageToken string) (*TodoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(pageToken)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode page token: %w", err)
+	}
+
+	cursor := &TodoCursor{}
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, fmt.Errorf("cannot decode page token: %w", err)
+	}
+
+	return cursor, nil
+}
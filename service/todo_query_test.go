@@ -0,0 +1,255 @@
+package service_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+func TestParseTodoOrder(t *testing.T) {
+	tests := []struct {
+		orderBy        string
+		wantField      service.TodoOrderField
+		wantDescending bool
+		wantErr        bool
+	}{
+		{"", service.TodoOrderByCreatedAt, false, false},
+		{"due_at", service.TodoOrderByDueAt, false, false},
+		{"due_at desc", service.TodoOrderByDueAt, true, false},
+		{" title  ASC ", service.TodoOrderByTitle, false, false},
+		{"priority DESC", service.TodoOrderByPriority, true, false},
+		{"updated_at asc", service.TodoOrderByUpdatedAt, false, false},
+		{"owner", "", false, true},
+		{"due_at sideways", "", false, true},
+		{"due_at desc title", "", false, true},
+	}
+	for _, tt := range tests {
+		field, descending, err := service.ParseTodoOrder(tt.orderBy)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTodoOrder(%q) succeeded, want an error", tt.orderBy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTodoOrder(%q): %v", tt.orderBy, err)
+			continue
+		}
+		if field != tt.wantField || descending != tt.wantDescending {
+			t.Errorf("ParseTodoOrder(%q) = %q, %v, want %q, %v", tt.orderBy, field, descending, tt.wantField, tt.wantDescending)
+		}
+	}
+}
+
+// queryTestTodos returns todos of alice created one hour apart, b and d have
+// no due date, and a todo of bob
+func queryTestTodos() []*service.Todo {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	hour := func(n int) time.Time { return start.Add(time.Duration(n) * time.Hour) }
+
+	return []*service.Todo{
+		{ID: "a", FromUser: "alice", Title: "Buy milk", Status: service.TodoStatusOpen, Priority: service.TodoPriorityHigh, DueAt: hour(30), CreatedAt: hour(1), UpdatedAt: hour(5)},
+		{ID: "b", FromUser: "alice", Title: "buy bread", Status: service.TodoStatusDone, Priority: service.TodoPriorityLow, CreatedAt: hour(2), UpdatedAt: hour(2)},
+		{ID: "c", FromUser: "alice", Title: "Call mom", Status: service.TodoStatusInProgress, Priority: service.TodoPriorityHigh, DueAt: hour(10), CreatedAt: hour(3), UpdatedAt: hour(4)},
+		{ID: "d", FromUser: "alice", Title: "Write report", Status: service.TodoStatusOpen, Priority: service.TodoPriorityUrgent, CreatedAt: hour(4), UpdatedAt: hour(6)},
+		{ID: "e", FromUser: "alice", Title: "File taxes", Status: service.TodoStatusOpen, Priority: service.TodoPriorityNone, DueAt: hour(20), CreatedAt: hour(5), UpdatedAt: hour(3)},
+		{ID: "f", FromUser: "bob", Title: "Buy milk too", Status: service.TodoStatusOpen, Priority: service.TodoPriorityHigh, DueAt: hour(30), CreatedAt: hour(6), UpdatedAt: hour(6)},
+	}
+}
+
+// queryTestStores are the stores the query tests run against, with the todos
+// of queryTestTodos
+var queryTestStores = []struct {
+	name     string
+	newStore func(t *testing.T) service.TodoStore
+}{
+	{"InMemory", func(t *testing.T) service.TodoStore {
+		return saveQueryTestTodos(t, service.NewInMemoryTodoStore())
+	}},
+	{"Bolt", func(t *testing.T) service.TodoStore {
+		return saveQueryTestTodos(t, service.NewBoltTodoStore(newTestBoltDB(t)))
+	}},
+}
+
+func saveQueryTestTodos(t *testing.T, store service.TodoStore) service.TodoStore {
+	t.Helper()
+
+	for _, todo := range queryTestTodos() {
+		if err := store.Save(todo); err != nil {
+			t.Fatalf("Save %s: %v", todo.ID, err)
+		}
+	}
+	return store
+}
+
+func queryIDs(t *testing.T, store service.TodoStore, query *service.TodoQuery) []string {
+	t.Helper()
+
+	ids := []string{}
+	err := store.GetMany(context.Background(), query, func(todo *service.Todo) error {
+		ids = append(ids, todo.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetMany: %v", err)
+	}
+	return ids
+}
+
+func TestTodoQueryFilter(t *testing.T) {
+	for _, stores := range queryTestStores {
+		t.Run(stores.name, func(t *testing.T) {
+			testTodoQueryFilter(t, stores.newStore(t))
+		})
+	}
+}
+
+func testTodoQueryFilter(t *testing.T, store service.TodoStore) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter service.TodoFilter
+		want   []string
+	}{
+		{"no filter", service.TodoFilter{}, []string{"a", "b", "c", "d", "e"}},
+		{"statuses", service.TodoFilter{Statuses: []service.TodoStatus{service.TodoStatusDone, service.TodoStatusInProgress}}, []string{"b", "c"}},
+		{"priorities", service.TodoFilter{Priorities: []service.TodoPriority{service.TodoPriorityHigh}}, []string{"a", "c"}},
+		{"due before", service.TodoFilter{DueBefore: start.Add(20 * time.Hour)}, []string{"c"}},
+		{"due after", service.TodoFilter{DueAfter: start.Add(10 * time.Hour)}, []string{"a", "e"}},
+		{"due range", service.TodoFilter{DueAfter: start.Add(5 * time.Hour), DueBefore: start.Add(25 * time.Hour)}, []string{"c", "e"}},
+		{"title ignores case", service.TodoFilter{TitleContains: "BUY"}, []string{"a", "b"}},
+		{"status and priority", service.TodoFilter{
+			Statuses:   []service.TodoStatus{service.TodoStatusOpen},
+			Priorities: []service.TodoPriority{service.TodoPriorityHigh, service.TodoPriorityUrgent},
+		}, []string{"a", "d"}},
+		{"status, title and due date", service.TodoFilter{
+			Statuses:      []service.TodoStatus{service.TodoStatusOpen},
+			TitleContains: "i",
+			DueAfter:      start,
+		}, []string{"a", "e"}},
+		{"no match", service.TodoFilter{
+			Statuses:      []service.TodoStatus{service.TodoStatusDone},
+			TitleContains: "milk",
+		}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := queryIDs(t, store, &service.TodoQuery{FromUser: "alice", Filter: tt.filter})
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("todos = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoQueryOrder(t *testing.T) {
+	for _, stores := range queryTestStores {
+		t.Run(stores.name, func(t *testing.T) {
+			testTodoQueryOrder(t, stores.newStore(t))
+		})
+	}
+}
+
+func testTodoQueryOrder(t *testing.T, store service.TodoStore) {
+
+	tests := []struct {
+		orderBy string
+		want    []string
+	}{
+		{"", []string{"a", "b", "c", "d", "e"}},
+		{"created_at desc", []string{"e", "d", "c", "b", "a"}},
+		{"updated_at", []string{"b", "e", "c", "a", "d"}},
+		{"updated_at desc", []string{"d", "a", "c", "e", "b"}},
+		// todos without a due date come last in both directions
+		{"due_at", []string{"c", "e", "a", "b", "d"}},
+		{"due_at desc", []string{"a", "e", "c", "d", "b"}},
+		// ties are ordered by ID
+		{"priority", []string{"e", "b", "a", "c", "d"}},
+		{"priority desc", []string{"d", "c", "a", "b", "e"}},
+		{"title", []string{"a", "c", "e", "d", "b"}},
+		{"title desc", []string{"b", "d", "e", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.orderBy, func(t *testing.T) {
+			orderBy, descending, err := service.ParseTodoOrder(tt.orderBy)
+			if err != nil {
+				t.Fatalf("ParseTodoOrder: %v", err)
+			}
+			newQuery := func() *service.TodoQuery {
+				return &service.TodoQuery{FromUser: "alice", OrderBy: orderBy, Descending: descending}
+			}
+
+			ids := queryIDs(t, store, newQuery())
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("todos = %v, want %v", ids, tt.want)
+			}
+
+			// pages of two todos resume after the cursor of the last todo
+			paged := []string{}
+			var after *service.TodoCursor
+			for len(paged) < len(tt.want) {
+				query := newQuery()
+				query.Limit = 2
+				if after != nil {
+					if err := query.StartAfter(after); err != nil {
+						t.Fatalf("StartAfter: %v", err)
+					}
+				}
+
+				var last *service.Todo
+				err := store.GetMany(context.Background(), query, func(todo *service.Todo) error {
+					paged = append(paged, todo.ID)
+					last = todo
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("GetMany: %v", err)
+				}
+				if last == nil {
+					t.Fatalf("page after %v is empty", paged)
+				}
+				after = query.Cursor(last)
+			}
+			if !slices.Equal(paged, tt.want) {
+				t.Fatalf("paged todos = %v, want %v", paged, tt.want)
+			}
+		})
+	}
+}
+
+func TestTodoQueryStartAfterAnotherOrder(t *testing.T) {
+	todo := queryTestTodos()[0]
+
+	query := &service.TodoQuery{FromUser: "alice", OrderBy: service.TodoOrderByDueAt}
+	pageToken, err := service.EncodeTodoCursor(query.Cursor(todo))
+	if err != nil {
+		t.Fatalf("EncodeTodoCursor: %v", err)
+	}
+	cursor, err := service.DecodeTodoCursor(pageToken)
+	if err != nil {
+		t.Fatalf("DecodeTodoCursor: %v", err)
+	}
+
+	if err := query.StartAfter(cursor); err != nil {
+		t.Fatalf("StartAfter with the cursor of the same order: %v", err)
+	}
+
+	others := []*service.TodoQuery{
+		{FromUser: "alice", OrderBy: service.TodoOrderByDueAt, Descending: true},
+		{FromUser: "alice", OrderBy: service.TodoOrderByCreatedAt},
+		{FromUser: "alice"},
+	}
+	for _, other := range others {
+		if err := other.StartAfter(cursor); err == nil {
+			t.Errorf("StartAfter with a %s cursor succeeded for order %q descending %v", cursor.OrderBy, other.OrderBy, other.Descending)
+		}
+	}
+
+	if _, err := service.DecodeTodoCursor("not a page token"); err == nil {
+		t.Error("DecodeTodoCursor of an invalid page token succeeded")
+	}
+}
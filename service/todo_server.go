@@ -3,31 +3,73 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chienaeae/todo-go-grpc/pb"
 	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
-// maxImagesize is 1 Megabyte
-const maxImageSize = 1 << 20
+const (
+	// imageChunkSize is the size of the chunks an image is downloaded in
+	imageChunkSize = 32 << 10
+	// uploadSessionDuration is how long an interrupted upload can be resumed
+	uploadSessionDuration = 24 * time.Hour
+	// imageURLDuration is how long a presigned image URL can be used
+	imageURLDuration = 15 * time.Minute
+	// eventEpochHeader and eventSequenceHeader are the headers of WatchTodos
+	// with the epoch and the sequence number the watch starts after, a client
+	// that receives no event before it reconnects resumes after them
+	eventEpochHeader    = "todo-event-epoch"
+	eventSequenceHeader = "todo-event-sequence"
+)
 
 type TodoServer struct {
 	pb.UnimplementedTodoServiceServer
 	todoStore     TodoStore
 	imageStore    ImageStore
 	feedbackStore FeedbackStore
+	shareStore    ShareStore
+	userStore     UserStore
+	// uploadSessionStore keeps the partial uploads until they are complete
+	uploadSessionStore UploadSessionStore
+	uploadPolicy       *UploadPolicy
+	authorizer         *TodoAuthorizer
+	// eventBus delivers the changes of todos to WatchTodos
+	eventBus *EventBus
 }
 
-func NewTodoServer(todoStore TodoStore, imageStore ImageStore, feedbackStore FeedbackStore) *TodoServer {
+func NewTodoServer(
+	todoStore TodoStore,
+	imageStore ImageStore,
+	feedbackStore FeedbackStore,
+	shareStore ShareStore,
+	userStore UserStore,
+	uploadSessionStore UploadSessionStore,
+	uploadPolicy *UploadPolicy,
+	eventBus *EventBus,
+) *TodoServer {
 	return &TodoServer{
-		todoStore:     todoStore,
-		imageStore:    imageStore,
-		feedbackStore: feedbackStore,
+		todoStore:          todoStore,
+		imageStore:         imageStore,
+		feedbackStore:      feedbackStore,
+		shareStore:         shareStore,
+		userStore:          userStore,
+		uploadSessionStore: uploadSessionStore,
+		uploadPolicy:       uploadPolicy,
+		authorizer:         NewTodoAuthorizer(shareStore),
+		eventBus:           eventBus,
 	}
 }
 
@@ -58,11 +100,38 @@ func (server *TodoServer) CreateTodo(ctx context.Context, req *pb.CreateTodoRequ
 		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
 	}
 
-	err = server.todoStore.Save(&Todo{
-		ID:       todo.Id,
-		Title:    todo.Title,
-		FromUser: userClaims.Username,
-	})
+	todoStatus, err := fromPbTodoStatus(todo.GetStatus())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "todo status is invalid: %v", err)
+	}
+	if todoStatus == "" {
+		todoStatus = TodoStatusOpen
+	}
+
+	priority, err := fromPbTodoPriority(todo.GetPriority())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "todo priority is invalid: %v", err)
+	}
+
+	dueAt, err := fromPbTimestamp(todo.GetDueAt())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "todo due_at is invalid: %v", err)
+	}
+
+	now := time.Now()
+	newTodo := &Todo{
+		ID:          todo.Id,
+		Title:       todo.Title,
+		Description: todo.Description,
+		FromUser:    userClaims.Username,
+		Priority:    priority,
+		DueAt:       dueAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	newTodo.SetStatus(todoStatus, now)
+
+	err = server.todoStore.Save(newTodo)
 	if err != nil {
 		code := codes.Internal
 		if errors.Is(err, ErrAlreadyExists) {
@@ -73,6 +142,7 @@ func (server *TodoServer) CreateTodo(ctx context.Context, req *pb.CreateTodoRequ
 	}
 
 	log.Printf("saved todo with id: %s", todo.Id)
+	server.publishEvent(TodoEventCreated, newTodo, nil)
 
 	res := &pb.CreateTodoResponse{
 		Id: todo.Id,
@@ -83,6 +153,12 @@ func (server *TodoServer) CreateTodo(ctx context.Context, req *pb.CreateTodoRequ
 
 func (server *TodoServer) GetTodo(ctx context.Context, req *pb.GetTodoRequest) (*pb.GetTodoResponse, error) {
 	id := req.GetId()
+
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
 	todo, err := server.todoStore.GetById(id)
 	if err != nil {
 		return nil, logError(status.Errorf(codes.Internal, "unexpected error: %v", err))
@@ -92,31 +168,25 @@ func (server *TodoServer) GetTodo(ctx context.Context, req *pb.GetTodoRequest) (
 		return nil, logError(status.Errorf(codes.NotFound, "cannot find todo with ID: %v", id))
 	}
 
-	fs, err := server.feedbackStore.Find(todo.ID)
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionView)
 	if err != nil {
-		return nil, logError(status.Errorf(codes.Internal, "cannot find feedback: %v", err))
-	}
-	if fs == nil {
-		fs = make([]*Feedback, 0)
+		return nil, logError(err)
 	}
 
-	feedbacks := make([]*pb.FeedBack, 0, len(fs))
+	feedbacks, err := server.feedbackStore.Find(todo.ID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find feedback: %v", err))
+	}
 
-	for _, f := range fs {
-		log.Printf("%v: ", f)
-		feedbacks = append(feedbacks, &pb.FeedBack{
-			Id:      f.ID,
-			Content: f.Content,
-		})
+	images, err := server.imageStore.List(todo.ID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find images: %v", err))
 	}
 
 	res := &pb.GetTodoResponse{
-		Todo: &pb.TodoResult{
-			Id:       todo.ID,
-			Title:    todo.Title,
-			FromUser: todo.FromUser,
-		},
-		Feedbacks: feedbacks,
+		Todo:        toPbTodoResult(todo),
+		Feedbacks:   toPbFeedbackThreads(feedbacks),
+		Attachments: toPbAttachments(images),
 	}
 	return res, nil
 }
@@ -129,176 +199,1148 @@ func (server *TodoServer) GetTodos(req *pb.GetTodosRequest, stream pb.TodoServic
 		return logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
 	}
 
+	query, err := toTodoQuery(userClaims.Username, req)
+	if err != nil {
+		return logError(status.Errorf(codes.InvalidArgument, "invalid todos request: %v", err))
+	}
+
+	if req.GetIncludeShared() {
+		shares, err := server.shareStore.ListByUser(userClaims.Username)
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot find shared todos: %v", err))
+		}
+
+		for _, share := range shares {
+			query.SharedIDs = append(query.SharedIDs, share.TodoID)
+		}
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize > 0 {
+		// one more todo is fetched to know whether there is a next page
+		query.Limit = pageSize + 1
+	}
+
+	send := func(todo *Todo, nextPageToken string) error {
+		res := &pb.GetTodosResponse{
+			Todo:          toPbTodoResult(todo),
+			NextPageToken: nextPageToken,
+		}
+
+		err := stream.Send(res)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("sent todo with id: %s", todo.ID)
+		return nil
+	}
+
+	// the last todo is held back until it is known whether it ends the page
+	var last *Todo
+	count := 0
+	hasNextPage := false
 	err = server.todoStore.GetMany(
 		stream.Context(),
-		userClaims.Username,
+		query,
 		func(todo *Todo) error {
-			res := &pb.GetTodosResponse{
-				Todo: &pb.TodoResult{
-					Id:       todo.ID,
-					Title:    todo.Title,
-					FromUser: todo.FromUser,
-				},
+			count++
+			if pageSize > 0 && count > pageSize {
+				hasNextPage = true
+				return nil
 			}
 
-			err := stream.Send(res)
-			if err != nil {
-				return err
+			if last != nil {
+				if err := send(last, ""); err != nil {
+					return err
+				}
 			}
-
-			log.Printf("sent todo with id: %s", todo.ID)
+			last = todo
 			return nil
 		},
 	)
+	if err != nil {
+		if ctxErr := contextError(stream.Context()); ctxErr != nil {
+			return ctxErr
+		}
+		return status.Errorf(codes.Internal, "unexpected error: %v", err)
+	}
+
+	if last == nil {
+		return nil
+	}
+
+	nextPageToken := ""
+	if hasNextPage {
+		cursor := query.Cursor(last)
+		cursor.QueryHash, err = todoQueryHash(userClaims.Username, req)
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot create page token: %v", err))
+		}
+
+		nextPageToken, err = EncodeTodoCursor(cursor)
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot create page token: %v", err))
+		}
+	}
 
+	err = send(last, nextPageToken)
 	if err != nil {
 		return status.Errorf(codes.Internal, "unexpected error: %v", err)
 	}
 	return nil
 }
 
-func (server *TodoServer) UploadImage(stream pb.TodoService_UploadImageServer) error {
-	req, err := stream.Recv()
+func (server *TodoServer) UpdateTodo(ctx context.Context, req *pb.UpdateTodoRequest) (*pb.UpdateTodoResponse, error) {
+	todo := req.GetTodo()
+	if todo == nil {
+		return nil, status.Error(codes.InvalidArgument, "todo is required")
+	}
+
+	mask := req.GetUpdateMask()
+	if mask != nil && !mask.IsValid(todo) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid update mask: %v", mask.GetPaths())
+	}
+
+	userClaims, err := GetUserClaims(ctx)
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot receive image info"))
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
 	}
 
-	todoID := req.GetImageInfo().GetTodoId()
-	imageType := req.GetImageInfo().GetImageType()
+	found, err := server.findTodo(todo.GetId())
+	if err != nil {
+		return nil, err
+	}
 
-	todo, err := server.todoStore.GetById(todoID)
+	err = server.authorizer.Authorize(userClaims, found, TodoPermissionEdit)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot find todo: %v", err))
+		return nil, logError(err)
 	}
 
-	if todo == nil {
-		return logError(status.Errorf(codes.InvalidArgument, "todo id %s doesn't exist", todoID))
+	paths := mask.GetPaths()
+	if len(paths) == 0 {
+		// without an update mask only the fields set in the request are updated
+		todo.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+			paths = append(paths, string(fd.Name()))
+			return true
+		})
 	}
 
-	imageData := bytes.Buffer{}
-	imageSize := 0
+	now := time.Now()
+	for _, path := range paths {
+		switch path {
+		case "id":
+			continue
+		case "title":
+			found.Title = todo.GetTitle()
+		case "description":
+			found.Description = todo.GetDescription()
+		case "status":
+			todoStatus, err := fromPbTodoStatus(todo.GetStatus())
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "todo status is invalid: %v", err)
+			}
+			if todoStatus == "" {
+				return nil, status.Error(codes.InvalidArgument, "todo status is required")
+			}
+			found.SetStatus(todoStatus, now)
+		case "priority":
+			priority, err := fromPbTodoPriority(todo.GetPriority())
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "todo priority is invalid: %v", err)
+			}
+			found.Priority = priority
+		case "due_at":
+			dueAt, err := fromPbTimestamp(todo.GetDueAt())
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "todo due_at is invalid: %v", err)
+			}
+			found.DueAt = dueAt
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "field %q cannot be updated", path)
+		}
+	}
+	found.UpdatedAt = now
 
-	for {
-		err = contextError(stream.Context())
-		if err != nil {
-			return err
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	err = server.todoStore.Update(found)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
 		}
+		return nil, logError(status.Errorf(code, "cannot update todo in the store: %v", err))
+	}
 
-		req, err = stream.Recv()
-		if err == io.EOF {
-			log.Print("no more image bytes data")
-			break
+	log.Printf("updated todo with id: %s", found.ID)
+	server.publishEvent(TodoEventUpdated, found, nil)
+
+	res := &pb.UpdateTodoResponse{
+		Todo: toPbTodoResult(found),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) DeleteTodo(ctx context.Context, req *pb.DeleteTodoRequest) (*pb.DeleteTodoResponse, error) {
+	id := req.GetId()
+
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	found, err := server.findTodo(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, found, TodoPermissionManage)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	if err := contextError(ctx); err != nil {
+		return nil, err
+	}
+
+	// the images, feedbacks and shares are deleted first and deleting them again
+	// is not an error, so a failed delete can be retried until the todo is gone
+	images, err := server.imageStore.List(id)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find images: %v", err))
+	}
+
+	for _, image := range images {
+		err := server.imageStore.Delete(image.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, logError(status.Errorf(codes.Internal, "cannot delete image: %v", err))
 		}
-		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot receive chunk data: %v", err))
+	}
+
+	feedbacks, err := server.feedbackStore.Find(id)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find feedbacks: %v", err))
+	}
+
+	for _, feedback := range feedbacks {
+		// deleting a thread deletes its replies
+		if feedback.ParentID != "" {
+			continue
 		}
 
-		chunk := req.GetChunkData()
-		size := len(chunk)
+		err := server.feedbackStore.Delete(id, feedback.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, logError(status.Errorf(codes.Internal, "cannot delete feedback: %v", err))
+		}
+	}
 
-		log.Printf("receivd a chunk with size: %d", size)
+	shares, err := server.shareStore.ListByTodo(id)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find shares: %v", err))
+	}
 
-		imageSize += size
-		if imageSize > maxImageSize {
-			return logError(status.Errorf(codes.InvalidArgument, "image is too large: %d > %d", imageSize, maxImageSize))
+	for _, share := range shares {
+		err := server.shareStore.Delete(id, share.Username)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, logError(status.Errorf(codes.Internal, "cannot delete share: %v", err))
 		}
+	}
 
-		_, err = imageData.Write(chunk)
-		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot write chunk data: %v", err))
+	err = server.todoStore.Delete(id)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
 		}
+		return nil, logError(status.Errorf(code, "cannot delete todo from the store: %v", err))
+	}
+
+	log.Printf("deleted todo with id: %s", id)
+	server.publishEventTo(TodoEventDeleted, found, nil, shares)
+
+	res := &pb.DeleteTodoResponse{
+		Id: id,
+	}
+	return res, nil
+}
+
+func (server *TodoServer) CreateUploadSession(
+	ctx context.Context,
+	req *pb.CreateUploadSessionRequest,
+) (*pb.CreateUploadSessionResponse, error) {
+	imageType := req.GetImageInfo().GetImageType()
+	if err := ValidateImageType(imageType); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "image type is invalid: %v", err)
+	}
+
+	digest, err := hex.DecodeString(req.GetSha256())
+	if err != nil || len(digest) != sha256.Size {
+		return nil, status.Errorf(codes.InvalidArgument, "sha256 is not a hex encoded SHA-256 digest: %q", req.GetSha256())
 	}
 
-	imageID, err := server.imageStore.Save(todoID, imageType, imageData)
+	userClaims, err := GetUserClaims(ctx)
 	if err != nil {
-		return logError(status.Errorf(codes.Internal, "cannot save image to the store: %v", err))
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
 	}
 
-	res := &pb.UploadImageResponse{
-		Id:   imageID,
-		Size: uint32(imageSize),
+	size := req.GetSize()
+	maxSize := server.uploadPolicy.MaxSize(userClaims.Role)
+	if size == 0 || size > uint64(maxSize) {
+		return nil, status.Errorf(codes.InvalidArgument, "image size must be between 1 and %d bytes: %d", maxSize, size)
 	}
 
-	err = stream.SendAndClose(res)
+	todo, err := server.findTodo(req.GetImageInfo().GetTodoId())
 	if err != nil {
-		return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
+		return nil, err
 	}
 
-	log.Printf("saved image with id: %s, size: %d", imageID, imageSize)
-	return nil
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionEdit)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a new upload session ID: %v", err)
+	}
+
+	session := &UploadSession{
+		ID:        id.String(),
+		TodoID:    todo.ID,
+		Username:  userClaims.Username,
+		ImageType: imageType,
+		Size:      int64(size),
+		SHA256:    hex.EncodeToString(digest),
+		ExpiresAt: time.Now().Add(uploadSessionDuration),
+	}
+
+	err = server.uploadSessionStore.Create(session)
+	if errors.Is(err, ErrTooManyUploads) {
+		return nil, logError(status.Errorf(codes.ResourceExhausted, "cannot create upload session: %v", err))
+	}
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot create upload session: %v", err))
+	}
+
+	log.Printf("created upload session with id: %s, size: %d", session.ID, session.Size)
+
+	res := &pb.CreateUploadSessionResponse{
+		Session: toPbUploadSession(session),
+	}
+	return res, nil
 }
 
-func (server *TodoServer) FeedbackTodo(stream pb.TodoService_FeedbackTodoServer) error {
+func (server *TodoServer) GetUploadSession(
+	ctx context.Context,
+	req *pb.GetUploadSessionRequest,
+) (*pb.GetUploadSessionResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	session, err := server.findUploadSession(userClaims, req.GetSessionId())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.GetUploadSessionResponse{
+		Session: toPbUploadSession(session),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) UploadImage(stream pb.TodoService_UploadImageServer) error {
 	userClaims, err := GetUserClaims(stream.Context())
 	if err != nil {
 		return logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
 	}
 
+	req, err := stream.Recv()
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot receive upload session ID: %v", err))
+	}
+
+	session, err := server.findUploadSession(userClaims, req.GetSessionId())
+	if err != nil {
+		return err
+	}
+
+	// the received chunks are kept in the session, so a dropped stream can be
+	// resumed with a new one
 	for {
-		err := contextError(stream.Context())
+		err = contextError(stream.Context())
 		if err != nil {
 			return err
 		}
 
-		req, err := stream.Recv()
+		req, err = stream.Recv()
 		if err == io.EOF {
-			log.Print("no more feedback data")
+			log.Print("no more image bytes data")
 			break
 		}
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot receive stream request: %v", err))
+			return logError(status.Errorf(codes.Unknown, "cannot receive chunk: %v", err))
 		}
 
-		todoID := req.GetTodoId()
-		content := req.GetContent()
+		chunk := req.GetChunk()
+		if chunk == nil {
+			return logError(status.Error(codes.InvalidArgument, "chunk is required"))
+		}
 
-		log.Printf("received a feedback request: id = %s", todoID)
+		log.Printf("receivd a chunk with offset: %d, size: %d", chunk.GetOffset(), len(chunk.GetData()))
 
-		found, err := server.todoStore.GetById(todoID)
-		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot find todo: %v", err))
+		digest := sha256.Sum256(chunk.GetData())
+		if hex.EncodeToString(digest[:]) != strings.ToLower(chunk.GetSha256()) {
+			return logError(status.Errorf(codes.DataLoss, "chunk at offset %d does not match its sha256", chunk.GetOffset()))
 		}
 
-		if found == nil {
-			return logError(status.Errorf(codes.NotFound, "todoID %s is not found", todoID))
+		offset := int64(chunk.GetOffset())
+		if offset+int64(len(chunk.GetData())) > session.Size {
+			return logError(status.Errorf(codes.InvalidArgument, "chunk exceeds the image size of %d bytes", session.Size))
 		}
 
-		feedback, err := server.feedbackStore.Add(todoID, &Feedback{
-			Content:  content,
-			FromUser: userClaims.Username,
-		})
+		session, err = server.uploadSessionStore.Append(session.ID, offset, chunk.GetData())
 		if err != nil {
-			return logError(status.Errorf(codes.Internal, "cannot add feedback to the store: %v", err))
+			if errors.Is(err, ErrUploadOffset) {
+				return logError(status.Errorf(codes.FailedPrecondition, "chunk offset %d is not the received bytes", offset))
+			}
+			if errors.Is(err, ErrNotFound) {
+				return logError(status.Errorf(codes.NotFound, "upload session %s has expired", session.ID))
+			}
+			return logError(status.Errorf(codes.Internal, "cannot write chunk: %v", err))
 		}
+	}
 
-		res := &pb.FeedbackTodoResponse{
-			TodoId:     todoID,
-			FeedbackId: feedback.ID,
-		}
+	res := &pb.UploadImageResponse{
+		ReceivedBytes: uint64(session.Received),
+	}
 
-		err = stream.Send(res)
+	if session.Received == session.Size {
+		imageID, err := server.commitUploadSession(userClaims, session)
 		if err != nil {
-			return logError(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+			return err
 		}
+
+		res.Id = imageID
+		res.Size = uint32(session.Size)
+		log.Printf("saved image with id: %s, size: %d", imageID, session.Size)
+	}
+
+	err = stream.SendAndClose(res)
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot send response: %v", err))
 	}
 
 	return nil
 }
 
-func contextError(ctx context.Context) error {
-	switch ctx.Err() {
-	case context.Canceled:
-		return logError(status.Error(codes.Canceled, "request is cancelled"))
-	case context.DeadlineExceeded:
-		return logError(status.Error(codes.DeadlineExceeded, "deadline is exceeded"))
-	default:
-		return nil
+// findUploadSession returns a NotFound status error when the session does not
+// exist or was created by another user
+func (server *TodoServer) findUploadSession(userClaims *UserClaims, id string) (*UploadSession, error) {
+	session, err := server.uploadSessionStore.Find(id)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find upload session: %v", err))
+	}
+
+	if session == nil || session.Username != userClaims.Username {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find upload session with ID: %v", id))
 	}
+
+	return session, nil
 }
 
-func logError(err error) error {
+// commitUploadSession saves the received image when it matches the digest of
+// the session. The session is claimed before its data is checked, so a
+// session completed by two streams is saved once, and it is deleted either way.
+func (server *TodoServer) commitUploadSession(userClaims *UserClaims, session *UploadSession) (string, error) {
+	// the todo may have been deleted or unshared during the upload
+	todo, err := server.findTodo(session.TodoID)
 	if err != nil {
-		log.Print(err)
+		return "", err
 	}
-	return nil
+
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionEdit)
+	if err != nil {
+		return "", logError(err)
+	}
+
+	file, err := server.uploadSessionStore.Claim(session.ID)
+	if errors.Is(err, ErrNotFound) {
+		return "", logError(status.Errorf(codes.NotFound, "upload session %s has expired or was already committed", session.ID))
+	}
+	if err != nil {
+		return "", logError(status.Errorf(codes.Internal, "cannot claim upload session: %v", err))
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.Printf("cannot delete upload session %s: %v", session.ID, err)
+		}
+	}()
+
+	digest, err := uploadDigest(file)
+	if err != nil {
+		return "", logError(status.Errorf(codes.Internal, "cannot read upload: %v", err))
+	}
+
+	if digest != session.SHA256 {
+		return "", logError(status.Error(codes.DataLoss, "image does not match the sha256 of the upload session"))
+	}
+
+	extension, err := server.validateUpload(file)
+	if err != nil {
+		return "", err
+	}
+
+	processed, err := ProcessImage(file)
+	if err != nil {
+		return "", logError(status.Errorf(codes.InvalidArgument, "image is invalid: %v", err))
+	}
+
+	// the extension comes from the detected type, the type sent by the client is
+	// only a hint
+	imageID, err := server.imageStore.Save(session.TodoID, extension, bytes.NewReader(processed.Data))
+	if err != nil {
+		return "", logError(status.Errorf(codes.Internal, "cannot save image to the store: %v", err))
+	}
+
+	for _, thumbnail := range processed.Thumbnails {
+		err := server.imageStore.SaveVariant(imageID, thumbnail.Variant, bytes.NewReader(thumbnail.Data))
+		if err != nil {
+			// an image without its thumbnails is not listed
+			if err := server.imageStore.Delete(imageID); err != nil {
+				log.Printf("cannot delete image %s without thumbnails: %v", imageID, err)
+			}
+			return "", logError(status.Errorf(codes.Internal, "cannot save thumbnail to the store: %v", err))
+		}
+	}
+
+	return imageID, nil
+}
+
+// validateUpload checks the received image against the upload policy and
+// returns the extension it is stored with, the data is read from its start
+func (server *TodoServer) validateUpload(file io.ReadSeeker) (string, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", logError(status.Errorf(codes.Internal, "cannot read upload: %v", err))
+	}
+
+	extension, err := server.uploadPolicy.Validate(file)
+	if err != nil {
+		return "", logError(status.Errorf(codes.InvalidArgument, "image is invalid: %v", err))
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", logError(status.Errorf(codes.Internal, "cannot read upload: %v", err))
+	}
+
+	return extension, nil
+}
+
+func uploadDigest(file io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (server *TodoServer) DownloadImage(req *pb.DownloadImageRequest, stream pb.TodoService_DownloadImageServer) error {
+	userClaims, err := GetUserClaims(stream.Context())
+	if err != nil {
+		return logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	image, err := server.findImage(userClaims, req.GetImageId(), TodoPermissionView)
+	if err != nil {
+		return err
+	}
+
+	if variant := req.GetVariant(); variant != "" && image.Variant(variant) == nil {
+		return logError(status.Errorf(codes.NotFound, "image %s has no variant %q", image.ID, variant))
+	}
+
+	file, err := server.imageStore.Open(image.ID, req.GetVariant())
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return logError(status.Errorf(code, "cannot open image: %v", err))
+	}
+	defer file.Close()
+
+	res := &pb.DownloadImageResponse{
+		Data: &pb.DownloadImageResponse_Attachment{
+			Attachment: toPbAttachment(image),
+		},
+	}
+
+	err = stream.Send(res)
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot send attachment: %v", err))
+	}
+
+	buffer := make([]byte, imageChunkSize)
+	for {
+		err = contextError(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		n, err := file.Read(buffer)
+		if n > 0 {
+			res := &pb.DownloadImageResponse{
+				Data: &pb.DownloadImageResponse_ChunkData{
+					ChunkData: buffer[:n],
+				},
+			}
+
+			if err := stream.Send(res); err != nil {
+				return logError(status.Errorf(codes.Unknown, "cannot send chunk data: %v", err))
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot read image: %v", err))
+		}
+	}
+
+	log.Printf("sent image with id: %s, size: %d", image.ID, image.Size)
+	return nil
+}
+
+func (server *TodoServer) GetImageURL(ctx context.Context, req *pb.GetImageURLRequest) (*pb.GetImageURLResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	image, err := server.findImage(userClaims, req.GetImageId(), TodoPermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	if variant := req.GetVariant(); variant != "" && image.Variant(variant) == nil {
+		return nil, logError(status.Errorf(codes.NotFound, "image %s has no variant %q", image.ID, variant))
+	}
+
+	presigner, ok := server.imageStore.(ImagePresigner)
+	if !ok {
+		return nil, logError(status.Errorf(codes.Unimplemented, "image store does not support image URLs"))
+	}
+
+	expiresAt := time.Now().Add(imageURLDuration)
+	url, err := presigner.PresignURL(image.ID, req.GetVariant(), imageURLDuration)
+	if err != nil {
+		code := codes.Internal
+		switch {
+		case errors.Is(err, ErrPresignNotSupported):
+			code = codes.Unimplemented
+		case errors.Is(err, ErrNotFound):
+			code = codes.NotFound
+		}
+		return nil, logError(status.Errorf(code, "cannot presign image URL: %v", err))
+	}
+
+	res := &pb.GetImageURLResponse{
+		Url:       url,
+		ExpiresAt: toPbTimestamp(expiresAt),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) ListImages(ctx context.Context, req *pb.ListImagesRequest) (*pb.ListImagesResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	todo, err := server.findTodo(req.GetTodoId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionView)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	images, err := server.imageStore.List(todo.ID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find images: %v", err))
+	}
+
+	res := &pb.ListImagesResponse{
+		Attachments: toPbAttachments(images),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) DeleteImage(ctx context.Context, req *pb.DeleteImageRequest) (*pb.DeleteImageResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	image, err := server.findImage(userClaims, req.GetImageId(), TodoPermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.imageStore.Delete(image.ID)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, logError(status.Errorf(code, "cannot delete image from the store: %v", err))
+	}
+
+	log.Printf("deleted image with id: %s", image.ID)
+
+	res := &pb.DeleteImageResponse{
+		ImageId: image.ID,
+	}
+	return res, nil
+}
+
+// findImage returns the image when the user has the permission on its todo
+func (server *TodoServer) findImage(userClaims *UserClaims, imageID string, permission TodoPermission) (*ImageInfo, error) {
+	image, err := server.imageStore.Find(imageID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find image: %v", err))
+	}
+
+	if image == nil {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find image with ID: %v", imageID))
+	}
+
+	todo, err := server.findTodo(image.TodoID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, todo, permission)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	return image, nil
+}
+
+func (server *TodoServer) FeedbackTodo(stream pb.TodoService_FeedbackTodoServer) error {
+	userClaims, err := GetUserClaims(stream.Context())
+	if err != nil {
+		return logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	for {
+		err := contextError(stream.Context())
+		if err != nil {
+			return err
+		}
+
+		req, err := stream.Recv()
+		if err == io.EOF {
+			log.Print("no more feedback data")
+			break
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot receive stream request: %v", err))
+		}
+
+		todoID := req.GetTodoId()
+		content := req.GetContent()
+
+		log.Printf("received a feedback request: id = %s", todoID)
+
+		found, err := server.todoStore.GetById(todoID)
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot find todo: %v", err))
+		}
+
+		if found == nil {
+			return logError(status.Errorf(codes.NotFound, "todoID %s is not found", todoID))
+		}
+
+		err = server.authorizer.Authorize(userClaims, found, TodoPermissionComment)
+		if err != nil {
+			return logError(err)
+		}
+
+		feedback, err := server.feedbackStore.Add(todoID, &Feedback{
+			Content:   content,
+			FromUser:  userClaims.Username,
+			ParentID:  req.GetParentFeedbackId(),
+			CreatedAt: time.Now(),
+		})
+		if errors.Is(err, ErrNotFound) {
+			return logError(status.Errorf(codes.NotFound, "todo %s has no feedback %s to reply to", todoID, req.GetParentFeedbackId()))
+		}
+		if err != nil {
+			return logError(status.Errorf(codes.Internal, "cannot add feedback to the store: %v", err))
+		}
+
+		server.publishEvent(TodoEventFeedbackAdded, found, feedback)
+
+		res := &pb.FeedbackTodoResponse{
+			TodoId:     todoID,
+			FeedbackId: feedback.ID,
+		}
+
+		err = stream.Send(res)
+		if err != nil {
+			return logError(status.Errorf(codes.Unknown, "cannot send stream response: %v", err))
+		}
+	}
+
+	return nil
+}
+
+func (server *TodoServer) EditFeedback(ctx context.Context, req *pb.EditFeedbackRequest) (*pb.EditFeedbackResponse, error) {
+	content := req.GetContent()
+	if strings.TrimSpace(content) == "" {
+		return nil, status.Error(codes.InvalidArgument, "feedback content must not be empty")
+	}
+
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	todo, feedback, err := server.findOwnFeedback(userClaims, req.GetTodoId(), req.GetFeedbackId(), "edit")
+	if err != nil {
+		return nil, err
+	}
+
+	feedback.Content = content
+	feedback.EditedAt = time.Now()
+
+	err = server.feedbackStore.Update(todo.ID, feedback)
+	if errors.Is(err, ErrNotFound) {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find feedback: %s", feedback.ID))
+	}
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot update feedback: %v", err))
+	}
+
+	log.Printf("edited feedback with id: %s", feedback.ID)
+	server.publishEvent(TodoEventFeedbackEdited, todo, feedback)
+
+	res := &pb.EditFeedbackResponse{
+		Feedback: toPbFeedback(feedback),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) DeleteFeedback(ctx context.Context, req *pb.DeleteFeedbackRequest) (*pb.DeleteFeedbackResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	todo, feedback, err := server.findOwnFeedback(userClaims, req.GetTodoId(), req.GetFeedbackId(), "delete")
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.feedbackStore.Delete(todo.ID, feedback.ID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find feedback: %s", feedback.ID))
+	}
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot delete feedback: %v", err))
+	}
+
+	log.Printf("deleted feedback with id: %s", feedback.ID)
+	server.publishEvent(TodoEventFeedbackDeleted, todo, feedback)
+
+	res := &pb.DeleteFeedbackResponse{
+		FeedbackId: feedback.ID,
+	}
+	return res, nil
+}
+
+// findOwnFeedback returns the todo and the feedback when the user can still comment on its
+// todo and is its author or an admin, the action names what the user does
+func (server *TodoServer) findOwnFeedback(userClaims *UserClaims, todoID string, feedbackID string, action string) (*Todo, *Feedback, error) {
+	todo, err := server.findTodo(todoID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionComment)
+	if err != nil {
+		return nil, nil, logError(err)
+	}
+
+	feedback, err := server.feedbackStore.Get(todo.ID, feedbackID)
+	if err != nil {
+		return nil, nil, logError(status.Errorf(codes.Internal, "cannot find feedback: %v", err))
+	}
+
+	if feedback == nil {
+		return nil, nil, status.Errorf(codes.NotFound, "cannot find feedback: %s", feedbackID)
+	}
+
+	if feedback.FromUser != userClaims.Username && userClaims.Role != "admin" {
+		return nil, nil, logError(status.Errorf(codes.PermissionDenied, "only the author or an admin can %s feedback %s", action, feedbackID))
+	}
+
+	return todo, feedback, nil
+}
+
+func (server *TodoServer) ShareTodo(ctx context.Context, req *pb.ShareTodoRequest) (*pb.ShareTodoResponse, error) {
+	role, err := fromPbCollaboratorRole(req.GetRole())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "collaborator role is invalid: %v", err)
+	}
+
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	todo, err := server.findTodo(req.GetTodoId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionManage)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	username := req.GetUsername()
+	if username == todo.FromUser {
+		return nil, status.Error(codes.FailedPrecondition, "cannot share a todo with its owner")
+	}
+
+	user, err := server.userStore.Find(username)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find user: %v", err))
+	}
+
+	if user == nil {
+		return nil, status.Errorf(codes.NotFound, "cannot find user: %s", username)
+	}
+
+	share := &Share{
+		TodoID:    todo.ID,
+		Username:  user.Username,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+
+	found, err := server.shareStore.Find(todo.ID, user.Username)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find share: %v", err))
+	}
+
+	if found != nil {
+		// changing the role of a collaborator keeps the time it was added
+		share.CreatedAt = found.CreatedAt
+	}
+
+	err = server.shareStore.Save(share)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot save share to the store: %v", err))
+	}
+
+	log.Printf("shared todo %s with %s as %s", todo.ID, share.Username, share.Role)
+
+	res := &pb.ShareTodoResponse{
+		Collaborator: toPbCollaborator(share),
+	}
+	return res, nil
+}
+
+func (server *TodoServer) UnshareTodo(ctx context.Context, req *pb.UnshareTodoRequest) (*pb.UnshareTodoResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	todo, err := server.findTodo(req.GetTodoId())
+	if err != nil {
+		return nil, err
+	}
+
+	// collaborators can leave a todo, only the owner and admins can remove others
+	username := req.GetUsername()
+	if username != userClaims.Username {
+		err = server.authorizer.Authorize(userClaims, todo, TodoPermissionManage)
+		if err != nil {
+			return nil, logError(err)
+		}
+	}
+
+	err = server.shareStore.Delete(todo.ID, username)
+	if err != nil {
+		code := codes.Internal
+		if errors.Is(err, ErrNotFound) {
+			code = codes.NotFound
+		}
+		return nil, logError(status.Errorf(code, "cannot delete share from the store: %v", err))
+	}
+
+	log.Printf("unshared todo %s with %s", todo.ID, username)
+
+	return &pb.UnshareTodoResponse{}, nil
+}
+
+func (server *TodoServer) ListCollaborators(
+	ctx context.Context,
+	req *pb.ListCollaboratorsRequest,
+) (*pb.ListCollaboratorsResponse, error) {
+	userClaims, err := GetUserClaims(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot get user claims from context: %v", err)
+	}
+
+	todo, err := server.findTodo(req.GetTodoId())
+	if err != nil {
+		return nil, err
+	}
+
+	err = server.authorizer.Authorize(userClaims, todo, TodoPermissionView)
+	if err != nil {
+		return nil, logError(err)
+	}
+
+	shares, err := server.shareStore.ListByTodo(todo.ID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find shares: %v", err))
+	}
+
+	collaborators := make([]*pb.Collaborator, 0, len(shares))
+	for _, share := range shares {
+		collaborators = append(collaborators, toPbCollaborator(share))
+	}
+
+	res := &pb.ListCollaboratorsResponse{
+		Collaborators: collaborators,
+	}
+	return res, nil
+}
+
+// WatchTodos streams the events of the todos the user can view
+func (server *TodoServer) WatchTodos(req *pb.WatchTodosRequest, stream pb.TodoService_WatchTodosServer) error {
+	userClaims, err := GetUserClaims(stream.Context())
+	if err != nil {
+		return logError(status.Errorf(codes.Internal, "cannot get user claims from context: %v", err))
+	}
+
+	// the sequence numbers of another epoch are not the ones of the bus, the
+	// server restarted since
+	if req.GetAfterSequence() > 0 && req.GetEpoch() != server.eventBus.Epoch() {
+		return logError(status.Errorf(codes.OutOfRange, "cannot resume after sequence %d of epoch %q, get the todos again", req.GetAfterSequence(), req.GetEpoch()))
+	}
+
+	subscription, err := server.eventBus.Subscribe(req.GetAfterSequence())
+	if errors.Is(err, ErrEventsExpired) {
+		return logError(status.Errorf(codes.OutOfRange, "cannot resume after sequence %d, get the todos again", req.GetAfterSequence()))
+	}
+	if err != nil {
+		return logError(status.Errorf(codes.Internal, "cannot watch todos: %v", err))
+	}
+	defer subscription.Close()
+
+	err = stream.SendHeader(metadata.Pairs(
+		eventEpochHeader, server.eventBus.Epoch(),
+		eventSequenceHeader, strconv.FormatUint(subscription.After(), 10),
+	))
+	if err != nil {
+		return logError(status.Errorf(codes.Unknown, "cannot send header: %v", err))
+	}
+
+	log.Printf("%s is watching todos after sequence %d", userClaims.Username, req.GetAfterSequence())
+
+	for {
+		event, err := subscription.Next(stream.Context())
+		if errors.Is(err, ErrSubscriberTooSlow) {
+			return logError(status.Error(codes.ResourceExhausted, "watcher is too slow, resume after the last received sequence"))
+		}
+		if err != nil {
+			return contextError(stream.Context())
+		}
+
+		if userClaims.Role != "admin" && !slices.Contains(event.Usernames, userClaims.Username) {
+			continue
+		}
+
+		err = stream.Send(toPbTodoEvent(event))
+		if err != nil {
+			return logError(status.Errorf(codes.Unknown, "cannot send event: %v", err))
+		}
+	}
+}
+
+// publishEvent sends a change of the todo to its watchers
+func (server *TodoServer) publishEvent(eventType TodoEventType, todo *Todo, feedback *Feedback) {
+	shares, err := server.shareStore.ListByTodo(todo.ID)
+	if err != nil {
+		// the collaborators miss the event, the change itself is saved
+		log.Printf("cannot find shares of todo %s: %v", todo.ID, err)
+	}
+
+	server.publishEventTo(eventType, todo, feedback, shares)
+}
+
+// publishEventTo sends a change of the todo to its owner and to the users it
+// is shared with
+func (server *TodoServer) publishEventTo(eventType TodoEventType, todo *Todo, feedback *Feedback, shares []*Share) {
+	usernames := []string{todo.FromUser}
+	for _, share := range shares {
+		usernames = append(usernames, share.Username)
+	}
+
+	server.eventBus.Publish(&TodoEvent{
+		Type:      eventType,
+		Todo:      todo,
+		Feedback:  feedback,
+		Usernames: usernames,
+	})
+}
+
+// findTodo returns a NotFound status error when the todo does not exist
+func (server *TodoServer) findTodo(id string) (*Todo, error) {
+	todo, err := server.todoStore.GetById(id)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find todo: %v", err))
+	}
+
+	if todo == nil {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find todo with ID: %v", id))
+	}
+
+	return todo, nil
+}
+
+func contextError(ctx context.Context) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return logError(status.Error(codes.Canceled, "request is cancelled"))
+	case context.DeadlineExceeded:
+		return logError(status.Error(codes.DeadlineExceeded, "deadline is exceeded"))
+	default:
+		return nil
+	}
+}
+
+func logError(err error) error {
+	if err != nil {
+		log.Print(err)
+	}
+	return err
 }
@@ -0,0 +1,600 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// todoTestServer serves a todo server with the admin philly and the users
+// alice and bob. Its stores set up todos owned by any of them.
+type todoTestServer struct {
+	*testServers
+	listener *service.PipeListener
+}
+
+func newTodoTestServer(t *testing.T) *todoTestServer {
+	t.Helper()
+
+	servers := newTestServers(t, newInMemoryAuthStores(), map[string]string{"philly": "admin", "alice": "user", "bob": "user"})
+
+	// every method needs a login, the todo server checks the rest
+	roles := make(map[string][]string)
+	for _, method := range pb.TodoService_ServiceDesc.Methods {
+		roles["/"+pb.TodoService_ServiceDesc.ServiceName+"/"+method.MethodName] = []string{"admin", "user"}
+	}
+	for _, stream := range pb.TodoService_ServiceDesc.Streams {
+		roles["/"+pb.TodoService_ServiceDesc.ServiceName+"/"+stream.StreamName] = []string{"admin", "user"}
+	}
+
+	return &todoTestServer{servers, servers.serve(t, servers.interceptor(roles, nil))}
+}
+
+// dial connects as the user
+func (server *todoTestServer) dial(t *testing.T, username string) pb.TodoServiceClient {
+	t.Helper()
+
+	user, err := server.userStore.Find(username)
+	if err != nil || user == nil {
+		t.Fatalf("Find user %s: (%v, %v)", username, user, err)
+	}
+	token, _, err := server.jwtManager.Generate(user)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	cc, err := grpc.NewClient(
+		"passthrough:///todo",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithPerRPCCredentials(bearerToken(token)),
+		grpc.WithContextDialer(server.listener.DialContext),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return pb.NewTodoServiceClient(cc)
+}
+
+// saveTodo saves a todo of the owner to the store, as only admins can create
+// todos with CreateTodo
+func (server *todoTestServer) saveTodo(t *testing.T, owner string) *service.Todo {
+	t.Helper()
+
+	now := time.Now()
+	todo := &service.Todo{
+		ID:        uuid.NewString(),
+		Title:     "todo of " + owner,
+		FromUser:  owner,
+		Status:    service.TodoStatusOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := server.todoStore.Save(todo); err != nil {
+		t.Fatalf("Save todo: %v", err)
+	}
+	return todo
+}
+
+// share shares the todo with the user
+func (server *todoTestServer) share(t *testing.T, todo *service.Todo, username string, role service.ShareRole) {
+	t.Helper()
+
+	err := server.shareStore.Save(&service.Share{TodoID: todo.ID, Username: username, Role: role, CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Save share: %v", err)
+	}
+}
+
+// bearerToken sends the access token without transport security, the test
+// server listens on a pipe
+type bearerToken string
+
+func (token bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(token)}, nil
+}
+
+func (token bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+func TestTodoServerOwnerOnlyUpdateAndDelete(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	todo := server.saveTodo(t, "alice")
+	alice, bob, philly := server.dial(t, "alice"), server.dial(t, "bob"), server.dial(t, "philly")
+
+	update := &pb.UpdateTodoRequest{Todo: &pb.Todo{Id: todo.ID, Title: "renamed"}}
+	if _, err := bob.UpdateTodo(ctx, update); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UpdateTodo by a non-owner: got %v, want PermissionDenied", err)
+	}
+	if _, err := bob.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.ID}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("DeleteTodo by a non-owner: got %v, want PermissionDenied", err)
+	}
+
+	found, err := server.todoStore.GetById(todo.ID)
+	if err != nil || found == nil || found.Title != todo.Title {
+		t.Fatalf("todo after rejected calls: got (%+v, %v), want it unchanged", found, err)
+	}
+
+	res, err := alice.UpdateTodo(ctx, update)
+	if err != nil {
+		t.Fatalf("UpdateTodo by the owner: %v", err)
+	}
+	if title := res.GetTodo().GetTitle(); title != "renamed" {
+		t.Fatalf("UpdateTodo by the owner: got title %q, want %q", title, "renamed")
+	}
+
+	if _, err := philly.UpdateTodo(ctx, update); err != nil {
+		t.Fatalf("UpdateTodo by an admin: %v", err)
+	}
+
+	// an editor updates the todo but only the owner deletes it
+	server.share(t, todo, "bob", service.ShareRoleEditor)
+	if _, err := bob.UpdateTodo(ctx, update); err != nil {
+		t.Fatalf("UpdateTodo by an editor: %v", err)
+	}
+	if _, err := bob.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.ID}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("DeleteTodo by an editor: got %v, want PermissionDenied", err)
+	}
+	if _, err := alice.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.ID}); err != nil {
+		t.Fatalf("DeleteTodo by the owner: %v", err)
+	}
+	if _, err := alice.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.ID}); status.Code(err) != codes.NotFound {
+		t.Fatalf("GetTodo after DeleteTodo: got %v, want NotFound", err)
+	}
+}
+
+func TestTodoServerDeleteTodoDeletesItsData(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	todo := server.saveTodo(t, "alice")
+	server.share(t, todo, "bob", service.ShareRoleCommenter)
+	alice, bob := server.dial(t, "alice"), server.dial(t, "bob")
+
+	if _, err := uploadImage(t, alice, todo.ID, encodePNG(t, 10, 10)); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	feedbackID := addFeedback(t, bob, todo.ID, "", "looks good")
+	addFeedback(t, alice, todo.ID, feedbackID, "thanks")
+
+	if _, err := alice.DeleteTodo(ctx, &pb.DeleteTodoRequest{Id: todo.ID}); err != nil {
+		t.Fatalf("DeleteTodo: %v", err)
+	}
+
+	images, err := server.imageStore.List(todo.ID)
+	if err != nil || len(images) != 0 {
+		t.Fatalf("images of a deleted todo: got (%v, %v), want none", images, err)
+	}
+	feedbacks, err := server.feedbackStore.Find(todo.ID)
+	if err != nil || len(feedbacks) != 0 {
+		t.Fatalf("feedbacks of a deleted todo: got (%v, %v), want none", feedbacks, err)
+	}
+	shares, err := server.shareStore.ListByTodo(todo.ID)
+	if err != nil || len(shares) != 0 {
+		t.Fatalf("shares of a deleted todo: got (%v, %v), want none", shares, err)
+	}
+}
+
+// uploadImage uploads the image to the todo in one chunk and returns its ID
+func uploadImage(t *testing.T, client pb.TodoServiceClient, todoID string, data []byte) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	digest := sha256.Sum256(data)
+	sha := hex.EncodeToString(digest[:])
+	created, err := client.CreateUploadSession(ctx, &pb.CreateUploadSessionRequest{
+		ImageInfo: &pb.ImageInfo{TodoId: todoID, ImageType: ".png"},
+		Size:      uint64(len(data)),
+		Sha256:    sha,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	stream, err := client.UploadImage(ctx)
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	requests := []*pb.UploadImageRequest{
+		{Data: &pb.UploadImageRequest_SessionId{SessionId: created.GetSession().GetId()}},
+		{Data: &pb.UploadImageRequest_Chunk{Chunk: &pb.ImageChunk{Data: data, Sha256: sha}}},
+	}
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("send upload request: %v", err)
+		}
+	}
+
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", err
+	}
+	return res.GetId(), nil
+}
+
+// downloadImage returns the attachment and the data of the image
+func downloadImage(client pb.TodoServiceClient, imageID string) (*pb.Attachment, []byte, error) {
+	stream, err := client.DownloadImage(context.Background(), &pb.DownloadImageRequest{ImageId: imageID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var attachment *pb.Attachment
+	var data []byte
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return attachment, data, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if res.GetAttachment() != nil {
+			attachment = res.GetAttachment()
+		}
+		data = append(data, res.GetChunkData()...)
+	}
+}
+
+func TestTodoServerImages(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	todo := server.saveTodo(t, "alice")
+	alice, bob := server.dial(t, "alice"), server.dial(t, "bob")
+
+	imageID, err := uploadImage(t, alice, todo.ID, encodePNG(t, 10, 10))
+	if err != nil {
+		t.Fatalf("upload by the owner: %v", err)
+	}
+
+	// the todo is not shared with bob yet
+	if _, err := bob.ListImages(ctx, &pb.ListImagesRequest{TodoId: todo.ID}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("ListImages by a stranger: got %v, want PermissionDenied", err)
+	}
+	if _, _, err := downloadImage(bob, imageID); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("DownloadImage by a stranger: got %v, want PermissionDenied", err)
+	}
+
+	server.share(t, todo, "bob", service.ShareRoleViewer)
+	if _, err := uploadImage(t, bob, todo.ID, encodePNG(t, 10, 10)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("upload by a viewer: got %v, want PermissionDenied", err)
+	}
+
+	listed, err := bob.ListImages(ctx, &pb.ListImagesRequest{TodoId: todo.ID})
+	if err != nil {
+		t.Fatalf("ListImages by a viewer: %v", err)
+	}
+	if attachments := listed.GetAttachments(); len(attachments) != 1 || attachments[0].GetId() != imageID || len(attachments[0].GetVariants()) != 2 {
+		t.Fatalf("ListImages: got %v, want image %s with 2 thumbnails", attachments, imageID)
+	}
+
+	attachment, data, err := downloadImage(bob, imageID)
+	if err != nil {
+		t.Fatalf("DownloadImage by a viewer: %v", err)
+	}
+	if attachment.GetId() != imageID || uint64(len(data)) != attachment.GetSize() {
+		t.Fatalf("DownloadImage: got attachment %v with %d bytes", attachment, len(data))
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("decode downloaded image: %v", err)
+	}
+
+	if _, err := bob.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageID}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("DeleteImage by a viewer: got %v, want PermissionDenied", err)
+	}
+	if _, err := alice.DeleteImage(ctx, &pb.DeleteImageRequest{ImageId: imageID}); err != nil {
+		t.Fatalf("DeleteImage by the owner: %v", err)
+	}
+	if _, _, err := downloadImage(alice, imageID); status.Code(err) != codes.NotFound {
+		t.Fatalf("DownloadImage of a deleted image: got %v, want NotFound", err)
+	}
+	listed, err = alice.ListImages(ctx, &pb.ListImagesRequest{TodoId: todo.ID})
+	if err != nil || len(listed.GetAttachments()) != 0 {
+		t.Fatalf("ListImages after DeleteImage: got (%v, %v), want no images", listed.GetAttachments(), err)
+	}
+}
+
+// addFeedback adds a feedback to the todo and returns its ID
+func TestTodoServerTooManyUploadSessions(t *testing.T) {
+	server := newTodoTestServer(t)
+	client := server.dial(t, "alice")
+	todo := server.saveTodo(t, "alice")
+
+	sum := sha256.Sum256([]byte("image"))
+	req := &pb.CreateUploadSessionRequest{
+		ImageInfo: &pb.ImageInfo{TodoId: todo.ID, ImageType: ".png"},
+		Size:      5,
+		Sha256:    hex.EncodeToString(sum[:]),
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := client.CreateUploadSession(context.Background(), req); err != nil {
+			t.Fatalf("CreateUploadSession: %v", err)
+		}
+	}
+
+	_, err := client.CreateUploadSession(context.Background(), req)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("CreateUploadSession over the limit error = %v, want ResourceExhausted", err)
+	}
+}
+
+func addFeedback(t *testing.T, client pb.TodoServiceClient, todoID string, parentID string, content string) string {
+	t.Helper()
+
+	stream, err := client.FeedbackTodo(context.Background())
+	if err != nil {
+		t.Fatalf("FeedbackTodo: %v", err)
+	}
+	err = stream.Send(&pb.FeedbackTodoRequest{TodoId: todoID, Content: content, ParentFeedbackId: parentID})
+	if err != nil {
+		t.Fatalf("send feedback: %v", err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("receive feedback: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("CloseSend: %v", err)
+	}
+	return res.GetFeedbackId()
+}
+
+func TestTodoServerEditAndDeleteFeedback(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	todo := server.saveTodo(t, "alice")
+	server.share(t, todo, "bob", service.ShareRoleCommenter)
+	alice, bob, philly := server.dial(t, "alice"), server.dial(t, "bob"), server.dial(t, "philly")
+
+	feedbackID := addFeedback(t, bob, todo.ID, "", "looks good")
+	addFeedback(t, alice, todo.ID, feedbackID, "thanks")
+
+	res, err := alice.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.ID})
+	if err != nil {
+		t.Fatalf("GetTodo: %v", err)
+	}
+	if feedbacks := res.GetFeedbacks(); len(feedbacks) != 1 || feedbacks[0].GetEditedAt() != nil || len(feedbacks[0].GetReplies()) != 1 {
+		t.Fatalf("GetTodo: got feedbacks %v, want one unedited thread with one reply", feedbacks)
+	}
+
+	// the owner of the todo is not the author of the feedback
+	edit := &pb.EditFeedbackRequest{TodoId: todo.ID, FeedbackId: feedbackID, Content: "looks great"}
+	if _, err := alice.EditFeedback(ctx, edit); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("EditFeedback by another user: got %v, want PermissionDenied", err)
+	}
+	if _, err := alice.DeleteFeedback(ctx, &pb.DeleteFeedbackRequest{TodoId: todo.ID, FeedbackId: feedbackID}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("DeleteFeedback by another user: got %v, want PermissionDenied", err)
+	}
+	empty := &pb.EditFeedbackRequest{TodoId: todo.ID, FeedbackId: feedbackID, Content: " "}
+	if _, err := bob.EditFeedback(ctx, empty); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("EditFeedback with empty content: got %v, want InvalidArgument", err)
+	}
+
+	edited, err := bob.EditFeedback(ctx, edit)
+	if err != nil {
+		t.Fatalf("EditFeedback by the author: %v", err)
+	}
+	if feedback := edited.GetFeedback(); feedback.GetContent() != "looks great" || feedback.GetEditedAt() == nil {
+		t.Fatalf("EditFeedback: got %v, want the new content with edited_at", feedback)
+	}
+
+	res, err = alice.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.ID})
+	if err != nil {
+		t.Fatalf("GetTodo: %v", err)
+	}
+	if feedback := res.GetFeedbacks()[0]; feedback.GetContent() != "looks great" || feedback.GetEditedAt() == nil {
+		t.Fatalf("GetTodo after EditFeedback: got %v, want the new content with edited_at", feedback)
+	}
+
+	if _, err := philly.EditFeedback(ctx, edit); err != nil {
+		t.Fatalf("EditFeedback by an admin: %v", err)
+	}
+	if _, err := philly.DeleteFeedback(ctx, &pb.DeleteFeedbackRequest{TodoId: todo.ID, FeedbackId: feedbackID}); err != nil {
+		t.Fatalf("DeleteFeedback by an admin: %v", err)
+	}
+
+	res, err = alice.GetTodo(ctx, &pb.GetTodoRequest{Id: todo.ID})
+	if err != nil || len(res.GetFeedbacks()) != 0 {
+		t.Fatalf("GetTodo after DeleteFeedback: got (%v, %v), want no feedbacks", res.GetFeedbacks(), err)
+	}
+	if _, err := bob.EditFeedback(ctx, edit); status.Code(err) != codes.NotFound {
+		t.Fatalf("EditFeedback of a deleted feedback: got %v, want NotFound", err)
+	}
+}
+
+// watchTodos starts watching the todos, it returns once the watch receives
+// events
+func watchTodos(t *testing.T, client pb.TodoServiceClient) pb.TodoService_WatchTodosClient {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	stream, err := client.WatchTodos(ctx, &pb.WatchTodosRequest{})
+	if err != nil {
+		t.Fatalf("WatchTodos: %v", err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("WatchTodos header: %v", err)
+	}
+	return stream
+}
+
+func TestTodoServerWatchTodosHidesOtherTodos(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	private := server.saveTodo(t, "alice")
+	shared := server.saveTodo(t, "alice")
+	server.share(t, shared, "bob", service.ShareRoleViewer)
+	alice := server.dial(t, "alice")
+
+	bobWatch := watchTodos(t, server.dial(t, "bob"))
+	phillyWatch := watchTodos(t, server.dial(t, "philly"))
+
+	for _, todo := range []*service.Todo{private, shared} {
+		_, err := alice.UpdateTodo(ctx, &pb.UpdateTodoRequest{Todo: &pb.Todo{Id: todo.ID, Title: "renamed"}})
+		if err != nil {
+			t.Fatalf("UpdateTodo: %v", err)
+		}
+	}
+	addFeedback(t, alice, private.ID, "", "private note")
+	addFeedback(t, alice, shared.ID, "", "shared note")
+
+	// the events of the private todo are skipped
+	want := []pb.TodoEventType{pb.TodoEventType_TODO_EVENT_TYPE_UPDATED, pb.TodoEventType_TODO_EVENT_TYPE_FEEDBACK_ADDED}
+	for _, eventType := range want {
+		event, err := bobWatch.Recv()
+		if err != nil {
+			t.Fatalf("receive event: %v", err)
+		}
+		if event.GetType() != eventType || event.GetTodo().GetId() != shared.ID {
+			t.Fatalf("collaborator got a %v event of todo %s, want a %v event of the shared todo %s",
+				event.GetType(), event.GetTodo().GetId(), eventType, shared.ID)
+		}
+	}
+
+	// admins see every todo
+	for _, todo := range []*service.Todo{private, shared, private, shared} {
+		event, err := phillyWatch.Recv()
+		if err != nil {
+			t.Fatalf("receive event: %v", err)
+		}
+		if event.GetTodo().GetId() != todo.ID {
+			t.Fatalf("admin got an event of todo %s, want todo %s", event.GetTodo().GetId(), todo.ID)
+		}
+	}
+}
+
+func TestTodoServerWatchTodosResumesInTheSameEpoch(t *testing.T) {
+	server := newTodoTestServer(t)
+	ctx := context.Background()
+
+	todo := server.saveTodo(t, "alice")
+	alice := server.dial(t, "alice")
+	update := &pb.UpdateTodoRequest{Todo: &pb.Todo{Id: todo.ID, Title: "renamed"}}
+
+	watch := watchTodos(t, alice)
+	header, err := watch.Header()
+	if err != nil {
+		t.Fatalf("WatchTodos header: %v", err)
+	}
+	if _, err := alice.UpdateTodo(ctx, update); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	last, err := watch.Recv()
+	if err != nil {
+		t.Fatalf("receive event: %v", err)
+	}
+	if epoch := header.Get("todo-event-epoch"); len(epoch) != 1 || epoch[0] != last.GetEpoch() || last.GetEpoch() == "" {
+		t.Fatalf("event of epoch %q, header epoch %v, want the same epoch", last.GetEpoch(), epoch)
+	}
+
+	// the update published while disconnected is received after resuming
+	if _, err := alice.UpdateTodo(ctx, update); err != nil {
+		t.Fatalf("UpdateTodo: %v", err)
+	}
+	resumed, err := alice.WatchTodos(ctx, &pb.WatchTodosRequest{AfterSequence: last.GetSequence(), Epoch: last.GetEpoch()})
+	if err != nil {
+		t.Fatalf("WatchTodos: %v", err)
+	}
+	event, err := resumed.Recv()
+	if err != nil {
+		t.Fatalf("receive resumed event: %v", err)
+	}
+	if event.GetSequence() != last.GetSequence()+1 {
+		t.Fatalf("resumed at sequence %d, want %d", event.GetSequence(), last.GetSequence()+1)
+	}
+
+	// a restarted server has another epoch with the same sequence numbers
+	for _, epoch := range []string{"", uuid.NewString()} {
+		stream, err := alice.WatchTodos(ctx, &pb.WatchTodosRequest{AfterSequence: last.GetSequence(), Epoch: epoch})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.OutOfRange {
+			t.Fatalf("WatchTodos of epoch %q: got %v, want OutOfRange", epoch, err)
+		}
+	}
+}
+
+// getTodos returns the IDs of the todos of a page and its next page token
+func getTodos(client pb.TodoServiceClient, req *pb.GetTodosRequest) ([]string, string, error) {
+	stream, err := client.GetTodos(context.Background(), req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var ids []string
+	nextPageToken := ""
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return ids, nextPageToken, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		ids = append(ids, res.GetTodo().GetId())
+		if res.GetNextPageToken() != "" {
+			nextPageToken = res.GetNextPageToken()
+		}
+	}
+}
+
+func TestTodoServerPageTokenOfAnotherQuery(t *testing.T) {
+	server := newTodoTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		server.saveTodo(t, "alice")
+		server.saveTodo(t, "bob")
+	}
+	alice, bob := server.dial(t, "alice"), server.dial(t, "bob")
+
+	req := &pb.GetTodosRequest{Filter: &pb.TodoFilter{TitleContains: "todo"}, PageSize: 2}
+	first, pageToken, err := getTodos(alice, req)
+	if err != nil || len(first) != 2 || pageToken == "" {
+		t.Fatalf("GetTodos first page: got (%v, %q, %v), want 2 todos and a page token", first, pageToken, err)
+	}
+
+	// the page size may change between the pages
+	next := &pb.GetTodosRequest{Filter: req.GetFilter(), PageSize: 10, PageToken: pageToken}
+	second, _, err := getTodos(alice, next)
+	if err != nil || len(second) != 1 || second[0] == first[0] || second[0] == first[1] {
+		t.Fatalf("GetTodos second page: got (%v, %v), want the third todo", second, err)
+	}
+
+	tests := map[string]struct {
+		client pb.TodoServiceClient
+		req    *pb.GetTodosRequest
+	}{
+		"another filter": {alice, &pb.GetTodosRequest{Filter: &pb.TodoFilter{TitleContains: "of"}, PageToken: pageToken}},
+		"shared todos":   {alice, &pb.GetTodosRequest{Filter: req.GetFilter(), IncludeShared: true, PageToken: pageToken}},
+		"another user":   {bob, &pb.GetTodosRequest{Filter: req.GetFilter(), PageToken: pageToken}},
+	}
+	for name, tt := range tests {
+		if _, _, err := getTodos(tt.client, tt.req); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("GetTodos with the page token of %s: got %v, want InvalidArgument", name, err)
+		}
+	}
+}
@@ -6,32 +6,77 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/jinzhu/copier"
 )
 
 var ErrAlreadyExists = errors.New("record already exists")
+var ErrNotFound = errors.New("record not found")
 
 type TodoStore interface {
 	Save(todo *Todo) error
 	GetById(id string) (*Todo, error)
-	GetMany(ctx context.Context, fromUser string, found func(todo *Todo) error) error
+	GetMany(ctx context.Context, query *TodoQuery, found func(todo *Todo) error) error
+	Update(todo *Todo) error
+	Delete(id string) error
 }
 
+type TodoStatus string
+
+const (
+	TodoStatusOpen       TodoStatus = "open"
+	TodoStatusInProgress TodoStatus = "in_progress"
+	TodoStatusDone       TodoStatus = "done"
+	TodoStatusCancelled  TodoStatus = "cancelled"
+)
+
+// TodoPriority is ordered from the lowest to the highest priority
+type TodoPriority int
+
+const (
+	TodoPriorityNone TodoPriority = iota
+	TodoPriorityLow
+	TodoPriorityMedium
+	TodoPriorityHigh
+	TodoPriorityUrgent
+)
+
 type Todo struct {
-	ID       string
-	Title    string
-	FromUser string
+	ID          string
+	Title       string
+	Description string
+	FromUser    string
+	Status      TodoStatus
+	Priority    TodoPriority
+	DueAt       time.Time
+	CompletedAt time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SetStatus changes the status of the todo and keeps CompletedAt in sync with it
+func (todo *Todo) SetStatus(todoStatus TodoStatus, now time.Time) {
+	if todoStatus == TodoStatusDone && todo.Status != TodoStatusDone {
+		todo.CompletedAt = now
+	} else if todoStatus != TodoStatusDone {
+		todo.CompletedAt = time.Time{}
+	}
+
+	todo.Status = todoStatus
 }
 
 type InMemoryTodoStore struct {
 	mutex sync.RWMutex
 	data  map[string]*Todo
+	// byUser indexes the todo IDs by the user who created them
+	byUser map[string]map[string]bool
 }
 
 func NewInMemoryTodoStore() *InMemoryTodoStore {
 	return &InMemoryTodoStore{
-		data: make(map[string]*Todo),
+		data:   make(map[string]*Todo),
+		byUser: make(map[string]map[string]bool),
 	}
 }
 
@@ -48,7 +93,7 @@ func (store *InMemoryTodoStore) Save(todo *Todo) error {
 		return err
 	}
 
-	store.data[other.ID] = other
+	store.put(other)
 	return nil
 }
 
@@ -64,34 +109,128 @@ func (store *InMemoryTodoStore) GetById(id string) (*Todo, error) {
 	return deepCopy(todo)
 }
 
-func (store *InMemoryTodoStore) GetMany(ctx context.Context, fromUser string, found func(todo *Todo) error) error {
-	store.mutex.RLock()
-	defer store.mutex.RUnlock()
-
-	for _, todo := range store.data {
-		if todo.FromUser != fromUser {
-			continue
-		}
+func (store *InMemoryTodoStore) GetMany(ctx context.Context, query *TodoQuery, found func(todo *Todo) error) error {
+	todos, err := store.query(query)
+	if err != nil {
+		return err
+	}
 
+	for _, todo := range todos {
 		err := ctx.Err()
 		if err == context.Canceled || err == context.DeadlineExceeded {
 			log.Print("context is cancelled")
-			return nil
+			return err
 		}
 
-		other, err := deepCopy(todo)
+		err = found(todo)
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		err = found(other)
+// query copies the todos matching the query in the query order
+func (store *InMemoryTodoStore) query(query *TodoQuery) ([]*Todo, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	todos := make([]*Todo, 0)
+	match := func(todo *Todo) error {
+		if !query.Matches(todo) || !query.IsAfterCursor(todo) {
+			return nil
+		}
+
+		other, err := deepCopy(todo)
 		if err != nil {
 			return err
 		}
+
+		todos = append(todos, other)
+		return nil
 	}
+
+	if query.FromUser != "" {
+		for id := range store.byUser[query.FromUser] {
+			if err := match(store.data[id]); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range query.SharedIDs {
+			todo := store.data[id]
+			if todo == nil || store.byUser[query.FromUser][id] {
+				continue
+			}
+
+			if err := match(todo); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, todo := range store.data {
+			if err := match(todo); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return query.SortAndLimit(todos), nil
+}
+
+func (store *InMemoryTodoStore) Update(todo *Todo) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	old := store.data[todo.ID]
+	if old == nil {
+		return ErrNotFound
+	}
+
+	other, err := deepCopy(todo)
+	if err != nil {
+		return err
+	}
+
+	store.remove(old)
+	store.put(other)
+	return nil
+}
+
+func (store *InMemoryTodoStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	todo := store.data[id]
+	if todo == nil {
+		return ErrNotFound
+	}
+
+	store.remove(todo)
 	return nil
 }
 
+func (store *InMemoryTodoStore) put(todo *Todo) {
+	store.data[todo.ID] = todo
+
+	ids := store.byUser[todo.FromUser]
+	if ids == nil {
+		ids = make(map[string]bool)
+		store.byUser[todo.FromUser] = ids
+	}
+	ids[todo.ID] = true
+}
+
+func (store *InMemoryTodoStore) remove(todo *Todo) {
+	delete(store.data, todo.ID)
+
+	ids := store.byUser[todo.FromUser]
+	delete(ids, todo.ID)
+	if len(ids) == 0 {
+		delete(store.byUser, todo.FromUser)
+	}
+}
+
 func deepCopy(todo *Todo) (*Todo, error) {
 	other := &Todo{}
 
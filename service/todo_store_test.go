@@ -0,0 +1,20 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryTodoStore(t *testing.T) {
+	storetest.RunTodoStoreTests(t, func(t *testing.T) service.TodoStore {
+		return service.NewInMemoryTodoStore()
+	})
+}
+
+func TestBoltTodoStore(t *testing.T) {
+	storetest.RunTodoStoreTests(t, func(t *testing.T) service.TodoStore {
+		return service.NewBoltTodoStore(newTestBoltDB(t))
+	})
+}
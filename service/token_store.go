@@ -0,0 +1,242 @@
+package service
+
+import (
+	"container/heap"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RefreshToken is the server side record of a refresh token, only the hash of
+// the token is stored
+type RefreshToken struct {
+	Hash     string
+	Username string
+	// FamilyID is shared by every token rotated from the same login, so a reused
+	// token can revoke the whole chain
+	FamilyID  string
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+type RefreshTokenStore interface {
+	Save(token *RefreshToken) error
+	Find(hash string) (*RefreshToken, error)
+	// Consume marks the token revoked and returns it as it was before, in one
+	// step, so of concurrent calls with the same token only one gets it
+	// unrevoked. It returns nil when there is no token with the hash.
+	Consume(hash string) (*RefreshToken, error)
+	RevokeFamily(familyID string) error
+	// RevokeUser revokes every refresh token of the user
+	RevokeUser(username string) error
+}
+
+// RevocationStore keeps the IDs of access tokens revoked before they expire
+type RevocationStore interface {
+	Revoke(tokenID string, expiresAt time.Time) error
+	IsRevoked(tokenID string) (bool, error)
+}
+
+// NewRefreshTokenValue generates a random refresh token
+func NewRefreshTokenValue() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("cannot generate refresh token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored under
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type InMemoryRefreshTokenStore struct {
+	mutex  sync.RWMutex
+	tokens map[string]*RefreshToken
+	// byFamily and byUser index the token hashes by family and by user
+	byFamily map[string]map[string]bool
+	byUser   map[string]map[string]bool
+	// expiries orders the token hashes by expiry, so expired tokens are found
+	// without a scan
+	expiries refreshTokenExpiries
+}
+
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{
+		tokens:   make(map[string]*RefreshToken),
+		byFamily: make(map[string]map[string]bool),
+		byUser:   make(map[string]map[string]bool),
+	}
+}
+
+func (store *InMemoryRefreshTokenStore) Save(token *RefreshToken) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.tokens[token.Hash] != nil {
+		return ErrAlreadyExists
+	}
+
+	// expired tokens are useless even for reuse detection
+	now := time.Now()
+	for len(store.expiries) > 0 && store.expiries[0].expiresAt.Before(now) {
+		expired := heap.Pop(&store.expiries).(refreshTokenExpiry)
+		store.remove(expired.hash)
+	}
+
+	other := *token
+	store.tokens[token.Hash] = &other
+	addToIndex(store.byFamily, token.FamilyID, token.Hash)
+	addToIndex(store.byUser, token.Username, token.Hash)
+
+	heap.Push(&store.expiries, refreshTokenExpiry{token.ExpiresAt, token.Hash})
+	return nil
+}
+
+func (store *InMemoryRefreshTokenStore) Find(hash string) (*RefreshToken, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	token := store.tokens[hash]
+	if token == nil {
+		return nil, nil
+	}
+
+	other := *token
+	return &other, nil
+}
+
+func (store *InMemoryRefreshTokenStore) Consume(hash string) (*RefreshToken, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	token := store.tokens[hash]
+	if token == nil {
+		return nil, nil
+	}
+
+	other := *token
+	token.Revoked = true
+	return &other, nil
+}
+
+func (store *InMemoryRefreshTokenStore) RevokeFamily(familyID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for hash := range store.byFamily[familyID] {
+		store.tokens[hash].Revoked = true
+	}
+
+	return nil
+}
+
+func (store *InMemoryRefreshTokenStore) RevokeUser(username string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for hash := range store.byUser[username] {
+		store.tokens[hash].Revoked = true
+	}
+
+	return nil
+}
+
+func (store *InMemoryRefreshTokenStore) remove(hash string) {
+	token := store.tokens[hash]
+	if token == nil {
+		return
+	}
+	delete(store.tokens, hash)
+	removeFromIndex(store.byFamily, token.FamilyID, hash)
+	removeFromIndex(store.byUser, token.Username, hash)
+}
+
+func addToIndex(index map[string]map[string]bool, key string, hash string) {
+	hashes := index[key]
+	if hashes == nil {
+		hashes = make(map[string]bool)
+		index[key] = hashes
+	}
+	hashes[hash] = true
+}
+
+func removeFromIndex(index map[string]map[string]bool, key string, hash string) {
+	hashes := index[key]
+	delete(hashes, hash)
+	if len(hashes) == 0 {
+		delete(index, key)
+	}
+}
+
+type refreshTokenExpiry struct {
+	expiresAt time.Time
+	hash      string
+}
+
+// refreshTokenExpiries is a heap of the refresh token expiries, the first one
+// expires first
+type refreshTokenExpiries []refreshTokenExpiry
+
+func (expiries refreshTokenExpiries) Len() int { return len(expiries) }
+
+func (expiries refreshTokenExpiries) Less(i, j int) bool {
+	return expiries[i].expiresAt.Before(expiries[j].expiresAt)
+}
+
+func (expiries refreshTokenExpiries) Swap(i, j int) {
+	expiries[i], expiries[j] = expiries[j], expiries[i]
+}
+
+func (expiries *refreshTokenExpiries) Push(x any) {
+	*expiries = append(*expiries, x.(refreshTokenExpiry))
+}
+
+func (expiries *refreshTokenExpiries) Pop() any {
+	old := *expiries
+	expiry := old[len(old)-1]
+	*expiries = old[:len(old)-1]
+	return expiry
+}
+
+type InMemoryRevocationStore struct {
+	mutex   sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewInMemoryRevocationStore() *InMemoryRevocationStore {
+	return &InMemoryRevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (store *InMemoryRevocationStore) Revoke(tokenID string, expiresAt time.Time) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// expired tokens are rejected anyway, so they do not need to be kept
+	now := time.Now()
+	for id, other := range store.revoked {
+		if other.Before(now) {
+			delete(store.revoked, id)
+		}
+	}
+
+	store.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (store *InMemoryRevocationStore) IsRevoked(tokenID string) (bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	_, ok := store.revoked[tokenID]
+	return ok, nil
+}
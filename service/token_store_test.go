@@ -0,0 +1,32 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokenStoreTests(t, func(t *testing.T) service.RefreshTokenStore {
+		return service.NewInMemoryRefreshTokenStore()
+	})
+}
+
+func TestBoltRefreshTokenStore(t *testing.T) {
+	storetest.RunRefreshTokenStoreTests(t, func(t *testing.T) service.RefreshTokenStore {
+		return service.NewBoltRefreshTokenStore(newTestBoltDB(t))
+	})
+}
+
+func TestInMemoryRevocationStore(t *testing.T) {
+	storetest.RunRevocationStoreTests(t, func(t *testing.T) service.RevocationStore {
+		return service.NewInMemoryRevocationStore()
+	})
+}
+
+func TestBoltRevocationStore(t *testing.T) {
+	storetest.RunRevocationStoreTests(t, func(t *testing.T) service.RevocationStore {
+		return service.NewBoltRevocationStore(newTestBoltDB(t))
+	})
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// sniffLength is the number of bytes http.DetectContentType looks at
+const sniffLength = 512
+
+// UploadPolicy decides which images can be uploaded
+type UploadPolicy struct {
+	// MaxSizes is the maximum image size in bytes of each role, roles without an
+	// entry use DefaultMaxSize
+	MaxSizes       map[string]int64
+	DefaultMaxSize int64
+	// AllowedTypes maps the allowed MIME types to the extension images of that
+	// type are stored with, the type must have a registered image decoder
+	AllowedTypes map[string]string
+	// MaxDimension is the maximum width and height of an image in pixels
+	MaxDimension int
+	// MaxFrames is the maximum number of frames of an animated image
+	MaxFrames int
+	// MaxPixels is the maximum number of pixels of an image, the pixels of an
+	// animated image are its width times its height times its frames
+	MaxPixels int64
+}
+
+func DefaultUploadPolicy() *UploadPolicy {
+	return &UploadPolicy{
+		MaxSizes:       make(map[string]int64),
+		DefaultMaxSize: 1 << 20,
+		AllowedTypes: map[string]string{
+			"image/png":  ".png",
+			"image/jpeg": ".jpg",
+			"image/gif":  ".gif",
+		},
+		MaxDimension: 8192,
+		MaxFrames:    100,
+		MaxPixels:    8192 * 8192,
+	}
+}
+
+// MaxSize returns the maximum image size in bytes for the role
+func (policy *UploadPolicy) MaxSize(role string) int64 {
+	if size, ok := policy.MaxSizes[role]; ok {
+		return size
+	}
+
+	return policy.DefaultMaxSize
+}
+
+// Validate detects the type of the image from its content and checks its
+// header, it returns the extension the image is stored with
+func (policy *UploadPolicy) Validate(imageData io.Reader) (string, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(imageData, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("cannot read image: %w", err)
+	}
+	header = header[:n]
+
+	mimeType := http.DetectContentType(header)
+	extension, ok := policy.AllowedTypes[mimeType]
+	if !ok {
+		return "", fmt.Errorf("image type %s is not allowed", mimeType)
+	}
+
+	// the bytes read by DecodeConfig are kept, so the frames of a GIF image can
+	// be counted from the start
+	var consumed bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(io.MultiReader(bytes.NewReader(header), imageData), &consumed))
+	if err != nil {
+		return "", fmt.Errorf("cannot decode %s image: %w", mimeType, err)
+	}
+
+	if "image/"+format != mimeType {
+		return "", fmt.Errorf("image is a %s image but decodes as %s", mimeType, format)
+	}
+
+	if config.Width <= 0 || config.Height <= 0 ||
+		config.Width > policy.MaxDimension || config.Height > policy.MaxDimension {
+		return "", fmt.Errorf(
+			"image dimensions %dx%d are not between 1x1 and %dx%d",
+			config.Width, config.Height, policy.MaxDimension, policy.MaxDimension,
+		)
+	}
+
+	frames := 1
+	if format == "gif" {
+		frames, err = countGIFFrames(io.MultiReader(&consumed, imageData), policy.MaxFrames)
+		if err != nil {
+			return "", fmt.Errorf("cannot decode %s image: %w", mimeType, err)
+		}
+	}
+
+	if frames > policy.MaxFrames {
+		return "", fmt.Errorf("image has more than %d frames", policy.MaxFrames)
+	}
+
+	if pixels := int64(config.Width) * int64(config.Height) * int64(frames); pixels > policy.MaxPixels {
+		return "", fmt.Errorf("image has %d pixels in its frames, more than %d", pixels, policy.MaxPixels)
+	}
+
+	return extension, nil
+}
+
+// countGIFFrames counts the frames of a GIF image by walking its blocks without
+// decoding them, it stops once there are more than maxFrames
+func countGIFFrames(imageData io.Reader, maxFrames int) (int, error) {
+	const (
+		extensionIntroducer = 0x21
+		imageSeparator      = 0x2c
+		trailer             = 0x3b
+	)
+
+	reader := bufio.NewReader(imageData)
+
+	// the header, then the logical screen descriptor with the flags of the global
+	// color table in its fifth byte
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, err
+	}
+	if err := skipColorTable(reader, header[10]); err != nil {
+		return 0, err
+	}
+
+	frames := 0
+	for frames <= maxFrames {
+		introducer, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch introducer {
+		case extensionIntroducer:
+			if _, err := reader.ReadByte(); err != nil {
+				return 0, err
+			}
+		case imageSeparator:
+			// the image descriptor with the flags of the local color table in its
+			// last byte, then the LZW minimum code size
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(reader, descriptor); err != nil {
+				return 0, err
+			}
+			if err := skipColorTable(reader, descriptor[8]); err != nil {
+				return 0, err
+			}
+			if _, err := reader.ReadByte(); err != nil {
+				return 0, err
+			}
+			frames++
+		case trailer:
+			return frames, nil
+		default:
+			return 0, fmt.Errorf("unknown GIF block 0x%02x", introducer)
+		}
+
+		// extensions and image data are sub-blocks ended by an empty one
+		for {
+			size, err := reader.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if size == 0 {
+				break
+			}
+			if _, err := reader.Discard(int(size)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return frames, nil
+}
+
+// skipColorTable skips the color table the flags of a descriptor announce
+func skipColorTable(reader *bufio.Reader, flags byte) error {
+	const colorTableFlag = 0x80
+	if flags&colorTableFlag == 0 {
+		return nil
+	}
+
+	_, err := reader.Discard(3 << ((flags & 0x07) + 1))
+	return err
+}
+
+// ValidateImageType checks the image type sent by a client, it may only be a
+// file extension hint
+func ValidateImageType(imageType string) error {
+	if strings.ContainsAny(imageType, "/\\\x00") || strings.Contains(imageType, "..") {
+		return fmt.Errorf("image type must not contain path separators: %q", imageType)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, width, height)))
+	if err != nil {
+		t.Fatalf("cannot encode PNG: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestUploadPolicyValidate(t *testing.T) {
+	policy := service.DefaultUploadPolicy()
+	policy.MaxDimension = 100
+
+	extension, err := policy.Validate(bytes.NewReader(encodePNG(t, 10, 20)))
+	if err != nil || extension != ".png" {
+		t.Fatalf("Validate PNG: got (%q, %v), want (\".png\", nil)", extension, err)
+	}
+
+	// a PNG signature followed by garbage is detected as PNG but cannot be decoded
+	corrupt := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0xff}, 64)...)
+
+	tests := map[string][]byte{
+		"text":      []byte("<html><body>not an image</body></html>"),
+		"empty":     {},
+		"corrupt":   corrupt,
+		"too wide":  encodePNG(t, 101, 1),
+		"too tall":  encodePNG(t, 1, 101),
+		"truncated": encodePNG(t, 10, 10)[:20],
+	}
+	for name, data := range tests {
+		if _, err := policy.Validate(bytes.NewReader(data)); err == nil {
+			t.Errorf("Validate %s: got no error", name)
+		}
+	}
+
+	delete(policy.AllowedTypes, "image/png")
+	if _, err := policy.Validate(bytes.NewReader(encodePNG(t, 10, 10))); err == nil {
+		t.Error("Validate PNG that is not allowed: got no error")
+	}
+}
+
+func encodeGIF(t *testing.T, width, height, frames int) []byte {
+	t.Helper()
+
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buffer bytes.Buffer
+	if err := gif.EncodeAll(&buffer, animation); err != nil {
+		t.Fatalf("cannot encode GIF: %v", err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestUploadPolicyValidateGIFFrames(t *testing.T) {
+	policy := service.DefaultUploadPolicy()
+	policy.MaxFrames = 5
+	policy.MaxPixels = 4 * 100 * 100
+
+	extension, err := policy.Validate(bytes.NewReader(encodeGIF(t, 100, 100, 4)))
+	if err != nil || extension != ".gif" {
+		t.Fatalf("Validate GIF: got (%q, %v), want (\".gif\", nil)", extension, err)
+	}
+
+	tests := map[string][]byte{
+		"too many frames": encodeGIF(t, 10, 10, 6),
+		"too many pixels": encodeGIF(t, 100, 100, 5),
+		"truncated":       encodeGIF(t, 10, 10, 2)[:40],
+	}
+	for name, data := range tests {
+		if _, err := policy.Validate(bytes.NewReader(data)); err == nil {
+			t.Errorf("Validate %s: got no error", name)
+		}
+	}
+}
+
+func TestUploadPolicyMaxSize(t *testing.T) {
+	policy := service.DefaultUploadPolicy()
+	policy.MaxSizes["admin"] = 10 << 20
+
+	if size := policy.MaxSize("admin"); size != 10<<20 {
+		t.Errorf("MaxSize admin: got %d, want %d", size, 10<<20)
+	}
+	if size := policy.MaxSize("user"); size != policy.DefaultMaxSize {
+		t.Errorf("MaxSize user: got %d, want %d", size, policy.DefaultMaxSize)
+	}
+}
+
+func TestValidateImageType(t *testing.T) {
+	for _, imageType := range []string{".png", "png", ""} {
+		if err := service.ValidateImageType(imageType); err != nil {
+			t.Errorf("ValidateImageType %q: %v", imageType, err)
+		}
+	}
+
+	for _, imageType := range []string{"/../../etc/passwd", "..\\evil.exe", ".png/x", "..", ".png\x00"} {
+		if err := service.ValidateImageType(imageType); err == nil {
+			t.Errorf("ValidateImageType %q: got no error", imageType)
+		}
+	}
+}
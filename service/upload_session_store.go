@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrUploadOffset is returned when a chunk does not start at the received bytes
+// of its upload session
+var ErrUploadOffset = errors.New("chunk offset does not match the received bytes")
+
+// ErrTooManyUploads is returned when a user creates an upload session while
+// the most upload sessions a user can have are open
+var ErrTooManyUploads = errors.New("too many upload sessions in progress")
+
+// UploadSession tracks an image upload, so an interrupted upload can resume
+// from the bytes already received
+type UploadSession struct {
+	ID        string
+	TodoID    string
+	Username  string
+	ImageType string
+	Size      int64
+	// SHA256 is the hex encoded digest the whole image must match
+	SHA256    string
+	Received  int64
+	ExpiresAt time.Time
+}
+
+type UploadSessionStore interface {
+	// Create creates the session with no data received, it returns
+	// ErrTooManyUploads when the user has too many sessions open
+	Create(session *UploadSession) error
+	// Find returns nil when there is no session with the ID or it has expired
+	Find(id string) (*UploadSession, error)
+	// Append writes the data at the offset, which must be the received bytes of
+	// the session, and returns the updated session
+	Append(id string, offset int64, data []byte) (*UploadSession, error)
+	// Open returns a reader of the received data, the caller must close it
+	Open(id string) (io.ReadCloser, error)
+	// Claim removes the session, so no other stream can append to or claim it,
+	// and returns a reader of its data, closing the reader deletes the data
+	Claim(id string) (io.ReadSeekCloser, error)
+	// Delete removes the session and its data
+	Delete(id string) error
+}
+
+// DiskUploadSessionStore writes the received data of each session to a
+// temporary file in its folder. The sessions are only kept in memory, so the
+// files left in the folder by a previous run are deleted when it is created.
+type DiskUploadSessionStore struct {
+	mutex    sync.Mutex
+	folder   string
+	sessions map[string]*diskUploadSession
+	// userSessions counts the sessions of each user
+	userSessions       map[string]int
+	maxSessionsPerUser int
+	cancel             context.CancelFunc
+	// wg waits for the expiry loop
+	wg sync.WaitGroup
+}
+
+// diskUploadSession serializes the writes to a session, so two streams cannot
+// write the same offset
+type diskUploadSession struct {
+	mutex   sync.Mutex
+	session UploadSession
+	path    string
+	deleted bool
+}
+
+// NewDiskUploadSessionStore deletes the upload files left in the folder, and
+// deletes the expired sessions every expiry interval until the store is closed
+func NewDiskUploadSessionStore(folder string, maxSessionsPerUser int, expiryInterval time.Duration) (*DiskUploadSessionStore, error) {
+	err := os.MkdirAll(folder, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create upload folder: %w", err)
+	}
+
+	// no session of a previous run can be resumed
+	stale, err := filepath.Glob(filepath.Join(folder, "*.part"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read upload folder: %w", err)
+	}
+	for _, path := range stale {
+		log.Printf("delete stale upload file %s", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("cannot delete upload file: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	store := &DiskUploadSessionStore{
+		folder:             folder,
+		sessions:           make(map[string]*diskUploadSession),
+		userSessions:       make(map[string]int),
+		maxSessionsPerUser: maxSessionsPerUser,
+		cancel:             cancel,
+	}
+
+	store.wg.Add(1)
+	go func() {
+		defer store.wg.Done()
+
+		ticker := time.NewTicker(expiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				store.deleteExpired()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return store, nil
+}
+
+// Close stops deleting the expired sessions
+func (store *DiskUploadSessionStore) Close() {
+	store.cancel()
+	store.wg.Wait()
+}
+
+func (store *DiskUploadSessionStore) Create(session *UploadSession) error {
+	store.deleteExpired()
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.sessions[session.ID] != nil {
+		return ErrAlreadyExists
+	}
+
+	if store.userSessions[session.Username] >= store.maxSessionsPerUser {
+		return ErrTooManyUploads
+	}
+
+	path := filepath.Join(store.folder, session.ID+".part")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot create upload file: %w", err)
+	}
+	file.Close()
+
+	other := *session
+	other.Received = 0
+	store.sessions[session.ID] = &diskUploadSession{
+		session: other,
+		path:    path,
+	}
+	store.userSessions[session.Username]++
+	return nil
+}
+
+func (store *DiskUploadSessionStore) Find(id string) (*UploadSession, error) {
+	upload := store.get(id)
+	if upload == nil {
+		return nil, nil
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if upload.deleted {
+		return nil, nil
+	}
+
+	other := upload.session
+	return &other, nil
+}
+
+func (store *DiskUploadSessionStore) Append(id string, offset int64, data []byte) (*UploadSession, error) {
+	upload := store.get(id)
+	if upload == nil {
+		return nil, ErrNotFound
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if upload.deleted {
+		return nil, ErrNotFound
+	}
+
+	if offset != upload.session.Received {
+		return nil, ErrUploadOffset
+	}
+
+	if offset+int64(len(data)) > upload.session.Size {
+		return nil, fmt.Errorf("data exceeds the upload size of %d bytes", upload.session.Size)
+	}
+
+	file, err := os.OpenFile(upload.path, os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open upload file: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.WriteAt(data, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot write upload file: %w", err)
+	}
+
+	upload.session.Received += int64(len(data))
+	other := upload.session
+	return &other, nil
+}
+
+func (store *DiskUploadSessionStore) Open(id string) (io.ReadCloser, error) {
+	upload := store.get(id)
+	if upload == nil {
+		return nil, ErrNotFound
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if upload.deleted {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(upload.path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open upload file: %w", err)
+	}
+
+	return file, nil
+}
+
+func (store *DiskUploadSessionStore) Claim(id string) (io.ReadSeekCloser, error) {
+	store.mutex.Lock()
+	upload := store.sessions[id]
+	if upload == nil || upload.session.ExpiresAt.Before(time.Now()) {
+		store.mutex.Unlock()
+		return nil, ErrNotFound
+	}
+	store.forget(upload)
+	store.mutex.Unlock()
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if upload.deleted {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(upload.path)
+	if err != nil {
+		upload.remove()
+		return nil, fmt.Errorf("cannot open upload file: %w", err)
+	}
+
+	// the session is gone, the file is removed once its reader is closed
+	upload.deleted = true
+	return &claimedUploadFile{file}, nil
+}
+
+func (store *DiskUploadSessionStore) Delete(id string) error {
+	store.mutex.Lock()
+	upload := store.sessions[id]
+	if upload != nil {
+		store.forget(upload)
+	}
+	store.mutex.Unlock()
+
+	if upload == nil {
+		return ErrNotFound
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	return upload.remove()
+}
+
+// deleteExpired deletes the sessions that cannot be resumed anymore
+func (store *DiskUploadSessionStore) deleteExpired() {
+	expired := make([]*diskUploadSession, 0)
+
+	store.mutex.Lock()
+	now := time.Now()
+	for _, upload := range store.sessions {
+		if upload.session.ExpiresAt.Before(now) {
+			store.forget(upload)
+			expired = append(expired, upload)
+		}
+	}
+	store.mutex.Unlock()
+
+	for _, upload := range expired {
+		upload.mutex.Lock()
+		if err := upload.remove(); err != nil {
+			log.Printf("cannot delete expired upload session %s: %v", upload.session.ID, err)
+		}
+		upload.mutex.Unlock()
+	}
+}
+
+// forget removes the session from the sessions of the store, the caller must
+// hold the lock of the store
+func (store *DiskUploadSessionStore) forget(upload *diskUploadSession) {
+	delete(store.sessions, upload.session.ID)
+
+	username := upload.session.Username
+	store.userSessions[username]--
+	if store.userSessions[username] <= 0 {
+		delete(store.userSessions, username)
+	}
+}
+
+// get returns nil when there is no session with the ID or it has expired
+func (store *DiskUploadSessionStore) get(id string) *diskUploadSession {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	upload := store.sessions[id]
+	if upload == nil || upload.session.ExpiresAt.Before(time.Now()) {
+		return nil
+	}
+
+	return upload
+}
+
+func (upload *diskUploadSession) remove() error {
+	upload.deleted = true
+
+	err := os.Remove(upload.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete upload file: %w", err)
+	}
+
+	return nil
+}
+
+// claimedUploadFile removes the file of a claimed session when it is closed
+type claimedUploadFile struct {
+	*os.File
+}
+
+func (file *claimedUploadFile) Close() error {
+	err := file.File.Close()
+	if err != nil {
+		return fmt.Errorf("cannot close upload file: %w", err)
+	}
+
+	err = os.Remove(file.Name())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cannot delete upload file: %w", err)
+	}
+
+	return nil
+}
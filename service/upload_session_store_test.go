@@ -0,0 +1,126 @@
+package service_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+	"github.com/google/uuid"
+)
+
+func TestDiskUploadSessionStore(t *testing.T) {
+	storetest.RunUploadSessionStoreTests(t, func(t *testing.T) service.UploadSessionStore {
+		return newTestUploadSessionStore(t, 10, time.Minute)
+	})
+}
+
+func newTestUploadSessionStore(t *testing.T, maxSessionsPerUser int, expiryInterval time.Duration) *service.DiskUploadSessionStore {
+	t.Helper()
+
+	return newTestUploadSessionStoreIn(t, t.TempDir(), maxSessionsPerUser, expiryInterval)
+}
+
+func newTestUploadSessionStoreIn(t *testing.T, folder string, maxSessionsPerUser int, expiryInterval time.Duration) *service.DiskUploadSessionStore {
+	t.Helper()
+
+	store, err := service.NewDiskUploadSessionStore(folder, maxSessionsPerUser, expiryInterval)
+	if err != nil {
+		t.Fatalf("NewDiskUploadSessionStore: %v", err)
+	}
+	t.Cleanup(store.Close)
+
+	return store
+}
+
+func newTestUploadSession(username string, duration time.Duration) *service.UploadSession {
+	return &service.UploadSession{
+		ID:        uuid.NewString(),
+		TodoID:    uuid.NewString(),
+		Username:  username,
+		ImageType: ".png",
+		Size:      10,
+		SHA256:    "936a185caaa266bb9cbe981e9e05cb78cd732b0b3280eb944412bb6f8f8f07af",
+		ExpiresAt: time.Now().Add(duration),
+	}
+}
+
+func TestDiskUploadSessionStoreDeletesStaleFiles(t *testing.T) {
+	folder := t.TempDir()
+	stale := filepath.Join(folder, uuid.NewString()+".part")
+	if err := os.WriteFile(stale, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(folder, "notes.txt")
+	if err := os.WriteFile(other, []byte("notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestUploadSessionStoreIn(t, folder, 10, time.Minute)
+
+	if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stale upload file after NewDiskUploadSessionStore: got %v, want it deleted", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("other file after NewDiskUploadSessionStore: %v", err)
+	}
+}
+
+func TestDiskUploadSessionStoreExpiresOnTimer(t *testing.T) {
+	folder := t.TempDir()
+	store := newTestUploadSessionStoreIn(t, folder, 10, 10*time.Millisecond)
+
+	session := newTestUploadSession("alice", 50*time.Millisecond)
+	if err := store.Create(session); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	path := filepath.Join(folder, session.ID+".part")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("upload file: %v", err)
+	}
+
+	// no other session is created, the timer deletes the file
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("upload file of an expired session: got %v, want it deleted", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDiskUploadSessionStoreMaxSessionsPerUser(t *testing.T) {
+	store := newTestUploadSessionStore(t, 2, time.Minute)
+
+	first := newTestUploadSession("alice", time.Hour)
+	for _, session := range []*service.UploadSession{first, newTestUploadSession("alice", time.Hour), newTestUploadSession("bob", time.Hour)} {
+		if err := store.Create(session); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	if err := store.Create(newTestUploadSession("alice", time.Hour)); !errors.Is(err, service.ErrTooManyUploads) {
+		t.Fatalf("Create over the limit: got %v, want %v", err, service.ErrTooManyUploads)
+	}
+
+	// a claimed session is not open anymore
+	file, err := store.Claim(first.ID)
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	file.Close()
+	if err := store.Create(newTestUploadSession("alice", time.Hour)); err != nil {
+		t.Fatalf("Create after Claim: %v", err)
+	}
+
+	if err := store.Create(newTestUploadSession("alice", time.Hour)); !errors.Is(err, service.ErrTooManyUploads) {
+		t.Fatalf("Create over the limit: got %v, want %v", err, service.ErrTooManyUploads)
+	}
+}
@@ -1,31 +1,102 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	minPasswordLength = 8
+	// maxPasswordLength is the number of bytes bcrypt takes into account
+	maxPasswordLength = 72
+)
+
+var (
+	ErrWeakPassword    = errors.New("password is too weak")
+	ErrInvalidUsername = errors.New("username is invalid")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,32}$`)
+
+var roles = map[string]bool{
+	"admin": true,
+	"user":  true,
+}
+
 type User struct {
 	Username       string
 	HashedPassword string
 	Role           string
+	Disabled       bool
 }
 
 func NewUser(username string, password string, role string) (*User, error) {
-	HashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return nil, fmt.Errorf("cannot hash password: %w", err)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("%w: it must have 3 to 32 letters, digits, dots, underscores or dashes", ErrInvalidUsername)
 	}
+
 	user := &User{
-		Username:       username,
-		HashedPassword: string(HashedPassword),
-		Role:           role,
+		Username: username,
+		Role:     role,
+	}
+
+	err := user.SetPassword(password)
+	if err != nil {
+		return nil, err
 	}
 
 	return user, nil
 }
 
+// ValidatePassword checks the password strength rules
+func ValidatePassword(username string, password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("%w: it must have at least %d characters", ErrWeakPassword, minPasswordLength)
+	}
+
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("%w: it must have at most %d bytes", ErrWeakPassword, maxPasswordLength)
+	}
+
+	hasLetter := strings.IndexFunc(password, unicode.IsLetter) >= 0
+	hasDigit := strings.IndexFunc(password, unicode.IsDigit) >= 0
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("%w: it must contain both letters and digits", ErrWeakPassword)
+	}
+
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("%w: it must not contain the username", ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// IsValidRole reports whether the role is known to the server
+func IsValidRole(role string) bool {
+	return roles[role]
+}
+
+// SetPassword validates the password and replaces the hashed password of the user
+func (user *User) SetPassword(password string) error {
+	err := ValidatePassword(user.Username, password)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("cannot hash password: %w", err)
+	}
+
+	user.HashedPassword = string(hashedPassword)
+	return nil
+}
+
 func (user *User) IsCorrectPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password))
 	return err == nil
@@ -36,5 +107,6 @@ func (user *User) Clone() *User {
 		Username:       user.Username,
 		HashedPassword: user.HashedPassword,
 		Role:           user.Role,
+		Disabled:       user.Disabled,
 	}
 }
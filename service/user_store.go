@@ -1,11 +1,20 @@
 package service
 
-import "sync"
+import (
+	"slices"
+	"strings"
+	"sync"
+)
 
 type UserStore interface {
 	Save(user *User) error
 
 	Find(username string) (*User, error)
+
+	Update(user *User) error
+
+	// List returns every user ordered by username
+	List() ([]*User, error)
 }
 
 type InMemoryUserStore struct {
@@ -42,3 +51,30 @@ func (store *InMemoryUserStore) Find(username string) (*User, error) {
 
 	return user.Clone(), nil
 }
+
+func (store *InMemoryUserStore) Update(user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.users[user.Username] == nil {
+		return ErrNotFound
+	}
+
+	store.users[user.Username] = user.Clone()
+	return nil
+}
+
+func (store *InMemoryUserStore) List() ([]*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	users := make([]*User, 0, len(store.users))
+	for _, user := range store.users {
+		users = append(users, user.Clone())
+	}
+
+	slices.SortFunc(users, func(a, b *User) int {
+		return strings.Compare(a.Username, b.Username)
+	})
+	return users, nil
+}
@@ -0,0 +1,20 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryUserStore(t *testing.T) {
+	storetest.RunUserStoreTests(t, func(t *testing.T) service.UserStore {
+		return service.NewInMemoryUserStore()
+	})
+}
+
+func TestBoltUserStore(t *testing.T) {
+	storetest.RunUserStoreTests(t, func(t *testing.T) service.UserStore {
+		return service.NewBoltUserStore(newTestBoltDB(t))
+	})
+}
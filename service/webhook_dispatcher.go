@@ -0,0 +1,367 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	// WebhookEventHeader is the header with the event type of a delivery
+	WebhookEventHeader = "X-Todo-Event"
+	// WebhookDeliveryHeader is the header with the delivery ID, it is the same
+	// for every attempt of a delivery
+	WebhookDeliveryHeader = "X-Todo-Delivery"
+	// WebhookTimestampHeader is the header with the Unix time of the attempt
+	WebhookTimestampHeader = "X-Todo-Timestamp"
+	// WebhookSignatureHeader is the header with the signature of the attempt,
+	// see SignWebhookPayload
+	WebhookSignatureHeader = "X-Todo-Signature"
+	// maxWebhookResponseSize is the number of bytes of a response body read
+	// before the connection is reused
+	maxWebhookResponseSize = 64 << 10
+)
+
+// WebhookRetryPolicy decides when a failed delivery is attempted again
+type WebhookRetryPolicy struct {
+	// MaxAttempts is the number of attempts before a delivery fails
+	MaxAttempts int
+	// BaseDelay is the delay after the first failed attempt, it doubles after
+	// every attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+func DefaultWebhookRetryPolicy() *WebhookRetryPolicy {
+	return &WebhookRetryPolicy{
+		MaxAttempts: 8,
+		BaseDelay:   time.Second,
+		MaxDelay:    5 * time.Minute,
+	}
+}
+
+// Delay returns the delay after the failed attempt, attempts start at 1
+func (policy *WebhookRetryPolicy) Delay(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, policy.MaxDelay)
+}
+
+// SignWebhookPayload returns the value of the signature header of a delivery
+// attempt: sha256= and the hex encoded HMAC-SHA256 of the timestamp header, a
+// dot and the body, keyed by the webhook secret
+func SignWebhookPayload(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookDispatcher posts the events of the bus to the webhooks of the store.
+// Every delivery is recorded in the store before its first attempt, so the
+// pending deliveries are resumed when the dispatcher starts again. Deliveries
+// are attempted concurrently, a webhook can receive events out of order.
+type WebhookDispatcher struct {
+	webhookStore WebhookStore
+	eventBus     *EventBus
+	client       *http.Client
+	retryPolicy  *WebhookRetryPolicy
+	ctx          context.Context
+	cancel       context.CancelFunc
+	// wg waits for the event loop and the deliveries in progress
+	wg sync.WaitGroup
+}
+
+func NewWebhookDispatcher(
+	webhookStore WebhookStore,
+	eventBus *EventBus,
+	client *http.Client,
+	retryPolicy *WebhookRetryPolicy,
+) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookDispatcher{
+		webhookStore: webhookStore,
+		eventBus:     eventBus,
+		client:       client,
+		retryPolicy:  retryPolicy,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Start resumes the pending deliveries and posts the events published from now
+// on until the dispatcher is closed
+func (dispatcher *WebhookDispatcher) Start() error {
+	subscription, err := dispatcher.eventBus.Subscribe(0)
+	if err != nil {
+		return fmt.Errorf("cannot subscribe to events: %w", err)
+	}
+
+	webhooks, err := dispatcher.webhookStore.List()
+	if err != nil {
+		subscription.Close()
+		return fmt.Errorf("cannot list webhooks: %w", err)
+	}
+
+	for _, webhook := range webhooks {
+		deliveries, err := dispatcher.webhookStore.ListDeliveries(webhook.ID)
+		if err != nil {
+			subscription.Close()
+			return fmt.Errorf("cannot list deliveries of webhook %s: %w", webhook.ID, err)
+		}
+
+		for _, delivery := range deliveries {
+			if delivery.Status == WebhookDeliveryPending {
+				dispatcher.deliverAsync(delivery)
+			}
+		}
+	}
+
+	dispatcher.wg.Add(1)
+	go func() {
+		defer dispatcher.wg.Done()
+		dispatcher.dispatchEvents(subscription)
+	}()
+	return nil
+}
+
+// Close stops posting events and waits for the attempts in progress, the
+// pending deliveries are resumed by the next Start
+func (dispatcher *WebhookDispatcher) Close() {
+	dispatcher.cancel()
+	dispatcher.wg.Wait()
+}
+
+// Replay posts the payload of the delivery again as a new delivery, it returns
+// ErrNotFound when the delivery or its webhook does not exist
+func (dispatcher *WebhookDispatcher) Replay(deliveryID string) (*WebhookDelivery, error) {
+	original, err := dispatcher.webhookStore.FindDelivery(deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find delivery: %w", err)
+	}
+
+	if original == nil {
+		return nil, ErrNotFound
+	}
+
+	webhook, err := dispatcher.webhookStore.Find(original.WebhookID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find webhook: %w", err)
+	}
+
+	if webhook == nil {
+		return nil, ErrNotFound
+	}
+
+	delivery := &WebhookDelivery{
+		ID:            uuid.New().String(),
+		WebhookID:     webhook.ID,
+		EventSequence: original.EventSequence,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        WebhookDeliveryPending,
+		CreatedAt:     time.Now(),
+		ReplayOf:      original.ID,
+	}
+
+	err = dispatcher.webhookStore.SaveDelivery(delivery)
+	if err != nil {
+		return nil, fmt.Errorf("cannot save delivery: %w", err)
+	}
+
+	// the attempts update their own copy of the delivery
+	dispatcher.deliverAsync(delivery.clone())
+	return delivery, nil
+}
+
+// dispatchEvents creates the deliveries of the events until the dispatcher is
+// closed, when it falls behind it subscribes again after the last event
+func (dispatcher *WebhookDispatcher) dispatchEvents(subscription *Subscription) {
+	after := subscription.After()
+	for {
+		event, err := subscription.Next(dispatcher.ctx)
+		if errors.Is(err, ErrSubscriberTooSlow) {
+			subscription.Close()
+			subscription, err = dispatcher.eventBus.Subscribe(after)
+			if errors.Is(err, ErrEventsExpired) {
+				log.Printf("webhooks missed the events after sequence %d", after)
+				subscription, err = dispatcher.eventBus.Subscribe(0)
+			}
+			if err != nil {
+				log.Printf("cannot subscribe to events: %v", err)
+				return
+			}
+			continue
+		}
+		if err != nil {
+			subscription.Close()
+			return
+		}
+
+		after = event.Sequence
+		dispatcher.dispatch(event)
+	}
+}
+
+// dispatch creates a delivery of the event for every webhook accepting it
+func (dispatcher *WebhookDispatcher) dispatch(event *TodoEvent) {
+	webhooks, err := dispatcher.webhookStore.List()
+	if err != nil {
+		log.Printf("cannot list webhooks for event %d: %v", event.Sequence, err)
+		return
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(event.Type) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(toPbTodoEvent(event))
+			if err != nil {
+				log.Printf("cannot encode event %d: %v", event.Sequence, err)
+				return
+			}
+		}
+
+		delivery := &WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     webhook.ID,
+			EventSequence: event.Sequence,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        WebhookDeliveryPending,
+			CreatedAt:     time.Now(),
+		}
+
+		err = dispatcher.webhookStore.SaveDelivery(delivery)
+		if err != nil {
+			log.Printf("cannot save delivery of event %d to webhook %s: %v", event.Sequence, webhook.ID, err)
+			continue
+		}
+
+		dispatcher.deliverAsync(delivery)
+	}
+}
+
+func (dispatcher *WebhookDispatcher) deliverAsync(delivery *WebhookDelivery) {
+	dispatcher.wg.Add(1)
+	go func() {
+		defer dispatcher.wg.Done()
+		dispatcher.deliver(delivery)
+	}()
+}
+
+// deliver attempts the delivery until it succeeds, it runs out of attempts,
+// its webhook is deleted or the dispatcher is closed
+func (dispatcher *WebhookDispatcher) deliver(delivery *WebhookDelivery) {
+	if delivery.Attempts > 0 {
+		// a resumed delivery waits as if its last attempt just failed
+		if !dispatcher.sleep(dispatcher.retryPolicy.Delay(delivery.Attempts)) {
+			return
+		}
+	}
+
+	for {
+		webhook, err := dispatcher.webhookStore.Find(delivery.WebhookID)
+		if err != nil {
+			log.Printf("cannot find webhook %s: %v", delivery.WebhookID, err)
+			return
+		}
+
+		if webhook == nil {
+			return
+		}
+
+		delivery.Attempts++
+		delivery.LastAttemptAt = time.Now()
+		delivery.ResponseStatus, err = dispatcher.post(webhook, delivery)
+		if dispatcher.ctx.Err() != nil {
+			// the interrupted attempt is not recorded, it is made again on resume
+			return
+		}
+
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = ""
+			delivery.Status = WebhookDeliverySucceeded
+		}
+
+		if err != nil && delivery.Attempts >= dispatcher.retryPolicy.MaxAttempts {
+			delivery.Status = WebhookDeliveryFailed
+		}
+
+		if err := dispatcher.webhookStore.SaveDelivery(delivery); err != nil {
+			log.Printf("cannot save delivery %s: %v", delivery.ID, err)
+		}
+
+		if delivery.Status != WebhookDeliveryPending {
+			return
+		}
+
+		if !dispatcher.sleep(dispatcher.retryPolicy.Delay(delivery.Attempts)) {
+			return
+		}
+	}
+}
+
+// post sends the payload of the delivery to the webhook, it returns the
+// response status and an error when the status is not 2xx
+func (dispatcher *WebhookDispatcher) post(webhook *Webhook, delivery *WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(dispatcher.ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("cannot create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, toPbTodoEventType(delivery.EventType).String())
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+
+	res, err := dispatcher.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, maxWebhookResponseSize))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status: %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// sleep returns false when the dispatcher is closed before the delay
+func (dispatcher *WebhookDispatcher) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-dispatcher.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,273 @@
+package service_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/google/uuid"
+)
+
+// webhookReceiver records the posts it receives and responds with the next
+// status of its list, the last status is repeated
+type webhookReceiver struct {
+	t        *testing.T
+	secret   string
+	mutex    sync.Mutex
+	statuses []int
+	posts    []*http.Request
+	bodies   [][]byte
+	server   *httptest.Server
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) *webhookReceiver {
+	receiver := &webhookReceiver{t: t, secret: secret, statuses: statuses}
+	receiver.server = httptest.NewServer(http.HandlerFunc(receiver.serveHTTP))
+	t.Cleanup(receiver.server.Close)
+	return receiver
+}
+
+func (receiver *webhookReceiver) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		receiver.t.Errorf("read webhook body: %v", err)
+	}
+
+	signature := service.SignWebhookPayload(receiver.secret, r.Header.Get(service.WebhookTimestampHeader), body)
+	if r.Header.Get(service.WebhookSignatureHeader) != signature {
+		receiver.t.Errorf("signature: got %q, want %q", r.Header.Get(service.WebhookSignatureHeader), signature)
+	}
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	receiver.posts = append(receiver.posts, r)
+	receiver.bodies = append(receiver.bodies, body)
+	statusCode := receiver.statuses[min(len(receiver.posts), len(receiver.statuses))-1]
+	w.WriteHeader(statusCode)
+}
+
+func (receiver *webhookReceiver) received() ([]*http.Request, [][]byte) {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	return receiver.posts, receiver.bodies
+}
+
+func TestWebhookDispatcherPostsSignedEvents(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret", http.StatusNoContent)
+	store := service.NewInMemoryWebhookStore()
+	webhook := mustCreateWebhook(t, store, receiver.server.URL, service.TodoEventCreated)
+	bus := service.NewEventBus(10, 10)
+	startWebhookDispatcher(t, store, bus, 3)
+
+	todo := &service.Todo{ID: uuid.New().String(), Title: "title", FromUser: "alice"}
+	bus.Publish(&service.TodoEvent{Type: service.TodoEventUpdated, Todo: todo})
+	bus.Publish(&service.TodoEvent{Type: service.TodoEventCreated, Todo: todo})
+
+	deliveries := waitForDeliveries(t, store, webhook.ID, 1)
+	assertDeliveryResult(t, deliveries[0], service.WebhookDeliverySucceeded, 1, http.StatusNoContent)
+	if deliveries[0].EventSequence != 2 {
+		t.Fatalf("delivery: got sequence %d, want 2", deliveries[0].EventSequence)
+	}
+
+	posts, bodies := receiver.received()
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+
+	if got := posts[0].Header.Get(service.WebhookEventHeader); got != "TODO_EVENT_TYPE_CREATED" {
+		t.Fatalf("event header: got %q, want %q", got, "TODO_EVENT_TYPE_CREATED")
+	}
+	if got := posts[0].Header.Get(service.WebhookDeliveryHeader); got != deliveries[0].ID {
+		t.Fatalf("delivery header: got %q, want %q", got, deliveries[0].ID)
+	}
+
+	var payload struct {
+		Sequence string `json:"sequence"`
+		Todo     struct {
+			ID string `json:"id"`
+		} `json:"todo"`
+	}
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Sequence != "2" || payload.Todo.ID != todo.ID {
+		t.Fatalf("payload: got %s", bodies[0])
+	}
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	flaky := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	broken := newWebhookReceiver(t, "secret", http.StatusInternalServerError)
+	store := service.NewInMemoryWebhookStore()
+	flakyWebhook := mustCreateWebhook(t, store, flaky.server.URL)
+	brokenWebhook := mustCreateWebhook(t, store, broken.server.URL)
+	bus := service.NewEventBus(10, 10)
+	startWebhookDispatcher(t, store, bus, 3)
+
+	bus.Publish(&service.TodoEvent{Type: service.TodoEventCreated, Todo: &service.Todo{ID: uuid.New().String()}})
+
+	deliveries := waitForDeliveries(t, store, flakyWebhook.ID, 1)
+	assertDeliveryResult(t, deliveries[0], service.WebhookDeliverySucceeded, 3, http.StatusOK)
+
+	deliveries = waitForDeliveries(t, store, brokenWebhook.ID, 1)
+	assertDeliveryResult(t, deliveries[0], service.WebhookDeliveryFailed, 3, http.StatusInternalServerError)
+	if deliveries[0].Error == "" {
+		t.Fatal("failed delivery: got no error")
+	}
+
+	// every attempt of a delivery has the same delivery ID
+	posts, _ := broken.received()
+	for _, post := range posts {
+		if got := post.Header.Get(service.WebhookDeliveryHeader); got != deliveries[0].ID {
+			t.Fatalf("delivery header: got %q, want %q", got, deliveries[0].ID)
+		}
+	}
+}
+
+func TestWebhookDispatcherReplays(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret", http.StatusInternalServerError, http.StatusOK)
+	store := service.NewInMemoryWebhookStore()
+	webhook := mustCreateWebhook(t, store, receiver.server.URL)
+	bus := service.NewEventBus(10, 10)
+	dispatcher := startWebhookDispatcher(t, store, bus, 1)
+
+	bus.Publish(&service.TodoEvent{Type: service.TodoEventDeleted, Todo: &service.Todo{ID: uuid.New().String()}})
+	original := waitForDeliveries(t, store, webhook.ID, 1)[0]
+	assertDeliveryResult(t, original, service.WebhookDeliveryFailed, 1, http.StatusInternalServerError)
+
+	replay, err := dispatcher.Replay(original.ID)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if replay.ReplayOf != original.ID || replay.ID == original.ID {
+		t.Fatalf("Replay: got delivery %s replaying %q, want a new delivery replaying %s", replay.ID, replay.ReplayOf, original.ID)
+	}
+
+	deliveries := waitForDeliveries(t, store, webhook.ID, 2)
+	assertDeliveryResult(t, deliveries[1], service.WebhookDeliverySucceeded, 1, http.StatusOK)
+
+	_, bodies := receiver.received()
+	if len(bodies) != 2 || string(bodies[0]) != string(bodies[1]) {
+		t.Fatalf("got bodies %q, want the same body twice", bodies)
+	}
+
+	if _, err := dispatcher.Replay(uuid.New().String()); err != service.ErrNotFound {
+		t.Fatalf("Replay unknown delivery: got %v, want %v", err, service.ErrNotFound)
+	}
+}
+
+func TestWebhookDispatcherResumesPendingDeliveries(t *testing.T) {
+	receiver := newWebhookReceiver(t, "secret", http.StatusOK)
+	store := service.NewInMemoryWebhookStore()
+	webhook := mustCreateWebhook(t, store, receiver.server.URL)
+
+	delivery := &service.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: webhook.ID,
+		EventType: service.TodoEventCreated,
+		Payload:   []byte("{}"),
+		Status:    service.WebhookDeliveryPending,
+		Attempts:  1,
+		CreatedAt: time.Now(),
+	}
+	if err := store.SaveDelivery(delivery); err != nil {
+		t.Fatalf("SaveDelivery: %v", err)
+	}
+
+	startWebhookDispatcher(t, store, service.NewEventBus(10, 10), 3)
+
+	deliveries := waitForDeliveries(t, store, webhook.ID, 1)
+	assertDeliveryResult(t, deliveries[0], service.WebhookDeliverySucceeded, 2, http.StatusOK)
+}
+
+func TestWebhookRetryPolicyDelay(t *testing.T) {
+	policy := &service.WebhookRetryPolicy{
+		MaxAttempts: 10,
+		BaseDelay:   time.Second,
+		MaxDelay:    10 * time.Second,
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, delay := range want {
+		if got := policy.Delay(i + 1); got != delay {
+			t.Fatalf("Delay(%d): got %v, want %v", i+1, got, delay)
+		}
+	}
+}
+
+func mustCreateWebhook(t *testing.T, store service.WebhookStore, url string, eventTypes ...service.TodoEventType) *service.Webhook {
+	t.Helper()
+
+	webhook := &service.Webhook{
+		ID:         uuid.New().String(),
+		URL:        url,
+		Secret:     "secret",
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now(),
+	}
+	if err := store.Save(webhook); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return webhook
+}
+
+func startWebhookDispatcher(t *testing.T, store service.WebhookStore, bus *service.EventBus, maxAttempts int) *service.WebhookDispatcher {
+	t.Helper()
+
+	policy := &service.WebhookRetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}
+	dispatcher := service.NewWebhookDispatcher(store, bus, http.DefaultClient, policy)
+	if err := dispatcher.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(dispatcher.Close)
+	return dispatcher
+}
+
+// waitForDeliveries waits until the webhook has count deliveries and none of
+// them is pending
+func waitForDeliveries(t *testing.T, store service.WebhookStore, webhookID string, count int) []*service.WebhookDelivery {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := store.ListDeliveries(webhookID)
+		if err != nil {
+			t.Fatalf("ListDeliveries: %v", err)
+		}
+
+		done := len(deliveries) == count
+		for _, delivery := range deliveries {
+			done = done && delivery.Status != service.WebhookDeliveryPending
+		}
+		if done {
+			return deliveries
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got deliveries %+v, want %d finished deliveries", deliveries, count)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func assertDeliveryResult(t *testing.T, delivery *service.WebhookDelivery, status service.WebhookDeliveryStatus, attempts int, responseStatus int) {
+	t.Helper()
+
+	if delivery.Status != status || delivery.Attempts != attempts || delivery.ResponseStatus != responseStatus {
+		t.Fatalf(
+			"delivery: got status %s after %d attempts with response %d, want %s after %d attempts with response %d",
+			delivery.Status, delivery.Attempts, delivery.ResponseStatus, status, attempts, responseStatus,
+		)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/chienaeae/todo-go-grpc/pb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WebhookServer manages the webhooks, every RPC is restricted to admins by the
+// auth interceptor
+type WebhookServer struct {
+	pb.UnimplementedWebhookServiceServer
+	webhookStore WebhookStore
+	dispatcher   *WebhookDispatcher
+}
+
+func NewWebhookServer(webhookStore WebhookStore, dispatcher *WebhookDispatcher) *WebhookServer {
+	return &WebhookServer{
+		webhookStore: webhookStore,
+		dispatcher:   dispatcher,
+	}
+}
+
+func (server *WebhookServer) CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest) (*pb.CreateWebhookResponse, error) {
+	webhookURL, err := url.Parse(req.GetUrl())
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		return nil, logError(status.Errorf(codes.InvalidArgument, "url must be an absolute http or https URL: %q", req.GetUrl()))
+	}
+
+	eventTypes := make([]TodoEventType, 0, len(req.GetEventTypes()))
+	for _, pbEventType := range req.GetEventTypes() {
+		eventType, err := fromPbTodoEventType(pbEventType)
+		if err != nil {
+			return nil, logError(status.Errorf(codes.InvalidArgument, "%v", err))
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	secret := req.GetSecret()
+	if secret == "" {
+		secret, err = NewWebhookSecret()
+		if err != nil {
+			return nil, logError(status.Errorf(codes.Internal, "%v", err))
+		}
+	}
+
+	webhook := &Webhook{
+		ID:         uuid.New().String(),
+		URL:        webhookURL.String(),
+		Secret:     secret,
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now(),
+	}
+
+	err = server.webhookStore.Save(webhook)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot save webhook: %v", err))
+	}
+
+	log.Printf("created webhook %s posting to %s", webhook.ID, webhook.URL)
+
+	res := &pb.CreateWebhookResponse{
+		Webhook: toPbWebhook(webhook),
+		Secret:  secret,
+	}
+	return res, nil
+}
+
+func (server *WebhookServer) ListWebhooks(ctx context.Context, req *pb.ListWebhooksRequest) (*pb.ListWebhooksResponse, error) {
+	webhooks, err := server.webhookStore.List()
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot list webhooks: %v", err))
+	}
+
+	res := &pb.ListWebhooksResponse{
+		Webhooks: make([]*pb.Webhook, 0, len(webhooks)),
+	}
+	for _, webhook := range webhooks {
+		res.Webhooks = append(res.Webhooks, toPbWebhook(webhook))
+	}
+	return res, nil
+}
+
+func (server *WebhookServer) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest) (*pb.DeleteWebhookResponse, error) {
+	err := server.webhookStore.Delete(req.GetId())
+	if errors.Is(err, ErrNotFound) {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find webhook with ID: %s", req.GetId()))
+	}
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot delete webhook: %v", err))
+	}
+
+	log.Printf("deleted webhook %s", req.GetId())
+
+	res := &pb.DeleteWebhookResponse{Id: req.GetId()}
+	return res, nil
+}
+
+func (server *WebhookServer) ListWebhookDeliveries(
+	ctx context.Context,
+	req *pb.ListWebhookDeliveriesRequest,
+) (*pb.ListWebhookDeliveriesResponse, error) {
+	webhook, err := server.webhookStore.Find(req.GetWebhookId())
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot find webhook: %v", err))
+	}
+
+	if webhook == nil {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find webhook with ID: %s", req.GetWebhookId()))
+	}
+
+	deliveries, err := server.webhookStore.ListDeliveries(webhook.ID)
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot list deliveries: %v", err))
+	}
+
+	res := &pb.ListWebhookDeliveriesResponse{
+		Deliveries: make([]*pb.WebhookDelivery, 0, len(deliveries)),
+	}
+	for _, delivery := range deliveries {
+		res.Deliveries = append(res.Deliveries, toPbWebhookDelivery(delivery))
+	}
+	return res, nil
+}
+
+func (server *WebhookServer) ReplayWebhookDelivery(
+	ctx context.Context,
+	req *pb.ReplayWebhookDeliveryRequest,
+) (*pb.ReplayWebhookDeliveryResponse, error) {
+	delivery, err := server.dispatcher.Replay(req.GetDeliveryId())
+	if errors.Is(err, ErrNotFound) {
+		return nil, logError(status.Errorf(codes.NotFound, "cannot find delivery with ID: %s", req.GetDeliveryId()))
+	}
+	if err != nil {
+		return nil, logError(status.Errorf(codes.Internal, "cannot replay delivery: %v", err))
+	}
+
+	log.Printf("replaying delivery %s as %s", req.GetDeliveryId(), delivery.ID)
+
+	res := &pb.ReplayWebhookDeliveryResponse{Delivery: toPbWebhookDelivery(delivery)}
+	return res, nil
+}
+
+func toPbWebhook(webhook *Webhook) *pb.Webhook {
+	eventTypes := make([]pb.TodoEventType, 0, len(webhook.EventTypes))
+	for _, eventType := range webhook.EventTypes {
+		eventTypes = append(eventTypes, toPbTodoEventType(eventType))
+	}
+
+	return &pb.Webhook{
+		Id:         webhook.ID,
+		Url:        webhook.URL,
+		EventTypes: eventTypes,
+		CreatedAt:  toPbTimestamp(webhook.CreatedAt),
+	}
+}
+
+func toPbWebhookDelivery(delivery *WebhookDelivery) *pb.WebhookDelivery {
+	return &pb.WebhookDelivery{
+		Id:             delivery.ID,
+		WebhookId:      delivery.WebhookID,
+		EventSequence:  delivery.EventSequence,
+		EventType:      toPbTodoEventType(delivery.EventType),
+		Payload:        string(delivery.Payload),
+		Status:         toPbWebhookDeliveryStatus(delivery.Status),
+		Attempts:       uint32(delivery.Attempts),
+		ResponseStatus: uint32(delivery.ResponseStatus),
+		Error:          delivery.Error,
+		CreatedAt:      toPbTimestamp(delivery.CreatedAt),
+		LastAttemptAt:  toPbTimestamp(delivery.LastAttemptAt),
+		ReplayOf:       delivery.ReplayOf,
+	}
+}
+
+func toPbWebhookDeliveryStatus(deliveryStatus WebhookDeliveryStatus) pb.WebhookDeliveryStatus {
+	switch deliveryStatus {
+	case WebhookDeliveryPending:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_PENDING
+	case WebhookDeliverySucceeded:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_SUCCEEDED
+	case WebhookDeliveryFailed:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_FAILED
+	default:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_UNSPECIFIED
+	}
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Webhook posts the events of the todos to a URL outside the server
+type Webhook struct {
+	ID  string
+	URL string
+	// Secret is the HMAC-SHA256 key signing the payloads
+	Secret string
+	// EventTypes are the types of the events posted, every event is posted when
+	// it is empty
+	EventTypes []TodoEventType
+	CreatedAt  time.Time
+}
+
+// Accepts reports whether events of the type are posted to the webhook
+func (webhook *Webhook) Accepts(eventType TodoEventType) bool {
+	return len(webhook.EventTypes) == 0 || slices.Contains(webhook.EventTypes, eventType)
+}
+
+func (webhook *Webhook) clone() *Webhook {
+	other := *webhook
+	other.EventTypes = slices.Clone(webhook.EventTypes)
+	return &other
+}
+
+// NewWebhookSecret generates a random secret to sign the payloads of a webhook
+func NewWebhookSecret() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("cannot generate webhook secret: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is the post of an event to a webhook with all its attempts
+type WebhookDelivery struct {
+	ID            string
+	WebhookID     string
+	EventSequence uint64
+	EventType     TodoEventType
+	Payload       []byte
+	Status        WebhookDeliveryStatus
+	Attempts      int
+	// ResponseStatus is the HTTP status of the last attempt, it is 0 when the
+	// attempt got no response
+	ResponseStatus int
+	// Error describes why the last attempt failed
+	Error         string
+	CreatedAt     time.Time
+	LastAttemptAt time.Time
+	// ReplayOf is the ID of the delivery this one replays
+	ReplayOf string
+}
+
+func (delivery *WebhookDelivery) clone() *WebhookDelivery {
+	other := *delivery
+	other.Payload = slices.Clone(delivery.Payload)
+	return &other
+}
+
+type WebhookStore interface {
+	// Save creates the webhook or replaces an existing one
+	Save(webhook *Webhook) error
+	// Find returns nil when there is no webhook with the ID
+	Find(id string) (*Webhook, error)
+	// List returns the webhooks in the order they were created
+	List() ([]*Webhook, error)
+	// Delete deletes the webhook and its deliveries, it returns ErrNotFound
+	// when there is no webhook with the ID
+	Delete(id string) error
+	// SaveDelivery creates the delivery or replaces an existing one
+	SaveDelivery(delivery *WebhookDelivery) error
+	// FindDelivery returns nil when there is no delivery with the ID
+	FindDelivery(id string) (*WebhookDelivery, error)
+	// ListDeliveries returns the deliveries of a webhook in the order they were
+	// created
+	ListDeliveries(webhookID string) ([]*WebhookDelivery, error)
+}
+
+type InMemoryWebhookStore struct {
+	mutex      sync.RWMutex
+	webhooks   map[string]*Webhook
+	deliveries map[string]*WebhookDelivery
+	// byWebhook indexes the delivery IDs by webhook ID
+	byWebhook map[string]map[string]bool
+}
+
+func NewInMemoryWebhookStore() *InMemoryWebhookStore {
+	return &InMemoryWebhookStore{
+		webhooks:   make(map[string]*Webhook),
+		deliveries: make(map[string]*WebhookDelivery),
+		byWebhook:  make(map[string]map[string]bool),
+	}
+}
+
+func (store *InMemoryWebhookStore) Save(webhook *Webhook) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.webhooks[webhook.ID] = webhook.clone()
+	return nil
+}
+
+func (store *InMemoryWebhookStore) Find(id string) (*Webhook, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	webhook := store.webhooks[id]
+	if webhook == nil {
+		return nil, nil
+	}
+
+	return webhook.clone(), nil
+}
+
+func (store *InMemoryWebhookStore) List() ([]*Webhook, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	webhooks := make([]*Webhook, 0, len(store.webhooks))
+	for _, webhook := range store.webhooks {
+		webhooks = append(webhooks, webhook.clone())
+	}
+
+	sortWebhooks(webhooks)
+	return webhooks, nil
+}
+
+func (store *InMemoryWebhookStore) Delete(id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.webhooks[id] == nil {
+		return ErrNotFound
+	}
+
+	for deliveryID := range store.byWebhook[id] {
+		delete(store.deliveries, deliveryID)
+	}
+	delete(store.byWebhook, id)
+	delete(store.webhooks, id)
+	return nil
+}
+
+func (store *InMemoryWebhookStore) SaveDelivery(delivery *WebhookDelivery) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.byWebhook[delivery.WebhookID] == nil {
+		store.byWebhook[delivery.WebhookID] = make(map[string]bool)
+	}
+
+	store.deliveries[delivery.ID] = delivery.clone()
+	store.byWebhook[delivery.WebhookID][delivery.ID] = true
+	return nil
+}
+
+func (store *InMemoryWebhookStore) FindDelivery(id string) (*WebhookDelivery, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	delivery := store.deliveries[id]
+	if delivery == nil {
+		return nil, nil
+	}
+
+	return delivery.clone(), nil
+}
+
+func (store *InMemoryWebhookStore) ListDeliveries(webhookID string) ([]*WebhookDelivery, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	deliveries := make([]*WebhookDelivery, 0, len(store.byWebhook[webhookID]))
+	for id := range store.byWebhook[webhookID] {
+		deliveries = append(deliveries, store.deliveries[id].clone())
+	}
+
+	sortWebhookDeliveries(deliveries)
+	return deliveries, nil
+}
+
+func sortWebhooks(webhooks []*Webhook) {
+	slices.SortFunc(webhooks, func(a, b *Webhook) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+func sortWebhookDeliveries(deliveries []*WebhookDelivery) {
+	slices.SortFunc(deliveries, func(a, b *WebhookDelivery) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,20 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/chienaeae/todo-go-grpc/service"
+	"github.com/chienaeae/todo-go-grpc/service/storetest"
+)
+
+func TestInMemoryWebhookStore(t *testing.T) {
+	storetest.RunWebhookStoreTests(t, func(t *testing.T) service.WebhookStore {
+		return service.NewInMemoryWebhookStore()
+	})
+}
+
+func TestBoltWebhookStore(t *testing.T) {
+	storetest.RunWebhookStoreTests(t, func(t *testing.T) service.WebhookStore {
+		return service.NewBoltWebhookStore(newTestBoltDB(t))
+	})
+}